@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// moduleAlias maps an aliased module path prefix to the module path of the project
+type moduleAlias struct {
+	from string
+	to   string
+}
+
+// moduleAliases are applied to package names given on the command line, e.g.
+// to use the upstream module path when working on a fork
+type moduleAliases []moduleAlias
+
+// parseModuleAliases parses -module-alias values of the form from=to
+func parseModuleAliases(values []string) (moduleAliases, error) {
+	var aliases moduleAliases
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return nil, fmt.Errorf("invalid module alias %q, expected upstream/path=local/path", value)
+		}
+		aliases = append(aliases, moduleAlias{
+			from: strings.TrimSuffix(strings.TrimSpace(parts[0]), "/"),
+			to:   strings.TrimSuffix(strings.TrimSpace(parts[1]), "/"),
+		})
+	}
+
+	// The longest prefix wins when aliases are nested
+	sort.SliceStable(aliases, func(i, j int) bool {
+		return len(aliases[i].from) > len(aliases[j].from)
+	})
+
+	return aliases, nil
+}
+
+// resolve translates a package path starting with an aliased module path to
+// the project's module path. Other paths are returned unchanged.
+func (a moduleAliases) resolve(pkg string) string {
+	for _, alias := range a {
+		if pkg == alias.from || strings.HasPrefix(pkg, alias.from+"/") {
+			return alias.to + strings.TrimPrefix(pkg, alias.from)
+		}
+	}
+	return pkg
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// structureAnalysisFileName is the name of the findings of -analyze
+const structureAnalysisFileName = "structure_analysis.txt"
+
+// minHighFanIn is the least number of importers that makes a package's
+// fan-in unusually high, however small the module
+const minHighFanIn = 3
+
+// importsAny reports whether the sorted edges of a package include imp
+func importsAny(edges []string, imp string) bool {
+	i := sort.SearchStrings(edges, imp)
+	return i < len(edges) && edges[i] == imp
+}
+
+// analyzeStructure returns the sections of the findings about the import
+// graph of the packages: cycles, near-cycles and packages with a high fan-in
+func analyzeStructure(moduleName string, packages []*packageInfo) []reportSection {
+	rel := func(pkg string) string {
+		return relativePackagePath(moduleName, pkg)
+	}
+	relList := func(pkgs []string) string {
+		var rels []string
+		for _, pkg := range pkgs {
+			rels = append(rels, rel(pkg))
+		}
+		return strings.Join(rels, ", ")
+	}
+	names, edges := importGraph(packages, false)
+	_, testEdges := importGraph(packages, true)
+	byPath := make(map[string]*packageInfo)
+	for _, pkg := range packages {
+		byPath[pkg.ImportPath] = pkg
+	}
+
+	// Cycles of the package graph don't build, nor do those through the tests
+	// of a package; those through external tests do, and are near-cycles
+	var cycles, testCycles []string
+	for _, component := range stronglyConnectedComponents(names, edges) {
+		if len(component) > 1 {
+			sort.Strings(component)
+			cycles = append(cycles, relList(component))
+		}
+	}
+	for _, component := range stronglyConnectedComponents(names, testEdges) {
+		if len(component) < 2 {
+			continue
+		}
+		sort.Strings(component)
+		inCycle := make(map[string]bool)
+		for _, pkg := range component {
+			inCycle[pkg] = true
+		}
+		var closing []string
+		for _, pkg := range component {
+			for _, imp := range testEdges[pkg] {
+				if !inCycle[imp] || importsAny(edges[pkg], imp) {
+					continue
+				}
+				tests := "external tests"
+				for _, testImp := range byPath[pkg].TestImports {
+					if testImp == imp {
+						tests = "tests"
+					}
+				}
+				closing = append(closing, fmt.Sprintf("the %s of %s import %s", tests, rel(pkg), rel(imp)))
+			}
+		}
+		if len(closing) > 0 {
+			testCycles = append(testCycles, fmt.Sprintf("%s: %s", relList(component), strings.Join(closing, "; ")))
+		}
+	}
+
+	// A package importing one outside of it that imports a package below it
+	// was likely split to break a cycle
+	var splits []string
+	for _, pkg := range names {
+		for _, imp := range edges[pkg] {
+			if strings.HasPrefix(imp, pkg+"/") {
+				continue
+			}
+			for _, next := range edges[imp] {
+				if strings.HasPrefix(next, pkg+"/") {
+					splits = append(splits, fmt.Sprintf("%s imports %s, which imports %s", rel(pkg), rel(imp), rel(next)))
+				}
+			}
+		}
+	}
+
+	// The fan-in is unusual over two standard deviations above the mean
+	fanIn := make(map[string]int)
+	for _, pkg := range names {
+		for _, imp := range edges[pkg] {
+			fanIn[imp]++
+		}
+	}
+	var highFanIn []string
+	if len(names) > 0 {
+		mean, variance := 0.0, 0.0
+		for _, pkg := range names {
+			mean += float64(fanIn[pkg])
+		}
+		mean /= float64(len(names))
+		for _, pkg := range names {
+			variance += math.Pow(float64(fanIn[pkg])-mean, 2)
+		}
+		threshold := int(math.Ceil(mean + 2*math.Sqrt(variance/float64(len(names)))))
+		if threshold < minHighFanIn {
+			threshold = minHighFanIn
+		}
+
+		var high []string
+		for _, pkg := range names {
+			if fanIn[pkg] >= threshold {
+				high = append(high, pkg)
+			}
+		}
+		sort.SliceStable(high, func(i, j int) bool {
+			return fanIn[high[i]] > fanIn[high[j]]
+		})
+		for _, pkg := range high {
+			highFanIn = append(highFanIn, fmt.Sprintf("%s: imported by %d of %d packages (mean %.1f)", rel(pkg), fanIn[pkg], len(names), mean))
+		}
+	}
+
+	return []reportSection{
+		{"Import cycles, which don't build", cycles},
+		{"Import cycles through tests", testCycles},
+		{"Packages likely split to break a cycle", splits},
+		{"Packages with an unusually high fan-in", highFanIn},
+	}
+}
+
+// reportSection is a titled list of entries of a report
+type reportSection struct {
+	title   string
+	entries []string
+}
+
+// writeStructureAnalysis writes the findings about the import graph of the
+// packages of the module, the one packages are ordered by
+func writeStructureAnalysis(moduleName, syncPath string, packages []*packageInfo, registry *artifactRegistry, rep *reporter) error {
+	var b strings.Builder
+	b.WriteString("Structure analysis\n")
+	b.WriteString("==================\n\n")
+	b.WriteString("Import cycles and near-cycles between the packages of the module, and the\n")
+	b.WriteString("packages many others depend on.\n")
+
+	findings := 0
+	for _, section := range analyzeStructure(moduleName, packages) {
+		if len(section.entries) == 0 {
+			continue
+		}
+		findings += len(section.entries)
+		fmt.Fprintf(&b, "\n%s (%d)\n", section.title, len(section.entries))
+		for _, entry := range section.entries {
+			fmt.Fprintf(&b, "  %s\n", entry)
+		}
+	}
+	if findings == 0 {
+		b.WriteString("\nNo findings.\n")
+	}
+
+	name := projectFileName(structureAnalysisFileName)
+	outputPath := filepath.Join(syncPath, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputPath, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	registry.register(&artifact{Name: name, Kind: kindReport})
+
+	rep.info("Analyzed the structure of %d packages, %d findings", len(packages), findings)
+
+	return nil
+}
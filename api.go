@@ -0,0 +1,322 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Names of the API definition summaries
+const (
+	protoSummaryFileName   = "proto_summary.txt"
+	httpAPISummaryFileName = "http_api_summary.txt"
+)
+
+// openAPIFileNames are the names of the OpenAPI and Swagger definitions
+// summarized wherever they are in the project
+var openAPIFileNames = map[string]bool{
+	"openapi.yaml": true,
+	"openapi.yml":  true,
+	"openapi.json": true,
+	"swagger.yaml": true,
+	"swagger.yml":  true,
+	"swagger.json": true,
+}
+
+// httpMethods are the operations of an OpenAPI path item, in display order
+var httpMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+var (
+	protoLiteral = regexp.MustCompile(`(?s)"(?:[^"\\\n]|\\.)*"|'(?:[^'\\\n]|\\.)*'|/\*.*?\*/|//[^\n]*`)
+	protoPackage = regexp.MustCompile(`\bpackage\s+([\w.]+)\s*;`)
+	protoToken   = regexp.MustCompile(`\b(message|service|enum)\s+(\w+)\s*\{|\brpc\s+(\w+)\s*\(\s*(stream\s+)?([\w.]+)\s*\)\s*returns\s*\(\s*(stream\s+)?([\w.]+)\s*\)|[{}]`)
+)
+
+// protoRPC is a method of a protobuf service
+type protoRPC struct {
+	name, request, response string
+}
+
+// protoFile is the summary of a .proto file
+type protoFile struct {
+	pkg      string
+	services map[string][]protoRPC
+	order    []string // services in declaration order
+	messages []string // qualified with their enclosing messages
+	enums    []string
+}
+
+// parseProto extracts the services, rpcs, messages and enums of a .proto
+// file. It only tracks declarations and braces, which is enough for the
+// summary but doesn't validate the file.
+func parseProto(src string) (*protoFile, error) {
+	// Comments and string literals may hold braces and keywords
+	src = protoLiteral.ReplaceAllStringFunc(src, func(s string) string {
+		if strings.HasPrefix(s, "/") {
+			return ""
+		}
+		return `""`
+	})
+	f := &protoFile{services: make(map[string][]protoRPC)}
+	if m := protoPackage.FindStringSubmatch(src); m != nil {
+		f.pkg = m[1]
+	}
+
+	// Every open brace pushes the declaration it opens, "" for option blocks
+	type scope struct{ kind, name string }
+	var stack []scope
+	for _, m := range protoToken.FindAllStringSubmatch(src, -1) {
+		switch {
+		case m[0] == "{":
+			stack = append(stack, scope{})
+		case m[0] == "}":
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("unbalanced braces")
+			}
+			stack = stack[:len(stack)-1]
+		case m[3] != "":
+			if len(stack) == 0 || stack[len(stack)-1].kind != "service" {
+				continue
+			}
+			service := stack[len(stack)-1].name
+			f.services[service] = append(f.services[service], protoRPC{name: m[3], request: strings.TrimSpace(m[4] + m[5]), response: strings.TrimSpace(m[6] + m[7])})
+		default:
+			name := m[2]
+			var parents []string
+			for _, s := range stack {
+				if s.kind == "message" {
+					parents = append(parents, s.name)
+				}
+			}
+			qualified := strings.Join(append(parents, name), ".")
+			switch m[1] {
+			case "service":
+				f.order = append(f.order, name)
+			case "message":
+				f.messages = append(f.messages, qualified)
+			case "enum":
+				f.enums = append(f.enums, qualified)
+			}
+			stack = append(stack, scope{m[1], name})
+		}
+	}
+	if len(stack) != 0 {
+		return nil, fmt.Errorf("unbalanced braces")
+	}
+	return f, nil
+}
+
+// findFiles returns the regular files below the directories whose name
+// matches, skipping the noise directories
+func findFiles(dirs []string, match func(name string) bool) []string {
+	seen := make(map[string]bool)
+	var files []string
+	for _, dir := range dirs {
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			if info.IsDir() {
+				if path != dir && noiseDirs[info.Name()] {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info.Mode().IsRegular() && match(info.Name()) && !seen[path] {
+				seen[path] = true
+				files = append(files, path)
+			}
+			return nil
+		})
+	}
+	sort.Strings(files)
+	return files
+}
+
+// writeProtoSummary summarizes the .proto files of the included directories
+func writeProtoSummary(projectPath, syncPath string, files []string, registry *artifactRegistry, rep *reporter) error {
+	var b strings.Builder
+	b.WriteString("Protocol buffer definitions\n")
+	b.WriteString("===========================\n")
+
+	for _, filePath := range files {
+		relPath, err := filepath.Rel(projectPath, filePath)
+		if err != nil {
+			relPath = filePath
+		}
+		relPath = filepath.ToSlash(relPath)
+
+		src, err := os.ReadFile(filePath)
+		if err != nil {
+			rep.warn("could not read %s: %v", relPath, err)
+			continue
+		}
+		f, err := parseProto(string(src))
+		if err != nil {
+			rep.warn("could not summarize %s: %v", relPath, err)
+			continue
+		}
+
+		fmt.Fprintf(&b, "\n%s", relPath)
+		if f.pkg != "" {
+			fmt.Fprintf(&b, " (package %s)", f.pkg)
+		}
+		b.WriteString("\n")
+		for _, service := range f.order {
+			fmt.Fprintf(&b, "  service %s\n", service)
+			for _, rpc := range f.services[service] {
+				fmt.Fprintf(&b, "    rpc %s(%s) returns (%s)\n", rpc.name, rpc.request, rpc.response)
+			}
+		}
+		if len(f.messages) > 0 {
+			fmt.Fprintf(&b, "  messages: %s\n", strings.Join(f.messages, ", "))
+		}
+		if len(f.enums) > 0 {
+			fmt.Fprintf(&b, "  enums: %s\n", strings.Join(f.enums, ", "))
+		}
+	}
+
+	name := projectFileName(protoSummaryFileName)
+	outputPath := filepath.Join(syncPath, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputPath, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	registry.register(&artifact{Name: name, Kind: kindReport})
+
+	return nil
+}
+
+// openAPIOperation is an operation of an OpenAPI definition
+type openAPIOperation struct {
+	method, path, operationID, summary string
+}
+
+// parseOpenAPI extracts the operations of an OpenAPI or Swagger definition,
+// in YAML or JSON, sorted by path
+func parseOpenAPI(data []byte) (title, version string, ops []openAPIOperation, err error) {
+	var spec struct {
+		OpenAPI string `yaml:"openapi"`
+		Swagger string `yaml:"swagger"`
+		Info    struct {
+			Title   string `yaml:"title"`
+			Version string `yaml:"version"`
+		} `yaml:"info"`
+		Paths map[string]map[string]interface{} `yaml:"paths"`
+	}
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		return "", "", nil, err
+	}
+	if spec.OpenAPI == "" && spec.Swagger == "" {
+		return "", "", nil, fmt.Errorf("neither an openapi nor a swagger version is declared")
+	}
+
+	paths := make([]string, 0, len(spec.Paths))
+	for p := range spec.Paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		for _, method := range httpMethods {
+			op, ok := spec.Paths[p][method].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			id, _ := op["operationId"].(string)
+			summary, _ := op["summary"].(string)
+			ops = append(ops, openAPIOperation{strings.ToUpper(method), p, id, strings.TrimSpace(summary)})
+		}
+	}
+	return spec.Info.Title, spec.Info.Version, ops, nil
+}
+
+// writeHTTPAPISummary summarizes the OpenAPI and Swagger definitions
+func writeHTTPAPISummary(projectPath, syncPath string, files []string, registry *artifactRegistry, rep *reporter) error {
+	var b strings.Builder
+	b.WriteString("HTTP API definitions\n")
+	b.WriteString("====================\n")
+
+	for _, filePath := range files {
+		relPath, err := filepath.Rel(projectPath, filePath)
+		if err != nil {
+			relPath = filePath
+		}
+		relPath = filepath.ToSlash(relPath)
+
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			rep.warn("could not read %s: %v", relPath, err)
+			continue
+		}
+		title, version, ops, err := parseOpenAPI(data)
+		if err != nil {
+			rep.warn("could not summarize %s: %v", relPath, err)
+			continue
+		}
+
+		fmt.Fprintf(&b, "\n%s", relPath)
+		if title != "" {
+			fmt.Fprintf(&b, " (%s %s)", title, version)
+		}
+		b.WriteString("\n")
+		for _, op := range ops {
+			fmt.Fprintf(&b, "  %-7s %s", op.method, op.path)
+			if op.operationID != "" {
+				fmt.Fprintf(&b, "  %s", op.operationID)
+			}
+			if op.summary != "" {
+				fmt.Fprintf(&b, "  - %s", op.summary)
+			}
+			b.WriteString("\n")
+		}
+		if len(ops) == 0 {
+			b.WriteString("  (no operations)\n")
+		}
+	}
+
+	name := projectFileName(httpAPISummaryFileName)
+	outputPath := filepath.Join(syncPath, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputPath, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	registry.register(&artifact{Name: name, Kind: kindReport})
+
+	return nil
+}
+
+// writeAPISummaries summarizes the .proto files of the included directories
+// and the OpenAPI definitions of the project, writing a summary only for the
+// kinds of definitions found
+func writeAPISummaries(projectPath, syncPath string, includedDirs []string, registry *artifactRegistry, rep *reporter) {
+	protoFiles := findFiles(includedDirs, func(name string) bool {
+		return strings.HasSuffix(name, ".proto")
+	})
+	if len(protoFiles) > 0 {
+		if err := writeProtoSummary(projectPath, syncPath, protoFiles, registry, rep); err != nil {
+			rep.warn("could not write the protobuf summary: %v", err)
+		} else {
+			rep.info("Summarized %d .proto files", len(protoFiles))
+		}
+	}
+
+	openAPIFiles := findFiles([]string{projectPath}, func(name string) bool {
+		return openAPIFileNames[strings.ToLower(name)]
+	})
+	if len(openAPIFiles) > 0 {
+		if err := writeHTTPAPISummary(projectPath, syncPath, openAPIFiles, registry, rep); err != nil {
+			rep.warn("could not write the HTTP API summary: %v", err)
+		} else {
+			rep.info("Summarized %d OpenAPI definitions", len(openAPIFiles))
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// isZipArchive reports whether the -archive path names a zip archive rather
+// than a gzipped tarball
+func isZipArchive(archivePath string) bool {
+	return strings.HasSuffix(strings.ToLower(archivePath), ".zip")
+}
+
+// validateArchivePath checks the extension of the -archive path, which picks
+// the archive format
+func validateArchivePath(archivePath string) error {
+	lower := strings.ToLower(archivePath)
+	for _, ext := range []string{".tar.gz", ".tgz", ".zip"} {
+		if strings.HasSuffix(lower, ext) {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported archive %s, expected a .tar.gz, .tgz or .zip file", archivePath)
+}
+
+// archiveEmitter writes the files of the context into a .tar.gz or .zip
+// archive, under their path in the single-file outputs, with the directory
+// structure alongside
+type archiveEmitter struct {
+	path string
+}
+
+func (a *archiveEmitter) emit(s *emission) error {
+	entries := s.contents()
+	if structure := s.structure(); structure != "" {
+		entries = append([]contextEntry{{path: structureFileName, content: []byte(structure)}}, entries...)
+	}
+
+	var buf bytes.Buffer
+	if err := writeArchive(&buf, isZipArchive(a.path), s.meta.generatedAt, entries); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(a.path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(a.path, buf.Bytes())
+}
+
+func (a *archiveEmitter) target() string {
+	return a.path
+}
+
+// writeArchive writes the entries as the files of a zip archive or a gzipped
+// tarball, stamped with the time of the sync so that the same context gives
+// the same archive
+func writeArchive(w io.Writer, zipped bool, modTime time.Time, entries []contextEntry) error {
+	if zipped {
+		zw := zip.NewWriter(w)
+		for _, e := range entries {
+			f, err := zw.CreateHeader(&zip.FileHeader{Name: e.path, Method: zip.Deflate, Modified: modTime})
+			if err != nil {
+				return err
+			}
+			if _, err := f.Write(e.content); err != nil {
+				return err
+			}
+		}
+		return zw.Close()
+	}
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	for _, e := range entries {
+		header := &tar.Header{Name: e.path, Mode: 0644, Size: int64(len(e.content)), ModTime: modTime, Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(e.content); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// benchmarksFileName is the name of the benchmark inventory
+const benchmarksFileName = "benchmarks.txt"
+
+// benchmark is a Benchmark function found in a test file
+type benchmark struct {
+	name     string
+	file     string // base name of the test file
+	doc      string // first line of the doc comment
+	parallel bool   // calls b.RunParallel
+	subs     bool   // calls b.Run
+}
+
+// findBenchmarks parses the test files of a package for benchmark functions
+func findBenchmarks(pkg *packageInfo) ([]benchmark, error) {
+	fset := token.NewFileSet()
+	var benchmarks []benchmark
+
+	for _, list := range [][]string{pkg.TestGoFiles, pkg.XTestGoFiles} {
+		for _, name := range list {
+			file, err := parser.ParseFile(fset, filepath.Join(pkg.Dir, name), nil, parser.ParseComments)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, decl := range file.Decls {
+				fn, ok := decl.(*ast.FuncDecl)
+				if !ok || fn.Recv != nil || fn.Body == nil || !isBenchmarkName(fn.Name.Name) {
+					continue
+				}
+				param := benchmarkParam(fn)
+				if param == "" {
+					continue
+				}
+
+				bm := benchmark{name: fn.Name.Name, file: name}
+				if fn.Doc != nil {
+					bm.doc = strings.SplitN(strings.TrimSpace(fn.Doc.Text()), "\n", 2)[0]
+				}
+				bm.parallel, bm.subs = benchmarkCalls(fn.Body, param)
+				benchmarks = append(benchmarks, bm)
+			}
+		}
+	}
+
+	sort.Slice(benchmarks, func(i, j int) bool {
+		return benchmarks[i].name < benchmarks[j].name
+	})
+	return benchmarks, nil
+}
+
+// isBenchmarkName reports whether a function name is one the go tool runs as a
+// benchmark: "Benchmark" not followed by a lower-case letter
+func isBenchmarkName(name string) bool {
+	if !strings.HasPrefix(name, "Benchmark") {
+		return false
+	}
+	rest := name[len("Benchmark"):]
+	return rest == "" || !(rest[0] >= 'a' && rest[0] <= 'z')
+}
+
+// benchmarkParam returns the name of the *testing.B parameter of a benchmark
+// function, or "" if the signature isn't func(*testing.B)
+func benchmarkParam(fn *ast.FuncDecl) string {
+	params := fn.Type.Params.List
+	if len(params) != 1 || len(params[0].Names) > 1 {
+		return ""
+	}
+	star, ok := params[0].Type.(*ast.StarExpr)
+	if !ok {
+		return ""
+	}
+	sel, ok := star.X.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "B" {
+		return ""
+	}
+	if len(params[0].Names) == 0 {
+		return "_"
+	}
+	return params[0].Names[0].Name
+}
+
+// benchmarkCalls reports whether the body calls RunParallel or Run on the
+// benchmark parameter
+func benchmarkCalls(body *ast.BlockStmt, param string) (parallel, subs bool) {
+	ast.Inspect(body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if ident, ok := sel.X.(*ast.Ident); ok && ident.Name == param {
+			switch sel.Sel.Name {
+			case "RunParallel":
+				parallel = true
+			case "Run":
+				subs = true
+			}
+		}
+		return true
+	})
+	return parallel, subs
+}
+
+// writeBenchmarks writes the inventory of benchmark functions of the packages,
+// omitting packages without benchmarks
+func writeBenchmarks(syncPath, moduleName string, packages []*packageInfo, registry *artifactRegistry, rep *reporter) error {
+	sorted := make([]*packageInfo, len(packages))
+	copy(sorted, packages)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ImportPath < sorted[j].ImportPath
+	})
+
+	var b strings.Builder
+	b.WriteString("Benchmarks\n")
+	b.WriteString("==========\n")
+
+	count := 0
+	for _, pkg := range sorted {
+		benchmarks, err := findBenchmarks(pkg)
+		if err != nil {
+			rep.warn("could not scan %s for benchmarks: %v", pkg.ImportPath, err)
+			continue
+		}
+		if len(benchmarks) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&b, "\n%s\n", relativePackagePath(moduleName, pkg.ImportPath))
+		for _, bm := range benchmarks {
+			var notes []string
+			if bm.parallel {
+				notes = append(notes, "parallel")
+			}
+			if bm.subs {
+				notes = append(notes, "sub-benchmarks")
+			}
+
+			fmt.Fprintf(&b, "  %s (%s)", bm.name, bm.file)
+			if len(notes) > 0 {
+				fmt.Fprintf(&b, " [%s]", strings.Join(notes, ", "))
+			}
+			b.WriteString("\n")
+			if bm.doc != "" {
+				fmt.Fprintf(&b, "      %s\n", bm.doc)
+			}
+		}
+		count += len(benchmarks)
+	}
+
+	if count == 0 {
+		b.WriteString("\n(none)\n")
+	}
+
+	name := projectFileName(benchmarksFileName)
+	outputPath := filepath.Join(syncPath, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputPath, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+
+	rep.info("Found %d benchmarks", count)
+
+	return registry.register(&artifact{Name: name, Kind: kindReport})
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// defaultBuildFiles are the globs, relative to the project, of the build
+// tooling files linked with -build-files: makefiles, Dockerfiles, compose
+// files and CI configuration at the root and in the well-known locations
+var defaultBuildFiles = []string{
+	"Makefile",
+	"GNUmakefile",
+	"*.mk",
+	"Dockerfile*",
+	"*.Dockerfile",
+	"docker-compose*.yml",
+	"docker-compose*.yaml",
+	"compose.yml",
+	"compose.yaml",
+	".goreleaser.yml",
+	".goreleaser.yaml",
+	".github/workflows/*.yml",
+	".github/workflows/*.yaml",
+	".gitlab-ci.yml",
+	".circleci/config.yml",
+	"Jenkinsfile",
+	"build/*/Dockerfile*",
+	"build/ci/*",
+	"deployments/*/Dockerfile*",
+	"docker/Dockerfile*",
+	"docker/*/Dockerfile*",
+}
+
+// findBuildFiles returns the regular files matching the build file globs,
+// sorted. Invalid globs match nothing.
+func findBuildFiles(projectPath string, globs []string) []string {
+	var files []string
+	seen := make(map[string]bool)
+	for _, glob := range globs {
+		matches, _ := filepath.Glob(filepath.Join(projectPath, glob))
+		for _, match := range matches {
+			if info, err := os.Stat(match); err != nil || !info.Mode().IsRegular() || seen[match] {
+				continue
+			}
+			seen[match] = true
+			files = append(files, match)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// linkBuildFiles links the files matching the build file globs, honoring
+// the excluded directories, -exclude-file patterns and .gitignore. Files
+// larger than maxSize are skipped with a warning.
+func linkBuildFiles(projectPath, syncPath string, globs, excludeDirs []string, maxSize int64, opts *options, registry *artifactRegistry, rep *reporter) {
+	for _, glob := range globs {
+		if _, err := filepath.Match(glob, ""); err != nil {
+			rep.warn("invalid build file pattern %s: %v", glob, err)
+		}
+	}
+
+	linked := 0
+	for _, filePath := range findBuildFiles(projectPath, globs) {
+		relPath, err := filepath.Rel(projectPath, filePath)
+		if err != nil || strings.HasPrefix(relPath, "..") {
+			continue
+		}
+
+		excluded := false
+		for _, excludeDir := range excludeDirs {
+			excludePath := excludeDir
+			if !filepath.IsAbs(excludePath) {
+				excludePath = filepath.Join(projectPath, excludeDir)
+			}
+			if strings.HasPrefix(filePath, excludePath+string(os.PathSeparator)) {
+				excluded = true
+				break
+			}
+		}
+		if excluded {
+			rep.info("Skipping build file in excluded directory: %s", relPath)
+			continue
+		}
+
+		if vc := projectVCS(projectPath); vc != nil {
+			if ignored, err := vc.isIgnored(filePath); err == nil && ignored {
+				rep.info("Skipping %s-ignored file: %s", vc.kind(), relPath)
+				continue
+			}
+		}
+
+		if info, err := os.Stat(filePath); err == nil && info.Size() > maxSize {
+			rep.warn("skipping build file %s: %d bytes, over -max-file-size of %d", relPath, info.Size(), maxSize)
+			continue
+		}
+
+		if err := linkProjectFile(filePath, projectPath, syncPath, kindBuild, opts, registry, rep); err != nil {
+			rep.warn("could not link build file %s: %v", relPath, err)
+			continue
+		}
+		linked++
+	}
+
+	rep.info("Linked %d build files", linked)
+}
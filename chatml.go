@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// chatMLFileName is the name of the file written with -format=chatml
+const chatMLFileName = "messages.json"
+
+// minMessageSize is the smallest -max-message-size, which leaves room for
+// the header of a file next to a part of its content
+const minMessageSize = 4 << 10
+
+// chatMessage is a message of a chat completions request
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// renderChatML renders the entries as the messages array of a chat
+// completions request: a system message with instructions, then user
+// messages with the directory structure and the files, each file under a
+// header naming its path. Files are packed into messages of at most maxSize
+// bytes of content, the larger ones split across consecutive messages.
+func renderChatML(meta repomixMetadata, structure string, entries []contextEntry, maxSize int) ([]byte, error) {
+	var system strings.Builder
+	fmt.Fprintf(&system, "The following messages contain the context of the Go module %s", meta.module)
+	if meta.commit != "" {
+		fmt.Fprintf(&system, " at commit %s", meta.commit)
+	}
+	system.WriteString(", generated by gocontext.\n")
+	system.WriteString("They contain the directory structure followed by package documentation and source files,\n")
+	system.WriteString("with packages in dependency order. Each file starts with a \"File: <path>\" header line;\n")
+	system.WriteString("files too large for a single message are split into parts across consecutive messages,\n")
+	system.WriteString("with \"(part N of M)\" appended to the header.\n")
+
+	p := &messagePacker{maxSize: maxSize}
+	if structure != "" {
+		p.add("Directory structure", structure)
+	}
+	for _, e := range entries {
+		p.add("File: "+e.path, string(e.content))
+	}
+	p.flush()
+
+	messages := append([]chatMessage{{Role: "system", Content: system.String()}}, p.messages...)
+
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(messages); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// messagePacker packs blocks of a header and content into user messages of
+// at most maxSize bytes
+type messagePacker struct {
+	maxSize  int
+	messages []chatMessage
+	current  strings.Builder
+}
+
+// add adds a block to the current message, or to a new one if it doesn't
+// fit, splitting it into parts if it doesn't fit in a message of its own
+func (p *messagePacker) add(header, content string) {
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	block := header + "\n\n" + content
+	if p.fits(block) {
+		p.append(block)
+		return
+	}
+	p.flush()
+	if len(block) <= p.maxSize {
+		p.append(block)
+		return
+	}
+
+	// Room is left for the longest part header, there being no more parts
+	// than bytes of content
+	budget := p.maxSize - len(header) - len(fmt.Sprintf(" (part %d of %d)\n\n", len(content), len(content)))
+	if budget < 1 {
+		budget = 1
+	}
+	parts := splitContent(content, budget)
+	for i, part := range parts {
+		p.flush()
+		p.append(fmt.Sprintf("%s (part %d of %d)\n\n%s", header, i+1, len(parts), part))
+	}
+}
+
+// fits reports whether a block fits in the current message, after the blank
+// line separating it from the previous block
+func (p *messagePacker) fits(block string) bool {
+	size := p.current.Len() + len(block)
+	if p.current.Len() > 0 {
+		size++
+	}
+	return size <= p.maxSize
+}
+
+func (p *messagePacker) append(block string) {
+	if p.current.Len() > 0 {
+		p.current.WriteString("\n")
+	}
+	p.current.WriteString(block)
+}
+
+// flush ends the current message
+func (p *messagePacker) flush() {
+	if p.current.Len() == 0 {
+		return
+	}
+	p.messages = append(p.messages, chatMessage{Role: "user", Content: p.current.String()})
+	p.current.Reset()
+}
+
+// splitContent splits content into parts of at most size bytes, at the end
+// of a line where possible and never inside a UTF-8 sequence
+func splitContent(content string, size int) []string {
+	var parts []string
+	for len(content) > size {
+		cut := strings.LastIndexByte(content[:size], '\n') + 1
+		if cut == 0 {
+			cut = size
+			for cut > 0 && !utf8.RuneStart(content[cut]) {
+				cut--
+			}
+			if cut == 0 {
+				_, cut = utf8.DecodeRuneInString(content)
+			}
+		}
+		parts = append(parts, content[:cut])
+		content = content[cut:]
+	}
+	if content != "" {
+		parts = append(parts, content)
+	}
+	return parts
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// clipboardCommands returns the commands that can copy stdin to the system
+// clipboard on this platform, in order of preference
+func clipboardCommands() [][]string {
+	switch runtime.GOOS {
+	case "darwin":
+		return [][]string{{"pbcopy"}}
+	case "windows":
+		return [][]string{{"clip.exe"}}
+	}
+
+	var commands [][]string
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		commands = append(commands, []string{"wl-copy"})
+	}
+	commands = append(commands, []string{"xclip", "-selection", "clipboard"}, []string{"xsel", "--clipboard", "--input"})
+	if runtime.GOOS == "linux" {
+		// WSL exposes the Windows clipboard
+		commands = append(commands, []string{"clip.exe"})
+	}
+	return commands
+}
+
+// copyToClipboard copies data to the system clipboard using the first
+// available clipboard utility
+func copyToClipboard(data []byte) error {
+	var tried []string
+	for _, command := range clipboardCommands() {
+		if _, err := exec.LookPath(command[0]); err != nil {
+			tried = append(tried, command[0])
+			continue
+		}
+
+		cmd := exec.Command(command[0], command[1:]...)
+		cmd.Stdin = bytes.NewReader(data)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s failed: %v %s", command[0], err, bytes.TrimSpace(stderr.Bytes()))
+		}
+		return nil
+	}
+
+	return fmt.Errorf("no clipboard utility found (tried %v)", tried)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// cliFlagsFileName is the name of the inventory of the flags of the module
+const cliFlagsFileName = "cli_flags.txt"
+
+// definedFlag is a flag registration and the package defining it
+type definedFlag struct {
+	commandFlag
+	pkg string // path relative to the module
+}
+
+// packageFlags returns the flags registered by the non-test files of a package
+func packageFlags(pkg *packageInfo) ([]commandFlag, error) {
+	var flags []commandFlag
+	for _, list := range [][]string{pkg.GoFiles, pkg.CgoFiles} {
+		for _, name := range list {
+			filePath := filepath.Join(pkg.Dir, name)
+			src, err := os.ReadFile(filePath)
+			if err != nil {
+				return nil, err
+			}
+			fset := token.NewFileSet()
+			file, err := parser.ParseFile(fset, filePath, src, 0)
+			if err != nil {
+				return nil, err
+			}
+			flags = append(flags, findFlags(src, fset, file)...)
+		}
+	}
+	return flags, nil
+}
+
+// describe formats where and how a flag is defined
+func (f definedFlag) describe() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s (%s:%d) %s", f.pkg, f.file, f.line, f.typeName)
+	if f.shorthand != "" {
+		fmt.Fprintf(&b, ", shorthand -%s", f.shorthand)
+	}
+	if f.value != "" {
+		fmt.Fprintf(&b, ", default %s", f.value)
+	}
+	if f.usage != "" {
+		fmt.Fprintf(&b, "\n      %s", strings.Replace(f.usage, "\n", "\n      ", -1))
+	}
+	return b.String()
+}
+
+// writeCLIFlags writes the inventory of the flags registered anywhere in the
+// packages, grouped by flag name. Flags whose name isn't a constant string are
+// listed separately.
+func writeCLIFlags(syncPath, moduleName string, packages []*packageInfo, registry *artifactRegistry, rep *reporter) error {
+	byName := make(map[string][]definedFlag)
+	var dynamic []definedFlag
+	for _, pkg := range packages {
+		flags, err := packageFlags(pkg)
+		if err != nil {
+			rep.warn("could not read the flags of %s: %v", pkg.ImportPath, err)
+			continue
+		}
+		for _, f := range flags {
+			d := definedFlag{commandFlag: f, pkg: relativePackagePath(moduleName, pkg.ImportPath)}
+			if f.dynamic {
+				dynamic = append(dynamic, d)
+			} else {
+				byName[f.name] = append(byName[f.name], d)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("CLI flags\n")
+	b.WriteString("=========\n")
+	for _, name := range names {
+		defs := byName[name]
+		fmt.Fprintf(&b, "\n-%s", name)
+		if len(defs) > 1 {
+			fmt.Fprintf(&b, " (defined %d times)", len(defs))
+		}
+		b.WriteString("\n")
+		for _, d := range defs {
+			fmt.Fprintf(&b, "  %s\n", d.describe())
+		}
+	}
+	if len(names) == 0 {
+		b.WriteString("\n(none)\n")
+	}
+
+	if len(dynamic) > 0 {
+		b.WriteString("\nUndetermined names\n")
+		b.WriteString("==================\n\n")
+		for _, d := range dynamic {
+			fmt.Fprintf(&b, "%s\n  %s\n", d.name, d.describe())
+		}
+	}
+
+	name := projectFileName(cliFlagsFileName)
+	outputPath := filepath.Join(syncPath, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputPath, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	registry.register(&artifact{Name: name, Kind: kindReport})
+
+	rep.info("Listed %d flags and %d flags with undetermined names", len(names), len(dynamic))
+
+	return nil
+}
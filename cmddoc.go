@@ -0,0 +1,344 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// flagFuncs are the flag registration functions of the flag package, of
+// FlagSets, and the shorthand variants of pflag (as used by cobra): the number
+// of arguments, the position of the name, shorthand, default and usage
+// arguments, and the type shown for the flag. A negative position means the
+// argument is absent.
+var flagFuncs = map[string]struct {
+	args                          int
+	name, shorthand, value, usage int
+	typeName                      string
+}{
+	"String":       {3, 0, -1, 1, 2, "string"},
+	"Bool":         {3, 0, -1, 1, 2, "bool"},
+	"Int":          {3, 0, -1, 1, 2, "int"},
+	"Int64":        {3, 0, -1, 1, 2, "int64"},
+	"Uint":         {3, 0, -1, 1, 2, "uint"},
+	"Uint64":       {3, 0, -1, 1, 2, "uint64"},
+	"Float64":      {3, 0, -1, 1, 2, "float64"},
+	"Duration":     {3, 0, -1, 1, 2, "duration"},
+	"StringSlice":  {3, 0, -1, 1, 2, "strings"},
+	"StringVar":    {4, 1, -1, 2, 3, "string"},
+	"BoolVar":      {4, 1, -1, 2, 3, "bool"},
+	"IntVar":       {4, 1, -1, 2, 3, "int"},
+	"Int64Var":     {4, 1, -1, 2, 3, "int64"},
+	"UintVar":      {4, 1, -1, 2, 3, "uint"},
+	"Uint64Var":    {4, 1, -1, 2, 3, "uint64"},
+	"Float64Var":   {4, 1, -1, 2, 3, "float64"},
+	"DurationVar":  {4, 1, -1, 2, 3, "duration"},
+	"TextVar":      {4, 1, -1, 2, 3, "value"},
+	"Var":          {3, 1, -1, -1, 2, "value"},
+	"Func":         {3, 0, -1, -1, 1, "func"},
+	"BoolFunc":     {3, 0, -1, -1, 1, "func"},
+	"StringP":      {4, 0, 1, 2, 3, "string"},
+	"BoolP":        {4, 0, 1, 2, 3, "bool"},
+	"IntP":         {4, 0, 1, 2, 3, "int"},
+	"Int64P":       {4, 0, 1, 2, 3, "int64"},
+	"DurationP":    {4, 0, 1, 2, 3, "duration"},
+	"StringSliceP": {4, 0, 1, 2, 3, "strings"},
+	"StringVarP":   {5, 1, 2, 3, 4, "string"},
+	"BoolVarP":     {5, 1, 2, 3, 4, "bool"},
+	"IntVarP":      {5, 1, 2, 3, 4, "int"},
+	"Int64VarP":    {5, 1, 2, 3, 4, "int64"},
+	"DurationVarP": {5, 1, 2, 3, 4, "duration"},
+	"VarP":         {4, 1, 2, -1, 3, "value"},
+}
+
+// commandFlag is a flag registration found in a package. The name of a
+// dynamic flag isn't a constant string and holds the source of its expression.
+type commandFlag struct {
+	name, shorthand, typeName, value, usage string
+
+	file    string
+	line    int
+	dynamic bool
+}
+
+// flagGroup are the flags registered by a function, or at package level
+type flagGroup struct {
+	owner string
+	flags []commandFlag
+}
+
+// commandSynopsis describes the command line of a main package
+type commandSynopsis struct {
+	doc    string
+	usages []string // values of the usage and help string constants
+	groups []flagGroup
+}
+
+// stringValue evaluates a string literal or a concatenation of literals
+func stringValue(expr ast.Expr) (string, bool) {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		if e.Kind != token.STRING {
+			return "", false
+		}
+		s, err := strconv.Unquote(e.Value)
+		return s, err == nil
+	case *ast.BinaryExpr:
+		if e.Op != token.ADD {
+			return "", false
+		}
+		x, ok := stringValue(e.X)
+		if !ok {
+			return "", false
+		}
+		y, ok := stringValue(e.Y)
+		return x + y, ok
+	case *ast.ParenExpr:
+		return stringValue(e.X)
+	}
+	return "", false
+}
+
+// sourceText returns the source of a node
+func sourceText(src []byte, fset *token.FileSet, node ast.Node) string {
+	return string(src[fset.Position(node.Pos()).Offset:fset.Position(node.End()).Offset])
+}
+
+// findFlags returns the flag registrations under node
+func findFlags(src []byte, fset *token.FileSet, node ast.Node) []commandFlag {
+	var flags []commandFlag
+	ast.Inspect(node, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		f, ok := flagFuncs[sel.Sel.Name]
+		if !ok || len(call.Args) != f.args {
+			return true
+		}
+		pos := fset.Position(call.Pos())
+		cf := commandFlag{typeName: f.typeName, file: filepath.Base(pos.Filename), line: pos.Line}
+		if name, ok := stringValue(call.Args[f.name]); ok {
+			cf.name = name
+		} else if _, isLit := call.Args[f.name].(*ast.BasicLit); isLit {
+			return true
+		} else if _, ok := stringValue(call.Args[f.usage]); !ok {
+			// Without a constant name or usage, it's likely not a flag at all
+			return true
+		} else {
+			cf.name, cf.dynamic = sourceText(src, fset, call.Args[f.name]), true
+		}
+		if f.shorthand >= 0 {
+			cf.shorthand, _ = stringValue(call.Args[f.shorthand])
+		}
+		if f.value >= 0 {
+			if s, ok := stringValue(call.Args[f.value]); ok {
+				cf.value = strconv.Quote(s)
+			} else {
+				cf.value = sourceText(src, fset, call.Args[f.value])
+			}
+		}
+		if s, ok := stringValue(call.Args[f.usage]); ok {
+			cf.usage = s
+		} else {
+			cf.usage = sourceText(src, fset, call.Args[f.usage])
+		}
+		flags = append(flags, cf)
+		return true
+	})
+	return flags
+}
+
+// isUsageName reports whether a constant or variable likely holds help text
+func isUsageName(name string) bool {
+	name = strings.ToLower(name)
+	return strings.Contains(name, "usage") || strings.Contains(name, "help")
+}
+
+// extractCommandSynopsis reads the package comment, usage strings and flag
+// registrations of the main package in pkgDir
+func extractCommandSynopsis(pkgDir string) (*commandSynopsis, error) {
+	names, err := buildableGoFiles(pkgDir)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &commandSynopsis{}
+	var packageFlags []commandFlag
+	for _, name := range names {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		filePath := filepath.Join(pkgDir, name)
+		src, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, filePath, src, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+
+		if s.doc == "" && file.Doc != nil {
+			s.doc = strings.TrimSpace(file.Doc.Text())
+		}
+
+		for _, decl := range file.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				if d.Body == nil {
+					continue
+				}
+				if flags := findFlags(src, fset, d.Body); len(flags) > 0 {
+					s.groups = append(s.groups, flagGroup{owner: d.Name.Name, flags: flags})
+				}
+			case *ast.GenDecl:
+				if d.Tok != token.CONST && d.Tok != token.VAR {
+					continue
+				}
+				for _, spec := range d.Specs {
+					vs := spec.(*ast.ValueSpec)
+					for i, ident := range vs.Names {
+						if i >= len(vs.Values) || !isUsageName(ident.Name) {
+							continue
+						}
+						if text, ok := stringValue(vs.Values[i]); ok {
+							s.usages = append(s.usages, strings.TrimSpace(text))
+						}
+					}
+				}
+				packageFlags = append(packageFlags, findFlags(src, fset, d)...)
+			}
+		}
+	}
+
+	// The flags of main come first, after those registered at package level
+	sort.SliceStable(s.groups, func(i, j int) bool {
+		return s.groups[i].owner == "main" && s.groups[j].owner != "main"
+	})
+	if len(packageFlags) > 0 {
+		s.groups = append([]flagGroup{{flags: packageFlags}}, s.groups...)
+	}
+	return s, nil
+}
+
+// render formats the synopsis of the command
+func (s *commandSynopsis) render(name, importPath string) string {
+	var b strings.Builder
+	title := fmt.Sprintf("Command %s (%s)", name, importPath)
+	fmt.Fprintf(&b, "%s\n%s\n", title, strings.Repeat("=", len(title)))
+
+	if s.doc != "" {
+		fmt.Fprintf(&b, "\n%s\n", s.doc)
+	}
+
+	for _, usage := range s.usages {
+		fmt.Fprintf(&b, "\nUsage\n-----\n%s\n", usage)
+	}
+
+	for _, g := range s.groups {
+		heading := "Flags"
+		if len(s.groups) > 1 && g.owner != "" {
+			heading = fmt.Sprintf("Flags registered in %s", g.owner)
+		} else if len(s.groups) > 1 {
+			heading = "Flags registered at package level"
+		}
+		fmt.Fprintf(&b, "\n%s\n%s\n", heading, strings.Repeat("-", len(heading)))
+		for _, f := range g.flags {
+			if f.dynamic {
+				continue
+			}
+			fmt.Fprintf(&b, "  -%s", f.name)
+			if f.shorthand != "" {
+				fmt.Fprintf(&b, ", -%s", f.shorthand)
+			}
+			fmt.Fprintf(&b, " %s", f.typeName)
+			if f.value != "" {
+				fmt.Fprintf(&b, " (default %s)", f.value)
+			}
+			b.WriteString("\n")
+			if f.usage != "" {
+				fmt.Fprintf(&b, "        %s\n", strings.Replace(f.usage, "\n", "\n        ", -1))
+			}
+		}
+	}
+
+	if len(s.groups) == 0 {
+		b.WriteString("\n(no flags found)\n")
+	}
+	return b.String()
+}
+
+// commandFileName returns the name of the synopsis of a command, named after
+// the command unless full, when it's named after its package path
+func commandFileName(moduleName, pkg string, full bool) string {
+	relPkg := relativePackagePath(moduleName, pkg)
+
+	switch grouping {
+	case groupDir:
+		return path.Join(relPkg, "cmd.txt")
+	case groupPackage:
+		return path.Join(packageDirName(relPkg), "cmd.txt")
+	}
+
+	if relPkg == "." {
+		relPkg = pkg
+	}
+	if !full {
+		relPkg = path.Base(relPkg)
+	}
+	return flatName(kindPrefixes[kindCommand], relPkg) + ".txt"
+}
+
+// writeCommandSynopses writes the command line synopsis of every main package
+func writeCommandSynopses(moduleName, syncPath string, packages []*packageInfo, registry *artifactRegistry, rep *reporter) {
+	// Commands are named after their directory unless two share the same name
+	seen := make(map[string]int)
+	for _, pkg := range packages {
+		if pkg.Name == "main" {
+			seen[path.Base(pkg.ImportPath)]++
+		}
+	}
+
+	for _, pkg := range packages {
+		if pkg.Name != "main" || pkg.Dir == "" {
+			continue
+		}
+
+		synopsis, err := extractCommandSynopsis(pkg.Dir)
+		if err != nil {
+			rep.warn("could not read the command line of %s: %v", pkg.ImportPath, err)
+			continue
+		}
+
+		cmdName := path.Base(pkg.ImportPath)
+		name := commandFileName(moduleName, pkg.ImportPath, seen[cmdName] > 1)
+		outputPath := filepath.Join(syncPath, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+			rep.warn("could not write the command line of %s: %v", pkg.ImportPath, err)
+			continue
+		}
+		if err := writeFileAtomic(outputPath, []byte(synopsis.render(cmdName, pkg.ImportPath))); err != nil {
+			rep.warn("could not write the command line of %s: %v", pkg.ImportPath, err)
+			continue
+		}
+
+		if err := registry.register(&artifact{Name: name, Kind: kindCommand, Package: pkg.ImportPath, dir: pkg.Dir}); err != nil {
+			rep.warn("could not register the command line of %s: %v", pkg.ImportPath, err)
+			continue
+		}
+		rep.info("Described the command line of %s", pkg.ImportPath)
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// runCommand runs a subcommand and returns the process exit code
+func runCommand(name string, args []string) int {
+	switch name {
+	case "packages":
+		return runPackagesCommand(args)
+	case "completion":
+		return runCompletionCommand(args)
+	case "verify":
+		return runVerifyCommand(args)
+	case "verify-links":
+		return runVerifyLinksCommand(args)
+	case "profiles":
+		return runProfilesCommand(args)
+	case "doc":
+		return runDocCommand(args)
+	case "doctor":
+		return runDoctorCommand(args)
+	case "files":
+		return runFilesCommand(args)
+	default:
+		fmt.Printf("Error: unknown command %q\n", name)
+		fmt.Println("Available commands: packages, completion, verify, verify-links, profiles, doc, doctor, files")
+		return 2
+	}
+}
+
+// resolveProject returns the absolute path of a Go project, defaulting to
+// the current directory
+func resolveProject(projectPath string) (string, error) {
+	if projectPath == "" {
+		currentDir, err := os.Getwd()
+		if err != nil {
+			return "", fmt.Errorf("error getting current directory: %v", err)
+		}
+		projectPath = currentDir
+	}
+
+	absProjectPath, err := filepath.Abs(projectPath)
+	if err != nil {
+		return "", fmt.Errorf("error resolving project path: %v", err)
+	}
+
+	if !isGoProject(absProjectPath) {
+		return "", fmt.Errorf("%s does not appear to be a Go project", absProjectPath)
+	}
+
+	return absProjectPath, nil
+}
+
+// runPackagesCommand prints the packages discovered in the project, in the
+// form accepted by -include and -exclude
+func runPackagesCommand(args []string) int {
+	fs := flag.NewFlagSet("packages", flag.ExitOnError)
+	projectPath := fs.String("project", "", "Path to the Go project (default: current directory)")
+	relative := fs.Bool("relative", false, "Print directories relative to the module root instead of import paths")
+	fs.Parse(args)
+
+	absProjectPath, err := resolveProject(*projectPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	packages, err := discoverPackages(absProjectPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error discovering packages: %v\n", err)
+		return 1
+	}
+
+	moduleName, _ := resolveModuleName(absProjectPath)
+
+	for _, pkg := range packages {
+		if *relative {
+			relPkg := relativePackagePath(moduleName, pkg)
+			if relPkg == "." || relPkg == pkg {
+				continue
+			}
+			pkg = relPkg
+		}
+		fmt.Println(pkg)
+	}
+
+	return 0
+}
+
+// runProfilesCommand prints the profiles defined in the project's config file
+func runProfilesCommand(args []string) int {
+	fs := flag.NewFlagSet("profiles", flag.ExitOnError)
+	projectPath := fs.String("project", "", "Path to the Go project (default: current directory)")
+	fs.Parse(args)
+
+	absProjectPath, err := resolveProject(*projectPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	cfg, err := loadConfig(absProjectPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading config: %v\n", err)
+		return 1
+	}
+
+	for _, name := range cfg.profileNames() {
+		fmt.Println(name)
+	}
+
+	return 0
+}
+
+// runDocCommand prints the documentation of a single package, and optionally
+// of the packages of the module it imports, without syncing anything
+func runDocCommand(args []string) int {
+	fs := flag.NewFlagSet("doc", flag.ExitOnError)
+	projectPath := fs.String("project", "", "Path to the Go project (default: current directory)")
+	withDeps := fs.Bool("with-deps", false, "Also print the documentation of the packages of the module the package imports directly")
+	synopsisOnly := fs.Bool("doc-synopsis-only", false, "Print only the package synopsis and top-level symbol list")
+	fs.StringVar(&docFormat, "doc-format", docFormatText, "Format of the documentation: text (go doc output), md (markdown rendered from go/doc) or pretty (go doc -all like text listing the promoted fields and methods of each type, type-checked with go/types)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: gocontext doc [flags] <import-path>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	if err := validateDocFormat(docFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	absProjectPath, err := resolveProject(*projectPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	moduleName, _ := resolveModuleName(absProjectPath)
+
+	// Packages may be given relative to the module root
+	pkg := fs.Arg(0)
+	if info, err := os.Stat(filepath.Join(absProjectPath, pkg)); moduleName != "" && err == nil && info.IsDir() {
+		pkg = path.Join(moduleName, filepath.ToSlash(filepath.Clean(pkg)))
+	}
+
+	packages := []string{pkg}
+	if *withDeps {
+		infos, err := loadPackages(absProjectPath, packages)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		for _, info := range infos {
+			packages = append(packages, moduleImports(moduleName, info)...)
+		}
+	}
+
+	// Packages go list can't resolve fail one at a time below
+	resolvePackageDirs(absProjectPath, packages)
+
+	// The packages share the importer, so that their imports are only
+	// type-checked once
+	imp := newPackageImporter(nil)
+
+	status := 0
+	for i, p := range packages {
+		pkgDir, err := getPackageDir(p, absProjectPath)
+		var output []byte
+		if err == nil {
+			output, err = renderDocumentation(p, pkgDir, absProjectPath, imp, *synopsisOnly, false)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error documenting %s: %v\n", p, err)
+			status = 1
+			continue
+		}
+
+		if len(packages) > 1 {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("==> %s <==\n", p)
+		}
+		os.Stdout.Write(output)
+	}
+
+	return status
+}
+
+// runCompletionCommand prints a shell completion script
+func runCompletionCommand(args []string) int {
+	if len(args) != 1 {
+		fmt.Println("Usage: gocontext completion bash|zsh")
+		return 2
+	}
+
+	// Collect the flags of the main command
+	var flags []string
+	flag.VisitAll(func(f *flag.Flag) {
+		flags = append(flags, "-"+f.Name)
+	})
+	sort.Strings(flags)
+
+	switch args[0] {
+	case "bash":
+		fmt.Print(strings.Replace(bashCompletion, completionFlags, strings.Join(flags, " "), 1))
+	case "zsh":
+		fmt.Print(strings.Replace(zshCompletion, completionFlags, strings.Join(flags, " "), 1))
+	default:
+		fmt.Printf("Error: unsupported shell %q, expected bash or zsh\n", args[0])
+		return 2
+	}
+
+	return 0
+}
+
+// completionFlags stands for the flags of the main command in the completion
+// scripts, which are printed as is rather than as format strings
+const completionFlags = "@FLAGS@"
+
+// bashCompletion completes flags, subcommands, and -include/-exclude values
+// against the live package list of the current project
+const bashCompletion = `# bash completion for gocontext
+# Install with: source <(gocontext completion bash)
+_gocontext() {
+    local cur prev flag
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    prev="${COMP_WORDS[COMP_CWORD-1]}"
+    flag="$prev"
+    if [[ "$prev" == "=" && $COMP_CWORD -ge 2 ]]; then
+        flag="${COMP_WORDS[COMP_CWORD-2]}"
+    fi
+    if [[ "$cur" == "=" ]]; then
+        flag="$prev"
+        cur=""
+    fi
+
+    case "$flag" in
+        -profile|--profile)
+            COMPREPLY=( $(compgen -W "$(gocontext profiles 2>/dev/null)" -- "$cur") )
+            return
+            ;;
+        -include|--include|-exclude|--exclude)
+            local prefix="" last="$cur" pkgs
+            if [[ "$cur" == *,* ]]; then
+                prefix="${cur%,*},"
+                last="${cur##*,}"
+            fi
+            pkgs="$(gocontext packages 2>/dev/null) $(gocontext packages -relative 2>/dev/null)"
+            COMPREPLY=( $(compgen -P "$prefix" -W "$pkgs" -- "$last") )
+            return
+            ;;
+    esac
+
+    if [[ "$cur" == -* ]]; then
+        COMPREPLY=( $(compgen -W "@FLAGS@" -- "$cur") )
+    elif [[ $COMP_CWORD -eq 1 ]]; then
+        COMPREPLY=( $(compgen -W "packages completion verify verify-links profiles doc doctor files" -- "$cur") )
+    fi
+}
+complete -o default -F _gocontext gocontext
+`
+
+// zshCompletion is the zsh counterpart of bashCompletion
+const zshCompletion = `#compdef gocontext
+# zsh completion for gocontext
+# Install with: source <(gocontext completion zsh)
+_gocontext() {
+    local -a pkgs
+    case "${words[CURRENT-1]}" in
+        -profile|--profile)
+            compadd -- ${(f)"$(gocontext profiles 2>/dev/null)"}
+            return
+            ;;
+        -include|--include|-exclude|--exclude)
+            compset -P '*,'
+            pkgs=(${(f)"$(gocontext packages 2>/dev/null)"} ${(f)"$(gocontext packages -relative 2>/dev/null)"})
+            compadd -S '' -a pkgs
+            return
+            ;;
+    esac
+
+    if [[ "${words[CURRENT]}" == -* ]]; then
+        compadd -- @FLAGS@
+    elif (( CURRENT == 2 )); then
+        compadd -- packages completion verify verify-links profiles doc doctor files
+    else
+        _files
+    fi
+}
+compdef _gocontext gocontext
+`
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// The values of -include and -exclude are completed after the last comma,
+// keeping all the values before it
+func TestBashCompletionCommaList(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not installed")
+	}
+
+	tests := []struct {
+		cur  string
+		want string
+	}{
+		{"pkg/", "pkg/a pkg/b"},
+		{"pkg/a,pkg/b,pkg/", "pkg/a,pkg/b,pkg/a pkg/a,pkg/b,pkg/b"},
+		{"pkg/a,cm", "pkg/a,cmd/tool"},
+	}
+	for _, tt := range tests {
+		script := bashCompletion + `
+gocontext() { [[ "$1" == packages && -z "$2" ]] && printf '%s\n' pkg/a pkg/b cmd/tool; }
+COMP_WORDS=(gocontext -include "$1")
+COMP_CWORD=2
+_gocontext
+echo "${COMPREPLY[*]}"
+`
+		output, err := exec.Command(bash, "-c", script, "bash", tt.cur).Output()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.cur, err)
+		}
+		if got := strings.TrimSpace(string(output)); got != tt.want {
+			t.Errorf("%s: completed %q, want %q", tt.cur, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// licenseWords marks a leading comment block as a license header
+var licenseWords = regexp.MustCompile(`(?i)copyright|license|licensed|spdx-license-identifier`)
+
+// condenser squeezes whitespace out of copied and single-file output: trailing
+// whitespace is trimmed, runs of blank lines collapse to one, and the license
+// header repeated at the top of every file is kept only in the first one.
+// Nothing changes inside a line, nor in the lines whose whitespace is part of
+// the content, such as those of Go raw strings. Files are condensed
+// concurrently as they're copied.
+type condenser struct {
+	mu sync.Mutex
+
+	// header is the license header dropped from files, taken from the first
+	// file in walk order that has one, headerFile, unless given with
+	// -license-header
+	header     []byte
+	headerFile string
+
+	// tokenizer counts the tokens saved
+	tokenizer tokenizer
+
+	files                     int
+	before, after             int64
+	tokensBefore, tokensAfter int
+}
+
+// newCondenser creates a condenser counting tokens with tok, reading the
+// license header to drop from headerFile if given
+func newCondenser(headerFile string, tok tokenizer) (*condenser, error) {
+	c := &condenser{tokenizer: tok}
+	if headerFile != "" {
+		data, err := os.ReadFile(headerFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read the license header: %v", err)
+		}
+		c.header = bytes.TrimSpace(trimLines(bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))))
+		if len(c.header) == 0 {
+			return nil, fmt.Errorf("license header %s is empty", headerFile)
+		}
+	}
+	return c, nil
+}
+
+// trimLines removes the trailing spaces and tabs of every line
+func trimLines(content []byte) []byte {
+	lines := bytes.Split(content, []byte("\n"))
+	for i, line := range lines {
+		lines[i] = bytes.TrimRight(line, " \t")
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
+
+// splitEOL splits a line into its text and its line break, "\n", "\r\n" or
+// none at the end of the content
+func splitEOL(line []byte) ([]byte, []byte) {
+	if bytes.HasSuffix(line, []byte("\r\n")) {
+		return line[:len(line)-2], line[len(line)-2:]
+	}
+	if bytes.HasSuffix(line, []byte("\n")) {
+		return line[:len(line)-1], line[len(line)-1:]
+	}
+	return line, nil
+}
+
+// condenseText trims the trailing whitespace of the lines of a file and
+// collapses its runs of blank lines, leaving alone the verbatim lines whose
+// whitespace is part of the content
+func condenseText(name string, content []byte) []byte {
+	lines := bytes.SplitAfter(content, []byte("\n"))
+	verbatim := verbatimLines(name, lines)
+
+	var b bytes.Buffer
+	b.Grow(len(content))
+	blank := false
+	for i, line := range lines {
+		if verbatim[i] {
+			b.Write(line)
+			blank = false
+			continue
+		}
+		text, eol := splitEOL(line)
+		text = bytes.TrimRight(text, " \t")
+		if len(text) == 0 && eol != nil {
+			if blank {
+				continue
+			}
+			blank = true
+		} else {
+			blank = false
+		}
+		b.Write(text)
+		b.Write(eol)
+	}
+	return b.Bytes()
+}
+
+// verbatimLines marks the lines of a file, as split after their line breaks,
+// that condensing mustn't touch: the lines of Go raw string literals,
+// shell heredocs, and Markdown hard breaks and fenced code blocks
+func verbatimLines(name string, lines [][]byte) []bool {
+	verbatim := make([]bool, len(lines))
+	base := filepath.Base(name)
+	switch ext := strings.ToLower(filepath.Ext(name)); {
+	case ext == ".go":
+		markRawStrings(lines, verbatim)
+	case ext == ".md" || ext == ".markdown":
+		markMarkdown(lines, verbatim)
+	case ext == ".sh" || ext == ".bash" || ext == ".zsh" || ext == ".ksh" || strings.HasPrefix(base, "Dockerfile") || len(lines) > 0 && bytes.HasPrefix(lines[0], []byte("#!")):
+		markHeredocs(lines, verbatim)
+	}
+	return verbatim
+}
+
+// markRawStrings marks the lines whose line break is inside a raw string
+// literal of Go source
+func markRawStrings(lines [][]byte, verbatim []bool) {
+	src := bytes.Join(lines, nil)
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(src))
+	var s scanner.Scanner
+	s.Init(file, src, nil, 0)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			return
+		}
+		if tok != token.STRING || !strings.HasPrefix(lit, "`") {
+			continue
+		}
+		start := fset.Position(pos).Line
+		end := start + strings.Count(lit, "\n")
+		for line := start; line < end; line++ {
+			verbatim[line-1] = true
+		}
+	}
+}
+
+// markMarkdown marks the hard line breaks, lines ending with two spaces, and
+// the lines of fenced code blocks of Markdown, fences included
+func markMarkdown(lines [][]byte, verbatim []bool) {
+	var fence []byte
+	for i, line := range lines {
+		text, _ := splitEOL(line)
+		trimmed := bytes.TrimLeft(text, " ")
+		if fence != nil {
+			verbatim[i] = true
+			if bytes.HasPrefix(trimmed, fence) && len(bytes.TrimSpace(trimmed[len(fence):])) == 0 {
+				fence = nil
+			}
+			continue
+		}
+		if bytes.HasPrefix(trimmed, []byte("```")) || bytes.HasPrefix(trimmed, []byte("~~~")) {
+			fence = trimmed[:3]
+			verbatim[i] = true
+			continue
+		}
+		verbatim[i] = bytes.HasSuffix(text, []byte("  ")) && len(bytes.TrimSpace(text)) > 0
+	}
+}
+
+// heredocStart matches the redirections starting a heredoc, capturing the
+// dash of <<- and the delimiter, quoted or not
+var heredocStart = regexp.MustCompile(`(?:^|[^<])<<(-?)[ \t]*(?:'(\w+)'|"(\w+)"|\\?(\w+))`)
+
+// markHeredocs marks the bodies of the heredocs of a shell script along with
+// their delimiter lines, trailing whitespace making a delimiter line part of
+// the body
+func markHeredocs(lines [][]byte, verbatim []bool) {
+	type heredoc struct {
+		delimiter []byte
+		tabs      bool
+	}
+	var pending []heredoc
+	for i, line := range lines {
+		text, _ := splitEOL(line)
+		if len(pending) > 0 {
+			verbatim[i] = true
+			if pending[0].tabs {
+				text = bytes.TrimLeft(text, "\t")
+			}
+			if bytes.Equal(text, pending[0].delimiter) {
+				pending = pending[1:]
+			}
+			continue
+		}
+		for _, m := range heredocStart.FindAllSubmatch(text, -1) {
+			delimiter := m[2]
+			if delimiter == nil {
+				delimiter = m[3]
+			}
+			if delimiter == nil {
+				delimiter = m[4]
+			}
+			pending = append(pending, heredoc{delimiter: delimiter, tabs: len(m[1]) > 0})
+		}
+	}
+}
+
+// leadingComment returns the comment block at the top of the content, up to
+// the first blank line, and the rest of the content after the blank line
+func leadingComment(content []byte) ([]byte, []byte) {
+	if !bytes.HasPrefix(content, []byte("//")) && !bytes.HasPrefix(content, []byte("/*")) && !bytes.HasPrefix(content, []byte("#")) {
+		return nil, content
+	}
+	for offset := 0; offset < len(content); {
+		end := bytes.IndexByte(content[offset:], '\n')
+		if end < 0 {
+			break
+		}
+		if text, _ := splitEOL(content[offset : offset+end+1]); len(text) == 0 {
+			block, _ := splitEOL(content[:offset])
+			return block, content[offset+end+1:]
+		}
+		offset += end + 1
+	}
+	return nil, content
+}
+
+// headerBlock returns the leading comment of condensed content with its line
+// breaks normalized, to compare headers
+func headerBlock(condensed []byte) []byte {
+	block, _ := leadingComment(condensed)
+	return bytes.ReplaceAll(block, []byte("\r\n"), []byte("\n"))
+}
+
+// isLicense reports whether a leading comment is a license header
+func isLicense(block []byte) bool {
+	return len(block) > 0 && licenseWords.Match(block)
+}
+
+// chooseHeader picks the license header to keep only once from the first of
+// the files, in walk order, that has one, unless it is already chosen. Files
+// copied concurrently keep the header in the same file whatever the order
+// they're condensed in.
+func (c *condenser) chooseHeader(sources []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, source := range sources {
+		if c.header != nil {
+			return
+		}
+		content, err := os.ReadFile(source)
+		if err != nil || len(content) == 0 || !isTextSample(content, false) {
+			continue
+		}
+		if block := headerBlock(condenseText(source, content)); isLicense(block) {
+			c.header, c.headerFile = block, source
+		}
+	}
+}
+
+// apply condenses the content of a text file with the given name. Only the
+// header and the totals are shared, files are condensed concurrently.
+func (c *condenser) apply(name string, content []byte) []byte {
+	condensed := condenseText(name, content)
+
+	// Keep the license header only in the first file carrying it
+	if block := headerBlock(condensed); len(block) > 0 {
+		c.mu.Lock()
+		if c.header == nil && isLicense(block) {
+			c.header, c.headerFile = block, name
+		} else if c.header != nil && name != c.headerFile && bytes.Equal(block, c.header) {
+			_, condensed = leadingComment(condensed)
+		}
+		c.mu.Unlock()
+	}
+
+	tokensBefore := countTextTokens(c.tokenizer, content)
+	tokensAfter := countTextTokens(c.tokenizer, condensed)
+
+	c.mu.Lock()
+	c.files++
+	c.before += int64(len(content))
+	c.after += int64(len(condensed))
+	c.tokensBefore += tokensBefore
+	c.tokensAfter += tokensAfter
+	c.mu.Unlock()
+	return condensed
+}
+
+// copyCondensed copies a text file condensed to dest, and any other file as is
+func (c *condenser) copyCondensed(source, dest string) error {
+	content, err := os.ReadFile(source)
+	if err != nil {
+		return err
+	}
+	if len(content) == 0 || !isTextSample(content, false) {
+		return copyFile(source, dest)
+	}
+
+	if err := os.Remove(dest); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(dest, c.apply(source, content), 0644)
+}
+
+// report returns the savings of the transform
+func (c *condenser) report() string {
+	saved := 0.0
+	if c.before > 0 {
+		saved = 100 * float64(c.before-c.after) / float64(c.before)
+	}
+	return fmt.Sprintf("Condensed %d files: %d -> %d bytes, ~%d tokens (%.1f%% saved)", c.files, c.before, c.after, c.tokensBefore-c.tokensAfter, saved)
+}
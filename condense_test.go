@@ -0,0 +1,153 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestLeadingComment(t *testing.T) {
+	tests := []struct {
+		name, content, block, rest string
+	}{
+		{"line comments", "// Copyright 2024\n// Apache-2.0\n\npackage a\n", "// Copyright 2024\n// Apache-2.0", "package a\n"},
+		{"block comment", "/*\n * Copyright\n */\n\npackage a\n", "/*\n * Copyright\n */", "package a\n"},
+		{"hash comment", "# Copyright\n\nset -e\n", "# Copyright", "set -e\n"},
+		{"crlf", "// Copyright\r\n\r\npackage a\r\n", "// Copyright", "package a\r\n"},
+		{"no comment", "package a\n\n// Copyright\n", "", "package a\n\n// Copyright\n"},
+		{"no blank line", "// Copyright\npackage a\n", "", "// Copyright\npackage a\n"},
+		{"empty", "", "", ""},
+	}
+	for _, tt := range tests {
+		block, rest := leadingComment([]byte(tt.content))
+		if string(block) != tt.block || string(rest) != tt.rest {
+			t.Errorf("%s: got %q and %q, want %q and %q", tt.name, block, rest, tt.block, tt.rest)
+		}
+	}
+}
+
+func TestCondenserApply(t *testing.T) {
+	const license = "// Copyright 2024 The Authors\n// SPDX-License-Identifier: MIT\n\n"
+	tests := []struct {
+		name, file, content, want string
+	}{
+		{"trailing whitespace", "a.txt", "a  \nb\t\n", "a\nb\n"},
+		{"blank lines", "a.txt", "a\n\n\n\nb\n \n\t\nc\n", "a\n\nb\n\nc\n"},
+		{"crlf", "a.txt", "a \r\n\r\n\r\n\r\nb\t\r\n", "a\r\n\r\nb\r\n"},
+		{"no final newline", "a.txt", "a\nb  ", "a\nb"},
+		{
+			"go raw string",
+			"a.go",
+			"package a  \n\n\n\nconst s = `x  \n\n\n\ny\t\n`  \n",
+			"package a\n\nconst s = `x  \n\n\n\ny\t\n`\n",
+		},
+		{
+			"go raw string with a backquote in a comment",
+			"a.go",
+			"package a\n\n// a ` in a comment  \nvar s = `\n  \n`\n",
+			"package a\n\n// a ` in a comment\nvar s = `\n  \n`\n",
+		},
+		{"go raw string outside go", "a.txt", "s = `x  \n`\n", "s = `x\n`\n"},
+		{
+			"heredoc",
+			"run.sh",
+			"cat <<EOF  \nkeep  \n\n\n\nEOF\necho  \n",
+			"cat <<EOF\nkeep  \n\n\n\nEOF\necho\n",
+		},
+		{
+			"heredoc with trailing space on the delimiter",
+			"run.sh",
+			"cat <<'EOF'\na\nEOF \n\n\nEOF\nb \n",
+			"cat <<'EOF'\na\nEOF \n\n\nEOF\nb\n",
+		},
+		{
+			"indented heredoc",
+			"Dockerfile",
+			"RUN cat <<-EOF > x\n\tkeep \n\tEOF\nRUN true \n",
+			"RUN cat <<-EOF > x\n\tkeep \n\tEOF\nRUN true\n",
+		},
+		{"shebang", "run", "#!/bin/sh\ncat << \"END\"\n a \nEND\n", "#!/bin/sh\ncat << \"END\"\n a \nEND\n"},
+		{"here string", "run.sh", "cat <<<word  \nx \n", "cat <<<word\nx\n"},
+		{
+			"markdown",
+			"README.md",
+			"line with a break  \nnext \n\n\n```go\nx := 1  \n\n\n```\nend \n",
+			"line with a break  \nnext\n\n```go\nx := 1  \n\n\n```\nend\n",
+		},
+		{"license kept in the first file", "a.go", license + "package a\n", license + "package a\n"},
+		{"license dropped from the next ones", "b.go", license + "package b\n", "package b\n"},
+		{"other comment kept", "c.go", "// Package c does things\n\npackage c\n", "// Package c does things\n\npackage c\n"},
+	}
+
+	c, err := newCondenser("", heuristicTokenizer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		if got := string(c.apply(tt.file, []byte(tt.content))); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	if c.files != len(tests) {
+		t.Errorf("counted %d files, want %d", c.files, len(tests))
+	}
+}
+
+// The header is kept in the first file in walk order, whatever the order
+// the files are condensed in
+func TestCondenserChooseHeader(t *testing.T) {
+	const license = "// Copyright 2024 The Authors\n\n"
+	root := writeFixture(t, map[string]string{
+		"a.go": "package a\n",
+		"b.go": license + "package b\n",
+		"c.go": license + "package c\n",
+	})
+
+	for run := 0; run < 10; run++ {
+		c, err := newCondenser("", heuristicTokenizer{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sources []string
+		for _, name := range []string{"a.go", "b.go", "c.go"} {
+			sources = append(sources, filepath.Join(root, name))
+		}
+		c.chooseHeader(sources)
+
+		results := make([]string, len(sources))
+		var wg sync.WaitGroup
+		for i := len(sources) - 1; i >= 0; i-- {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				content, err := os.ReadFile(sources[i])
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				results[i] = string(c.apply(sources[i], content))
+			}(i)
+		}
+		wg.Wait()
+
+		if results[1] != license+"package b\n" || results[2] != "package c\n" {
+			t.Fatalf("run %d: header kept in the wrong file: %q", run, results)
+		}
+	}
+}
+
+// A header given with -license-header is dropped from every file, license
+// words or not
+func TestCondenserLicenseHeaderFile(t *testing.T) {
+	root := writeFixture(t, map[string]string{"header.txt": "// Internal tooling, do not edit  \r\n"})
+	c, err := newCondenser(filepath.Join(root, "header.txt"), heuristicTokenizer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, content := range []string{"// Internal tooling, do not edit\n\npackage a\n", "// Internal tooling, do not edit\r\n\r\npackage a\r\n"} {
+		if got := string(c.apply("a.go", []byte(content))); got != "package a\n" && got != "package a\r\n" {
+			t.Errorf("header kept in %q", got)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configFileName is the name of the optional config file in the project root
+const configFileName = ".gocontext.yaml"
+
+// config is the content of the config file. Top-level settings are the
+// defaults inherited by every profile.
+type config struct {
+	settings `yaml:",inline"`
+	Profiles map[string]settings `yaml:"profiles"`
+}
+
+// settings are the options that can be set in the config file. Command line
+// flags take precedence over them.
+type settings struct {
+	Include    []string `yaml:"include" json:"include,omitempty"`
+	Exclude    []string `yaml:"exclude" json:"exclude,omitempty"`
+	Output     string   `yaml:"output" json:"output,omitempty"`
+	Extensions []string `yaml:"extensions" json:"extensions,omitempty"`
+
+	// ExcludeDirs are directory names skipped when walking the project, in
+	// addition to the well-known noise directories
+	ExcludeDirs []string `yaml:"excludeDirs" json:"excludeDirs,omitempty"`
+
+	// RedactKeys are regular expressions of config keys whose values are
+	// masked, in addition to the secret, password, token and key defaults
+	RedactKeys []string `yaml:"redactKeys" json:"redactKeys,omitempty"`
+
+	// BuildFiles are the globs of the build files linked with -build-files,
+	// replacing the default makefiles, Dockerfiles and CI workflows
+	BuildFiles []string `yaml:"buildFiles" json:"buildFiles,omitempty"`
+}
+
+// loadConfig reads the config file of the project, returning an empty config
+// if there is none
+func loadConfig(projectPath string) (*config, error) {
+	data, err := os.ReadFile(filepath.Join(projectPath, configFileName))
+	if os.IsNotExist(err) {
+		return &config{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var c config
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", configFileName, err)
+	}
+
+	return &c, nil
+}
+
+// profileNames returns the names of the profiles in the config, sorted
+func (c *config) profileNames() []string {
+	var names []string
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resolve returns the settings of the named profile, with the settings it
+// doesn't set inherited from the top level. An empty name selects the
+// top-level settings.
+func (c *config) resolve(profile string) (settings, error) {
+	if profile == "" {
+		return c.settings, nil
+	}
+
+	p, ok := c.Profiles[profile]
+	if !ok {
+		msg := fmt.Sprintf("unknown profile %q", profile)
+		if suggestion := closestName(profile, c.profileNames()); suggestion != "" {
+			msg += fmt.Sprintf(" (did you mean %q?)", suggestion)
+		} else if len(c.Profiles) == 0 {
+			msg += fmt.Sprintf(", no profiles are defined in %s", configFileName)
+		}
+		return settings{}, fmt.Errorf("%s", msg)
+	}
+
+	s := c.settings
+	if p.Include != nil {
+		s.Include = p.Include
+	}
+	if p.Exclude != nil {
+		s.Exclude = p.Exclude
+	}
+	if p.Output != "" {
+		s.Output = p.Output
+	}
+	if p.Extensions != nil {
+		s.Extensions = p.Extensions
+	}
+	if p.ExcludeDirs != nil {
+		s.ExcludeDirs = p.ExcludeDirs
+	}
+	if p.RedactKeys != nil {
+		s.RedactKeys = p.RedactKeys
+	}
+	if p.BuildFiles != nil {
+		s.BuildFiles = p.BuildFiles
+	}
+	return s, nil
+}
+
+// extensionSet converts the configured extensions to the set used by fileFilter
+func extensionSet(extensions []string) map[string]bool {
+	set := make(map[string]bool)
+	for _, ext := range extensions {
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		set[ext] = true
+	}
+	return set
+}
+
+// closestName returns the candidate closest to name, or "" if none is close
+// enough to be a likely typo
+func closestName(name string, candidates []string) string {
+	best, bestDistance := "", len(name)/2+1
+	for _, candidate := range candidates {
+		if d := editDistance(name, candidate); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// readListFile reads the entries of a list file, one per line. Blank lines
+// and comments starting with # are skipped.
+func readListFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			entries = append(entries, line)
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// redactedValue replaces the values of secret-looking keys
+const redactedValue = "[REDACTED]"
+
+// defaultRedactKeys matches the keys whose values are always masked in
+// copied and single-file config files
+var defaultRedactKeys = []string{`secret`, `passw(or)?d`, `pwd`, `token`, `credential`, `key`}
+
+var (
+	// redactAssignment matches a key and its value in YAML, JSON, TOML, INI,
+	// properties and .env files: `key: value`, `"key": "value",`, `key = value`
+	// or `export KEY=value`
+	redactAssignment = regexp.MustCompile(`^(\s*(?:export\s+|-\s+)?)(["']?)([\w.\-]+)(["']?\s*[:=]\s*)(.*?)(,?\s*)$`)
+
+	// redactBlockScalar matches the indicator of a YAML block scalar, whose
+	// value is on the following, more indented lines
+	redactBlockScalar = regexp.MustCompile(`^[|>][-+0-9]*$`)
+
+	// redactReference matches values that only refer to an environment
+	// variable, which are kept as they document where the secret comes from
+	redactReference = regexp.MustCompile(`^["']?\$\{?\w+\}?["']?$`)
+)
+
+// redactor masks the values of secret-looking keys in config files before
+// they leave the project: when copied with -copy and in single-file output.
+// Symlinked config files point at the project and aren't redacted.
+type redactor struct {
+	keys *regexp.Regexp
+
+	// masked counts the masked values by source file. A file read for both a
+	// copy and a bundle is only counted once.
+	masked map[string]int
+}
+
+// newRedactor creates a redactor for the default keys and the extra key
+// patterns, matched case-insensitively
+func newRedactor(extra []string) (*redactor, error) {
+	for _, pattern := range extra {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("invalid redaction key pattern %q: %v", pattern, err)
+		}
+	}
+	patterns := append(append([]string{}, defaultRedactKeys...), extra...)
+	keys, err := regexp.Compile(`(?i)(` + strings.Join(patterns, `)|(`) + `)`)
+	if err != nil {
+		return nil, err
+	}
+	return &redactor{keys: keys, masked: make(map[string]int)}, nil
+}
+
+// apply masks the values of secret-looking keys in the content of a config
+// file, line by line. Comments, empty values, nested structures and
+// references to environment variables are left as they are.
+func (r *redactor) apply(source string, content []byte) []byte {
+	lines := bytes.Split(content, []byte("\n"))
+	masked := 0
+	for i := 0; i < len(lines); i++ {
+		m := redactAssignment.FindSubmatch(lines[i])
+		if m == nil || !r.keys.Match(m[3]) {
+			continue
+		}
+		value := string(m[5])
+		if value == "" || value == "{" || value == "[" || redactReference.MatchString(value) {
+			continue
+		}
+
+		// The lines of a block scalar are dropped along with its indicator
+		if redactBlockScalar.MatchString(value) {
+			indent := len(m[1])
+			end := i + 1
+			for end < len(lines) {
+				line := lines[end]
+				trimmed := bytes.TrimLeft(line, " \t")
+				if len(trimmed) > 0 && len(line)-len(trimmed) <= indent {
+					break
+				}
+				end++
+			}
+			lines = append(lines[:i+1], lines[end:]...)
+			value = redactedValue
+		} else if quote := value[0]; (quote == '"' || quote == '\'') && len(value) > 1 && value[len(value)-1] == quote {
+			value = string(quote) + redactedValue + string(quote)
+		} else {
+			value = redactedValue
+		}
+
+		var b bytes.Buffer
+		b.Write(m[1])
+		b.Write(m[2])
+		b.Write(m[3])
+		b.Write(m[4])
+		b.WriteString(value)
+		b.Write(m[6])
+		lines[i] = b.Bytes()
+		masked++
+	}
+
+	r.masked[source] = masked
+	return bytes.Join(lines, []byte("\n"))
+}
+
+// content returns the content of an artifact as it may leave the project,
+// redacted if it's a config file
+func (r *redactor) content(a *artifact, content []byte) []byte {
+	if a.Kind != kindConfig {
+		return content
+	}
+	return r.apply(a.Source, content)
+}
+
+// total returns the number of masked values and of redacted files
+func (r *redactor) total() (values, files int) {
+	for _, n := range r.masked {
+		values += n
+	}
+	return values, len(r.masked)
+}
+
+// report returns the number of values masked, reported so that nothing is
+// redacted silently
+func (r *redactor) report() string {
+	values, files := r.total()
+	return fmt.Sprintf("Redacted %d values in %d config files", values, files)
+}
+
+// linkConfigFile symlinks a config file, or copies it redacted by red in copy
+// mode
+func linkConfigFile(source, dest string, red *redactor) error {
+	if !copyMode {
+		return linkFile(source, dest, nil)
+	}
+
+	content, err := os.ReadFile(source)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(dest); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(dest, red.apply(source, content), 0644)
+}
+
+// linkConfigFiles links the project files matching the globs, relative to
+// the project, as config files redacted by red
+func linkConfigFiles(projectPath, syncPath string, globs []string, red *redactor, registry *artifactRegistry, rep *reporter) {
+	var files []string
+	seen := make(map[string]bool)
+	for _, glob := range globs {
+		pattern := glob
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(projectPath, glob)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			rep.warn("invalid -config-files pattern %s: %v", glob, err)
+			continue
+		}
+		if len(matches) == 0 {
+			rep.warn("no config files match %s", glob)
+		}
+		for _, match := range matches {
+			if info, err := os.Stat(match); err != nil || !info.Mode().IsRegular() || seen[match] {
+				continue
+			}
+			seen[match] = true
+			files = append(files, match)
+		}
+	}
+	sort.Strings(files)
+
+	linked := 0
+	for _, filePath := range files {
+		relPath, err := filepath.Rel(projectPath, filePath)
+		if err != nil || strings.HasPrefix(relPath, "..") {
+			rep.warn("skipping config file %s outside the project", filePath)
+			continue
+		}
+		if !fileAllowed(relPath, kindConfig) {
+			rep.info("Skipping file excluded by pattern: %s", relPath)
+			continue
+		}
+		if registry.isExcluded(filePath) {
+			rep.info("Skipping excluded file: %s", relPath)
+			continue
+		}
+
+		name := artifactName(kindConfig, relPath)
+		if err := registry.register(&artifact{Name: name, Kind: kindConfig, Source: filePath}); err != nil {
+			rep.info("Skipping duplicate config file %s: %v", relPath, err)
+			continue
+		}
+		linkPath := filepath.Join(syncPath, filepath.FromSlash(name))
+		if _, err := os.Lstat(linkPath); err != nil || copyMode {
+			os.Remove(linkPath)
+			if err := linkConfigFile(filePath, linkPath, red); err != nil {
+				rep.warn("could not link config file %s: %v", relPath, err)
+				continue
+			}
+		}
+		linked++
+	}
+
+	rep.info("Linked %d config files", linked)
+}
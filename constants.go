@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// constantEntry is an exported constant with its value as evaluated by the
+// type checker and its expression as written, or inherited from the previous
+// spec of an iota sequence
+type constantEntry struct {
+	name, typeName, value, expr, doc string
+	deprecated                       bool
+}
+
+// constantGroup is a const declaration holding exported constants
+type constantGroup struct {
+	doc     string
+	pos     string
+	entries []constantEntry
+}
+
+// isDeprecated reports whether a doc comment has a paragraph starting with
+// "Deprecated:"
+func isDeprecated(doc string) bool {
+	for _, line := range strings.Split(doc, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "Deprecated:") {
+			return true
+		}
+	}
+	return false
+}
+
+// constantValue formats a constant as Go source would write it, keeping
+// floats short and integers and strings exact
+func constantValue(val constant.Value) string {
+	switch val.Kind() {
+	case constant.Unknown:
+		return "?"
+	case constant.Float, constant.Complex:
+		return val.String()
+	}
+	return val.ExactString()
+}
+
+// extractConstants reads the exported const groups of the package in pkgDir,
+// evaluating their values, iota sequences included, with the type checker.
+// Constants depending on packages that can't be imported are listed with an
+// unknown value.
+func extractConstants(pkgDir string, imp types.Importer) ([]constantGroup, error) {
+	names, err := buildableGoFiles(pkgDir)
+	if err != nil {
+		return nil, err
+	}
+
+	fset := token.NewFileSet()
+	var files []*ast.File
+	sources := make(map[*ast.File][]byte)
+	for _, name := range names {
+		filePath := filepath.Join(pkgDir, name)
+		src, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		file, err := parser.ParseFile(fset, filePath, src, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+		sources[file] = src
+	}
+
+	// Errors are expected for packages whose imports don't resolve, the
+	// constants that could be evaluated are still recorded
+	info := &types.Info{Defs: make(map[*ast.Ident]types.Object)}
+	conf := types.Config{Importer: imp, Error: func(error) {}}
+	pkg, _ := conf.Check(files[0].Name.Name, fset, files, info)
+
+	var groups []constantGroup
+	for _, file := range files {
+		src := sources[file]
+		for _, decl := range file.Decls {
+			d, ok := decl.(*ast.GenDecl)
+			if !ok || d.Tok != token.CONST {
+				continue
+			}
+
+			pos := fset.Position(d.Pos())
+			group := constantGroup{pos: fmt.Sprintf("%s:%d", filepath.Base(pos.Filename), pos.Line)}
+			if d.Doc != nil {
+				group.doc = strings.TrimSpace(d.Doc.Text())
+			}
+			groupDeprecated := isDeprecated(group.doc)
+
+			// Specs without values repeat the expressions of the previous one
+			var values []ast.Expr
+			for _, spec := range d.Specs {
+				vs := spec.(*ast.ValueSpec)
+				var doc string
+				if vs.Doc != nil {
+					doc = strings.TrimSpace(vs.Doc.Text())
+				} else if vs.Comment != nil {
+					doc = strings.TrimSpace(vs.Comment.Text())
+				}
+				if len(vs.Values) > 0 {
+					values = vs.Values
+				}
+				for i, ident := range vs.Names {
+					if !ident.IsExported() {
+						continue
+					}
+					var expr string
+					if i < len(values) {
+						expr = sourceText(src, fset, values[i])
+					}
+
+					entry := constantEntry{name: ident.Name, expr: expr, doc: doc, deprecated: groupDeprecated || isDeprecated(doc), value: "?"}
+					if obj, ok := info.Defs[ident].(*types.Const); ok && obj.Type() != types.Typ[types.Invalid] {
+						entry.typeName = types.TypeString(obj.Type(), types.RelativeTo(pkg))
+						entry.value = constantValue(obj.Val())
+					} else if vs.Type != nil {
+						entry.typeName = sourceText(src, fset, vs.Type)
+					}
+					group.entries = append(group.entries, entry)
+				}
+			}
+			if len(group.entries) > 0 {
+				groups = append(groups, group)
+			}
+		}
+	}
+	return groups, nil
+}
+
+// renderConstants formats the const groups of a package
+func renderConstants(importPath string, groups []constantGroup) string {
+	var b strings.Builder
+	title := fmt.Sprintf("Constants of %s", importPath)
+	fmt.Fprintf(&b, "%s\n%s\n", title, strings.Repeat("=", len(title)))
+
+	for _, g := range groups {
+		// Name the group after the type its constants share, if any
+		typeName := g.entries[0].typeName
+		for _, e := range g.entries[1:] {
+			if e.typeName != typeName {
+				typeName = ""
+				break
+			}
+		}
+		heading := fmt.Sprintf("const (%s)", g.pos)
+		if typeName != "" && !strings.HasPrefix(typeName, "untyped ") {
+			heading = fmt.Sprintf("%s constants (%s)", typeName, g.pos)
+		}
+		fmt.Fprintf(&b, "\n%s\n%s\n", heading, strings.Repeat("-", len(heading)))
+		if g.doc != "" {
+			fmt.Fprintf(&b, "%s\n\n", g.doc)
+		}
+
+		for _, e := range g.entries {
+			b.WriteString("  " + e.name)
+			if e.typeName != "" {
+				b.WriteString(" " + e.typeName)
+			}
+			b.WriteString(" = " + e.value)
+			if e.expr != "" && e.expr != e.value {
+				fmt.Fprintf(&b, " (%s)", e.expr)
+			}
+			if e.deprecated {
+				b.WriteString(" [deprecated]")
+			}
+			b.WriteString("\n")
+			if e.doc != "" {
+				fmt.Fprintf(&b, "      %s\n", strings.Replace(e.doc, "\n", "\n      ", -1))
+			}
+		}
+	}
+	return b.String()
+}
+
+// constantsFileName returns the name of the constant catalog of a package,
+// placed like its doc
+func constantsFileName(moduleName, pkg string) string {
+	relPkg := relativePackagePath(moduleName, pkg)
+
+	switch grouping {
+	case groupDir:
+		return path.Join(relPkg, "constants.txt")
+	case groupPackage:
+		return path.Join(packageDirName(relPkg), "constants.txt")
+	}
+
+	if relPkg == "." {
+		relPkg = pkg
+	}
+	return flatName(kindPrefixes[kindConstants], relPkg) + ".txt"
+}
+
+// writeConstantCatalogs writes the catalog of exported constants of every
+// package that has any
+func writeConstantCatalogs(moduleName, syncPath string, packages []*packageInfo, imp types.Importer, registry *artifactRegistry, rep *reporter) {
+	for _, pkg := range packages {
+		if pkg.Dir == "" || len(pkg.GoFiles)+len(pkg.CgoFiles) == 0 {
+			continue
+		}
+
+		groups, err := extractConstants(pkg.Dir, imp)
+		if err != nil {
+			rep.warn("could not read the constants of %s: %v", pkg.ImportPath, err)
+			continue
+		}
+		if len(groups) == 0 {
+			continue
+		}
+
+		name := constantsFileName(moduleName, pkg.ImportPath)
+		outputPath := filepath.Join(syncPath, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+			rep.warn("could not write the constants of %s: %v", pkg.ImportPath, err)
+			continue
+		}
+		if err := os.WriteFile(outputPath, []byte(renderConstants(pkg.ImportPath, groups)), 0644); err != nil {
+			rep.warn("could not write the constants of %s: %v", pkg.ImportPath, err)
+			continue
+		}
+
+		if err := registry.register(&artifact{Name: name, Kind: kindConstants, Package: pkg.ImportPath, dir: pkg.Dir}); err != nil {
+			rep.warn("could not register the constants of %s: %v", pkg.ImportPath, err)
+			continue
+		}
+		rep.info("Listed the constants of %s", pkg.ImportPath)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// coverageFileName is the name of the coverage summary
+const coverageFileName = "coverage.txt"
+
+// defaultCoverProfile is the coverage profile read when -coverprofile isn't
+// given, relative to the project
+const defaultCoverProfile = "coverage.out"
+
+// defaultCoverageThreshold is the statement coverage, in percent, below which
+// files are listed
+const defaultCoverageThreshold = 50.0
+
+// coverageCounts are the statements of a file or package and how many of them
+// ran
+type coverageCounts struct {
+	statements int
+	covered    int
+}
+
+// percent returns the share of covered statements
+func (c coverageCounts) percent() float64 {
+	if c.statements == 0 {
+		return 100
+	}
+	return 100 * float64(c.covered) / float64(c.statements)
+}
+
+// coverProfile is a parsed coverage profile: the statements of every file,
+// keyed by import path and file name as written by go test -coverprofile
+type coverProfile struct {
+	mode  string
+	files map[string]*coverageCounts
+}
+
+// parseCoverProfile reads a coverage profile. Blocks listed more than once,
+// as in profiles merged from several runs, are counted once, as covered if
+// any run covered them.
+func parseCoverProfile(filePath string) (*coverProfile, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	type block struct {
+		statements int
+		covered    bool
+	}
+	blocks := make(map[string]map[string]*block)
+
+	profile := &coverProfile{files: make(map[string]*coverageCounts)}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "mode:") {
+			profile.mode = strings.TrimSpace(strings.TrimPrefix(line, "mode:"))
+			continue
+		}
+
+		// file.go:startLine.startCol,endLine.endCol numStatements count
+		fields := strings.Fields(line)
+		colon := -1
+		if len(fields) == 3 {
+			colon = strings.LastIndex(fields[0], ":")
+		}
+		if colon < 0 {
+			return nil, fmt.Errorf("line %d: malformed block %q", lineNum, line)
+		}
+		statements, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: malformed statement count: %v", lineNum, err)
+		}
+		count, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: malformed execution count: %v", lineNum, err)
+		}
+
+		fileName, position := fields[0][:colon], fields[0][colon+1:]
+		if blocks[fileName] == nil {
+			blocks[fileName] = make(map[string]*block)
+		}
+		b, ok := blocks[fileName][position]
+		if !ok {
+			b = &block{statements: statements}
+			blocks[fileName][position] = b
+		}
+		b.covered = b.covered || count > 0
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if profile.mode == "" {
+		return nil, fmt.Errorf("missing mode line, not a coverage profile")
+	}
+
+	for fileName, fileBlocks := range blocks {
+		counts := &coverageCounts{}
+		for _, b := range fileBlocks {
+			counts.statements += b.statements
+			if b.covered {
+				counts.covered += b.statements
+			}
+		}
+		profile.files[fileName] = counts
+	}
+	return profile, nil
+}
+
+// writeCoverage summarizes the statement coverage of the packages from an
+// existing coverage profile. Files of the profile that no longer exist are
+// reported and left out.
+func writeCoverage(syncPath, moduleName, profilePath string, packages []*packageInfo, threshold float64, registry *artifactRegistry, rep *reporter) error {
+	profile, err := parseCoverProfile(profilePath)
+	if err != nil {
+		return err
+	}
+
+	byPackage := make(map[string][]string)
+	for fileName := range profile.files {
+		pkg := path.Dir(fileName)
+		byPackage[pkg] = append(byPackage[pkg], fileName)
+	}
+
+	type fileCoverage struct {
+		name string
+		coverageCounts
+	}
+	var b strings.Builder
+	var total coverageCounts
+	var low []fileCoverage
+	for _, pkg := range packages {
+		fileNames := byPackage[pkg.ImportPath]
+		if len(fileNames) == 0 {
+			continue
+		}
+		sort.Strings(fileNames)
+
+		var pkgCounts coverageCounts
+		var files []fileCoverage
+		for _, fileName := range fileNames {
+			if _, err := os.Stat(filepath.Join(pkg.Dir, path.Base(fileName))); err != nil {
+				rep.warn("coverage profile is stale, %s no longer exists", fileName)
+				continue
+			}
+			counts := *profile.files[fileName]
+			pkgCounts.statements += counts.statements
+			pkgCounts.covered += counts.covered
+
+			relPath := path.Join(relativePackagePath(moduleName, pkg.ImportPath), path.Base(fileName))
+			files = append(files, fileCoverage{relPath, counts})
+			if counts.percent() < threshold {
+				low = append(low, fileCoverage{relPath, counts})
+			}
+		}
+		if len(files) == 0 {
+			continue
+		}
+		total.statements += pkgCounts.statements
+		total.covered += pkgCounts.covered
+
+		fmt.Fprintf(&b, "\n%-50s %6.1f%%  (%d/%d statements)\n", relativePackagePath(moduleName, pkg.ImportPath), pkgCounts.percent(), pkgCounts.covered, pkgCounts.statements)
+		for _, f := range files {
+			fmt.Fprintf(&b, "  %-48s %6.1f%%  (%d/%d)\n", path.Base(f.name), f.percent(), f.covered, f.statements)
+		}
+	}
+
+	var out strings.Builder
+	out.WriteString("Coverage\n")
+	out.WriteString("========\n\n")
+	fmt.Fprintf(&out, "Profile: %s (mode: %s)\n", profilePath, profile.mode)
+	fmt.Fprintf(&out, "Total: %.1f%% of %d statements\n", total.percent(), total.statements)
+	if b.Len() == 0 {
+		out.WriteString("\n(the profile covers none of the packages)\n")
+	}
+	out.WriteString(b.String())
+
+	sort.SliceStable(low, func(i, j int) bool {
+		return low[i].percent() < low[j].percent()
+	})
+	fmt.Fprintf(&out, "\nFiles under %g%%\n", threshold)
+	out.WriteString(strings.Repeat("-", len(fmt.Sprintf("Files under %g%%", threshold))) + "\n")
+	for _, f := range low {
+		fmt.Fprintf(&out, "  %-48s %6.1f%%  (%d/%d)\n", f.name, f.percent(), f.covered, f.statements)
+	}
+	if len(low) == 0 {
+		out.WriteString("  (none)\n")
+	}
+
+	name := projectFileName(coverageFileName)
+	outputPath := filepath.Join(syncPath, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputPath, []byte(out.String()), 0644); err != nil {
+		return err
+	}
+	registry.register(&artifact{Name: name, Kind: kindReport})
+
+	rep.info("Summarized coverage: %.1f%% of %d statements", total.percent(), total.statements)
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// fileDiff is the unified diff of a single file
+type fileDiff struct {
+	path string // path relative to the project, the old path for deletions
+	text string
+}
+
+// verifyRef checks that ref names a commit of the repository at projectPath
+func verifyRef(projectPath, ref string) error {
+	if _, err := gitOutput(projectPath, "rev-parse", "--verify", "--quiet", ref+"^{commit}"); err != nil {
+		return fmt.Errorf("ref %q not found in %s", ref, projectPath)
+	}
+	return nil
+}
+
+// diffPath returns the path of the file a diff section is about: the new
+// path, or the old one if the file was deleted
+func diffPath(section string) string {
+	var oldPath string
+	for _, line := range strings.Split(section, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++ "):
+			if p := diffSide(strings.TrimPrefix(line, "+++ "), "b/"); p != "" {
+				return p
+			}
+		case strings.HasPrefix(line, "--- "):
+			oldPath = diffSide(strings.TrimPrefix(line, "--- "), "a/")
+		case strings.HasPrefix(line, "rename to "):
+			return unquoteDiffPath(strings.TrimPrefix(line, "rename to "))
+		case strings.HasPrefix(line, "@@"):
+			return oldPath
+		}
+	}
+	if oldPath != "" {
+		return oldPath
+	}
+
+	// Binary files and mode changes only have the header
+	header := strings.SplitN(section, "\n", 2)[0]
+	if i := strings.LastIndex(header, ` "b/`); i >= 0 {
+		return diffSide(header[i+1:], "b/")
+	}
+	if i := strings.LastIndex(header, " b/"); i >= 0 {
+		return unquoteDiffPath(header[i+len(" b/"):])
+	}
+	return ""
+}
+
+// diffSide returns the path of a side of a diff, given with its prefix and
+// possibly quoted, or "" for /dev/null
+func diffSide(p, prefix string) string {
+	p = unquoteDiffPath(p)
+	if !strings.HasPrefix(p, prefix) {
+		return ""
+	}
+	return strings.TrimPrefix(p, prefix)
+}
+
+// unquoteDiffPath removes the quotes git puts around unusual paths, and the
+// tab it may append
+func unquoteDiffPath(p string) string {
+	p = strings.TrimRight(p, "\t")
+	if unquoted, err := strconv.Unquote(p); err == nil {
+		return unquoted
+	}
+	return p
+}
+
+// diffSince returns the unified diffs of the files changed since ref,
+// committed or not, with the given number of context lines
+func diffSince(projectPath, ref string, contextLines int) ([]fileDiff, error) {
+	output, err := gitOutput(projectPath, "diff", "--no-color", "--no-ext-diff", "--relative", fmt.Sprintf("-U%d", contextLines), ref, "--")
+	if err != nil {
+		return nil, fmt.Errorf("could not diff against %s: %v", ref, err)
+	}
+	return splitDiff(output), nil
+}
+
+// splitDiff splits the output of git diff into the diffs of the files
+func splitDiff(output string) []fileDiff {
+	var diffs []fileDiff
+	for _, section := range strings.Split("\n"+output, "\ndiff --git ")[1:] {
+		section = "diff --git " + section
+		diffs = append(diffs, fileDiff{path: diffPath(section), text: section + "\n"})
+	}
+	return diffs
+}
+
+// writeDiffs writes the diff of every changed file, labeled with its path and
+// named after it with a .diff extension. Diffs of files in a documented
+// package are attached to the package, so that they are read along with its
+// documentation.
+func writeDiffs(syncPath, moduleName, ref string, diffs []fileDiff, packages []string, registry *artifactRegistry, rep *reporter) {
+	pkgByDir := make(map[string]string)
+	for _, pkg := range packages {
+		pkgByDir[relativePackagePath(moduleName, pkg)] = pkg
+	}
+
+	for _, d := range diffs {
+		if d.path == "" {
+			rep.warn("could not tell the file of a diff against %s", ref)
+			continue
+		}
+
+		name := artifactName(kindDiff, d.path) + ".diff"
+		outputPath := filepath.Join(syncPath, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+			rep.warn("could not write the diff of %s: %v", d.path, err)
+			continue
+		}
+		content := fmt.Sprintf("Changes to %s since %s\n\n%s", d.path, ref, d.text)
+		if err := os.WriteFile(outputPath, []byte(content), 0644); err != nil {
+			rep.warn("could not write the diff of %s: %v", d.path, err)
+			continue
+		}
+		if err := registry.register(&artifact{Name: name, Kind: kindDiff, Package: pkgByDir[path.Dir(d.path)]}); err != nil {
+			rep.warn("could not register the diff of %s: %v", d.path, err)
+		}
+	}
+
+	rep.info("Wrote the diffs of %d files changed since %s", len(diffs), ref)
+}
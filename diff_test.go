@@ -0,0 +1,104 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// capturedDiff is the output of git diff -M over a modified file, a deleted
+// file, a modified binary, new files with a space and with characters git
+// quotes, and pure and edited renames
+var capturedDiff = strings.Join([]string{
+	"diff --git a/a.go b/a.go",
+	"index 2567407..1cebe20 100644",
+	"--- a/a.go",
+	"+++ b/a.go",
+	"@@ -1,3 +1,3 @@",
+	" package a",
+	" ",
+	"-func A() {}",
+	"+func A() { return }",
+	"diff --git a/gone.txt b/gone.txt",
+	"deleted file mode 100644",
+	"index 3367afd..0000000",
+	"--- a/gone.txt",
+	"+++ /dev/null",
+	"@@ -1 +0,0 @@",
+	"-old",
+	"diff --git a/img.png b/img.png",
+	"index f584f40..6bf43ff 100644",
+	"Binary files a/img.png and b/img.png differ",
+	"diff --git a/new file.txt b/new file.txt",
+	"new file mode 100644",
+	"index 0000000..3e75765",
+	"--- /dev/null",
+	"+++ b/new file.txt\t",
+	"@@ -0,0 +1 @@",
+	"+new",
+	"diff --git a/old.go b/new.go",
+	"similarity index 100%",
+	"rename from old.go",
+	"rename to new.go",
+	`diff --git "a/tab\t\303\251.txt" "b/tab\t\303\251.txt"`,
+	"new file mode 100644",
+	"index 0000000..587be6b",
+	"--- /dev/null",
+	`+++ "b/tab\t\303\251.txt"`,
+	"@@ -0,0 +1 @@",
+	"+x",
+	`diff --git a/new.go "b/renamed \303\251.go"`,
+	"similarity index 82%",
+	"rename from new.go",
+	`rename to "renamed \303\251.go"`,
+	"index bcf3b32..57925d7 100644",
+	"--- a/new.go",
+	`+++ "b/renamed \303\251.go"` + "\t",
+	"@@ -2,3 +2,4 @@ rename me",
+	" line2",
+	"+line5",
+}, "\n")
+
+func TestSplitDiff(t *testing.T) {
+	var paths []string
+	for _, d := range splitDiff(capturedDiff) {
+		paths = append(paths, d.path)
+		if !strings.HasPrefix(d.text, "diff --git ") || !strings.HasSuffix(d.text, "\n") {
+			t.Errorf("%s: diff %q", d.path, d.text)
+		}
+	}
+	want := []string{"a.go", "gone.txt", "img.png", "new file.txt", "new.go", "tab\té.txt", "renamed é.go"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("paths %q, want %q", paths, want)
+	}
+	if diffs := splitDiff(""); diffs != nil {
+		t.Errorf("diffs of no changes: %v", diffs)
+	}
+}
+
+func TestDiffPath(t *testing.T) {
+	tests := []struct {
+		name, section, want string
+	}{
+		{"modified", "diff --git a/a.go b/a.go\nindex 1..2 100644\n--- a/a.go\n+++ b/a.go\n@@ -1 +1 @@\n-a\n+b", "a.go"},
+		{"new", "diff --git a/n.go b/n.go\nnew file mode 100644\n--- /dev/null\n+++ b/n.go\n@@ -0,0 +1 @@\n+a", "n.go"},
+		{"deleted", "diff --git a/d.go b/d.go\ndeleted file mode 100644\n--- a/d.go\n+++ /dev/null\n@@ -1 +0,0 @@\n-a", "d.go"},
+		{"renamed", "diff --git a/old.go b/new.go\nsimilarity index 100%\nrename from old.go\nrename to new.go", "new.go"},
+		{"renamed with changes", "diff --git a/old.go b/new.go\nsimilarity index 90%\nrename from old.go\nrename to new.go\n--- a/old.go\n+++ b/new.go\n@@ -1 +1 @@", "new.go"},
+		{"binary", "diff --git a/i.png b/i.png\nindex 1..2 100644\nBinary files a/i.png and b/i.png differ", "i.png"},
+		{"new binary", "diff --git a/n.bin b/n.bin\nnew file mode 100644\nBinary files /dev/null and b/n.bin differ", "n.bin"},
+		{"deleted binary", "diff --git a/i.png b/i.png\ndeleted file mode 100644\nBinary files a/i.png and /dev/null differ", "i.png"},
+		{"mode change", "diff --git a/run.sh b/run.sh\nold mode 100644\nnew mode 100755", "run.sh"},
+		{"space", "diff --git a/my file.txt b/my file.txt\n--- a/my file.txt\t\n+++ b/my file.txt\t\n@@ -1 +1 @@", "my file.txt"},
+		{"quoted", `diff --git "a/tab\tx.txt" "b/tab\tx.txt"` + "\n--- /dev/null\n" + `+++ "b/tab\tx.txt"` + "\n@@ -0,0 +1 @@", "tab\tx.txt"},
+		{"quoted deleted", `diff --git "a/\303\251.txt" "b/\303\251.txt"` + "\ndeleted file mode 100644\n" + `--- "a/\303\251.txt"` + "\n+++ /dev/null\n@@ -1 +0,0 @@", "é.txt"},
+		{"quoted binary", `diff --git "a/\303\251.png" "b/\303\251.png"` + "\nBinary files " + `"a/\303\251.png" and "b/\303\251.png"` + " differ", "é.png"},
+		{"quoted rename", `diff --git a/x.go "b/\303\251.go"` + "\nsimilarity index 100%\nrename from x.go\n" + `rename to "\303\251.go"`, "é.go"},
+		{"unrecognized", "not a diff", ""},
+	}
+	for _, tt := range tests {
+		if got := diffPath(tt.section); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// docCacheFileName is the name of the doc cache inside stateDirName
+const docCacheFileName = "doc_cache.json"
+
+// docCache records the git tree hash of each package directory at the time
+// its documentation file was generated, or the hash of its content when no
+// tree describes its files
+type docCache struct {
+	Trees map[string]string `json:"trees"` // doc key -> tree or content hash
+
+	// pending holds the tree hashes of docs being regenerated, recorded once
+	// the doc file is written
+	pending map[string]string
+}
+
+// docs is the doc cache of the sync directory being written
+var docs = newDocCache()
+
+func newDocCache() *docCache {
+	return &docCache{Trees: make(map[string]string), pending: make(map[string]string)}
+}
+
+// docKey identifies a documentation file in the cache. The file name carries
+// the kind and format, so switching either regenerates the doc, as does
+// documenting the unexported declarations or no longer. The pretty format
+// shares its extension with text and is told apart in the key.
+func docKey(pkg, docFile string, unexported bool) string {
+	key := pkg + " " + filepath.Base(docFile)
+	if unexported {
+		key += " -u"
+	}
+	if docFormat == docFormatPretty {
+		key += " " + docFormatPretty
+	}
+	return key
+}
+
+// loadDocCache reads the doc cache of a sync directory, starting empty if
+// there is none
+func loadDocCache(outputPath string) *docCache {
+	c := newDocCache()
+	data, err := os.ReadFile(filepath.Join(outputPath, stateDirName, docCacheFileName))
+	if err != nil {
+		return c
+	}
+	if err := json.Unmarshal(data, c); err != nil || c.Trees == nil {
+		return newDocCache()
+	}
+	return c
+}
+
+// save writes the doc cache to a sync directory
+func (c *docCache) save(outputPath string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	stateDir := filepath.Join(outputPath, stateDirName)
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(stateDir, docCacheFileName), append(data, '\n'), 0644)
+}
+
+// upToDate reports whether the doc was generated from the given tree. If not,
+// the tree is remembered until the doc is written.
+func (c *docCache) upToDate(key, tree string) bool {
+	if c.Trees[key] == tree {
+		return true
+	}
+	c.pending[key] = tree
+	return false
+}
+
+// forget drops the cached tree of a doc, e.g. when its file is missing
+func (c *docCache) forget(key string) {
+	delete(c.Trees, key)
+	delete(c.pending, key)
+}
+
+// written records the tree a regenerated doc was generated from
+func (c *docCache) written(key string) {
+	if tree, ok := c.pending[key]; ok {
+		c.Trees[key] = tree
+		delete(c.pending, key)
+	}
+}
+
+// newestModTime returns the latest modification time of the files directly
+// inside dir
+func newestModTime(dir string) (time.Time, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var newest time.Time
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+	}
+	return newest, nil
+}
+
+// contentHash returns the hash of the paths and contents of the files inside
+// dir and its subdirectories, the files a tree hash covers, prefixed so that
+// it never equals a tree hash. In a git repository these are the files git
+// lists, tracked or not but not ignored; otherwise the tree is walked but for
+// its noise directories. The files of the sync directory at syncPath, when
+// inside dir, are left out either way.
+func contentHash(dir, syncPath string, isGitRepo bool) (string, error) {
+	var files []string
+	listed := false
+	if isGitRepo {
+		if output, err := runGit(dir, "ls-files", "--cached", "--others", "--exclude-standard", "-z", "--", "."); err == nil {
+			listed = true
+			for _, entry := range strings.Split(string(output), "\x00") {
+				if entry != "" {
+					files = append(files, filepath.Join(dir, filepath.FromSlash(entry)))
+				}
+			}
+		}
+	}
+	if !listed {
+		err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() {
+				if path != dir && (noiseDirs[entry.Name()] || path == syncPath) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			files = append(files, path)
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	h := sha256.New()
+	for _, path := range files {
+		if syncPath != "" && strings.HasPrefix(path, syncPath+string(os.PathSeparator)) {
+			continue
+		}
+		// Deleted files are still listed, submodules and nested
+		// repositories are listed as directories, their files aren't part
+		// of the tree
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) || err == nil && info.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return "", err
+		}
+		h.Write([]byte(filepath.ToSlash(rel) + "\x00"))
+		h.Write(data)
+		h.Write([]byte{0})
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The content hash covers the files of the subdirectories, like the tree
+// hash it stands in for
+func TestContentHashCoversSubdirectories(t *testing.T) {
+	root := writeFixture(t, map[string]string{
+		"pkg.go":             "package pkg\n",
+		"internal/helper.go": "package internal\n",
+		"assets/input.txt":   "input\n",
+	})
+	before, err := contentHash(root, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "assets", "input.txt"), []byte("changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	after, err := contentHash(root, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after == before {
+		t.Error("hash unchanged after a file of a subdirectory changed")
+	}
+
+	// Moving a file to another directory changes the hash too
+	if err := os.Rename(filepath.Join(root, "internal", "helper.go"), filepath.Join(root, "helper.go")); err != nil {
+		t.Fatal(err)
+	}
+	moved, err := contentHash(root, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved == after {
+		t.Error("hash unchanged after a file moved out of a subdirectory")
+	}
+}
+
+// Outside git, the noise directories and the sync directory are left out of
+// the hash
+func TestContentHashSkipsNoiseAndSyncDirectory(t *testing.T) {
+	root := writeFixture(t, map[string]string{
+		"pkg.go":                     "package pkg\n",
+		"node_modules/dep/index.js":  "module.exports = 1\n",
+		"testdata/input.txt":         "input\n",
+		".context/doc_pkg.txt":       "package pkg\n",
+		".context/.state/cache.json": "{}\n",
+	})
+	syncPath := filepath.Join(root, ".context")
+	before, err := contentHash(root, syncPath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"node_modules/dep/index.js", "testdata/input.txt", ".context/doc_pkg.txt", ".context/manifest.json"} {
+		if err := os.WriteFile(filepath.Join(root, filepath.FromSlash(name)), []byte("changed\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	after, err := contentHash(root, syncPath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after != before {
+		t.Error("hash changed after writing to noise directories and the sync directory")
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "pkg.go"), []byte("package pkg // changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := contentHash(root, syncPath, false); err != nil || changed == after {
+		t.Errorf("hash unchanged after the package changed (%v)", err)
+	}
+}
+
+// In git, only the files git lists are hashed: ignored build output and
+// dependencies aren't read
+func TestContentHashHashesGitListing(t *testing.T) {
+	root := writeFixture(t, map[string]string{
+		"pkg.go":            "package pkg\n",
+		"gen/types.go":      "package gen\n",
+		"bin/pkg":           "\x7fELF",
+		"node_modules/a.js": "1\n",
+		"out/doc_pkg.txt":   "package pkg\n",
+	})
+	var args []string
+	savedRunGit := runGit
+	runGit = func(dir string, gitArgs ...string) ([]byte, error) {
+		if dir != root {
+			return nil, fmt.Errorf("git run in %s", dir)
+		}
+		args = gitArgs
+		// Deleted files and nested repositories are listed too
+		return []byte("deleted.go\x00gen/types.go\x00out/doc_pkg.txt\x00pkg.go\x00nested/\x00"), nil
+	}
+	t.Cleanup(func() { runGit = savedRunGit })
+
+	syncPath := filepath.Join(root, "out")
+	before, err := contentHash(root, syncPath, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(args, " "); got != "ls-files --cached --others --exclude-standard -z -- ." {
+		t.Errorf("git %s", got)
+	}
+
+	for _, name := range []string{"bin/pkg", "node_modules/a.js", "out/doc_pkg.txt"} {
+		if err := os.WriteFile(filepath.Join(root, filepath.FromSlash(name)), []byte("changed\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if after, err := contentHash(root, syncPath, true); err != nil || after != before {
+		t.Errorf("hash changed after writing to files git doesn't list (%v)", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "gen", "types.go"), []byte("package gen // changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := contentHash(root, syncPath, true); err != nil || changed == before {
+		t.Errorf("hash unchanged after a listed file changed (%v)", err)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Placeholders of the templates of -doc-command
+const (
+	docCommandFile = "{file}" // the project-relative path of the file
+	docCommandOut  = "{out}"  // a directory for the command to write into
+)
+
+// docCommands is a flag value mapping file extensions to the command
+// documenting files with that extension, given as .ext=command. Commands
+// aren't split on commas, which they often contain.
+type docCommands map[string]string
+
+func (c docCommands) String() string {
+	var entries []string
+	for ext, command := range c {
+		entries = append(entries, ext+"="+command)
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ";")
+}
+
+func (c docCommands) Set(value string) error {
+	idx := strings.Index(value, "=")
+	if idx < 0 {
+		return fmt.Errorf("invalid doc command %q, expected .ext=command", value)
+	}
+	ext, command := strings.ToLower(strings.TrimSpace(value[:idx])), strings.TrimSpace(value[idx+1:])
+	if !strings.HasPrefix(ext, ".") || len(ext) == 1 || command == "" {
+		return fmt.Errorf("invalid doc command %q, expected .ext=command", value)
+	}
+	if _, ok := c[ext]; ok {
+		return fmt.Errorf("doc command for %s given twice", ext)
+	}
+	c[ext] = command
+	return nil
+}
+
+// shellQuote quotes s as a single word for sh
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// documentWithCommand runs the command documenting a file from the project
+// directory. The file's path replaces {file}, or is appended if the template
+// doesn't use it. The documentation is what the command writes into {out}
+// when the template uses it, its standard output otherwise.
+func documentWithCommand(template, projectPath, relPath string) ([]byte, error) {
+	command := template
+	if strings.Contains(command, docCommandFile) {
+		command = strings.Replace(command, docCommandFile, shellQuote(relPath), -1)
+	} else {
+		command += " " + shellQuote(relPath)
+	}
+
+	var outDir string
+	if strings.Contains(command, docCommandOut) {
+		dir, err := os.MkdirTemp("", "gocontext-doc-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+		outDir = dir
+		command = strings.Replace(command, docCommandOut, shellQuote(outDir), -1)
+	}
+
+	cmd := exec.CommandContext(runCtx, "sh", "-c", command)
+	cmd.Dir = projectPath
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, commandError(err)
+	}
+	if outDir == "" {
+		return output, nil
+	}
+
+	// The files the command wrote, in name order
+	var doc []byte
+	err = filepath.Walk(outDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		doc = append(doc, data...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(doc) == 0 {
+		return nil, fmt.Errorf("nothing written to %s", docCommandOut)
+	}
+	return doc, nil
+}
+
+// writeCommandDocs documents the linked files of the project with the
+// command given for their extension, named after each file with a .doc.txt
+// extension so that they sit alongside it when grouping by directory. A file
+// whose command fails is skipped with a warning, and one written by the
+// resumed sync, if any, is kept.
+func writeCommandDocs(projectPath, syncPath string, commands docCommands, resumed *resumeState, registry *artifactRegistry, rep *reporter) {
+	type docJob struct {
+		relPath, template, name, outputPath string
+	}
+	var todo []docJob
+	for _, a := range registry.artifacts {
+		if !isLinkedKind(a.Kind) || a.Kind == kindSourceDir || a.Source == "" {
+			continue
+		}
+		template, ok := commands[strings.ToLower(filepath.Ext(a.Source))]
+		if !ok {
+			continue
+		}
+		relPath, err := filepath.Rel(projectPath, a.Source)
+		if err != nil || strings.HasPrefix(relPath, "..") {
+			continue
+		}
+		name := artifactName(kindFileDoc, relPath) + ".doc.txt"
+		todo = append(todo, docJob{relPath, template, name, filepath.Join(syncPath, filepath.FromSlash(name))})
+	}
+
+	// The commands run concurrently, their results are registered in order
+	errs := make([]error, len(todo))
+	done := make([]bool, len(todo))
+	forEach(len(todo), func(i int) {
+		job := todo[i]
+		if resumed.done(job.outputPath) {
+			done[i] = true
+			return
+		}
+		if runCtx.Err() != nil {
+			return
+		}
+		doc, err := documentWithCommand(job.template, projectPath, job.relPath)
+		if err == nil {
+			err = os.MkdirAll(filepath.Dir(job.outputPath), 0755)
+		}
+		if err == nil {
+			err = writeFileAtomic(job.outputPath, doc)
+		}
+		errs[i], done[i] = err, err == nil
+	})
+
+	written, skipped := 0, 0
+	for i, job := range todo {
+		if errs[i] != nil && runCtx.Err() == nil {
+			rep.warn("could not document %s with %q: %v", filepath.ToSlash(job.relPath), job.template, errs[i])
+		}
+		if !done[i] {
+			if errs[i] == nil {
+				skipped++
+			}
+			continue
+		}
+		if err := registry.register(&artifact{Name: job.name, Kind: kindFileDoc}); err != nil {
+			rep.warn("could not register the doc of %s: %v", filepath.ToSlash(job.relPath), err)
+			continue
+		}
+		written++
+	}
+	if runCtx.Err() != nil && skipped > 0 {
+		rep.warn("%s, skipped the doc commands of %d of %d files", stopReason(), skipped, len(todo))
+	}
+	if len(todo) > 0 {
+		rep.info("Documented %d of %d files with doc commands", written, len(todo))
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Outcomes of a doctor check
+const (
+	checkPass = "PASS"
+	checkWarn = "WARN"
+	checkFail = "FAIL"
+)
+
+// doctorReport prints the outcome of the doctor checks as they run and
+// remembers whether any failed
+type doctorReport struct {
+	failed bool
+}
+
+func (r *doctorReport) add(status, name, detail string) {
+	if status == checkFail {
+		r.failed = true
+	}
+	fmt.Printf("[%s] %-20s %s\n", status, name, detail)
+}
+
+// toolVersion returns the path of a binary and the first line of its version
+// output, or an error if it isn't on PATH. versionArgs may be nil for tools
+// without a version flag.
+func toolVersion(name string, versionArgs ...string) (string, string, error) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", "", err
+	}
+	if versionArgs == nil {
+		return path, "", nil
+	}
+	output, err := exec.Command(path, versionArgs...).CombinedOutput()
+	if err != nil {
+		return path, "", nil
+	}
+	version := strings.TrimSpace(string(output))
+	if i := strings.IndexByte(version, '\n'); i >= 0 {
+		version = version[:i]
+	}
+	return path, version, nil
+}
+
+// checkTool reports whether a binary is available, failing the report if it
+// is required
+func (r *doctorReport) checkTool(name, purpose string, required bool, versionArgs ...string) {
+	path, version, err := toolVersion(name, versionArgs...)
+	if err != nil {
+		status := checkWarn
+		if required {
+			status = checkFail
+		}
+		r.add(status, name, fmt.Sprintf("not found on PATH (%s)", purpose))
+		return
+	}
+	if version == "" {
+		version = path
+	}
+	r.add(checkPass, name, version)
+}
+
+// nearestExistingDir returns dir or its closest ancestor that exists
+func nearestExistingDir(dir string) string {
+	for {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+// checkOutputLocation checks that the default output location is writable and
+// supports symlinks, in a temporary directory that is removed afterwards
+func (r *doctorReport) checkOutputLocation() {
+	home, source, err := contextHome()
+	if err != nil {
+		r.add(checkFail, "output location", err.Error())
+		return
+	}
+
+	dir := nearestExistingDir(home)
+	tmp, err := os.MkdirTemp(dir, ".gocontext-doctor-")
+	if err != nil {
+		r.add(checkFail, "output location", fmt.Sprintf("%s (from %s) is not writable: %v", home, source, err))
+		return
+	}
+	defer os.RemoveAll(tmp)
+	r.add(checkPass, "output location", fmt.Sprintf("%s (from %s) is writable", home, source))
+
+	target := filepath.Join(tmp, "target")
+	if err := os.WriteFile(target, []byte("gocontext"), 0644); err != nil {
+		r.add(checkFail, "symlinks", fmt.Sprintf("could not write a test file: %v", err))
+		return
+	}
+	link := filepath.Join(tmp, "link")
+	if err := os.Symlink(target, link); err != nil {
+		r.add(checkWarn, "symlinks", fmt.Sprintf("not supported in %s, use -copy: %v", dir, err))
+		return
+	}
+	if data, err := os.ReadFile(link); err != nil || string(data) != "gocontext" {
+		r.add(checkWarn, "symlinks", fmt.Sprintf("links in %s don't resolve, use -copy", dir))
+		return
+	}
+	r.add(checkPass, "symlinks", "supported")
+}
+
+// runDoctorCommand checks the environment gocontext runs in: the tools it
+// calls, the project and the output location. It fails if a required tool is
+// missing or the output location isn't writable.
+func runDoctorCommand(args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	projectPath := fs.String("project", "", "Path to the Go project (default: current directory)")
+	fs.Parse(args)
+
+	r := &doctorReport{}
+
+	absProjectPath, projectErr := resolveProject(*projectPath)
+	isGitRepo := projectErr == nil && isGitRepository(absProjectPath)
+
+	r.checkTool("go", "required to discover packages and extract documentation", true, "version")
+	r.checkTool("tree", "required to generate directory_structure.txt", true, "--version")
+	if isGitRepo {
+		r.checkTool("git", "required for .gitignore handling in git repositories", true, "--version")
+	} else {
+		r.checkTool("git", "used for .gitignore handling in git repositories", false, "--version")
+	}
+	r.checkTool("hg", "used for the ignore rules of Mercurial repositories", false, "--version")
+	r.checkTool("rsync", "used by -remote, which falls back to scp", false, "--version")
+	r.checkTool("scp", "used by -remote without rsync", false)
+
+	var clipboard []string
+	for _, command := range clipboardCommands() {
+		clipboard = append(clipboard, command[0])
+		if _, err := exec.LookPath(command[0]); err == nil {
+			clipboard = nil
+			r.add(checkPass, "clipboard", command[0])
+			break
+		}
+	}
+	if clipboard != nil {
+		r.add(checkWarn, "clipboard", fmt.Sprintf("no utility found for -clipboard (tried %s)", strings.Join(clipboard, ", ")))
+	}
+
+	if projectErr != nil {
+		r.add(checkWarn, "go project", projectErr.Error())
+	} else {
+		detail := absProjectPath
+		if moduleName, err := resolveModuleName(absProjectPath); err == nil && moduleName != "" {
+			detail = fmt.Sprintf("%s (%s)", absProjectPath, moduleName)
+		}
+		if isGitRepo {
+			detail += ", git repository"
+		}
+		r.add(checkPass, "go project", detail)
+	}
+
+	r.checkOutputLocation()
+
+	if r.failed {
+		fmt.Println("Some required checks failed")
+		return 1
+	}
+	fmt.Println("All required checks passed")
+	return 0
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"path/filepath"
+)
+
+// linkEmbedFiles links the files matched by the //go:embed directives of the
+// packages. The patterns, including globs and directories, are resolved by
+// go list relative to the package directory.
+func linkEmbedFiles(packages []*packageInfo, projectPath, syncPath string, opts *options, registry *artifactRegistry, rep *reporter) {
+	for _, pkg := range packages {
+		var files []string
+		files = append(files, pkg.EmbedFiles...)
+		files = append(files, pkg.TestEmbedFiles...)
+		files = append(files, pkg.XTestEmbedFiles...)
+
+		if len(pkg.EmbedPatterns) > 0 && len(files) == 0 {
+			rep.warn("go:embed patterns of %s matched no files", pkg.ImportPath)
+			continue
+		}
+
+		for _, file := range files {
+			if err := linkProjectFile(filepath.Join(pkg.Dir, file), projectPath, syncPath, kindEmbed, opts, registry, rep); err != nil {
+				rep.warn("could not link embedded file %s of %s: %v", file, pkg.ImportPath, err)
+			}
+		}
+	}
+}
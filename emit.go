@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// emitter writes one output of a run. Every output comes from the same sync,
+// so packages are discovered and documented once however many are asked for.
+type emitter interface {
+	// emit writes the output of the finished sync
+	emit(s *emission) error
+
+	// target is where the output goes, for the messages of the run
+	target() string
+}
+
+// emission is a finished sync as handed to the emitters. The single-file
+// outputs are fed from the same entry list, resolved and read once.
+type emission struct {
+	syncPath string
+	registry *artifactRegistry
+	results  []*syncResult
+	meta     repomixMetadata
+	regions  fileRegions
+	redact   *redactor
+	cond     *condenser
+	rep      *reporter
+
+	// summarize describes the run, for the outputs embedding its summary
+	summarize func() runSummary
+
+	resolved []contextEntry
+	loaded   []contextEntry
+}
+
+// entries returns the files of the single-file outputs in reading order,
+// without their content
+func (s *emission) entries() []contextEntry {
+	if s.resolved == nil {
+		s.resolved = resolveEntries(s.syncPath, s.registry, s.results)
+	}
+	return s.resolved
+}
+
+// read returns the content of an entry as written to the single-file
+// outputs: sliced to its regions, redacted and condensed. Binary and
+// unreadable files are reported and skipped.
+func (s *emission) read(e contextEntry) ([]byte, bool) {
+	content, err := os.ReadFile(e.source)
+	if err != nil || (len(content) > 0 && !isTextSample(content, false)) {
+		s.rep.warn("skipped binary or unreadable file %s", e.path)
+		return nil, false
+	}
+	content = s.redact.content(e.artifact, s.regions.content(e.artifact, content))
+	if s.cond != nil {
+		content = s.cond.apply(e.path, content)
+	}
+	return content, true
+}
+
+// contents returns the entries with their content, read once for all the
+// emitters
+func (s *emission) contents() []contextEntry {
+	if s.loaded == nil {
+		s.loaded = []contextEntry{}
+		for _, e := range s.entries() {
+			if content, ok := s.read(e); ok {
+				e.content = content
+				s.loaded = append(s.loaded, e)
+			}
+		}
+	}
+	return s.loaded
+}
+
+// structure returns the directory structure of the synced projects
+func (s *emission) structure() string {
+	return directoryStructure(s.syncPath, s.registry)
+}
+
+// dirEmitter is the sync directory of -format=dir. Its files are linked, or
+// copied with -copy, as they're registered during the sync, since pruning and
+// -resume work on the directory in place; emitting it saves the doc cache the
+// next sync compares the packages with.
+type dirEmitter struct {
+	path string
+}
+
+func (d *dirEmitter) emit(s *emission) error {
+	if err := docs.save(d.path); err != nil {
+		s.rep.warn("could not save the doc cache: %v", err)
+	}
+	return nil
+}
+
+func (d *dirEmitter) target() string {
+	return d.path
+}
+
+// fileEmitter renders the context as a single file in the layout of a
+// single-file format, written to path or, if set, to out. With clipboard, the
+// file is copied to the system clipboard as well.
+type fileEmitter struct {
+	format         string
+	path           string
+	out            io.Writer
+	clipboard      bool
+	maxMessageSize int
+}
+
+func (f *fileEmitter) emit(s *emission) error {
+	var output []byte
+	if f.format == formatChatML {
+		var err error
+		if output, err = renderChatML(s.meta, s.structure(), s.contents(), f.maxMessageSize); err != nil {
+			return err
+		}
+	} else {
+		output = renderRepomix(s.meta, s.structure(), s.contents())
+	}
+
+	if f.out != nil {
+		if _, err := f.out.Write(output); err != nil {
+			return err
+		}
+	} else {
+		if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+			return err
+		}
+		if err := writeFileAtomic(f.path, output); err != nil {
+			return err
+		}
+	}
+
+	if f.clipboard {
+		if err := copyToClipboard(output); err != nil {
+			return fmt.Errorf("could not copy to the clipboard: %v", err)
+		}
+		fmt.Printf("Context copied to clipboard (%d bytes)\n", len(output))
+	}
+	return nil
+}
+
+func (f *fileEmitter) target() string {
+	if f.out != nil {
+		return "stdout"
+	}
+	return f.path
+}
+
+// jsonEmitter writes the context as a single JSON object to out, see
+// writeJSONContext
+type jsonEmitter struct {
+	out io.Writer
+}
+
+func (j *jsonEmitter) emit(s *emission) error {
+	return writeJSONContext(j.out, s)
+}
+
+func (j *jsonEmitter) target() string {
+	return "stdout"
+}
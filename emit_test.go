@@ -0,0 +1,163 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testEmission is the emission of a sync of a project with a package doc in
+// the sync directory and two linked files
+func testEmission(t *testing.T) *emission {
+	t.Helper()
+	projectPath := writeFixture(t, map[string]string{
+		"a/a.go":      "// Copyright 2024 The Authors\n\npackage a  \n",
+		"a/README.md": "# a\n",
+	})
+	syncPath := writeFixture(t, map[string]string{
+		"doc_a.txt": "package a\n",
+		"image.png": "\x89PNG\x00\x00",
+	})
+
+	registry := newArtifactRegistry()
+	registry.register(&artifact{Name: "doc_a.txt", Kind: kindDoc, Package: "example.com/a"})
+	registry.register(&artifact{Name: "src_a_a.go", Kind: kindSource, Source: filepath.Join(projectPath, "a", "a.go")})
+	registry.register(&artifact{Name: "readme_a.md", Kind: kindReadme, Source: filepath.Join(projectPath, "a", "README.md")})
+	registry.register(&artifact{Name: "image.png", Kind: kindAsset})
+
+	cond, err := newCondenser("", heuristicTokenizer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &emission{
+		syncPath: syncPath,
+		registry: registry,
+		results: []*syncResult{{
+			project:  &project{path: projectPath, moduleName: "example.com"},
+			packages: []*packageInfo{{ImportPath: "example.com/a", Dir: filepath.Join(projectPath, "a")}},
+			order:    &packageOrder{packages: []string{"example.com/a"}},
+		}},
+		meta: repomixMetadata{module: "example.com", generatedAt: time.Unix(0, 0).UTC()},
+		cond: cond,
+		rep:  newReporter(io.Discard, false),
+	}
+}
+
+// The single-file outputs are fed from the same entries, read and condensed
+// once
+func TestEmissionReadsEntriesOnce(t *testing.T) {
+	s := testEmission(t)
+	archive := filepath.Join(t.TempDir(), "context.zip")
+	for _, e := range []emitter{&fileEmitter{format: formatRepomix, path: filepath.Join(t.TempDir(), "bundle.xml")}, &archiveEmitter{path: archive}} {
+		if err := e.emit(s); err != nil {
+			t.Fatalf("writing %s: %v", e.target(), err)
+		}
+	}
+
+	var paths []string
+	for _, e := range s.contents() {
+		paths = append(paths, e.path)
+	}
+	if want := []string{"doc_a.txt", "a/README.md", "a/a.go"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("entries %v, want %v", paths, want)
+	}
+	if s.cond.files != 3 {
+		t.Errorf("condensed %d files, want each of the 3 text files once", s.cond.files)
+	}
+}
+
+func TestWriteArchive(t *testing.T) {
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	entries := []contextEntry{
+		{path: "directory_structure.txt", content: []byte(".\n└── a\n")},
+		{path: "a/a.go", content: []byte("package a\n")},
+		{path: "empty.txt"},
+	}
+	want := map[string]string{
+		"directory_structure.txt": ".\n└── a\n",
+		"a/a.go":                  "package a\n",
+		"empty.txt":               "",
+	}
+
+	t.Run("zip", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := writeArchive(&buf, true, modTime, entries); err != nil {
+			t.Fatal(err)
+		}
+		zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[string]string)
+		for _, f := range zr.File {
+			r, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := io.ReadAll(r)
+			r.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got[f.Name] = string(data)
+			if !f.Modified.Equal(modTime) {
+				t.Errorf("%s modified %v, want %v", f.Name, f.Modified, modTime)
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("files %q, want %q", got, want)
+		}
+	})
+
+	t.Run("tar.gz", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := writeArchive(&buf, false, modTime, entries); err != nil {
+			t.Fatal(err)
+		}
+		gr, err := gzip.NewReader(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tr := tar.NewReader(gr)
+		got := make(map[string]string)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got[header.Name] = string(data)
+			if !header.ModTime.Equal(modTime) || header.Mode != 0644 {
+				t.Errorf("%s mode %o modified %v", header.Name, header.Mode, header.ModTime)
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("files %q, want %q", got, want)
+		}
+	})
+}
+
+func TestValidateArchivePath(t *testing.T) {
+	for _, name := range []string{"ctx.tar.gz", "ctx.TGZ", "out/ctx.zip"} {
+		if err := validateArchivePath(name); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	for _, name := range []string{"ctx.tar", "ctx.rar", "ctx"} {
+		if err := validateArchivePath(name); err == nil {
+			t.Errorf("%s accepted", name)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// entrypoint is a main package defining a main function
+type entrypoint struct {
+	Package string `json:"package"`
+	Dir     string `json:"dir"`
+	File    string `json:"file"`
+	Project string `json:"project,omitempty"`
+}
+
+// detectEntrypoints finds the packages named main among the loaded packages
+// and checks their files for a main function
+func detectEntrypoints(projectPath string, packages []*packageInfo) []entrypoint {
+	var entrypoints []entrypoint
+	for _, pkg := range packages {
+		if pkg.Name != "main" {
+			continue
+		}
+
+		for _, file := range pkg.GoFiles {
+			if !definesMain(filepath.Join(pkg.Dir, file)) {
+				continue
+			}
+
+			relDir, err := filepath.Rel(projectPath, pkg.Dir)
+			if err != nil {
+				relDir = pkg.Dir
+			}
+			entrypoints = append(entrypoints, entrypoint{
+				Package: pkg.ImportPath,
+				Dir:     filepath.ToSlash(relDir),
+				File:    file,
+			})
+			break
+		}
+	}
+
+	return entrypoints
+}
+
+// definesMain reports whether a Go file declares a top-level main function
+func definesMain(path string) bool {
+	file, err := parser.ParseFile(token.NewFileSet(), path, nil, 0)
+	if err != nil {
+		return false
+	}
+
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && fn.Name.Name == "main" {
+			return true
+		}
+	}
+	return false
+}
+
+// entrypointsFileName is the name of the map of the binaries of the module
+const entrypointsFileName = "entrypoints.txt"
+
+// mainPackage is a main package of the module and the binary it builds
+type mainPackage struct {
+	importPath string
+	relDir     string
+	binary     string
+	target     string
+	synopsis   string
+	references []string
+}
+
+// listMainPackages lists every main package of the project with a single go
+// list call, whatever the include and exclude rules select
+func listMainPackages(projectPath string) ([]*mainPackage, error) {
+	format := "{{if eq .Name \"main\"}}{{.ImportPath}}\t{{.Dir}}\t{{.Target}}\t{{.Doc}}{{end}}"
+	output, err := runGoWithRetry([]string{"list", "-e", "-f", format, "./..."}, projectPath, goAttempts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the main packages: %v", commandError(err))
+	}
+
+	var mains []*mainPackage
+	// Lines aren't trimmed, the target and doc may be empty
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.SplitN(strings.TrimRight(line, "\r"), "\t", 4)
+		if len(fields) < 4 {
+			continue
+		}
+		relDir, err := filepath.Rel(projectPath, fields[1])
+		if err != nil {
+			relDir = fields[1]
+		}
+		m := &mainPackage{importPath: fields[0], relDir: filepath.ToSlash(relDir), target: fields[2], synopsis: fields[3]}
+
+		// The binary is named after the package directory unless go knows better
+		m.binary = filepath.Base(fields[1])
+		if m.target != "" {
+			m.binary = strings.TrimSuffix(filepath.Base(m.target), ".exe")
+		}
+		mains = append(mains, m)
+	}
+	return mains, nil
+}
+
+// makeTarget matches the rule lines of a makefile, capturing the first target
+var makeTarget = regexp.MustCompile(`^([^\s#:=][^:=\s]*)[^:=]*::?([^=]|$)`)
+
+// isMakefile reports whether a build file is a makefile, whose references
+// are reported by target rather than by line
+func isMakefile(name string) bool {
+	base := strings.ToLower(filepath.Base(name))
+	return base == "makefile" || base == "gnumakefile" || strings.HasSuffix(base, ".mk")
+}
+
+// findBuildReferences records which targets of the makefiles and which lines
+// of the other build files build or run each main package, by its directory
+// or by the binary name given to -o
+func findBuildReferences(projectPath string, mains []*mainPackage, globs []string) {
+	patterns := make([]*regexp.Regexp, len(mains))
+	for i, m := range mains {
+		var alternatives []string
+		if m.relDir != "." {
+			alternatives = append(alternatives, `(^|[\s"'=])(\./)?`+regexp.QuoteMeta(m.relDir)+`($|[\s"'/])`)
+		}
+		alternatives = append(alternatives, `-o\s+\S*\b`+regexp.QuoteMeta(m.binary)+`($|[\s"'])`)
+		patterns[i] = regexp.MustCompile(strings.Join(alternatives, "|"))
+	}
+
+	for _, file := range findBuildFiles(projectPath, globs) {
+		content, err := os.ReadFile(file)
+		if err != nil || !isTextSample(content, false) {
+			continue
+		}
+		relPath, err := filepath.Rel(projectPath, file)
+		if err != nil {
+			relPath = file
+		}
+		relPath = filepath.ToSlash(relPath)
+		makefile := isMakefile(file)
+
+		target := ""
+		for n, line := range strings.Split(string(content), "\n") {
+			if makefile && !strings.HasPrefix(line, "\t") {
+				if match := makeTarget.FindStringSubmatch(line); match != nil {
+					target = match[1]
+				}
+			}
+			for i, m := range mains {
+				if !patterns[i].MatchString(line) {
+					continue
+				}
+				ref := fmt.Sprintf("%s line %d", relPath, n+1)
+				if makefile && target != "" {
+					ref = fmt.Sprintf("%s target %s", relPath, target)
+				}
+				if len(m.references) == 0 || m.references[len(m.references)-1] != ref {
+					m.references = append(m.references, ref)
+				}
+			}
+		}
+	}
+}
+
+// writeEntrypoints writes the map of the binaries of the module: every main
+// package with its directory, binary, package synopsis and the build files
+// referencing it
+func writeEntrypoints(projectPath, syncPath string, buildGlobs []string, registry *artifactRegistry, rep *reporter) error {
+	mains, err := listMainPackages(projectPath)
+	if err != nil {
+		return err
+	}
+	findBuildReferences(projectPath, mains, buildGlobs)
+
+	var b strings.Builder
+	b.WriteString("Entrypoints\n")
+	b.WriteString("===========\n\n")
+	b.WriteString("Every main package of the module, whatever -include and -exclude select.\n")
+	for _, m := range mains {
+		fmt.Fprintf(&b, "\n%s\n", m.relDir)
+		fmt.Fprintf(&b, "    import path: %s\n", m.importPath)
+		if m.target != "" {
+			fmt.Fprintf(&b, "    binary: %s (go install: %s)\n", m.binary, m.target)
+		} else {
+			fmt.Fprintf(&b, "    binary: %s\n", m.binary)
+		}
+		if m.synopsis != "" {
+			fmt.Fprintf(&b, "    %s\n", m.synopsis)
+		}
+		if len(m.references) > 0 {
+			fmt.Fprintf(&b, "    referenced by: %s\n", strings.Join(m.references, ", "))
+		}
+	}
+	if len(mains) == 0 {
+		b.WriteString("\n(no main package)\n")
+	}
+
+	name := projectFileName(entrypointsFileName)
+	outputPath := filepath.Join(syncPath, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputPath, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	registry.register(&artifact{Name: name, Kind: kindReport})
+
+	rep.info("Listed %d main packages", len(mains))
+
+	return nil
+}
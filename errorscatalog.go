@@ -0,0 +1,315 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// errorsCatalogFileName is the name of the catalog of the errors of the module
+const errorsCatalogFileName = "errors_catalog.txt"
+
+// errorType is the predeclared error type, errorInterface its interface
+var (
+	errorType      = types.Universe.Lookup("error").Type()
+	errorInterface = errorType.Underlying().(*types.Interface)
+)
+
+// isErrorVar reports whether obj is a package-level variable of type error
+func isErrorVar(obj types.Object) bool {
+	v, ok := obj.(*types.Var)
+	return ok && v.Pkg() != nil && v.Parent() == v.Pkg().Scope() && types.Identical(v.Type(), errorType)
+}
+
+// isConcreteError reports whether t is a concrete type implementing error,
+// as opposed to the error interface itself
+func isConcreteError(t types.Type) bool {
+	return !types.IsInterface(t) && types.Implements(t, errorInterface)
+}
+
+// packageCall returns the package path and function name of a call to a
+// function of another package, such as errors.New
+func packageCall(info *types.Info, call *ast.CallExpr) (string, string) {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return "", ""
+	}
+	x, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return "", ""
+	}
+	pkgName, ok := info.Uses[x].(*types.PkgName)
+	if !ok {
+		return "", ""
+	}
+	return pkgName.Imported().Path(), sel.Sel.Name
+}
+
+// errorCatalog is what a package declares about its errors
+type errorCatalog struct {
+	types     []string // error types, with their receiver and position
+	sentinels []string // sentinel errors with their message
+	funcs     []string // signatures of functions returning concrete error types
+	wrapping  []string // functions wrapping known errors with %w
+}
+
+// wrappedErrors returns the statically known errors a call to fmt.Errorf
+// wraps with %w: sentinels, errors.New calls and values of error types
+func wrappedErrors(c *checkedPackage, call *ast.CallExpr) []string {
+	if path, name := packageCall(c.info, call); path != "fmt" || name != "Errorf" || len(call.Args) < 2 {
+		return nil
+	}
+	format, ok := call.Args[0].(*ast.BasicLit)
+	if !ok || format.Kind != token.STRING || !strings.Contains(format.Value, "%w") {
+		return nil
+	}
+
+	var wrapped []string
+	for _, arg := range call.Args[1:] {
+		for {
+			paren, ok := arg.(*ast.ParenExpr)
+			if !ok {
+				break
+			}
+			arg = paren.X
+		}
+		if unary, ok := arg.(*ast.UnaryExpr); ok && unary.Op == token.AND {
+			arg = unary.X
+		}
+
+		ident, _ := arg.(*ast.Ident)
+		if sel, ok := arg.(*ast.SelectorExpr); ok {
+			ident = sel.Sel
+		}
+		if obj := c.info.Uses[ident]; ident != nil && obj != nil && isErrorVar(obj) {
+			name := obj.Name()
+			if obj.Pkg() != c.pkg {
+				name = obj.Pkg().Name() + "." + name
+			}
+			wrapped = append(wrapped, name)
+			continue
+		}
+
+		switch arg := arg.(type) {
+		case *ast.CallExpr:
+			if path, name := packageCall(c.info, arg); path == "errors" && name == "New" && len(arg.Args) == 1 {
+				if lit, ok := arg.Args[0].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+					wrapped = append(wrapped, "errors.New("+lit.Value+")")
+				}
+			}
+		case *ast.CompositeLit:
+			// Only the types are recorded, composite literals are named by theirs
+			typeIdent, _ := arg.Type.(*ast.Ident)
+			if sel, ok := arg.Type.(*ast.SelectorExpr); ok {
+				typeIdent = sel.Sel
+			}
+			if tn, ok := c.info.Uses[typeIdent].(*types.TypeName); typeIdent != nil && ok {
+				if t := tn.Type(); isConcreteError(t) || isConcreteError(types.NewPointer(t)) {
+					wrapped = append(wrapped, types.TypeString(t, types.RelativeTo(c.pkg)))
+				}
+			}
+		}
+	}
+	return wrapped
+}
+
+// catalogErrors collects the error types, sentinel errors and functions
+// returning concrete error types of a checked package
+func catalogErrors(c *checkedPackage) errorCatalog {
+	var catalog errorCatalog
+	qualifier := types.RelativeTo(c.pkg)
+	position := func(pos token.Pos) string {
+		p := c.fset.Position(pos)
+		return fmt.Sprintf("%s:%d", filepath.Base(p.Filename), p.Line)
+	}
+
+	// Types are checked with go/types: the method set of T or *T has Error
+	scope := c.pkg.Scope()
+	for _, name := range scope.Names() {
+		tn, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok || !tn.Exported() || types.IsInterface(tn.Type()) {
+			continue
+		}
+		receiver := ""
+		switch {
+		case types.Implements(tn.Type(), errorInterface):
+			receiver = "value receiver"
+		case types.Implements(types.NewPointer(tn.Type()), errorInterface):
+			receiver = "pointer receiver"
+		default:
+			continue
+		}
+		entry := fmt.Sprintf("type %s, %s, %s", name, receiver, position(tn.Pos()))
+		if m, _, _ := types.LookupFieldOrMethod(types.NewPointer(tn.Type()), true, c.pkg, "Unwrap"); m != nil {
+			entry += ", implements Unwrap"
+		}
+		catalog.types = append(catalog.types, entry)
+	}
+
+	// Sentinels are read from the AST, their values being calls
+	for _, file := range c.files {
+		for _, decl := range file.Decls {
+			switch d := decl.(type) {
+			case *ast.GenDecl:
+				if d.Tok != token.VAR {
+					continue
+				}
+				for _, spec := range d.Specs {
+					vs := spec.(*ast.ValueSpec)
+					for i, ident := range vs.Names {
+						if !ident.IsExported() || !strings.HasPrefix(ident.Name, "Err") || i >= len(vs.Values) {
+							continue
+						}
+						call, ok := vs.Values[i].(*ast.CallExpr)
+						if !ok || len(call.Args) == 0 {
+							continue
+						}
+						path, fn := packageCall(c.info, call)
+						if !(path == "errors" && fn == "New") && !(path == "fmt" && fn == "Errorf") {
+							continue
+						}
+						entry := ident.Name
+						if lit, ok := call.Args[0].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+							if message, err := strconv.Unquote(lit.Value); err == nil {
+								entry += fmt.Sprintf(", %q", message)
+							}
+						}
+						entry += ", " + position(ident.Pos())
+						if wrapped := wrappedErrors(c, call); len(wrapped) > 0 {
+							entry += ", wraps " + strings.Join(wrapped, ", ")
+						}
+						catalog.sentinels = append(catalog.sentinels, entry)
+					}
+				}
+
+			case *ast.FuncDecl:
+				if !d.Name.IsExported() {
+					continue
+				}
+				fn, ok := c.info.Defs[d.Name].(*types.Func)
+				if !ok {
+					continue
+				}
+				sig := fn.Type().(*types.Signature)
+				if recv := sig.Recv(); recv != nil {
+					t := recv.Type()
+					if p, ok := t.(*types.Pointer); ok {
+						t = p.Elem()
+					}
+					if named, ok := t.(*types.Named); !ok || !named.Obj().Exported() {
+						continue
+					}
+				}
+
+				for i := 0; i < sig.Results().Len(); i++ {
+					if isConcreteError(sig.Results().At(i).Type()) {
+						catalog.funcs = append(catalog.funcs, declString(c.fset, funcSignature(d)))
+						break
+					}
+				}
+
+				// Constructors wrapping known errors, each listed once
+				var wrapped []string
+				seen := make(map[string]bool)
+				if d.Body != nil {
+					ast.Inspect(d.Body, func(n ast.Node) bool {
+						if call, ok := n.(*ast.CallExpr); ok {
+							for _, w := range wrappedErrors(c, call) {
+								if !seen[w] {
+									seen[w] = true
+									wrapped = append(wrapped, w)
+								}
+							}
+						}
+						return true
+					})
+				}
+				if len(wrapped) > 0 {
+					name := d.Name.Name
+					if sig.Recv() != nil {
+						name = types.TypeString(sig.Recv().Type(), qualifier) + "." + name
+					}
+					catalog.wrapping = append(catalog.wrapping, fmt.Sprintf("%s wraps %s", name, strings.Join(wrapped, ", ")))
+				}
+			}
+		}
+	}
+	sort.Strings(catalog.sentinels)
+	sort.Strings(catalog.wrapping)
+	return catalog
+}
+
+// writeErrorsCatalog writes the catalog of the errors of the packages: their
+// exported error types, sentinel errors with their messages, functions
+// returning concrete error types and the errors wrapped with %w where it is
+// statically evident. The packages are type-checked by the shared importer.
+func writeErrorsCatalog(moduleName, syncPath string, packages []*packageInfo, imp *packageImporter, registry *artifactRegistry, rep *reporter) error {
+	var b strings.Builder
+	b.WriteString("Errors catalog\n")
+	b.WriteString("==============\n\n")
+	b.WriteString("Exported error types, sentinel errors with their message, functions\n")
+	b.WriteString("returning concrete error types and the errors wrapped with %w, by package.\n")
+
+	sorted := make([]*packageInfo, len(packages))
+	copy(sorted, packages)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ImportPath < sorted[j].ImportPath
+	})
+
+	typeCount, sentinelCount := 0, 0
+	for _, pkg := range sorted {
+		if pkg.Dir == "" || len(pkg.GoFiles)+len(pkg.CgoFiles) == 0 {
+			continue
+		}
+		c := imp.check(pkg.ImportPath)
+		if c.err != nil {
+			rep.warn("could not catalog the errors of %s: %v", pkg.ImportPath, c.err)
+			continue
+		}
+		catalog := catalogErrors(c)
+		if len(catalog.types)+len(catalog.sentinels)+len(catalog.funcs)+len(catalog.wrapping) == 0 {
+			continue
+		}
+		typeCount += len(catalog.types)
+		sentinelCount += len(catalog.sentinels)
+
+		fmt.Fprintf(&b, "\n%s\n", relativePackagePath(moduleName, pkg.ImportPath))
+		for _, section := range []struct {
+			title   string
+			entries []string
+		}{
+			{"Error types", catalog.types},
+			{"Sentinel errors", catalog.sentinels},
+			{"Functions returning concrete error types", catalog.funcs},
+			{"Wrapping", catalog.wrapping},
+		} {
+			if len(section.entries) == 0 {
+				continue
+			}
+			fmt.Fprintf(&b, "  %s\n", section.title)
+			for _, entry := range section.entries {
+				fmt.Fprintf(&b, "    %s\n", entry)
+			}
+		}
+	}
+
+	name := projectFileName(errorsCatalogFileName)
+	outputPath := filepath.Join(syncPath, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputPath, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	registry.register(&artifact{Name: name, Kind: kindReport})
+
+	rep.info("Cataloged %d error types and %d sentinel errors", typeCount, sentinelCount)
+
+	return nil
+}
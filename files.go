@@ -0,0 +1,222 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// resolveProjectFile resolves a file given on the command line, relative to
+// the current directory or else to the project, and returns its path relative
+// to the project. Files outside the project are rejected.
+func resolveProjectFile(projectPath, arg string) (string, string, error) {
+	filePath, err := filepath.Abs(arg)
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := os.Stat(filePath); os.IsNotExist(err) && !filepath.IsAbs(arg) {
+		filePath = filepath.Join(projectPath, arg)
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return "", "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", "", fmt.Errorf("%s is not a regular file", arg)
+	}
+
+	// Symlinks pointing out of the project are outside of it too
+	resolvedProject, err := filepath.EvalSymlinks(projectPath)
+	if err != nil {
+		return "", "", err
+	}
+	resolved, err := filepath.EvalSymlinks(filePath)
+	if err != nil {
+		return "", "", err
+	}
+	relPath, err := filepath.Rel(resolvedProject, resolved)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(os.PathSeparator)) {
+		return "", "", fmt.Errorf("%s is outside the project %s", arg, projectPath)
+	}
+	return filepath.Join(projectPath, relPath), filepath.ToSlash(relPath), nil
+}
+
+// runFilesCommand bundles exactly the given files, and optionally the docs of
+// their packages, without discovering anything else
+func runFilesCommand(args []string) int {
+	fs := flag.NewFlagSet("files", flag.ExitOnError)
+	projectPath := fs.String("project", "", "Path to the Go project (default: current directory)")
+	format := fs.String("format", formatRepomix, "Output format: repomix or chatml (a single file, written to stdout without -output) or dir (a sync directory at -output)")
+	messageSize := byteSize(100 << 10)
+	fs.Var(&messageSize, "max-message-size", "Largest content of a message of -format=chatml; larger files are split across messages")
+	outputPath := fs.String("output", "", "File (repomix) or directory (dir) to write the context to")
+	withDocs := fs.Bool("with-docs", false, "Also include the documentation of the packages of the Go files")
+	synopsisOnly := fs.Bool("doc-synopsis-only", false, "Only include the package synopsis and top-level symbol list with -with-docs")
+	fs.StringVar(&docFormat, "doc-format", docFormatText, "Format of the documentation: text (go doc output), md (markdown rendered from go/doc) or pretty (go doc -all like text listing the promoted fields and methods of each type, type-checked with go/types)")
+	verbose := fs.Bool("verbose", false, "Show detailed output")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: gocontext files [flags] <file>...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	if err := validateFormat(*format); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	if err := validateDocFormat(docFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	if messageSize < minMessageSize {
+		fmt.Fprintf(os.Stderr, "Error: -max-message-size must be at least %s\n", formatSize(minMessageSize))
+		return 2
+	}
+	if *format == formatDir && *outputPath == "" {
+		fmt.Fprintln(os.Stderr, "Error: -format=dir requires -output")
+		return 2
+	}
+
+	absProjectPath, err := resolveProject(*projectPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	moduleName, _ := resolveModuleName(absProjectPath)
+	rep := newReporter(os.Stderr, *verbose)
+
+	// Every path is checked before anything is written
+	var files, relPaths []string
+	pkgDirs := make(map[string]bool)
+	for _, arg := range fs.Args() {
+		filePath, relPath, err := resolveProjectFile(absProjectPath, arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		files = append(files, filePath)
+		relPaths = append(relPaths, relPath)
+		if strings.HasSuffix(relPath, ".go") {
+			pkgDirs["./"+path.Dir(relPath)] = true
+		}
+	}
+
+	// The packages of the Go files, listed in one go
+	var packages []*packageInfo
+	if *withDocs && len(pkgDirs) > 0 {
+		patterns := make([]string, 0, len(pkgDirs))
+		for dir := range pkgDirs {
+			patterns = append(patterns, dir)
+		}
+		sort.Strings(patterns)
+		if packages, err = loadPackages(absProjectPath, patterns); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+	}
+
+	// The packages are type-checked once for all their docs
+	imp := newPackageImporter(packages)
+
+	kind := kindDoc
+	if *synopsisOnly {
+		kind = kindSynopsis
+	}
+
+	if *format != formatDir {
+		var entries []contextEntry
+		for _, pkg := range packages {
+			output, err := renderDocumentation(pkg.ImportPath, pkg.Dir, absProjectPath, imp, *synopsisOnly, false)
+			if err != nil {
+				rep.warn("could not document %s: %v", pkg.ImportPath, err)
+				continue
+			}
+			entries = append(entries, contextEntry{path: docFileName(moduleName, pkg.ImportPath, kind), content: output})
+		}
+		for i, filePath := range files {
+			content, err := os.ReadFile(filePath)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return 1
+			}
+			entries = append(entries, contextEntry{path: relPaths[i], content: content})
+		}
+
+		meta := repomixMetadata{module: moduleName, generatedAt: time.Now()}
+		structure := strings.Join(relPaths, "\n") + "\n"
+		var output []byte
+		if *format == formatChatML {
+			if output, err = renderChatML(meta, structure, entries, int(messageSize)); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return 1
+			}
+		} else {
+			output = renderRepomix(meta, structure, entries)
+		}
+		if *outputPath == "" {
+			os.Stdout.Write(output)
+		} else if err := writeFileAtomic(*outputPath, output); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", *outputPath, err)
+			return 1
+		}
+		rep.summary()
+		return 0
+	}
+
+	// A sync directory of the files only
+	syncPath, err := filepath.Abs(*outputPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if err := os.MkdirAll(syncPath, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating %s: %v\n", syncPath, err)
+		return 1
+	}
+
+	registry := newArtifactRegistry()
+	for _, pkg := range packages {
+		output, err := renderDocumentation(pkg.ImportPath, pkg.Dir, absProjectPath, imp, *synopsisOnly, false)
+		if err != nil {
+			rep.warn("could not document %s: %v", pkg.ImportPath, err)
+			continue
+		}
+		name := docFileName(moduleName, pkg.ImportPath, kind)
+		docFile := filepath.Join(syncPath, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(docFile), 0755); err != nil {
+			rep.warn("could not document %s: %v", pkg.ImportPath, err)
+			continue
+		}
+		if err := os.WriteFile(docFile, output, 0644); err != nil {
+			rep.warn("could not document %s: %v", pkg.ImportPath, err)
+			continue
+		}
+		registry.register(&artifact{Name: name, Kind: kind, Package: pkg.ImportPath, dir: pkg.Dir})
+	}
+	for _, filePath := range files {
+		if err := linkProjectFile(filePath, absProjectPath, syncPath, kindSource, nil, registry, rep); err != nil {
+			fmt.Fprintf(os.Stderr, "Error linking %s: %v\n", filePath, err)
+			return 1
+		}
+	}
+
+	m := &manifest{Module: moduleName, Project: absProjectPath, Grouping: grouping, Copy: copyMode, DocFormat: docFormat}
+	if err := writeManifest(syncPath, m, heuristicTokenizer{}, registry); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing the manifest: %v\n", err)
+		return 1
+	}
+
+	rep.summary()
+	fmt.Fprintf(os.Stderr, "Context of %d files written to: %s\n", len(files), syncPath)
+	return 0
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// sniffSize is how much of a file is read to decide whether it is text
+const sniffSize = 8 * 1024
+
+// fileFilter decides which files of a walked directory are linked
+type fileFilter struct {
+	// extensions allowed; nil allows every file
+	extensions map[string]bool
+
+	// sniff includes files with other extensions when their content looks like text
+	sniff bool
+}
+
+// matches reports whether the file at path should be linked
+func (f *fileFilter) matches(path string) bool {
+	if f.extensions == nil || f.extensions[filepath.Ext(path)] {
+		return true
+	}
+	return f.sniff && looksLikeText(path)
+}
+
+// patternList is a flag value collecting repeated regular expressions, which
+// are compiled as they are parsed so that invalid patterns fail fast
+type patternList []*regexp.Regexp
+
+func (l *patternList) String() string {
+	var patterns []string
+	for _, re := range *l {
+		patterns = append(patterns, re.String())
+	}
+	return strings.Join(patterns, ",")
+}
+
+func (l *patternList) Set(value string) error {
+	re, err := regexp.Compile(value)
+	if err != nil {
+		return fmt.Errorf("invalid pattern %q: %v", value, err)
+	}
+	*l = append(*l, re)
+	return nil
+}
+
+// matchesAny reports whether any of the patterns matches the path
+func (l patternList) matchesAny(path string) bool {
+	for _, re := range l {
+		if re.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// File patterns matched against project-relative, slash-separated paths, set
+// once from the command line. Excluded files are never linked; when include
+// patterns are given, only matching files are linked from included and asset
+// directories.
+var (
+	excludeFilePatterns patternList
+	includeFilePatterns patternList
+)
+
+// fileAllowed reports whether the file patterns allow linking the file at
+// relPath as an artifact of the given kind
+func fileAllowed(relPath, kind string) bool {
+	relPath = filepath.ToSlash(relPath)
+	if excludeFilePatterns.matchesAny(relPath) {
+		return false
+	}
+	if len(includeFilePatterns) > 0 && (kind == kindSource || kind == kindAsset) {
+		return includeFilePatterns.matchesAny(relPath)
+	}
+	return true
+}
+
+// looksLikeText reads the beginning of a file and reports whether it looks
+// like text or code rather than binary data
+func looksLikeText(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	buf := make([]byte, sniffSize)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false
+	}
+	return isTextSample(buf[:n], n == sniffSize)
+}
+
+// isTextSample reports whether data looks like text or code rather than
+// binary data. When truncated, data may end in the middle of a character.
+func isTextSample(buf []byte, truncated bool) bool {
+	if len(buf) == 0 {
+		return false
+	}
+
+	contentType := http.DetectContentType(buf)
+	if !strings.HasPrefix(contentType, "text/") && contentType != "application/json" {
+		return false
+	}
+
+	// The sample may end in the middle of a multi-byte character
+	for i := 0; i < utf8.UTFMax && len(buf) > 0; i++ {
+		if utf8.Valid(buf) {
+			return true
+		}
+		if !truncated {
+			break
+		}
+		buf = buf[:len(buf)-1]
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Output formats
+const (
+	// formatDir is the sync directory of links and generated files
+	formatDir = "dir"
+
+	// formatRepomix is a single XML file in the layout used by repomix
+	formatRepomix = "repomix"
+
+	// formatChatML is a single JSON file of the messages of a chat
+	// completions request
+	formatChatML = "chatml"
+)
+
+// validateFormat checks the value of the -format flag
+func validateFormat(value string) error {
+	switch value {
+	case formatDir, formatRepomix, formatChatML:
+		return nil
+	}
+	return fmt.Errorf("invalid format %q, expected %s, %s or %s", value, formatDir, formatRepomix, formatChatML)
+}
+
+// formatFileName returns the name of the file a single-file format writes
+func formatFileName(format string) string {
+	if format == formatChatML {
+		return chatMLFileName
+	}
+	return repomixFileName
+}
+
+// contextEntry is a file of a single-file output
+type contextEntry struct {
+	path    string
+	content []byte
+
+	// artifact is the artifact of the entry and source the file its content
+	// is read from, unset for entries rendered directly
+	artifact *artifact
+	source   string
+}
+
+// resolveEntries lists the artifacts of a sync for the single-file outputs,
+// without their content. The entries are ordered for reading top to bottom:
+// project-wide reports first, then the docs, READMEs and sources of each
+// package in dependency order, then everything else. Linked files are named
+// by their path in the project and read from it.
+func resolveEntries(syncPath string, registry *artifactRegistry, results []*syncResult) []contextEntry {
+	// Rank the package directories of every project in dependency order
+	dirRanks := make(map[string]int)
+	pkgRanks := make(map[string]int)
+	rank := 0
+	for _, result := range results {
+		positions := result.order.position()
+		pkgs := make([]*packageInfo, len(result.packages))
+		copy(pkgs, result.packages)
+		sort.SliceStable(pkgs, func(i, j int) bool {
+			return positions[pkgs[i].ImportPath] < positions[pkgs[j].ImportPath]
+		})
+		for _, pkg := range pkgs {
+			dirRanks[pkg.Dir] = rank
+			pkgRanks[pkg.ImportPath] = rank
+			rank++
+		}
+	}
+
+	projectFor := func(a *artifact) *syncResult {
+		for _, result := range results {
+			if result.project.namespace == a.Project {
+				return result
+			}
+		}
+		return results[0]
+	}
+
+	type rankedEntry struct {
+		contextEntry
+		group, rank, kindRank int
+	}
+
+	var entries []rankedEntry
+	for _, a := range registry.artifacts {
+		if a.Kind == kindStructure || a.Kind == kindStructureJSON || a.Kind == kindSourceDir {
+			continue
+		}
+
+		e := rankedEntry{contextEntry: contextEntry{path: a.Name, artifact: a}, group: 2, kindRank: 2}
+		e.source = filepath.Join(syncPath, filepath.FromSlash(a.Name))
+
+		switch {
+		case a.Kind == kindReport:
+			e.group = 0
+		case a.Package != "":
+			e.group, e.rank, e.kindRank = 1, pkgRanks[a.Package], 0
+		case a.Source != "":
+			e.source = a.Source
+			result := projectFor(a)
+			if relPath, err := filepath.Rel(result.project.path, a.Source); err == nil {
+				e.path = path.Join(result.project.namespace, filepath.ToSlash(relPath))
+			}
+			if dirRank, ok := dirRanks[filepath.Dir(a.Source)]; ok {
+				e.group, e.rank = 1, dirRank
+				if a.Kind == kindReadme {
+					e.kindRank = 1
+				}
+			}
+		}
+		entries = append(entries, e)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.group != b.group {
+			return a.group < b.group
+		}
+		if a.rank != b.rank {
+			return a.rank < b.rank
+		}
+		if a.kindRank != b.kindRank {
+			return a.kindRank < b.kindRank
+		}
+		return a.path < b.path
+	})
+
+	result := make([]contextEntry, len(entries))
+	for i, e := range entries {
+		result[i] = e.contextEntry
+	}
+	return result
+}
+
+// directoryStructure returns the directory structure of the synced projects
+// as generated into the sync directory
+func directoryStructure(syncPath string, registry *artifactRegistry) string {
+	var parts []string
+	for _, a := range registry.artifacts {
+		if a.Kind != kindStructure {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(syncPath, filepath.FromSlash(a.Name)))
+		if err != nil {
+			continue
+		}
+		if a.Project != "" {
+			content = append([]byte(a.Project+"/\n"), content...)
+		}
+		parts = append(parts, string(content))
+	}
+	return strings.Join(parts, "\n")
+}
+
+// writeFileAtomic writes a file by renaming a temporary file in the same
+// directory, so readers never see a partial file
+func writeFileAtomic(filePath string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), "."+filepath.Base(filePath)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filePath)
+}
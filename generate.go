@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// generateFileName is the name of the go:generate summary
+const generateFileName = "generate_directives.txt"
+
+// generatedHeader matches the standard header of generated Go files
+var generatedHeader = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// generateDirective is a //go:generate comment found in a source file
+type generateDirective struct {
+	file    string // path relative to the project
+	line    int
+	command string
+}
+
+// generatedFile is a source file carrying a "Code generated" header
+type generatedFile struct {
+	file      string // path relative to the project
+	header    string
+	directive *generateDirective // directive that likely produced the file, if inferable
+}
+
+// scanGenerateInfo reads a Go file for go:generate directives and the
+// generated code header
+func scanGenerateInfo(filePath, relPath string) ([]generateDirective, string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+
+	var directives []generateDirective
+	var header string
+	inPreamble := true
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+
+		if strings.HasPrefix(line, "//go:generate ") {
+			directives = append(directives, generateDirective{
+				file:    relPath,
+				line:    lineNum,
+				command: strings.TrimSpace(strings.TrimPrefix(line, "//go:generate ")),
+			})
+		}
+
+		// The generated header must appear before the package clause
+		if inPreamble {
+			if strings.HasPrefix(line, "package ") {
+				inPreamble = false
+			} else if header == "" && generatedHeader.MatchString(line) {
+				header = line
+			}
+		}
+	}
+
+	return directives, header, scanner.Err()
+}
+
+// inferDirective returns the directive of the package whose generator is
+// named in the generated file's header
+func inferDirective(header string, directives []generateDirective) *generateDirective {
+	for i, d := range directives {
+		for _, field := range strings.Fields(d.command) {
+			if field == "go" || field == "run" || strings.HasPrefix(field, "-") || strings.HasPrefix(field, "$") {
+				continue
+			}
+			if name := path.Base(field); len(name) > 2 && strings.Contains(header, name) {
+				return &directives[i]
+			}
+		}
+	}
+	return nil
+}
+
+// writeGenerateDirectives writes the summary of go:generate directives and
+// generated files of the packages
+func writeGenerateDirectives(projectPath, syncPath, moduleName string, packages []*packageInfo, registry *artifactRegistry, rep *reporter) error {
+	var b strings.Builder
+	var generated []generatedFile
+	directiveCount := 0
+
+	b.WriteString("go:generate directives\n")
+	b.WriteString("======================\n")
+
+	for _, pkg := range packages {
+		var directives []generateDirective
+		var pkgGenerated []generatedFile
+
+		for _, filePath := range pkg.sourceFiles() {
+			relPath, err := filepath.Rel(projectPath, filePath)
+			if err != nil {
+				relPath = filePath
+			}
+			relPath = filepath.ToSlash(relPath)
+
+			fileDirectives, header, err := scanGenerateInfo(filePath, relPath)
+			if err != nil {
+				rep.warn("could not scan %s for go:generate directives: %v", relPath, err)
+				continue
+			}
+
+			directives = append(directives, fileDirectives...)
+			if header != "" {
+				pkgGenerated = append(pkgGenerated, generatedFile{file: relPath, header: header})
+			}
+		}
+
+		for i := range pkgGenerated {
+			pkgGenerated[i].directive = inferDirective(pkgGenerated[i].header, directives)
+		}
+		generated = append(generated, pkgGenerated...)
+
+		if len(directives) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&b, "\n%s\n", relativePackagePath(moduleName, pkg.ImportPath))
+		for _, d := range directives {
+			fmt.Fprintf(&b, "  %s:%d: %s\n", d.file, d.line, d.command)
+		}
+		directiveCount += len(directives)
+	}
+
+	if directiveCount == 0 {
+		b.WriteString("\n(none)\n")
+	}
+
+	b.WriteString("\nGenerated files\n")
+	b.WriteString("===============\n\n")
+	for _, g := range generated {
+		if g.directive != nil {
+			fmt.Fprintf(&b, "%s (from %s:%d: %s)\n", g.file, g.directive.file, g.directive.line, g.directive.command)
+		} else {
+			fmt.Fprintf(&b, "%s\n", g.file)
+		}
+	}
+	if len(generated) == 0 {
+		b.WriteString("(none)\n")
+	}
+
+	name := projectFileName(generateFileName)
+	outputPath := filepath.Join(syncPath, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputPath, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	registry.register(&artifact{Name: name, Kind: kindReport})
+
+	rep.info("Summarized %d go:generate directives and %d generated files", directiveCount, len(generated))
+
+	return nil
+}
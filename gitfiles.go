@@ -0,0 +1,157 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// gitListing is the set of files of a git project that git doesn't ignore,
+// tracked or not, listed with a single git ls-files call
+type gitListing struct {
+	// entries are the absolute paths listed. Submodules and nested
+	// repositories are listed as directories, without their files.
+	entries []string
+	listed  map[string]bool
+}
+
+// gitListings are the listings of the projects taken during the run, nil for
+// a project git couldn't list
+var (
+	gitListingsMu sync.Mutex
+	gitListings   = make(map[string]*gitListing)
+)
+
+// listGitFiles returns the listing of the git project at projectPath, taking
+// it the first time, or nil if git couldn't list its files
+func listGitFiles(projectPath string) *gitListing {
+	gitListingsMu.Lock()
+	defer gitListingsMu.Unlock()
+	if l, ok := gitListings[projectPath]; ok {
+		return l
+	}
+
+	var l *gitListing
+	if output, err := runGit(projectPath, "ls-files", "--cached", "--others", "--exclude-standard", "-z"); err == nil {
+		l = &gitListing{listed: make(map[string]bool)}
+		for _, entry := range strings.Split(string(output), "\x00") {
+			if entry == "" {
+				continue
+			}
+			path := filepath.Join(projectPath, filepath.FromSlash(strings.TrimSuffix(entry, "/")))
+			if !l.listed[path] {
+				l.listed[path] = true
+				l.entries = append(l.entries, path)
+			}
+		}
+	}
+	gitListings[projectPath] = l
+	return l
+}
+
+// cachedGitListing returns the listing of the project if it was taken
+func cachedGitListing(projectPath string) *gitListing {
+	gitListingsMu.Lock()
+	defer gitListingsMu.Unlock()
+	return gitListings[projectPath]
+}
+
+// walkOrder sorts paths in the order filepath.Walk visits them: the entries
+// of each directory in lexical order, depth first
+func walkOrder(paths []string) {
+	key := func(path string) string {
+		return strings.Replace(path, string(os.PathSeparator), "\x00", -1)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return key(paths[i]) < key(paths[j])
+	})
+}
+
+// candidateFiles returns the files below root, skipping the directories
+// below it that skipDir accepts, which logs them. In a git project the files are taken from
+// the listing of git, which leaves out the ignored trees without visiting
+// them; the tree is walked otherwise, and below the submodules and nested
+// repositories of the listing. Either way the files come in walk order.
+func candidateFiles(root, projectPath string, isGitRepo bool, skipDir func(path, name string) bool) ([]string, error) {
+	walk := func(dir string) ([]string, error) {
+		var files []string
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				if path != root && skipDir(path, info.Name()) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			files = append(files, path)
+			return nil
+		})
+		return files, err
+	}
+
+	var listing *gitListing
+	if isGitRepo {
+		listing = listGitFiles(projectPath)
+	}
+	if listing == nil || !strings.HasPrefix(root+string(os.PathSeparator), projectPath+string(os.PathSeparator)) {
+		return walk(root)
+	}
+
+	// Git doesn't list the files of submodules and nested repositories
+	for dir := root; dir != projectPath; dir = filepath.Dir(dir) {
+		if listing.listed[dir] {
+			return walk(root)
+		}
+	}
+
+	// Directories are checked once, each after the directories above it
+	prefix := root + string(os.PathSeparator)
+	skipped := make(map[string]bool)
+	var isSkipped func(dir string) bool
+	isSkipped = func(dir string) bool {
+		if !strings.HasPrefix(dir, prefix) {
+			return false
+		}
+		if skip, ok := skipped[dir]; ok {
+			return skip
+		}
+		skip := isSkipped(filepath.Dir(dir))
+		if !skip {
+			skip = skipDir(dir, filepath.Base(dir))
+		}
+		skipped[dir] = skip
+		return skip
+	}
+
+	var files []string
+	for _, path := range listing.entries {
+		if !strings.HasPrefix(path, prefix) || isSkipped(filepath.Dir(path)) {
+			continue
+		}
+
+		// Deleted files are still listed, submodules and nested
+		// repositories are walked
+		info, err := os.Lstat(path)
+		if err != nil {
+			continue
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		if skipDir(path, info.Name()) {
+			continue
+		}
+		nested, err := walk(path)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, nested...)
+	}
+	walkOrder(files)
+	return files, nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// runGit runs a git command in dir and returns its raw output. It's the only
+// way the snapshots run git, so that their commands can be counted or faked.
+var runGit = func(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, commandError(err)
+	}
+	return output, nil
+}
+
+// gitSnapshot is the state of a repository taken once per sync, answering
+// which package directories have uncommitted changes and what their tree at
+// HEAD is without running git for every package
+type gitSnapshot struct {
+	// prefix is the path of the snapshot's directory inside the repository,
+	// empty at its root or ending with a slash
+	prefix string
+
+	// changed are the repository paths with uncommitted changes, untracked
+	// directories ending with a slash. It's nil if git status failed.
+	changed []string
+
+	// trees are the hashes of the trees at HEAD by repository path, the root
+	// tree under ""
+	trees map[string]string
+
+	// empty is whether the repository has no commits yet, hence no trees
+	empty bool
+}
+
+// gitSnapshots are the snapshots taken during the run, by directory
+var (
+	gitSnapshotsMu sync.Mutex
+	gitSnapshots   = make(map[string]*gitSnapshot)
+)
+
+// snapshotGit returns the snapshot of the repository at dir, taking it with
+// three git commands the first time, two for a repository without commits
+func snapshotGit(dir string) *gitSnapshot {
+	gitSnapshotsMu.Lock()
+	defer gitSnapshotsMu.Unlock()
+	if s, ok := gitSnapshots[dir]; ok {
+		return s
+	}
+	s := &gitSnapshot{trees: make(map[string]string)}
+	gitSnapshots[dir] = s
+
+	// HEAD only fails to resolve when there are no commits, in which case
+	// the prefix is asked again without it
+	output, err := runGit(dir, "rev-parse", "--show-prefix", "HEAD^{tree}")
+	if err != nil {
+		if output, err = runGit(dir, "rev-parse", "--show-prefix"); err == nil {
+			s.empty = true
+		}
+	}
+	if err == nil {
+		lines := strings.Split(strings.TrimSuffix(string(output), "\n"), "\n")
+		s.prefix = lines[0]
+		if len(lines) == 2 {
+			s.trees[""] = lines[1]
+		}
+	}
+
+	// Entries are NUL-terminated, a rename being followed by its old path
+	if output, err := runGit(dir, "status", "--porcelain", "-z"); err == nil {
+		s.changed = []string{}
+		entries := strings.Split(string(output), "\x00")
+		for i := 0; i < len(entries); i++ {
+			entry := entries[i]
+			if len(entry) < 4 {
+				continue
+			}
+			s.changed = append(s.changed, entry[3:])
+			if (entry[0] == 'R' || entry[0] == 'C') && i+1 < len(entries) {
+				i++
+				s.changed = append(s.changed, entries[i])
+			}
+		}
+	}
+
+	if s.empty {
+		return s
+	}
+	if output, err := runGit(dir, "ls-tree", "-r", "-d", "-z", "--full-tree", "HEAD"); err == nil {
+		for _, entry := range strings.Split(string(output), "\x00") {
+			// <mode> tree <hash>\t<path>
+			tab := strings.Index(entry, "\t")
+			if tab < 0 {
+				continue
+			}
+			fields := strings.Fields(entry[:tab])
+			if len(fields) != 3 {
+				continue
+			}
+			s.trees[entry[tab+1:]] = fields[2]
+		}
+	}
+	return s
+}
+
+// repoPath returns the repository path of a directory, given relative to
+// the snapshot's
+func (s *gitSnapshot) repoPath(relDir string) string {
+	relDir = filepath.ToSlash(relDir)
+	if relDir == "." {
+		relDir = ""
+	}
+	return strings.TrimSuffix(s.prefix+relDir, "/")
+}
+
+// hasChanges reports whether the directory, given by its repository path, or
+// any file below it has uncommitted changes, as git status of the directory
+// would
+func (s *gitSnapshot) hasChanges(path string) bool {
+	for _, changed := range s.changed {
+		switch {
+		case path == "":
+			return true
+		case changed == path || strings.HasPrefix(changed, path+"/"):
+			return true
+		case strings.HasSuffix(changed, "/") && strings.HasPrefix(path+"/", changed):
+			// The directory is inside an untracked one
+			return true
+		}
+	}
+	return false
+}
+
+// treeHash returns the hash of the tree at HEAD of a directory given by its
+// repository path, and whether it has one
+func (s *gitSnapshot) treeHash(path string) (string, bool) {
+	hash, ok := s.trees[path]
+	return hash, ok
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeGit stands in for runGit, answering the commands of the snapshots
+// and counting them by directory and command
+type fakeGit struct {
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (f *fakeGit) run(dir string, args ...string) ([]byte, error) {
+	f.mu.Lock()
+	f.calls[dir+" "+args[0]]++
+	f.mu.Unlock()
+
+	switch args[0] {
+	case "rev-parse":
+		var lines []string
+		for _, arg := range args[1:] {
+			switch arg {
+			case "--show-prefix":
+				lines = append(lines, "")
+			case "HEAD^{tree}":
+				lines = append(lines, "root-tree")
+			case "--git-dir", "--git-common-dir":
+				lines = append(lines, ".git")
+			case "--show-toplevel":
+				lines = append(lines, dir)
+			}
+		}
+		return []byte(strings.Join(lines, "\n") + "\n"), nil
+	case "status":
+		return []byte(" M pkg/a/a.go\x00?? new/\x00"), nil
+	case "ls-tree":
+		return []byte("040000 tree a-tree\tpkg/a\x00040000 tree b-tree\tpkg/b\x00"), nil
+	}
+	return nil, fmt.Errorf("unexpected git %s", strings.Join(args, " "))
+}
+
+// withFakeGit runs the test with runGit faked and the caches of the
+// repositories emptied
+func withFakeGit(t *testing.T) *fakeGit {
+	f := &fakeGit{calls: make(map[string]int)}
+	savedRunGit, savedSnapshots, savedRepos := runGit, gitSnapshots, repoInfos
+	runGit, gitSnapshots, repoInfos = f.run, make(map[string]*gitSnapshot), make(map[string]*repoInfo)
+	t.Cleanup(func() {
+		runGit, gitSnapshots, repoInfos = savedRunGit, savedSnapshots, savedRepos
+	})
+	return f
+}
+
+func TestSnapshotGitRunsGitOncePerRepository(t *testing.T) {
+	f := withFakeGit(t)
+	repos := []string{"/repo/one", "/repo/two"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		for _, repo := range repos {
+			wg.Add(1)
+			go func(repo string) {
+				defer wg.Done()
+				s := snapshotGit(repo)
+				s.hasChanges("pkg/a")
+				s.treeHash("pkg/b")
+			}(repo)
+		}
+	}
+	wg.Wait()
+
+	for _, repo := range repos {
+		for _, command := range []string{"rev-parse", "status", "ls-tree"} {
+			if n := f.calls[repo+" "+command]; n != 1 {
+				t.Errorf("git %s ran %d times in %s, want once", command, n, repo)
+			}
+		}
+	}
+	if len(f.calls) != 3*len(repos) {
+		t.Errorf("git ran %v, want only rev-parse, status and ls-tree", f.calls)
+	}
+
+	s := snapshotGit(repos[0])
+	if !s.hasChanges("pkg/a") || s.hasChanges("pkg/b") || !s.hasChanges("new/dir") {
+		t.Errorf("changes of the snapshot %v", s.changed)
+	}
+	if hash, ok := s.treeHash("pkg/b"); !ok || hash != "b-tree" {
+		t.Errorf("tree of pkg/b %q, want b-tree", hash)
+	}
+	if hash, ok := s.treeHash(""); !ok || hash != "root-tree" {
+		t.Errorf("root tree %q, want root-tree", hash)
+	}
+}
+
+func TestResolveRepoRunsGitOncePerRepository(t *testing.T) {
+	f := withFakeGit(t)
+	for i := 0; i < 5; i++ {
+		if !isGitRepository("/repo/one") {
+			t.Fatal("/repo/one is not detected as a git repository")
+		}
+		resolveRepo("/repo/one")
+	}
+	if n := f.calls["/repo/one rev-parse"]; n != 1 || len(f.calls) != 1 {
+		t.Errorf("git ran %v, want a single rev-parse", f.calls)
+	}
+}
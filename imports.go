@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// importsFileName is the name of the intra-module import summary
+const importsFileName = "imports.txt"
+
+// moduleImports returns the sorted imports of a package that belong to the module
+func moduleImports(moduleName string, pkg *packageInfo) []string {
+	var imports []string
+	for _, imp := range pkg.Imports {
+		if moduleName != "" && (imp == moduleName || strings.HasPrefix(imp, moduleName+"/")) {
+			imports = append(imports, imp)
+		}
+	}
+	sort.Strings(imports)
+	return imports
+}
+
+// writeImports writes the intra-module import adjacency of the packages: each
+// package followed by the packages of the module it imports
+func writeImports(syncPath, moduleName string, packages []*packageInfo, registry *artifactRegistry) error {
+	sorted := make([]*packageInfo, len(packages))
+	copy(sorted, packages)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ImportPath < sorted[j].ImportPath
+	})
+
+	var b strings.Builder
+	b.WriteString("Intra-module imports\n")
+	b.WriteString("====================\n\n")
+
+	for _, pkg := range sorted {
+		fmt.Fprintf(&b, "%s\n", relativePackagePath(moduleName, pkg.ImportPath))
+
+		imports := moduleImports(moduleName, pkg)
+		if len(imports) == 0 {
+			b.WriteString("    (no intra-module imports)\n")
+		}
+		for _, imp := range imports {
+			fmt.Fprintf(&b, "    -> %s\n", relativePackagePath(moduleName, imp))
+		}
+		b.WriteString("\n")
+	}
+
+	name := projectFileName(importsFileName)
+	outputPath := filepath.Join(syncPath, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputPath, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+
+	return registry.register(&artifact{Name: name, Kind: kindReport})
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// packageIndexFileName is the name of the package overview
+const packageIndexFileName = "package_index.txt"
+
+// writePackageIndex writes an overview listing every package with the first
+// sentence of its package comment, in dependency order. The synopsis is
+// computed by go list using go/doc's Synopsis, so packages without doc.go are
+// covered too.
+func writePackageIndex(projectPath, syncPath, moduleName string, packages []*packageInfo, order *packageOrder, registry *artifactRegistry) error {
+	positions := order.position()
+	sorted := make([]*packageInfo, len(packages))
+	copy(sorted, packages)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return positions[sorted[i].ImportPath] < positions[sorted[j].ImportPath]
+	})
+
+	var b strings.Builder
+	b.WriteString("Package index\n")
+	b.WriteString("=============\n\n")
+	b.WriteString("Packages are listed in dependency order: each package comes after the\n")
+	b.WriteString("packages of the module it imports.\n\n")
+	for _, cycle := range order.cycles {
+		var relCycle []string
+		for _, pkg := range cycle {
+			relCycle = append(relCycle, relativePackagePath(moduleName, pkg))
+		}
+		fmt.Fprintf(&b, "Note: import cycle through test imports between %s, listed in lexical order.\n\n", strings.Join(relCycle, ", "))
+	}
+
+	for _, pkg := range sorted {
+		relDir, err := filepath.Rel(projectPath, pkg.Dir)
+		if err != nil || pkg.Dir == "" {
+			relDir = pkg.Dir
+		}
+
+		synopsis := pkg.Doc
+		if synopsis == "" {
+			synopsis = "(no package comment)"
+		}
+
+		fileCount := len(pkg.GoFiles) + len(pkg.CgoFiles)
+		fmt.Fprintf(&b, "%s\n", relativePackagePath(moduleName, pkg.ImportPath))
+		fmt.Fprintf(&b, "    %s\n", synopsis)
+		fmt.Fprintf(&b, "    dir: %s, %d files\n\n", filepath.ToSlash(relDir), fileCount)
+	}
+
+	name := projectFileName(packageIndexFileName)
+	outputPath := filepath.Join(syncPath, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputPath, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+
+	return registry.register(&artifact{Name: name, Kind: kindReport})
+}
+
+// writeCombinedIndex writes the package index of a sync directory merging
+// several projects: the modules, then the package index of each, read from
+// its namespace so that the projects synced by earlier runs are covered too
+func writeCombinedIndex(syncPath string, projects []projectInfo, registry *artifactRegistry) error {
+	var b strings.Builder
+	b.WriteString("Package index of all modules\n")
+	b.WriteString("============================\n\n")
+	b.WriteString("Every module has its own directory, named after the project:\n\n")
+	for _, p := range projects {
+		module := p.Module
+		if module == "" {
+			module = "(no module)"
+		}
+		fmt.Fprintf(&b, "    %s/  %s  (%s)\n", p.Name, module, p.Path)
+	}
+
+	for _, p := range projects {
+		title := fmt.Sprintf("%s/", p.Name)
+		if p.Module != "" {
+			title = fmt.Sprintf("%s/ (%s)", p.Name, p.Module)
+		}
+		fmt.Fprintf(&b, "\n\n%s\n%s\n\n", title, strings.Repeat("-", len(title)))
+
+		// The index of the project without its title
+		content, err := os.ReadFile(filepath.Join(syncPath, p.Name, filepath.FromSlash(projectFileName(packageIndexFileName))))
+		if err != nil {
+			b.WriteString("(no package index)\n")
+			continue
+		}
+		index := string(content)
+		if parts := strings.SplitN(index, "\n", 3); len(parts) == 3 && strings.HasPrefix(parts[1], "===") {
+			index = strings.TrimLeft(parts[2], "\n")
+		}
+		b.WriteString(strings.TrimRight(index, "\n") + "\n")
+	}
+
+	name := projectFileName(packageIndexFileName)
+	outputPath := filepath.Join(syncPath, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputPath, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+
+	return registry.register(&artifact{Name: name, Kind: kindReport})
+}
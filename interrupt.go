@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// exitInterrupted is the exit code of a sync interrupted with Ctrl-C, the
+// one of a process killed by SIGINT
+const exitInterrupted = 130
+
+// interrupted is closed on the first interrupt of the run
+var interrupted = make(chan struct{})
+
+// isInterrupted reports whether the run was interrupted
+func isInterrupted() bool {
+	select {
+	case <-interrupted:
+		return true
+	default:
+		return false
+	}
+}
+
+// stopReason describes why the run context is done, for the warnings of the
+// passes cut short
+func stopReason() string {
+	if isInterrupted() {
+		return "interrupted"
+	}
+	return "-max-runtime reached"
+}
+
+// handleInterrupts returns a context canceled on the first SIGINT or SIGTERM:
+// go subprocesses are killed and the passes stop at the next package, so that
+// the sync finishes early as partial, without deleting anything. A second
+// signal exits immediately.
+func handleInterrupts(ctx context.Context) context.Context {
+	ctx, cancel := context.WithCancel(ctx)
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		close(interrupted)
+		cancel()
+		fmt.Fprintln(os.Stderr, "\nInterrupted, finishing the sync as partial; interrupt again to exit immediately")
+
+		<-signals
+		os.Exit(exitInterrupted)
+	}()
+	return ctx
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"sort"
+)
+
+// jsonFile is a file of a package in the JSON output
+type jsonFile struct {
+	Path    string `json:"path"`
+	Kind    string `json:"kind"`
+	Content string `json:"content"`
+}
+
+// jsonPackage is a package in the JSON output, with its docs and the files
+// linked from its directory
+type jsonPackage struct {
+	ImportPath string     `json:"importPath"`
+	Name       string     `json:"name"`
+	Path       string     `json:"path"`
+	Project    string     `json:"project,omitempty"`
+	Docs       []jsonFile `json:"docs,omitempty"`
+	Files      []jsonFile `json:"files,omitempty"`
+}
+
+// writeJSONContext writes a finished sync as a single JSON object of the
+// module, its packages in dependency order, the directory structure and the
+// summary of the run. Packages are encoded one at a time as their files are
+// read, so the whole context is never held in memory.
+func writeJSONContext(w io.Writer, s *emission) error {
+	moduleJSON, err := json.Marshal(s.meta.module)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, `{"module":`+string(moduleJSON)+`,"packages":[`); err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	entries := s.entries()
+	first := true
+	for _, result := range s.results {
+		positions := result.order.position()
+		pkgs := make([]*packageInfo, len(result.packages))
+		copy(pkgs, result.packages)
+		sort.SliceStable(pkgs, func(i, j int) bool {
+			return positions[pkgs[i].ImportPath] < positions[pkgs[j].ImportPath]
+		})
+
+		for _, pkg := range pkgs {
+			jp := jsonPackage{
+				ImportPath: pkg.ImportPath,
+				Name:       pkg.Name,
+				Path:       relativePackagePath(result.project.moduleName, pkg.ImportPath),
+				Project:    result.project.namespace,
+			}
+			for _, e := range entries {
+				a := e.artifact
+				if a.Project != result.project.namespace {
+					continue
+				}
+				if a.Package != pkg.ImportPath && (a.Source == "" || filepath.Dir(a.Source) != pkg.Dir) {
+					continue
+				}
+				content, ok := s.read(e)
+				if !ok {
+					continue
+				}
+				f := jsonFile{Path: e.path, Kind: a.Kind, Content: string(content)}
+				if a.Package == pkg.ImportPath {
+					jp.Docs = append(jp.Docs, f)
+				} else {
+					jp.Files = append(jp.Files, f)
+				}
+			}
+
+			if !first {
+				if _, err := io.WriteString(w, ","); err != nil {
+					return err
+				}
+			}
+			first = false
+			if err := enc.Encode(jp); err != nil {
+				return err
+			}
+		}
+	}
+
+	structure, err := json.Marshal(s.structure())
+	if err != nil {
+		return err
+	}
+	summaryJSON, err := json.Marshal(s.summarize())
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, `],"structure":`+string(structure)+`,"summary":`+string(summaryJSON)+"}\n")
+	return err
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Groupings of artifacts in the sync directory
+const (
+	// groupFlat puts every artifact at the top level with a prefixed name
+	groupFlat = "flat"
+
+	// groupDir mirrors the project's directory hierarchy
+	groupDir = "dir"
+
+	// groupPackage creates one directory per package, plus projectDirName
+	// for project-wide artifacts
+	groupPackage = "package"
+)
+
+// projectDirName is the directory holding project-wide artifacts when grouping by package
+const projectDirName = "_project"
+
+// rootPackageDirName is the directory of the package in the project root when grouping by package
+const rootPackageDirName = "_root"
+
+// Layout options of the sync directory, set once from the command line
+var (
+	// copyMode copies files into the sync directory instead of symlinking them
+	copyMode bool
+
+	// grouping is one of groupFlat, groupDir or groupPackage
+	grouping = groupFlat
+
+	// docExtension replaces the extension of the documentation files when set
+	docExtension string
+
+	// renamedPrefixes are the prefixes of kindPrefixes changed from their
+	// default, recorded in the manifest
+	renamedPrefixes map[string]string
+
+	// docOrder holds the position of each package in dependency order when
+	// doc file names are numbered with -ordered-names
+	docOrder map[string]int
+)
+
+// kindPrefixes are the name prefixes of each artifact kind in the flat layout
+var kindPrefixes = map[string]string{
+	kindDoc:        "doc_",
+	kindSynopsis:   "synopsis_",
+	kindReadme:     "readme_",
+	kindSource:     "src_",
+	kindSourceDir:  "src_",
+	kindAsset:      "asset_",
+	kindEmbed:      "embed_",
+	kindStub:       "stub_",
+	kindCommand:    "cmd_",
+	kindConstants:  "constants_",
+	kindMigration:  "migration_",
+	kindConfig:     "cfg_",
+	kindBuild:      "build_",
+	kindDiff:       "diff_",
+	kindSignatures: "sig_",
+	kindFileDoc:    "filedoc_",
+}
+
+// configureNaming sets the extension of the documentation files and the
+// prefixes of docs, sources and READMEs in the flat layout, validating them.
+// An empty extension keeps the one of the doc format, a prefix may be empty.
+func configureNaming(ext, docPrefix, srcPrefix, readmePrefix string) error {
+	if ext != "" {
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		if ext == "." || strings.ContainsAny(ext, `/\`) {
+			return fmt.Errorf("invalid doc extension %q", ext)
+		}
+		docExtension = ext
+	}
+
+	for _, p := range []struct {
+		prefix string
+		kinds  []string
+	}{
+		{docPrefix, []string{kindDoc}},
+		{srcPrefix, []string{kindSource, kindSourceDir}},
+		{readmePrefix, []string{kindReadme}},
+	} {
+		if strings.ContainsAny(p.prefix, `/\`) {
+			return fmt.Errorf("invalid name prefix %q, it can't contain a path separator", p.prefix)
+		}
+		for _, kind := range p.kinds {
+			if kindPrefixes[kind] == p.prefix {
+				continue
+			}
+			if renamedPrefixes == nil {
+				renamedPrefixes = make(map[string]string)
+			}
+			kindPrefixes[kind] = p.prefix
+			renamedPrefixes[kind] = p.prefix
+		}
+	}
+	return nil
+}
+
+// validateGrouping checks the value of the -group flag
+func validateGrouping(value string) error {
+	switch value {
+	case groupFlat, groupDir, groupPackage:
+		return nil
+	}
+	return fmt.Errorf("invalid grouping %q, expected %s, %s or %s", value, groupFlat, groupDir, groupPackage)
+}
+
+// flatName builds a flat artifact name from a prefix and a relative path.
+// The path is normalized to forward slashes first so that names are the same
+// regardless of the OS path separator.
+func flatName(prefix, relPath string) string {
+	return prefix + strings.Replace(filepath.ToSlash(relPath), "/", "_", -1)
+}
+
+// packageDirName returns the directory of a package when grouping by package,
+// named after the package path relative to the project
+func packageDirName(relDir string) string {
+	relDir = filepath.ToSlash(relDir)
+	if relDir == "." || relDir == "" {
+		return rootPackageDirName
+	}
+	return flatName("", relDir)
+}
+
+// artifactName builds the name of an artifact of the given kind for a
+// project-relative file
+func artifactName(kind, relPath string) string {
+	relPath = filepath.ToSlash(relPath)
+
+	switch grouping {
+	case groupDir:
+		// The file keeps its place in the hierarchy
+		return relPath
+	case groupPackage:
+		// Sources live in their package's directory, everything else is project-wide
+		if kind == kindSource {
+			return path.Join(packageDirName(path.Dir(relPath)), path.Base(relPath))
+		}
+		return path.Join(projectDirName, flatName(kindPrefixes[kind], relPath))
+	}
+
+	return flatName(kindPrefixes[kind], relPath)
+}
+
+// docFileName returns the name of the documentation file of the given kind
+// for a package, using the package path relative to the module for uniqueness.
+// When grouping, it's placed inside the package's directory.
+func docFileName(moduleName, pkg, kind string) string {
+	relPkg := relativePackagePath(moduleName, pkg)
+	// Inside a directory the doc is named after its prefix, or its kind
+	base := strings.TrimSuffix(kindPrefixes[kind], "_")
+	if base == "" {
+		base = kind
+	}
+	base += docFileExt()
+
+	switch grouping {
+	case groupDir:
+		return path.Join(relPkg, base)
+	case groupPackage:
+		return path.Join(packageDirName(relPkg), base)
+	}
+
+	if relPkg == "." {
+		relPkg = pkg
+	}
+	if n, ok := docOrder[pkg]; ok {
+		return flatName(fmt.Sprintf("%s%03d_", kindPrefixes[kind], n+1), relPkg) + docFileExt()
+	}
+	return flatName(kindPrefixes[kind], relPkg) + docFileExt()
+}
+
+// projectFileName returns the name of a project-wide generated artifact such
+// as the directory structure
+func projectFileName(name string) string {
+	if grouping == groupPackage {
+		return path.Join(projectDirName, name)
+	}
+	return name
+}
+
+// linkFile places source at dest inside the sync directory, creating parent
+// directories as needed. Files are symlinked unless copy mode is enabled,
+// copies being sliced to the regions and condensed as set in opts, if given.
+func linkFile(source, dest string, opts *options) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+
+	if copyMode && opts != nil && opts.regions[source] != nil {
+		return copyRegions(source, dest, opts.regions[source], opts.cond)
+	}
+	if copyMode && opts != nil && opts.cond != nil {
+		return opts.cond.copyCondensed(source, dest)
+	}
+	if copyMode {
+		return copyFile(source, dest)
+	}
+	return os.Symlink(source, dest)
+}
+
+// copyFile copies the contents of source to dest. An existing dest is removed
+// first so that a symlink left by a previous run is never written through.
+func copyFile(source, dest string) error {
+	if err := os.Remove(dest); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
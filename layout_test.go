@@ -0,0 +1,78 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFlatName(t *testing.T) {
+	tests := []struct {
+		prefix, relPath, want string
+	}{
+		{"src_", "main.go", "src_main.go"},
+		{"src_", "cmd/app/main.go", "src_cmd_app_main.go"},
+		{"src_", filepath.Join("cmd", "app", "main.go"), "src_cmd_app_main.go"},
+		{"readme_", "internal/core/README.md", "readme_internal_core_README.md"},
+		{"", "a/b/c", "a_b_c"},
+		{"src_", "a_b/c.go", "src_a_b_c.go"},
+		{"src_", "a/b_c.go", "src_a_b_c.go"},
+	}
+	for _, tt := range tests {
+		if got := flatName(tt.prefix, tt.relPath); got != tt.want {
+			t.Errorf("flatName(%q, %q) = %q, want %q", tt.prefix, tt.relPath, got, tt.want)
+		}
+	}
+}
+
+func TestArtifactName(t *testing.T) {
+	defer func(g string) { grouping = g }(grouping)
+
+	tests := []struct {
+		grouping, kind, relPath, want string
+	}{
+		{groupFlat, kindSource, "pkg/models/user.go", "src_pkg_models_user.go"},
+		{groupFlat, kindReadme, "README.md", "readme_README.md"},
+		{groupFlat, kindReadme, "internal/core/README.md", "readme_internal_core_README.md"},
+		{groupFlat, kindSource, filepath.Join("pkg", "models", "user.go"), "src_pkg_models_user.go"},
+		{groupDir, kindSource, "pkg/models/user.go", "pkg/models/user.go"},
+		{groupDir, kindReadme, filepath.Join("internal", "core", "README.md"), "internal/core/README.md"},
+		{groupPackage, kindSource, "pkg/models/user.go", "pkg_models/user.go"},
+		{groupPackage, kindSource, "main.go", "_root/main.go"},
+		{groupPackage, kindReadme, "pkg/models/README.md", "_project/readme_pkg_models_README.md"},
+	}
+	for _, tt := range tests {
+		grouping = tt.grouping
+		if got := artifactName(tt.kind, tt.relPath); got != tt.want {
+			t.Errorf("artifactName(%q, %q) with grouping %s = %q, want %q", tt.kind, tt.relPath, tt.grouping, got, tt.want)
+		}
+	}
+}
+
+// Directory and file names containing underscores can flatten to the same
+// name, which the registry rejects instead of overwriting the first file
+func TestFlatNameCollision(t *testing.T) {
+	defer func(g string) { grouping = g }(grouping)
+	grouping = groupFlat
+
+	dir := t.TempDir()
+	first := filepath.Join(dir, "a_b", "c.go")
+	second := filepath.Join(dir, "a", "b_c.go")
+
+	name := artifactName(kindSource, "a_b/c.go")
+	if other := artifactName(kindSource, "a/b_c.go"); other != name {
+		t.Fatalf("expected a_b/c.go and a/b_c.go to flatten to the same name, got %q and %q", name, other)
+	}
+
+	r := newArtifactRegistry()
+	if err := r.register(&artifact{Name: name, Kind: kindSource, Source: first}); err != nil {
+		t.Fatalf("registering %s: %v", first, err)
+	}
+	err := r.register(&artifact{Name: name, Kind: kindSource, Source: second})
+	if err == nil || !strings.Contains(err.Error(), "name collision") {
+		t.Fatalf("registering %s under the name of %s: got %v, want a name collision", second, first, err)
+	}
+	if got := r.byName[name].Source; got != first {
+		t.Errorf("%s is registered for %s, want the first file %s", name, got, first)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// licenseHeaderLines is how many lines at the top of a file are searched for
+// a license header
+const licenseHeaderLines = 40
+
+// spdxIdentifier matches an SPDX license identifier line
+var spdxIdentifier = regexp.MustCompile(`SPDX-License-Identifier:\s*([^\s*/]+(?:\s+(?:OR|AND|WITH)\s+[^\s*/]+)*)`)
+
+// licensePatterns identify common license headers by their text, most
+// specific first. The names are SPDX identifiers.
+var licensePatterns = []struct {
+	name  string
+	texts []string
+}{
+	{"AGPL-3.0", []string{"gnu affero general public license"}},
+	{"LGPL-3.0", []string{"gnu lesser general public license", "version 3"}},
+	{"LGPL-2.1", []string{"gnu lesser general public license", "version 2.1"}},
+	{"GPL-3.0", []string{"gnu general public license", "version 3"}},
+	{"GPL-2.0", []string{"gnu general public license", "version 2"}},
+	{"Apache-2.0", []string{"apache license", "version 2.0"}},
+	{"MPL-2.0", []string{"mozilla public license", "2.0"}},
+	{"MIT", []string{"permission is hereby granted, free of charge"}},
+	{"BSD-3-Clause", []string{"redistribution and use in source and binary forms", "neither the name"}},
+	{"BSD-2-Clause", []string{"redistribution and use in source and binary forms"}},
+	{"ISC", []string{"permission to use, copy, modify, and/or distribute this software"}},
+	{"BSD-3-Clause", []string{"use of this source code is governed by a bsd-style license"}},
+}
+
+// detectLicense returns the SPDX identifier of the license declared at the
+// top of a file, either as an SPDX-License-Identifier line or by the text of a
+// common license header, or "" if none is found
+func detectLicense(content []byte) string {
+	var header []string
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for i := 0; i < licenseHeaderLines && scanner.Scan(); i++ {
+		line := scanner.Text()
+		if m := spdxIdentifier.FindStringSubmatch(line); m != nil {
+			return m[1]
+		}
+		header = append(header, strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "/*#")))
+	}
+
+	// Headers wrap lines anywhere, so the text is matched as a single line
+	text := strings.ToLower(strings.Join(strings.Fields(strings.Join(header, " ")), " "))
+	for _, pattern := range licensePatterns {
+		matched := true
+		for _, t := range pattern.texts {
+			if !strings.Contains(text, t) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return pattern.name
+		}
+	}
+	return ""
+}
+
+// fileLicense detects the license of the file at path from its first bytes
+func fileLicense(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	buf := make([]byte, 8*1024)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return ""
+	}
+	return detectLicense(buf[:n])
+}
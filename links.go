@@ -0,0 +1,198 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// danglingLink is a symlink of the sync directory whose target doesn't resolve
+type danglingLink struct {
+	name   string // path relative to the sync directory, slash-separated
+	target string
+
+	// recorded is set for links recorded as artifacts, created by a sync;
+	// the others are unrelated files of the sync directory
+	recorded bool
+}
+
+// findDanglingLinks stats the target of every symlink of the sync directory
+// and returns the links that don't resolve, telling those recorded apart
+func findDanglingLinks(outputPath string, recorded map[string]bool) []danglingLink {
+	var links []danglingLink
+	filepath.Walk(outputPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			if info.Name() == stateDirName {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			return nil
+		}
+		if _, err := os.Stat(path); err == nil {
+			return nil
+		}
+
+		name, err := filepath.Rel(outputPath, path)
+		if err != nil {
+			return nil
+		}
+		target, _ := os.Readlink(path)
+		name = filepath.ToSlash(name)
+		links = append(links, danglingLink{name: name, target: target, recorded: recorded[name]})
+		return nil
+	})
+	return links
+}
+
+// removeLink removes a link of the sync directory and the directories it
+// leaves empty
+func removeLink(outputPath, name string) error {
+	linkPath := filepath.Join(outputPath, filepath.FromSlash(name))
+	if err := os.Remove(linkPath); err != nil {
+		return err
+	}
+	removeEmptyParents(outputPath, filepath.Dir(linkPath))
+	return nil
+}
+
+// unregister drops an artifact from the registry
+func (r *artifactRegistry) unregister(name string) {
+	a, ok := r.byName[name]
+	if !ok {
+		return
+	}
+	delete(r.byName, name)
+	if a.Source != "" {
+		delete(r.bySource, resolveSourcePath(a.Source))
+	}
+	for i, other := range r.artifacts {
+		if other == a {
+			r.artifacts = append(r.artifacts[:i], r.artifacts[i+1:]...)
+			break
+		}
+	}
+}
+
+// verifyLinks checks the links of the sync just written, which dangle when a
+// source moved during the sync. With prune, the dangling links of the sync are
+// removed and dropped from the registry; unrelated links are only reported.
+func verifyLinks(outputPath string, registry *artifactRegistry, prune bool, rep *reporter) {
+	recorded := make(map[string]bool)
+	for _, a := range registry.artifacts {
+		recorded[a.Name] = true
+	}
+
+	links := findDanglingLinks(outputPath, recorded)
+	for _, l := range links {
+		switch {
+		case !l.recorded:
+			rep.warn("dangling link %s -> %s, not created by gocontext", l.name, l.target)
+		case prune:
+			if err := removeLink(outputPath, l.name); err != nil {
+				rep.warn("could not remove dangling link %s: %v", l.name, err)
+				continue
+			}
+			registry.unregister(l.name)
+			rep.info("Removed dangling link: %s -> %s", l.name, l.target)
+		default:
+			rep.warn("dangling link %s -> %s", l.name, l.target)
+		}
+	}
+	if len(links) == 0 {
+		rep.info("Every link of the sync directory resolves")
+	}
+}
+
+// runVerifyLinksCommand reports the dangling links of a sync directory,
+// telling those of the sync from unrelated files using the manifest, and
+// exits non-zero if any of the sync is left
+func runVerifyLinksCommand(args []string) int {
+	fs := flag.NewFlagSet("verify-links", flag.ExitOnError)
+	prune := fs.Bool("prune", false, "Remove the dangling links recorded in the manifest and drop them from it")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fmt.Println("Usage: gocontext verify-links [-prune] <dir>")
+		return 2
+	}
+	outputPath, err := filepath.Abs(fs.Arg(0))
+	if err != nil {
+		fmt.Printf("Error resolving %s: %v\n", fs.Arg(0), err)
+		return 1
+	}
+
+	m, err := readManifest(outputPath)
+	if err != nil {
+		fmt.Printf("Error: %s is not a sync directory: %v\n", outputPath, err)
+		return 1
+	}
+	recorded := make(map[string]bool)
+	for _, a := range m.Artifacts {
+		recorded[a.Name] = true
+	}
+
+	var ours, unrelated []danglingLink
+	for _, l := range findDanglingLinks(outputPath, recorded) {
+		if l.recorded {
+			ours = append(ours, l)
+		} else {
+			unrelated = append(unrelated, l)
+		}
+	}
+
+	if *prune && len(ours) > 0 {
+		removed := make(map[string]bool)
+		var left []danglingLink
+		for _, l := range ours {
+			if err := removeLink(outputPath, l.name); err != nil {
+				fmt.Printf("Error removing %s: %v\n", l.name, err)
+				left = append(left, l)
+				continue
+			}
+			removed[l.name] = true
+			fmt.Printf("Removed %s -> %s\n", l.name, l.target)
+		}
+
+		var artifacts []*artifact
+		for _, a := range m.Artifacts {
+			if !removed[a.Name] {
+				artifacts = append(artifacts, a)
+			}
+		}
+		m.Artifacts = artifacts
+		if err := saveManifest(outputPath, m); err != nil {
+			fmt.Printf("Error updating the manifest: %v\n", err)
+			return 1
+		}
+		ours = left
+	}
+
+	for _, group := range []struct {
+		title string
+		links []danglingLink
+	}{
+		{"Dangling links of the sync", ours},
+		{"Dangling links not created by gocontext", unrelated},
+	} {
+		if len(group.links) == 0 {
+			continue
+		}
+		fmt.Printf("%s (%d):\n", group.title, len(group.links))
+		for _, l := range group.links {
+			fmt.Printf("  %s -> %s\n", l.name, l.target)
+		}
+	}
+
+	if len(ours) > 0 {
+		fmt.Printf("Found %d dangling link(s), remove them with -prune\n", len(ours))
+		return 1
+	}
+	fmt.Println("Every link of the sync resolves")
+	return 0
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// lockFileName is the name of the file pinning the packages of a project,
+// kept in the project root next to go.sum
+const lockFileName = "gocontext.lock"
+
+// lockFileHeader is written at the top of the lock file
+const lockFileHeader = "# Packages processed by gocontext, one import path per line.\n# Regenerate with -lock; -frozen fails when discovery diverges.\n"
+
+// readLockFile reads the package list of a lock file
+func readLockFile(projectPath string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(projectPath, lockFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	var packages []string
+	for _, line := range splitAndTrim(string(data), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			packages = append(packages, line)
+		}
+	}
+	return packages, nil
+}
+
+// writeLockFile writes the sorted package list to the lock file
+func writeLockFile(projectPath string, packages []string) error {
+	sorted := make([]string, len(packages))
+	copy(sorted, packages)
+	sort.Strings(sorted)
+
+	var b strings.Builder
+	b.WriteString(lockFileHeader)
+	for _, pkg := range sorted {
+		fmt.Fprintf(&b, "%s\n", pkg)
+	}
+
+	return writeFileAtomic(filepath.Join(projectPath, lockFileName), []byte(b.String()))
+}
+
+// comparePackageSets returns the packages of current missing from locked, and
+// the packages of locked missing from current, both sorted
+func comparePackageSets(locked, current []string) (added, removed []string) {
+	lockedSet := make(map[string]bool)
+	for _, pkg := range locked {
+		lockedSet[pkg] = true
+	}
+	currentSet := make(map[string]bool)
+	for _, pkg := range current {
+		currentSet[pkg] = true
+		if !lockedSet[pkg] {
+			added = append(added, pkg)
+		}
+	}
+	for _, pkg := range locked {
+		if !currentSet[pkg] {
+			removed = append(removed, pkg)
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+// checkLockFile fails if the packages differ from those of the lock file,
+// listing the differences
+func checkLockFile(projectPath string, packages []string) error {
+	locked, err := readLockFile(projectPath)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("-frozen: %s not found in %s, create it with -lock", lockFileName, projectPath)
+	} else if err != nil {
+		return fmt.Errorf("-frozen: could not read %s: %v", lockFileName, err)
+	}
+
+	added, removed := comparePackageSets(locked, packages)
+	if len(added) == 0 && len(removed) == 0 {
+		return nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "-frozen: packages differ from %s:", filepath.Join(projectPath, lockFileName))
+	for _, pkg := range added {
+		fmt.Fprintf(&b, "\n  + %s", pkg)
+	}
+	for _, pkg := range removed {
+		fmt.Fprintf(&b, "\n  - %s", pkg)
+	}
+	b.WriteString("\nRun with -lock to accept the new package set")
+	return fmt.Errorf("%s", b.String())
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
@@ -8,77 +10,466 @@ import (
 	"os/exec"
 	"path"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 )
 
 func main() {
+	start := time.Now()
+
 	// Parse command line arguments
-	projectPath := flag.String("project", "", "Path to the Go project (default: current directory)")
-	outputPath := flag.String("output", "", "Path for the sync directory (default: ~/.gocontext/<module-name>)")
+	var projectPaths stringList
+	flag.Var(&projectPaths, "project", "Path to the Go project (default: current directory); repeat or comma-separate to merge several projects")
+	workspaceFlag := flag.Bool("workspace", false, "Sync the modules of the go.work workspace the project is part of, each into its own namespace; a go.work at the project root is used without it")
+	outputPath := flag.String("output", "", "Path for the sync directory (default: $GOCONTEXT_HOME/<module-name>, else $XDG_DATA_HOME/gocontext/<module-name> on Linux, else ~/.gocontext/<module-name>)")
 	includeFlag := flag.String("include", "", "Comma-separated list of directories or packages to include source code from")
 	excludeFlag := flag.String("exclude", "", "Comma-separated list of directories or packages to exclude")
+	includeFromFlag := flag.String("include-from", "", "File listing directories or packages to include source code from, one per line with # comments; merged with -include")
+	excludeFromFlag := flag.String("exclude-from", "", "File listing directories or packages to exclude, one per line with # comments; merged with -exclude")
 	cleanFlag := flag.Bool("clean", false, "Remove existing sync directory before creating a new one")
+	flag.IntVar(&jobs, "jobs", jobs, "Number of files checked against .gitignore, linked or documented with -doc-command concurrently")
+	resumeFlag := flag.Bool("resume", false, "Resume a partial sync, interrupted or out of -max-runtime, without writing again the docs it already wrote; a normal sync if the last one completed")
+	verifyLinksFlag := flag.Bool("verify-links", false, "After the sync, report the links of the sync directory whose target doesn't resolve")
+	pruneDanglingFlag := flag.Bool("prune-dangling", false, "Remove the dangling links of the sync found after it and drop them from the manifest; implies -verify-links")
+	remoteFlag := flag.String("remote", "", "Push the sync directory to [user@]host:/path after a successful sync (rsync, or scp as fallback)")
+	noCacheFlag := flag.Bool("no-cache", false, "Resolve every package directory with go list instead of reading them from the cache of the sync directory")
 	verboseFlag := flag.Bool("verbose", false, "Enable verbose logging")
+	var assetDirs stringList
+	flag.Var(&assetDirs, "asset-dir", "Directory to recursively include all files from, regardless of whether it contains Go code (repeatable)")
+	var migrationDirs stringList
+	flag.Var(&migrationDirs, "migrations", "Directory of SQL migrations to link in the order they are applied, indexed in "+migrationsIndexFileName+" (repeatable)")
+	skipDownFlag := flag.Bool("skip-down-migrations", false, "Leave out the down migrations of -migrations")
+	var includeRegions stringList
+	flag.Var(&includeRegions, "include-region", "Lines of a file to include, as path:start-end, the rest replaced by an omitted-lines marker; requires -copy, -bundle, -archive, -output-stdout-json or a single-file -format (repeatable, ranges of the same file are merged)")
+	buildFilesFlag := flag.Bool("build-files", true, "Link the Makefile, Dockerfiles, compose files and CI workflows of the project with a build_ prefix")
+	var configFileGlobs stringList
+	flag.Var(&configFileGlobs, "config-files", "Glob of config files relative to the project to link with a cfg_ prefix, e.g. 'configs/*.yaml'; values of secret-looking keys are masked when copied or bundled (repeatable)")
+	onlyFlag := flag.String("only", "", "Comma-separated list of packages of the module to sync, e.g. mymod/foo,mymod/bar: only their docs, READMEs and included sources are written again, the rest of the sync directory is left as is")
+	sinceTagFlag := flag.String("since-tag", "", "Only process the packages with changes since the given git tag, and write changes.txt listing them")
+	var modifiedWithin age
+	flag.Var(&modifiedWithin, "modified-within", "Only process the packages whose source was modified within the given age, e.g. 90d, 2w or 36h, by the last commit touching it in a git repository and its modification time otherwise")
+	diffContextFlag := flag.String("diff-context", "", "Write the diff of every file changed since the given git ref, committed or not, as diff_<path>.diff and only document the touched packages")
+	diffContextLinesFlag := flag.Int("diff-context-lines", 3, "Lines of context around the hunks of -diff-context")
+	excludeSuffixFlag := flag.String("exclude-suffix", "", "Comma-separated list of suffixes of the last import path element of packages to exclude, e.g. _mock,test")
+	flag.Var(&excludeFilePatterns, "exclude-file", "Regular expression of project-relative file paths never to include, e.g. '_mock\\.go$' (repeatable)")
+	flag.Var(&includeFilePatterns, "include-file-pattern", "Regular expression of project-relative file paths to include from included directories; other files are skipped (repeatable)")
+	stubsFlag := flag.Bool("stubs", false, "Write stub_<pkg>.go.txt with the declarations of every package whose sources aren't included, function bodies elided")
+	includeStubsFlag := flag.String("include-stubs", "", "Comma-separated list of directories or packages to write stubs of, function bodies elided")
+	linkDirsFlag := flag.Bool("link-dirs", false, "Symlink each included package directory as a whole instead of its individual files")
+	skipSubmodulesFlag := flag.Bool("skip-submodules", false, "Exclude git submodules entirely")
+	flag.StringVar(&docFormat, "doc-format", docFormatText, "Format of the documentation files: text (go doc output), md (markdown rendered from go/doc) or pretty (go doc -all like text listing the promoted fields and methods of each type, type-checked with go/types)")
+	docExtFlag := flag.String("doc-ext", "", "Extension of the documentation files, e.g. .ctx (default: .txt, or .md with -doc-format md)")
+	docPrefixFlag := flag.String("doc-prefix", kindPrefixes[kindDoc], "Name prefix of the documentation files in the flat layout, possibly empty")
+	srcPrefixFlag := flag.String("src-prefix", kindPrefixes[kindSource], "Name prefix of the linked source files in the flat layout, possibly empty")
+	readmePrefixFlag := flag.String("readme-prefix", kindPrefixes[kindReadme], "Name prefix of the linked READMEs in the flat layout, possibly empty")
+	synopsisOnlyFlag := flag.Bool("doc-synopsis-only", false, "Extract only the package synopsis and top-level symbol list instead of the full documentation")
+	var unexportedPrefixes stringList
+	flag.Var(&unexportedPrefixes, "unexported-prefix", "Import path prefix of the packages documented with their unexported declarations (go doc -u), e.g. mymod/internal; others only document the exported API (repeatable)")
+	docCommandsFlag := make(docCommands)
+	flag.Var(docCommandsFlag, "doc-command", "Document the linked files with an extension by running a command from the project, as .ext=command, e.g. '.proto=protoc --doc_out={out} {file}'; {file} is the file's path, the doc is written to {out} or stdout (repeatable)")
+	signaturesOnlyFlag := flag.Bool("signatures-only", false, "Write only the signatures of the exported declarations of each package, without any prose, instead of the documentation")
+	flag.BoolVar(&copyMode, "copy", false, "Copy files into the sync directory instead of symlinking them")
+	flag.StringVar(&grouping, "group", groupFlat, "Layout of the sync directory: flat (prefixed names), dir (mirror the project hierarchy) or package (one directory per package)")
+	groupByDirFlag := flag.Bool("group-by-dir", false, "Shorthand for -group=dir")
+	maxRuntimeFlag := flag.Duration("max-runtime", 0, "Stop extracting once the run takes this long, e.g. 30s, and write what was produced so far as a partial sync (0 for no limit)")
+	retriesFlag := flag.Int("retries", goAttempts-1, "Number of times to retry go commands that fail transiently, e.g. on network errors")
+	sniffFlag := flag.Bool("sniff", false, "Also include files with other extensions when their content looks like text (reads every candidate file)")
+	includeEmbedFlag := flag.Bool("include-embed", false, "Include the files referenced by //go:embed directives (embed_<path>)")
+	importsFlag := flag.Bool("imports", false, "Write imports.txt listing the intra-module imports of each package")
+	apiSummaryFlag := flag.Bool("api-summary", true, "Write proto_summary.txt for the .proto files of included directories and http_api_summary.txt for the OpenAPI definitions of the project")
+	xrefFlag := flag.Bool("xref", false, "Write "+xrefFileName+" mapping every exported type and function to the packages of the module referencing it; type-checks every package, so it's slow")
+	xrefIncludedFlag := flag.Bool("xref-included-only", false, "Only cross-reference the symbols of the packages included with -include; implies -xref")
+	symbolIndexFlag := flag.Bool("symbol-index", false, "Write "+symbolsFileName+" with every exported symbol, its kind, package and one-line declaration")
+	analyzeFlag := flag.Bool("analyze", false, "Write "+structureAnalysisFileName+" with the import cycles through tests, near-cycles and packages with an unusually high fan-in of the module")
+	errorsCatalogFlag := flag.Bool("errors-catalog", false, "Write "+errorsCatalogFileName+" listing the error types, sentinel errors with their messages and functions returning concrete error types of every package")
+	constantsFlag := flag.Bool("constants", false, "Write constants_<pkg>.txt for every package with exported constants, listing their types, evaluated values and docs")
+	cliFlagsFlag := flag.Bool("cli-flags", false, "Write "+cliFlagsFileName+", an inventory of the flags registered by the processed packages, grouped by name")
+	cmdDocsFlag := flag.Bool("cmd-docs", true, "Write cmd_<name>.txt for every main package with its package comment, usage strings and flags")
+	noDocsFlag := flag.Bool("no-docs", false, "Skip extracting package documentation")
+	noSourceFlag := flag.Bool("no-source", false, "Skip linking the source files of included directories, packages and files")
+	noReadmeFlag := flag.Bool("no-readme", false, "Skip linking README files")
+	todosFlag := flag.Bool("todos", false, "Write todos.txt listing the TODO comments of the processed packages, with author and age from git blame")
+	todoMarkersFlag := flag.String("todo-markers", defaultTodoMarkers, "Comma-separated list of the words marking comments listed by -todos")
+	coverProfileFlag := flag.String("coverprofile", "", "Coverage profile written by go test -coverprofile to summarize in coverage.txt, relative to the project (default: "+defaultCoverProfile+" if present)")
+	coverageThresholdFlag := flag.Float64("coverage-threshold", defaultCoverageThreshold, "Statement coverage in percent under which coverage.txt lists a file")
+	statsFlag := flag.Bool("stats", false, "Write stats.txt with the files, lines, comment, test and generated lines of each package")
+	statsFormatFlag := flag.String("stats-format", statsFormatText, "Format of the -stats table: text or csv (written to stats.csv)")
+	benchmarksFlag := flag.Bool("benchmarks", false, "Write benchmarks.txt listing the Benchmark functions of each package")
+	followTestDepsFlag := flag.Bool("follow-test-deps", false, "Also document the packages of the module imported only by the tests of the processed packages")
+	noDefaultExcludesFlag := flag.Bool("no-default-excludes", false, "Also walk .git, node_modules, vendor, testdata and build output directories for READMEs and source files")
+	structureDepthFlag := flag.Int("structure-depth", 0, "Only list the directory structure this many levels deep (0: unlimited)")
+	structureMaxEntriesFlag := flag.Int("structure-max-entries", 0, "Truncate the listing of every directory of the directory structure after this many entries, with a line counting the rest (0: unlimited)")
+	structureJSONFlag := flag.Bool("structure-json", false, "Also write "+structureJSONFileName+", the directory structure as nested JSON objects with the size of every entry and the package name of Go files")
+	vcsInfoFlag := flag.Bool("include-vcs-info", false, "Write vcs_info.txt with the commit, branch, dirty state and origin URL of the project")
+	orderedNamesFlag := flag.Bool("ordered-names", false, "Number doc file names in dependency order (doc_001_<pkg>.txt), flat layout only")
+	var moduleAliasList stringList
+	flag.Var(&moduleAliasList, "module-alias", "Module path alias upstream/path=local/path, so include/exclude packages can be given with either prefix (repeatable)")
+	bundleFlag := flag.String("bundle", "", "Also write the sync as a single file in the repomix layout to this path, from the same run as the sync directory")
+	archiveFlag := flag.String("archive", "", "Also write the files of the context into an archive at this path, .tar.gz, .tgz or .zip, from the same run as the other outputs")
+	formatFlag := flag.String("format", formatDir, "Output format: dir (sync directory of links and generated files), repomix (a single "+repomixFileName+" in the repomix XML layout) or chatml (a single "+chatMLFileName+" of the messages of a chat completions request)")
+	messageSize := byteSize(100 << 10)
+	flag.Var(&messageSize, "max-message-size", "Largest content of a message of -format=chatml; larger files are split across messages")
+	stdoutFlag := flag.Bool("stdout", false, "Write the output of a single-file -format to stdout instead of the sync directory; messages go to stderr")
+	stdoutJSONFlag := flag.Bool("output-stdout-json", false, "Write the context to stdout as a single JSON object of the module, its packages with their docs and files, and the directory structure; messages go to stderr")
+	clipboardFlag := flag.Bool("clipboard", false, "Copy the output of a single-file -format to the system clipboard (pbcopy, xclip, xsel, wl-copy or clip.exe)")
+	embedContentFlag := flag.Bool("embed-content", false, "Inline the content of every file into manifest.json as a JSON string")
+	tokenizerFlag := flag.String("tokenizer", tokenizerHeuristic, "Tokenizer of the token counts of the manifest: heuristic (bytes/4) or cl100k (exact)")
+	tokenizerVocabFlag := flag.String("tokenizer-vocab", "", "cl100k_base.tiktoken vocabulary of -tokenizer=cl100k in place of the built-in one")
+	var warnSize, maxSize byteSize
+	flag.Var(&warnSize, "warn-size", "Warn with the largest artifacts when the total size of the context exceeds this size, e.g. 2MB (k, m, g suffixes)")
+	flag.Var(&maxSize, "max-size", "Fail with exit code 4 when the total size of the context exceeds this size, leaving the output intact")
+	maxFileSizeFlag := flag.Int64("max-file-size", 1<<20, "Largest file, in bytes, whose content is inlined with -embed-content or that is linked with -build-files")
+	flag.BoolVar(&stripComments, "strip-comments", false, "Write included Go files without comments, except build constraints, directives and cgo preambles (copies them)")
+	condenseFlag := flag.Bool("condense", false, "Trim trailing whitespace, collapse blank lines and keep repeated license headers only once in copied (-copy) or single-file output")
+	licenseHeaderFlag := flag.String("license-header", "", "File with the license header block -condense drops from every file (default: the header of the first file that has one)")
+	lockFlag := flag.Bool("lock", false, "Write the processed packages to "+lockFileName+" in the project root")
+	frozenFlag := flag.Bool("frozen", false, "Fail if the processed packages differ from those of "+lockFileName)
+	forceFlag := flag.Bool("force", false, "Sync even if nothing changed since the last sync")
+	profileFlag := flag.String("profile", "", "Name of the profile of "+configFileName+" to use")
+
+	// Dispatch subcommands, which are handled before the main flags are parsed
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
 	flag.Parse()
 
-	// Use current directory if project path not specified
-	if *projectPath == "" {
-		currentDir, err := os.Getwd()
-		if err != nil {
-			fmt.Printf("Error getting current directory: %v\n", err)
+	if *remoteFlag != "" {
+		if _, _, err := parseRemote(*remoteFlag); err != nil {
+			fmt.Printf("Error: %v\n", err)
 			os.Exit(1)
 		}
-		*projectPath = currentDir
+	}
+
+	if *retriesFlag < 0 {
+		fmt.Println("Error: -retries must not be negative")
+		os.Exit(1)
+	}
+	goAttempts = *retriesFlag + 1
+	if *maxRuntimeFlag > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(context.Background(), *maxRuntimeFlag)
+		defer cancel()
+	}
+	runCtx = handleInterrupts(runCtx)
 
-		if *verboseFlag {
-			fmt.Printf("No project path specified, using current directory: %s\n", *projectPath)
+	if *groupByDirFlag {
+		grouping = groupDir
+	}
+	if err := validateGrouping(grouping); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := validateDocFormat(docFormat); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := configureNaming(*docExtFlag, *docPrefixFlag, *srcPrefixFlag, *readmePrefixFlag); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := validateFormat(*formatFlag); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if (*stdoutFlag || *clipboardFlag) && *formatFlag == formatDir {
+		fmt.Printf("Error: -stdout and -clipboard require a single-file -format such as %s\n", formatRepomix)
+		os.Exit(1)
+	}
+	if *structureDepthFlag < 0 || *structureMaxEntriesFlag < 0 {
+		fmt.Println("Error: -structure-depth and -structure-max-entries must not be negative")
+		os.Exit(1)
+	}
+	if messageSize < minMessageSize {
+		fmt.Printf("Error: -max-message-size must be at least %s\n", formatSize(minMessageSize))
+		os.Exit(1)
+	}
+	if *maxFileSizeFlag <= 0 {
+		fmt.Println("Error: -max-file-size must be positive")
+		os.Exit(1)
+	}
+	if *bundleFlag != "" && *formatFlag != formatDir {
+		fmt.Printf("Error: -bundle requires -format=%s, -format=%s already writes a single file\n", formatDir, *formatFlag)
+		os.Exit(1)
+	}
+	if *archiveFlag != "" {
+		if err := validateArchivePath(*archiveFlag); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
 		}
 	}
+	if *stdoutJSONFlag && (*formatFlag != formatDir || *stdoutFlag || *clipboardFlag || *bundleFlag != "" || *archiveFlag != "" || *remoteFlag != "") {
+		fmt.Println("Error: -output-stdout-json can't be combined with -format, -stdout, -clipboard, -bundle, -archive or -remote")
+		os.Exit(1)
+	}
+	if *condenseFlag && !copyMode && *formatFlag == formatDir && *bundleFlag == "" && *archiveFlag == "" && !*stdoutJSONFlag {
+		fmt.Println("Error: -condense only applies to copied files (-copy), -bundle, -archive, -output-stdout-json or a single-file -format")
+		os.Exit(1)
+	}
+	if *onlyFlag != "" && (*formatFlag != formatDir || *stdoutFlag || *stdoutJSONFlag || *clipboardFlag || *bundleFlag != "" || *archiveFlag != "" || *orderedNamesFlag || *cleanFlag) {
+		fmt.Println("Error: -only updates a sync directory in place and can't be combined with -format, -stdout, -output-stdout-json, -clipboard, -bundle, -archive, -ordered-names or -clean")
+		os.Exit(1)
+	}
+	if *diffContextFlag != "" && *sinceTagFlag != "" {
+		fmt.Println("Error: -diff-context and -since-tag both scope the sync to changes, give only one")
+		os.Exit(1)
+	}
+	if *diffContextLinesFlag < 0 {
+		fmt.Println("Error: -diff-context-lines must not be negative")
+		os.Exit(1)
+	}
+	if len(includeRegions) > 0 && !copyMode && *formatFlag == formatDir && *bundleFlag == "" && *archiveFlag == "" && !*stdoutJSONFlag {
+		fmt.Println("Error: -include-region slices file contents, which requires copied files (-copy), -bundle, -archive, -output-stdout-json or a single-file -format")
+		os.Exit(1)
+	}
+	for _, entry := range includeRegions {
+		if _, _, err := parseIncludeRegion(entry); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if warnSize > 0 && maxSize > 0 && warnSize > maxSize {
+		fmt.Println("Error: -warn-size must not exceed -max-size")
+		os.Exit(1)
+	}
+	if *statsFormatFlag != statsFormatText && *statsFormatFlag != statsFormatCSV {
+		fmt.Printf("Error: unknown -stats-format %q, expected %s or %s\n", *statsFormatFlag, statsFormatText, statsFormatCSV)
+		os.Exit(1)
+	}
+	if *noDocsFlag && *noSourceFlag && *noReadmeFlag {
+		fmt.Println("Warning: -no-docs, -no-source and -no-readme together leave only the directory structure and reports")
+	}
+	if *signaturesOnlyFlag && *synopsisOnlyFlag {
+		fmt.Println("Error: -signatures-only can't be combined with -doc-synopsis-only")
+		os.Exit(1)
+	}
+	if jobs < 1 {
+		fmt.Println("Error: -jobs must be at least 1")
+		os.Exit(1)
+	}
+	if *resumeFlag && *cleanFlag {
+		fmt.Println("Error: -resume can't be combined with -clean")
+		os.Exit(1)
+	}
+	if *lockFlag && *frozenFlag {
+		fmt.Println("Error: -lock can't be combined with -frozen")
+		os.Exit(1)
+	}
+	if *stdoutFlag && *remoteFlag != "" {
+		fmt.Println("Error: -stdout can't be combined with -remote")
+		os.Exit(1)
+	}
 
-	// Convert to absolute path
-	absProjectPath, err := filepath.Abs(*projectPath)
+	// With -stdout, stdout carries the context and every message goes to stderr
+	contextOut := os.Stdout
+	if *stdoutFlag || *stdoutJSONFlag {
+		os.Stdout = os.Stderr
+	}
+	rep := newReporter(os.Stdout, *verboseFlag)
+
+	aliases, err := parseModuleAliases(moduleAliasList)
 	if err != nil {
-		fmt.Printf("Error resolving project path: %v\n", err)
+		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
+	for _, alias := range aliases {
+		rep.info("Module alias: %s = %s", alias.from, alias.to)
+	}
 
-	// Verify the directory is a Go project
-	if !isGoProject(absProjectPath) {
-		fmt.Printf("Error: %s does not appear to be a Go project\n", absProjectPath)
+	tok, err := newTokenizer(*tokenizerFlag, *tokenizerVocabFlag)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Copies are condensed as they are made, single-file output when rendered
+	var cond *condenser
+	if *condenseFlag {
+		if cond, err = newCondenser(*licenseHeaderFlag, tok); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	opts := &options{
+		include:         splitAndTrim(*includeFlag, ","),
+		exclude:         splitAndTrim(*excludeFlag, ","),
+		excludeSuffixes: splitAndTrim(*excludeSuffixFlag, ","),
+		only:            splitAndTrim(*onlyFlag, ","),
+		sinceTag:        *sinceTagFlag,
+		modifiedWithin:  time.Duration(modifiedWithin),
+		diffRef:         *diffContextFlag,
+		diffLines:       *diffContextLinesFlag,
+		stubs:           *stubsFlag,
+		includeStubs:    splitAndTrim(*includeStubsFlag, ","),
+		assetDirs:       assetDirs,
+		migrationDirs:   migrationDirs,
+		configFiles:     configFileGlobs,
+		includeRegions:  includeRegions,
+		buildFiles:      *buildFilesFlag,
+		maxFileSize:     *maxFileSizeFlag,
+		skipDown:        *skipDownFlag,
+		linkDirs:        *linkDirsFlag && *formatFlag == formatDir,
+		skipSubmodules:  *skipSubmodulesFlag,
+		synopsisOnly:    *synopsisOnlyFlag,
+		signaturesOnly:  *signaturesOnlyFlag,
+		sniff:           *sniffFlag,
+		includeEmbed:    *includeEmbedFlag,
+		imports:         *importsFlag,
+		vcsInfo:         *vcsInfoFlag,
+		structureJSON:   *structureJSONFlag,
+		structureLimits: structureLimits{depth: *structureDepthFlag, maxEntries: *structureMaxEntriesFlag},
+		benchmarks:      *benchmarksFlag,
+		followTestDeps:  *followTestDepsFlag,
+		cmdDocs:         *cmdDocsFlag,
+		cliFlags:        *cliFlagsFlag,
+		constants:       *constantsFlag,
+		errorsCatalog:   *errorsCatalogFlag,
+		analyze:         *analyzeFlag,
+		symbolIndex:     *symbolIndexFlag,
+		xref:            *xrefFlag || *xrefIncludedFlag,
+		xrefIncluded:    *xrefIncludedFlag,
+		apiSummary:      *apiSummaryFlag,
+		noDocs:          *noDocsFlag,
+		noSource:        *noSourceFlag,
+		noReadme:        *noReadmeFlag,
+		coverProfile:    *coverProfileFlag,
+		coverThreshold:  *coverageThresholdFlag,
+		stats:           *statsFlag,
+		statsFormat:     *statsFormatFlag,
+		todos:           *todosFlag,
+		todoMarkers:     splitAndTrim(*todoMarkersFlag, ","),
+		lock:            *lockFlag,
+		frozen:          *frozenFlag,
+		orderedNames:    *orderedNamesFlag,
+		aliases:         aliases,
+		docCommands:     docCommandsFlag,
+		regions:         make(fileRegions),
+		tokens:          tok,
+
+		unexportedPrefixes: unexportedPrefixes,
+	}
+	if *formatFlag == formatDir {
+		opts.cond = cond
+	}
+
+	// Resolve the project paths, using the current directory if not specified
+	if len(projectPaths) == 0 {
+		projectPaths = stringList{""}
+	}
+
+	projects, err := resolveProjects(projectPaths, *workspaceFlag, rep)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
 		fmt.Println("Make sure you're running this from a Go project directory or specify a valid project path with -project flag")
 		os.Exit(1)
 	}
+	if *onlyFlag != "" && len(projects) > 1 {
+		fmt.Println("Error: -only takes the packages of a single project")
+		os.Exit(1)
+	}
 
-	// Get module name for default output path
-	moduleName, err := getModuleName(absProjectPath)
-	if err != nil && *verboseFlag {
-		fmt.Printf("Warning: Couldn't determine module name: %v\n", err)
+	// Apply the config file of the first project, or of its workspace, flags
+	// take precedence
+	cfg, err := loadConfig(projects[0].rootPath())
+	if err != nil {
+		fmt.Printf("Error reading config: %v\n", err)
+		os.Exit(1)
 	}
 
-	// If no output path specified, use ~/.gocontext/<module-name>
-	if *outputPath == "" {
-		homeDir, err := os.UserHomeDir()
+	settings, err := cfg.resolve(*profileFlag)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	setFlags := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = true
+	})
+	if !setFlags["include"] && !setFlags["include-from"] {
+		opts.include = settings.Include
+	}
+	if !setFlags["exclude"] && !setFlags["exclude-from"] {
+		opts.exclude = settings.Exclude
+	}
+	for _, list := range []struct {
+		path    string
+		entries *[]string
+	}{
+		{*includeFromFlag, &opts.include},
+		{*excludeFromFlag, &opts.exclude},
+	} {
+		if list.path == "" {
+			continue
+		}
+		entries, err := readListFile(list.path)
 		if err != nil {
-			fmt.Printf("Error getting home directory: %v\n", err)
+			fmt.Printf("Error reading list file: %v\n", err)
 			os.Exit(1)
 		}
-
-		// Create a safe directory name from the module
-		dirName := "default"
-		if moduleName != "" {
-			dirName = strings.Replace(moduleName, "/", "_", -1)
-			dirName = strings.Replace(dirName, ".", "_", -1)
-		} else {
-			dirName = filepath.Base(absProjectPath)
+		*list.entries = append(*list.entries, entries...)
+	}
+	if settings.Extensions != nil {
+		sourceExtensions = extensionSet(settings.Extensions)
+	}
+	if *noDefaultExcludesFlag {
+		noiseDirs = make(map[string]bool)
+	}
+	for _, name := range settings.ExcludeDirs {
+		noiseDirs[name] = true
+	}
+	opts.buildFileGlobs = defaultBuildFiles
+	if settings.BuildFiles != nil {
+		opts.buildFileGlobs = settings.BuildFiles
+	}
+	if opts.redact, err = newRedactor(settings.RedactKeys); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(opts.configFiles) > 0 && *remoteFlag != "" && !copyMode {
+		rep.warn("config files are symlinked and pushed to %s unredacted, use -copy to mask their secrets", *remoteFlag)
+	}
+	if *outputPath == "" && settings.Output != "" {
+		*outputPath = settings.Output
+		if !filepath.IsAbs(*outputPath) {
+			*outputPath = filepath.Join(projects[0].rootPath(), *outputPath)
 		}
+	}
 
-		*outputPath = filepath.Join(homeDir, ".gocontext", dirName)
+	// If no output path specified, use ~/.gocontext/<module-name>[@<profile>]
+	if *outputPath == "" {
+		// The modules of a workspace are synced into the workspace's directory
+		workspace := projects[0].workspace
+		for _, p := range projects {
+			if p.workspace != workspace {
+				workspace = ""
+			}
+		}
+		if len(projects) > 1 && workspace == "" {
+			fmt.Println("Error: -output is required when syncing multiple projects")
+			os.Exit(1)
+		}
 
-		if *verboseFlag {
-			fmt.Printf("No output path specified, using: %s\n", *outputPath)
+		if workspace != "" {
+			*outputPath, err = defaultOutputPath("", workspace)
+		} else {
+			*outputPath, err = defaultOutputPath(projects[0].moduleName, projects[0].path)
+		}
+		if err != nil {
+			fmt.Printf("Error determining the default output path: %v\n", err)
+			os.Exit(1)
+		}
+		if *profileFlag != "" {
+			*outputPath += "@" + *profileFlag
 		}
+
+		baseDir, source, _ := contextHome()
+		rep.info("Base directory %s taken from %s (order: GOCONTEXT_HOME, XDG_DATA_HOME on Linux, ~/.gocontext)", baseDir, source)
+		rep.info("No output path specified, using: %s", *outputPath)
 	}
 
 	// Convert output path to absolute
@@ -87,98 +478,1185 @@ func main() {
 		fmt.Printf("Error resolving output path: %v\n", err)
 		os.Exit(1)
 	}
+	var bundlePath, archivePath string
+	if *bundleFlag != "" {
+		if bundlePath, err = filepath.Abs(*bundleFlag); err != nil {
+			fmt.Printf("Error resolving bundle path: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *archiveFlag != "" {
+		if archivePath, err = filepath.Abs(*archiveFlag); err != nil {
+			fmt.Printf("Error resolving archive path: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
-	// Parse filter lists
-	includeList := splitAndTrim(*includeFlag, ",")
-	excludeList := splitAndTrim(*excludeFlag, ",")
+	// Exit early when the projects haven't changed since the last sync
+	var stateArgs []string
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "clean", "force", "verbose", "jobs", "no-cache":
+			return
+		}
+		stateArgs = append(stateArgs, "-"+f.Name+"="+f.Value.String())
+	})
+	if configData, err := json.Marshal(settings); err == nil {
+		stateArgs = append(stateArgs, "config="+string(configData))
+	}
 
-	// Categorize includes and excludes based on whether they are packages or directories
-	includeDirsList, includePkgsList := categorizeIncludesExcludes(includeList, moduleName)
-	excludeDirsList, excludePkgsList := categorizeIncludesExcludes(excludeList, moduleName)
+	state, err := currentState(projects, stateArgs)
+	if err != nil {
+		rep.info("Not recording sync state: %v", err)
+	}
+	if state != nil && !*forceFlag && !*cleanFlag && !*stdoutFlag && !*stdoutJSONFlag && !*clipboardFlag {
+		if saved, err := readState(absOutputPath); err == nil && state.upToDate(saved) {
+			outputFile := manifestFileName
+			if *formatFlag != formatDir {
+				outputFile = formatFileName(*formatFlag)
+			}
+			_, bundleErr := os.Stat(bundlePath)
+			_, archiveErr := os.Stat(archivePath)
+			if _, err := os.Stat(filepath.Join(absOutputPath, outputFile)); err == nil && (bundlePath == "" || bundleErr == nil) && (archivePath == "" || archiveErr == nil) {
+				fmt.Printf("Context is up to date: %s\n", absOutputPath)
+				return
+			}
+		}
+	}
 
-	if *verboseFlag {
-		fmt.Printf("Include directories: %v\n", includeDirsList)
-		fmt.Printf("Include packages: %v\n", includePkgsList)
-		fmt.Printf("Exclude directories: %v\n", excludeDirsList)
-		fmt.Printf("Exclude packages: %v\n", excludePkgsList)
+	// Create sync directory, which isn't needed when writing to stdout
+	if *stdoutFlag || *stdoutJSONFlag {
+		// The output is rendered from the staging directory only
+	} else if err := createSyncDirectory(absOutputPath, *cleanFlag); err != nil {
+		fmt.Printf("Error creating sync directory: %v\n", err)
+		os.Exit(1)
+	} else {
+		rep.info("Created sync directory at: %s", absOutputPath)
 	}
 
-	// Check if the project is a git repository
-	isGitRepo := isGitRepository(absProjectPath)
-	if *verboseFlag && isGitRepo {
-		fmt.Println("Git repository detected, will respect .gitignore patterns")
+	// Single-file formats are rendered from a staging directory
+	syncPath := absOutputPath
+	if *formatFlag != formatDir || *stdoutJSONFlag {
+		if syncPath, err = os.MkdirTemp("", "gocontext-"); err != nil {
+			fmt.Printf("Error creating staging directory: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	removeStaging := func() {
+		if syncPath != absOutputPath {
+			os.RemoveAll(syncPath)
+		}
 	}
 
-	// Create sync directory
-	if err := createSyncDirectory(absOutputPath, *cleanFlag); err != nil {
-		fmt.Printf("Error creating sync directory: %v\n", err)
+	// The previous manifest decides the namespaces and what gets pruned
+	previous, err := readManifest(syncPath)
+	if err != nil {
+		previous = nil
+	}
+	docs = loadDocCache(syncPath)
+
+	// Package directories are resolved again when the modules or Go changed
+	var dirCache *pkgDirCache
+	if !*noCacheFlag {
+		if dirCache, err = currentPkgDirCache(projects); err != nil {
+			rep.info("Not caching package directories: %v", err)
+		} else if n := loadPkgDirCache(absOutputPath, dirCache); n > 0 {
+			rep.info("Loaded %d cached package directories", n)
+		}
+	}
+
+	// A partial sync is resumed with -resume, from the files it already wrote
+	if *resumeFlag {
+		if opts.resumed = loadResume(syncPath, previous); opts.resumed != nil {
+			rep.info("Resuming the partial sync of %s, %d files already written", previous.GeneratedAt.Format(time.RFC3339), len(opts.resumed.written))
+		} else {
+			rep.info("No partial sync to resume, syncing from scratch")
+		}
+	}
+
+	// Links dangling after their source was renamed or removed are dropped,
+	// still included files are linked again under their new names below
+	var danglingLinks []string
+	if syncPath == absOutputPath && !copyMode {
+		danglingLinks = removeDanglingLinks(syncPath, previous, rep)
+	}
+
+	// Sync every project, each into its own namespace when there are several
+	assignNamespaces(projects, previous)
+
+	registry := newArtifactRegistry()
+	namespaces := make(map[string]bool)
+	synced := make(map[string]bool)
+	var results []*syncResult
+	var entrypoints []entrypoint
+	for _, p := range projects {
+		namespaces[p.namespace] = true
+	}
+
+	for _, p := range projects {
+		if p.namespace != "" {
+			rep.info("Syncing project %s (%s) into %s/", p.namespace, p.path, p.namespace)
+		}
+
+		result, err := syncProject(p, opts, namespaces, syncPath, rep)
+		if err != nil && isInterrupted() {
+			// What was synced so far is still recorded
+			rep.warn("interrupted while syncing %s: %v", p.path, err)
+			break
+		} else if err != nil {
+			rep.error("could not sync %s: %v", p.path, err)
+			removeStaging()
+			os.Exit(1)
+		}
+		results = append(results, result)
+
+		// Record the artifacts under their namespace
+		for _, a := range result.registry.artifacts {
+			if p.namespace != "" {
+				a.Name = path.Join(p.namespace, a.Name)
+				a.Project = p.namespace
+			}
+			registry.register(a)
+		}
+		for _, pkg := range result.selected {
+			synced[p.namespace+" "+pkg] = true
+		}
+		entrypoints = append(entrypoints, result.entrypoints...)
+	}
+
+	m := &manifest{
+		Grouping:     grouping,
+		Copy:         copyMode,
+		DocFormat:    docFormat,
+		DocExt:       docExtension,
+		NamePrefixes: renamedPrefixes,
+		OrderedNames: docOrder != nil,
+		Entrypoints:  entrypoints,
+	}
+	if projects[0].namespace == "" {
+		m.Module = projects[0].moduleName
+		m.Project = projects[0].path
+		m.VCS = vcsKind(projects[0].path)
+	} else {
+		for _, p := range projects {
+			m.Projects = append(m.Projects, projectInfo{Name: p.namespace, Path: p.path, Module: p.moduleName, VCS: vcsKind(p.path)})
+		}
+	}
+
+	if previous != nil {
+		// Remove artifacts from the previous sync that weren't produced this time,
+		// leaving those of projects that aren't part of this invocation alone.
+		// A partial sync didn't get to produce them all, so it keeps them.
+		var scope *onlyScope
+		if len(opts.only) > 0 && len(results) == 1 {
+			scope = results[0].only
+		}
+		if registry.settlePrevious(runCtx, syncPath, previous, scope, namespaces, synced, rep) {
+			m.Entrypoints = previous.Entrypoints
+		}
+
+		// Keep recording the projects that weren't synced this time
+		for _, info := range previous.Projects {
+			if !namespaces[info.Name] {
+				m.Projects = append(m.Projects, info)
+			}
+		}
+		sort.Slice(m.Projects, func(i, j int) bool {
+			return m.Projects[i].Name < m.Projects[j].Name
+		})
+		for _, ep := range previous.Entrypoints {
+			if ep.Project != "" && !namespaces[ep.Project] {
+				m.Entrypoints = append(m.Entrypoints, ep)
+			}
+		}
+		for _, a := range previous.Artifacts {
+			if a.Project != "" && !namespaces[a.Project] {
+				registry.register(a)
+			}
+		}
+	}
+
+	// Index the packages of all the modules of a merged sync directory
+	if len(m.Projects) > 0 {
+		if err := writeCombinedIndex(syncPath, m.Projects, registry); err != nil {
+			rep.warn("could not write the combined package index: %v", err)
+		}
+	}
+	// Only a previous sync makes new links worth reporting
+	var newLinks []string
+	if previous != nil {
+		newLinks = registry.newlyLinked(previous)
+	}
+
+	// Check that the links resolve, a source may have moved during the sync
+	if *verifyLinksFlag || *pruneDanglingFlag {
+		verifyLinks(syncPath, registry, *pruneDanglingFlag, rep)
+	}
+
+	if *embedContentFlag {
+		embedContents(syncPath, registry, *maxFileSizeFlag, opts.redact)
+	}
+
+	// Measure the context, the manifest records whether it's over the limit
+	sizes, totalSize := artifactSizes(syncPath, registry)
+	m.OverLimit = maxSize > 0 && totalSize > int64(maxSize)
+	m.Partial = runCtx.Err() != nil
+	m.Interrupted = isInterrupted()
+
+	if err := writeManifest(syncPath, m, opts.tokens, registry); err != nil {
+		rep.error("could not write the manifest: %v", err)
+		removeStaging()
 		os.Exit(1)
 	}
 
-	if *verboseFlag {
-		fmt.Printf("Created sync directory at: %s\n", absOutputPath)
+	if dirCache != nil && !*stdoutFlag && !*stdoutJSONFlag {
+		if err := savePkgDirCache(absOutputPath, dirCache); err != nil {
+			rep.warn("could not save the package directory cache: %v", err)
+		}
+	}
+
+	// Write the outputs of the run from the same sync: the sync directory, a
+	// single-file -format or the JSON of -output-stdout-json, and -bundle
+	// and -archive alongside
+	meta := repomixMetadata{module: m.Module, generatedAt: m.GeneratedAt}
+	if meta.module == "" {
+		var modules []string
+		for _, p := range projects {
+			modules = append(modules, p.moduleName)
+		}
+		meta.module = strings.Join(modules, ",")
+	}
+	if state != nil && len(projects) == 1 {
+		meta.commit = state.Projects[projects[0].path].Head
+	}
+
+	var emitters []emitter
+	switch {
+	case *stdoutJSONFlag:
+		emitters = append(emitters, &jsonEmitter{out: contextOut})
+	case *formatFlag == formatDir:
+		emitters = append(emitters, &dirEmitter{path: absOutputPath})
+	default:
+		single := &fileEmitter{
+			format:         *formatFlag,
+			path:           filepath.Join(absOutputPath, formatFileName(*formatFlag)),
+			clipboard:      *clipboardFlag,
+			maxMessageSize: int(messageSize),
+		}
+		if *stdoutFlag {
+			single.out = contextOut
+		}
+		emitters = append(emitters, single)
+	}
+	if bundlePath != "" {
+		emitters = append(emitters, &fileEmitter{format: formatRepomix, path: bundlePath})
+	}
+	if archivePath != "" {
+		emitters = append(emitters, &archiveEmitter{path: archivePath})
+	}
+
+	emitted := &emission{
+		syncPath: syncPath,
+		registry: registry,
+		results:  results,
+		meta:     meta,
+		regions:  opts.regions,
+		redact:   opts.redact,
+		cond:     cond,
+		rep:      rep,
+		summarize: func() runSummary {
+			return summarizeRun(registry, totalSize, m.EstimatedTokens, time.Since(start), rep)
+		},
+	}
+	for _, e := range emitters {
+		if err := e.emit(emitted); err != nil {
+			fmt.Printf("Error writing %s: %v\n", e.target(), err)
+			removeStaging()
+			os.Exit(1)
+		}
+	}
+	removeStaging()
+	syncedPath := emitters[0].target()
+
+	// Record the state for the next invocation, or drop an outdated one. A
+	// partial sync must not pass for up to date.
+	if *stdoutFlag || *stdoutJSONFlag {
+		// Nothing was written to the sync directory
+	} else if state != nil && !m.Partial {
+		if err := saveState(absOutputPath, state); err != nil {
+			rep.warn("could not save sync state: %v", err)
+		}
+	} else {
+		os.Remove(filepath.Join(absOutputPath, stateDirName, stateFileName))
+	}
+
+	rep.summary()
+	summarizeRun(registry, totalSize, m.EstimatedTokens, time.Since(start), rep).print(os.Stdout)
+
+	if strippedTotals.files > 0 {
+		saved := 0.0
+		if strippedTotals.before > 0 {
+			saved = 100 * float64(strippedTotals.before-strippedTotals.after) / float64(strippedTotals.before)
+		}
+		fmt.Printf("Stripped comments from %d Go files: %d -> %d bytes, ~%d tokens (%.1f%% saved)\n", strippedTotals.files, strippedTotals.before, strippedTotals.after, strippedTotals.tokensBefore-strippedTotals.tokensAfter, saved)
+	}
+
+	if cond != nil {
+		fmt.Println(cond.report())
+	}
+
+	if _, files := opts.redact.total(); files > 0 {
+		fmt.Println(opts.redact.report())
+	}
+
+	if len(danglingLinks) > 0 || len(newLinks) > 0 {
+		fmt.Printf("Links: %d dangling removed, %d newly linked\n", len(danglingLinks), len(newLinks))
+		for _, name := range newLinks {
+			rep.info("  + %s", name)
+		}
+	}
+
+	if m.OverLimit {
+		fmt.Printf("Error: the context is %s, over the maximum size of %s\n", formatSize(totalSize), formatSize(int64(maxSize)))
+		printLargestArtifacts(sizes)
+		fmt.Printf("The sync directory is intact at: %s\n", syncedPath)
+		os.Exit(exitSizeLimit)
+	}
+	if warnSize > 0 && totalSize > int64(warnSize) {
+		fmt.Println("================================================================")
+		fmt.Printf("WARNING: the context is %s, over the warning size of %s\n", formatSize(totalSize), formatSize(int64(warnSize)))
+		fmt.Println("================================================================")
+		printLargestArtifacts(sizes)
+	}
+
+	if m.Interrupted {
+		fmt.Printf("Warning: interrupted, the sync is partial: %s\n", syncedPath)
+		os.Exit(exitInterrupted)
+	}
+	if m.Partial {
+		fmt.Printf("Warning: -max-runtime of %s reached, the sync is partial\n", *maxRuntimeFlag)
+	}
+	fmt.Printf("Context synced successfully to: %s\n", syncedPath)
+	for _, e := range emitters[1:] {
+		fmt.Printf("Also written to: %s\n", e.target())
+	}
+
+	if *remoteFlag != "" {
+		if err := pushToRemote(absOutputPath, *remoteFlag, rep); err != nil {
+			fmt.Printf("Error pushing to remote %s: %v\n", *remoteFlag, err)
+			fmt.Printf("The local sync directory is intact at: %s\n", absOutputPath)
+			os.Exit(exitRemoteFailure)
+		}
+		fmt.Printf("Context pushed to: %s\n", *remoteFlag)
+	}
+}
+
+// options are the settings of a sync taken from the command line
+type options struct {
+	include         []string
+	exclude         []string
+	excludeSuffixes []string
+	only            []string
+	sinceTag        string
+	modifiedWithin  time.Duration
+	diffRef         string
+	diffLines       int
+	stubs           bool
+	includeStubs    []string
+	assetDirs       []string
+	migrationDirs   []string
+	configFiles     []string
+	includeRegions  []string
+	buildFiles      bool
+	buildFileGlobs  []string
+	maxFileSize     int64
+	skipDown        bool
+	linkDirs        bool
+	skipSubmodules  bool
+	synopsisOnly    bool
+	signaturesOnly  bool
+	sniff           bool
+	includeEmbed    bool
+	imports         bool
+	vcsInfo         bool
+	structureJSON   bool
+	structureLimits structureLimits
+	benchmarks      bool
+	followTestDeps  bool
+	cmdDocs         bool
+	cliFlags        bool
+	constants       bool
+	errorsCatalog   bool
+	analyze         bool
+	symbolIndex     bool
+	xref            bool
+	xrefIncluded    bool
+	apiSummary      bool
+	noDocs          bool
+	noSource        bool
+	noReadme        bool
+	coverProfile    string
+	coverThreshold  float64
+	stats           bool
+	statsFormat     string
+	todos           bool
+	todoMarkers     []string
+	lock            bool
+	frozen          bool
+	orderedNames    bool
+	aliases         moduleAliases
+	docCommands     docCommands
+
+	// regions are the regions of the files of -include-region, filled in
+	// as the projects are synced, and cond the condenser of the copies made
+	// with -copy, nil without -condense. Both are applied whenever a file is
+	// copied into the sync directory.
+	regions fileRegions
+	cond    *condenser
+
+	// redact masks the secrets of the config files copied or bundled, with
+	// the redactKeys of the config file
+	redact *redactor
+
+	// tokens counts the tokens of the files, for the manifest and the
+	// savings of -condense and -strip-comments
+	tokens tokenizer
+
+	// resumed is the interrupted sync resumed with -resume, nil otherwise
+	resumed *resumeState
+
+	// unexportedPrefixes are the package prefixes documented with their
+	// unexported declarations
+	unexportedPrefixes []string
+}
+
+// project is a Go project taking part in a sync
+type project struct {
+	path       string
+	moduleName string
+
+	// namespace is the subdirectory of the sync directory holding the
+	// project's artifacts, empty when a single project is synced
+	namespace string
+
+	// workspace is the directory of the go.work file the project was found
+	// in, empty unless a workspace is synced
+	workspace string
+}
+
+// rootPath returns the directory the settings of the project are read from:
+// its workspace, if any, or the project itself
+func (p *project) rootPath() string {
+	if p.workspace != "" {
+		return p.workspace
+	}
+	return p.path
+}
+
+// resolveProjects resolves the project paths given on the command line. A
+// workspace is expanded into its modules, synced as separate projects; with
+// workspace, projects are resolved to the workspace they are part of.
+func resolveProjects(projectPaths []string, workspace bool, rep *reporter) ([]*project, error) {
+	var paths, workDirs []string
+	for _, projectPath := range projectPaths {
+		absProjectPath, err := filepath.Abs(projectPath)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving project path: %v", err)
+		}
+		if projectPath == "" {
+			rep.info("No project path specified, using current directory: %s", absProjectPath)
+		}
+
+		workDir, members, err := workspaceMembers(absProjectPath, workspace, rep)
+		if err != nil {
+			return nil, err
+		}
+		if members == nil {
+			members = []string{absProjectPath}
+		}
+		for _, member := range members {
+			paths = append(paths, member)
+			workDirs = append(workDirs, workDir)
+		}
+	}
+
+	var projects []*project
+	seen := make(map[string]bool)
+	for i, projectPath := range paths {
+		absProjectPath, err := resolveProject(projectPath)
+		if err != nil {
+			return nil, err
+		}
+		if seen[absProjectPath] {
+			continue
+		}
+		seen[absProjectPath] = true
+
+		// Get module name for default output path
+		moduleName, err := resolveModuleName(absProjectPath)
+		if err != nil {
+			rep.warn("could not determine the module name: %v", err)
+		} else if moduleName != "" {
+			if _, err := os.Stat(filepath.Join(absProjectPath, "go.mod")); err != nil {
+				rep.info("No go.mod found, using import path %s as module name", moduleName)
+			}
+		}
+
+		p := &project{path: absProjectPath, moduleName: moduleName, workspace: workDirs[i]}
+		projects = append(projects, p)
+	}
+
+	return projects, nil
+}
+
+// assignNamespaces gives each project a unique namespace when several
+// projects are synced, or when syncing into a directory that already merges
+// several projects. Projects keep the namespace recorded in the previous manifest.
+func assignNamespaces(projects []*project, previous *manifest) {
+	if len(projects) == 1 && (previous == nil || len(previous.Projects) == 0) {
+		return
+	}
+
+	used := make(map[string]bool)
+	if previous != nil {
+		for _, info := range previous.Projects {
+			used[info.Name] = true
+		}
+	}
+
+	for _, p := range projects {
+		if previous != nil {
+			for _, info := range previous.Projects {
+				if info.Path == p.path {
+					p.namespace = info.Name
+				}
+			}
+		}
+		if p.namespace != "" {
+			continue
+		}
+
+		p.namespace = filepath.Base(p.path)
+		for i := 2; used[p.namespace]; i++ {
+			p.namespace = fmt.Sprintf("%s-%d", filepath.Base(p.path), i)
+		}
+		used[p.namespace] = true
+	}
+}
+
+// scopeEntries returns the include/exclude entries applying to the project
+// with the given namespace. Entries of the form "<namespace>:<entry>" only
+// apply to that project; other entries apply to every project.
+func scopeEntries(entries []string, namespace string, namespaces map[string]bool) []string {
+	var scoped []string
+	for _, entry := range entries {
+		if idx := strings.Index(entry, ":"); idx > 0 && namespaces[entry[:idx]] {
+			if entry[:idx] == namespace {
+				scoped = append(scoped, entry[idx+1:])
+			}
+			continue
+		}
+		scoped = append(scoped, entry)
+	}
+	return scoped
+}
+
+// syncResult is the outcome of syncing a single project
+type syncResult struct {
+	project     *project
+	registry    *artifactRegistry
+	packages    []*packageInfo
+	order       *packageOrder
+	entrypoints []entrypoint
+
+	// selected are the import paths of the packages synced, after
+	// filtering, loaded or not
+	selected []string
+
+	// only is what the run restricted with -only produced, nil otherwise
+	only *onlyScope
+}
+
+// syncProject extracts the documentation, links the files, and generates the
+// directory structure of a project into its namespace of the sync directory
+func syncProject(p *project, opts *options, namespaces map[string]bool, outputPath string, rep *reporter) (*syncResult, error) {
+	absProjectPath, moduleName := p.path, p.moduleName
+	absOutputPath := filepath.Join(outputPath, p.namespace)
+
+	// Categorize includes and excludes based on whether they are packages, files or directories
+	includeDirsList, includePkgsList, includeFilesList := categorizeIncludesExcludes(scopeEntries(opts.include, p.namespace, namespaces), absProjectPath, moduleName, opts.aliases, rep)
+	excludeDirsList, excludePkgsList, excludeFilesList := categorizeIncludesExcludes(scopeEntries(opts.exclude, p.namespace, namespaces), absProjectPath, moduleName, opts.aliases, rep)
+
+	rep.info("Include directories: %v", includeDirsList)
+	rep.info("Include packages: %v", includePkgsList)
+	rep.info("Include files: %v", includeFilesList)
+	rep.info("Exclude directories: %v", excludeDirsList)
+	rep.info("Exclude packages: %v", excludePkgsList)
+	rep.info("Exclude files: %v", excludeFilesList)
+
+	// Check if the project is a git repository
+	repo := resolveRepo(absProjectPath)
+	isGitRepo := repo != nil
+	if isGitRepo {
+		rep.info("Git repository detected, will respect .gitignore patterns")
+		if repo.subdirectory() {
+			rep.info("Project is the subdirectory %s of the work tree at %s", repo.prefix, repo.topLevel)
+		}
+		if repo.linkedWorktree() {
+			rep.info("Work tree is a linked worktree of the repository at %s", repo.commonDir)
+		}
+		if snapshotGit(absProjectPath).empty {
+			rep.info("Repository has no commits yet, docs are checked against the modification times of the packages")
+		}
+	} else if vc := projectVCS(absProjectPath); vc != nil {
+		rep.info("%s repository detected, will respect its ignore rules", vc.kind())
+	}
+
+	// Detect submodules so git checks run against the right repository
+	if isGitRepo {
+		projectSubmodules, err := parseGitmodules(absProjectPath, repo)
+		if err != nil {
+			rep.warn("could not read .gitmodules: %v", err)
+		}
+
+		for _, sub := range projectSubmodules {
+			if opts.skipSubmodules {
+				excludeDirsList = append(excludeDirsList, sub.path)
+			}
+			rep.info("Detected submodule: %s (skipped: %v)", sub.path, opts.skipSubmodules)
+		}
+		submodules = append(submodules, projectSubmodules...)
+	}
+
+	if err := os.MkdirAll(absOutputPath, 0755); err != nil {
+		return nil, err
 	}
 
 	// Discover and filter Go packages
 	allPackages, err := discoverPackages(absProjectPath)
 	if err != nil {
-		fmt.Printf("Error discovering packages: %v\n", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("error discovering packages: %v", err)
 	}
 
 	// Directory exclusions are already handled by categorizeIncludesExcludes
 
-	packages := filterPackages(allPackages, excludeDirsList, excludePkgsList, moduleName)
+	packages := filterPackages(allPackages, excludeDirsList, excludePkgsList, opts.excludeSuffixes, absProjectPath, moduleName, opts.aliases)
 
-	if *verboseFlag {
-		fmt.Printf("Discovered %d packages, using %d after filtering\n", len(allPackages), len(packages))
+	// A run restricted to some packages leaves everything else alone
+	if len(opts.only) > 0 {
+		return syncOnlyPackages(p, opts, allPackages, packages, includeDirsList, includePkgsList, excludeFilesList, isGitRepo, absOutputPath, rep)
 	}
 
-	// Extract documentation for each package
-	for _, pkg := range packages {
-		if err := extractDocumentation(moduleName, pkg, absOutputPath, absProjectPath, isGitRepo, *verboseFlag); err != nil && *verboseFlag {
-			fmt.Printf("Warning: Error extracting documentation for %s: %v\n", pkg, err)
+	// Scope the packages to those changed since a release, or since the ref
+	// whose diff is under review
+	var touched map[string][]string
+	changesRef := opts.sinceTag
+	if opts.sinceTag != "" {
+		if err := verifyTag(absProjectPath, opts.sinceTag); err != nil {
+			return nil, err
+		}
+	} else if opts.diffRef != "" {
+		if err := verifyRef(absProjectPath, opts.diffRef); err != nil {
+			return nil, err
+		}
+		changesRef = opts.diffRef
+	}
+	if changesRef != "" {
+		if touched, err = packagesTouchedSince(absProjectPath, moduleName, changesRef, packages); err != nil {
+			return nil, err
+		}
+		var changed []string
+		for _, pkg := range packages {
+			if _, ok := touched[pkg]; ok {
+				changed = append(changed, pkg)
+			}
+		}
+		packages = changed
+	}
+
+	// Scope the packages to the recently modified ones, their directories
+	// resolved at once before being looked at concurrently
+	if opts.modifiedWithin > 0 {
+		resolvePackageDirs(absProjectPath, packages)
+		dirs := make([]string, len(packages))
+		for i, pkg := range packages {
+			if dirs[i], err = getPackageDir(pkg, absProjectPath); err != nil {
+				rep.warn("could not find the directory of %s: %v", pkg, err)
+			}
+		}
+		recent := make([]bool, len(packages))
+		forEach(len(packages), func(i int) {
+			recent[i] = dirs[i] != "" && recentlyModified(dirs[i], opts.modifiedWithin)
+		})
+		var modified []string
+		for i, pkg := range packages {
+			if recent[i] {
+				modified = append(modified, pkg)
+			} else {
+				rep.info("Skipping package not modified within %s: %s", opts.modifiedWithin, pkg)
+			}
+		}
+		packages = modified
+	}
+
+	// Document the module packages only the tests depend on
+	if opts.followTestDeps {
+		testDeps, err := testOnlyDeps(absProjectPath, packages, allPackages)
+		if err != nil {
+			rep.warn("could not follow test dependencies: %v", err)
+		}
+		for _, pkg := range testDeps {
+			rep.info("Following test dependency: %s", pkg)
+		}
+		packages = append(packages, testDeps...)
+	}
+
+	rep.info("Discovered %d packages, using %d after filtering", len(allPackages), len(packages))
+
+	// Pin or check the package set
+	if opts.frozen {
+		if err := checkLockFile(absProjectPath, packages); err != nil {
+			return nil, err
+		}
+	}
+	if opts.lock {
+		if err := writeLockFile(absProjectPath, packages); err != nil {
+			return nil, fmt.Errorf("error writing %s: %v", lockFileName, err)
+		}
+		rep.info("Wrote %d packages to %s", len(packages), lockFileName)
+	}
+
+	result := &syncResult{project: p, registry: newArtifactRegistry(), selected: packages}
+	registry := result.registry
+
+	// Excluded files are never linked, like files matching -exclude-file
+	for _, file := range excludeFilesList {
+		registry.exclude(filepath.Join(absProjectPath, file))
+	}
+
+	// Load the packages once for the analysis passes
+	pkgInfos, err := loadPackages(absProjectPath, packages)
+	if err != nil {
+		rep.warn("could not load packages: %v", err)
+	}
+
+	// Detect the main entrypoints of the program
+	result.entrypoints = detectEntrypoints(absProjectPath, pkgInfos)
+	for i := range result.entrypoints {
+		result.entrypoints[i].Project = p.namespace
+		ep := result.entrypoints[i]
+		rep.info("Detected entrypoint: %s (%s/%s)", ep.Package, ep.Dir, ep.File)
+	}
+
+	// Present the packages in dependency order, leaf packages first
+	result.packages = pkgInfos
+	result.order = orderPackages(moduleName, pkgInfos)
+	if opts.orderedNames && grouping == groupFlat {
+		docOrder = result.order.position()
+	}
+
+	// Report cycles, near-cycles and packages with a high fan-in
+	if opts.analyze {
+		if err := writeStructureAnalysis(moduleName, absOutputPath, pkgInfos, registry, rep); err != nil {
+			rep.warn("could not write the structure analysis: %v", err)
+		}
+	}
+
+	// Write the overview of what each package does
+	if err := writePackageIndex(absProjectPath, absOutputPath, moduleName, pkgInfos, result.order, registry); err != nil {
+		rep.warn("could not write the package index: %v", err)
+	}
+
+	// Map every binary of the module, including the packages filtered out
+	if err := writeEntrypoints(absProjectPath, absOutputPath, opts.buildFileGlobs, registry, rep); err != nil {
+		rep.warn("could not write the entrypoints: %v", err)
+	}
+
+	// Summarize the internal structure of the module
+	if opts.imports {
+		if err := writeImports(absOutputPath, moduleName, pkgInfos, registry); err != nil {
+			rep.warn("could not write the import summary: %v", err)
+		}
+	}
+
+	// List the benchmarks available for performance work
+	if opts.benchmarks {
+		if err := writeBenchmarks(absOutputPath, moduleName, pkgInfos, registry, rep); err != nil {
+			rep.warn("could not write the benchmark inventory: %v", err)
+		}
+	}
+
+	// Inventory the flags of every command and library
+	if opts.cliFlags {
+		if err := writeCLIFlags(absOutputPath, moduleName, pkgInfos, registry, rep); err != nil {
+			rep.warn("could not write the flag inventory: %v", err)
+		}
+	}
+
+	// Index the exported symbols for lookups without reading the docs
+	if opts.symbolIndex {
+		if err := writeSymbolIndex(absProjectPath, absOutputPath, pkgInfos, registry, rep); err != nil {
+			rep.warn("could not write the symbol index: %v", err)
+		}
+	}
+
+	// Show where the mass of the code lives
+	if opts.stats {
+		if err := writeStats(absOutputPath, moduleName, pkgInfos, opts.statsFormat, registry, rep); err != nil {
+			rep.warn("could not write the package statistics: %v", err)
+		}
+	}
+
+	// Summarize the coverage of an existing profile, tests are never run
+	profilePath := opts.coverProfile
+	if profilePath == "" {
+		profilePath = defaultCoverProfile
+	}
+	if !filepath.IsAbs(profilePath) {
+		profilePath = filepath.Join(absProjectPath, profilePath)
+	}
+	if _, err := os.Stat(profilePath); err == nil {
+		if err := writeCoverage(absOutputPath, moduleName, profilePath, pkgInfos, opts.coverThreshold, registry, rep); err != nil {
+			rep.warn("could not summarize the coverage profile %s: %v", profilePath, err)
+		}
+	} else if opts.coverProfile != "" {
+		rep.warn("coverage profile %s not found", profilePath)
+	}
+
+	// List the open questions of the code
+	if opts.todos && len(opts.todoMarkers) > 0 {
+		if err := writeTodos(absProjectPath, absOutputPath, moduleName, pkgInfos, opts.todoMarkers, isGitRepo, registry, rep); err != nil {
+			rep.warn("could not write the TODO comments: %v", err)
+		}
+	}
+
+	// Record which snapshot of the project the context was generated from
+	if opts.vcsInfo {
+		if err := writeVCSInfo(absProjectPath, absOutputPath, registry, rep); err != nil {
+			rep.warn("could not write the version control info: %v", err)
+		}
+	}
+
+	// List what changed since the release or the reviewed ref
+	if changesRef != "" {
+		if err := writeChanges(absOutputPath, moduleName, changesRef, touched, registry); err != nil {
+			rep.warn("could not write the changes since %s: %v", changesRef, err)
+		}
+	}
+
+	// Write the hunks under review, next to the docs of their packages
+	if opts.diffRef != "" {
+		if diffs, err := diffSince(absProjectPath, opts.diffRef, opts.diffLines); err != nil {
+			rep.warn("%v", err)
+		} else {
+			writeDiffs(absOutputPath, moduleName, opts.diffRef, diffs, packages, registry, rep)
+		}
+	}
+
+	// Summarize go:generate directives and generated files
+	if err := writeGenerateDirectives(absProjectPath, absOutputPath, moduleName, pkgInfos, registry, rep); err != nil {
+		rep.warn("could not summarize go:generate directives: %v", err)
+	}
+
+	// The passes type-checking from source share the importer, so that the
+	// loaded packages are only checked once
+	imp := newPackageImporter(pkgInfos)
+
+	// Extract documentation for each package, or only the signatures it declares
+	if opts.signaturesOnly && !opts.noDocs {
+		writeSignatures(moduleName, absOutputPath, pkgInfos, opts.resumed, registry, rep)
+	} else if !opts.noDocs {
+		for i, pkg := range packages {
+			if runCtx.Err() != nil {
+				rep.warn("%s, skipped documenting %d of %d packages", stopReason(), len(packages)-i, len(packages))
+				break
+			}
+			rep.progress(i+1, len(packages), "Documenting %s", pkg)
+			if err := extractDocumentation(moduleName, pkg, absOutputPath, absProjectPath, imp, opts.resumed, registry, isGitRepo, opts.synopsisOnly, documentsUnexported(pkg, opts.unexportedPrefixes, opts.aliases), rep); err != nil {
+				rep.warn("could not document %s: %v", pkg, err)
+			}
+		}
+	}
+
+	// Describe the command line of every main package, which go doc barely covers
+	if opts.cmdDocs && !opts.noDocs {
+		writeCommandSynopses(moduleName, absOutputPath, pkgInfos, registry, rep)
+	}
+
+	// List the valid values of the domain types, scattered across const blocks
+	if opts.constants {
+		writeConstantCatalogs(moduleName, absOutputPath, pkgInfos, imp, registry, rep)
+	}
+
+	// Catalog the errors of the module, what callers check against
+	if opts.errorsCatalog {
+		if err := writeErrorsCatalog(moduleName, absOutputPath, pkgInfos, imp, registry, rep); err != nil {
+			rep.warn("could not write the errors catalog: %v", err)
 		}
 	}
 
 	// Find and symlink README.md files
-	if err := findAndSymlinkReadmes(absProjectPath, absOutputPath, excludeDirsList, isGitRepo, *verboseFlag); err != nil {
-		fmt.Printf("Error symlinking README files: %v\n", err)
-		os.Exit(1)
+	if !opts.noReadme {
+		if err := findAndSymlinkReadmes(absProjectPath, absOutputPath, excludeDirsList, opts, registry, isGitRepo, rep); err != nil {
+			return nil, fmt.Errorf("error symlinking README files: %v", err)
+		}
+	}
+
+	// When grouping by package, go.mod goes along the other project-wide files
+	if grouping == groupPackage {
+		goModPath := filepath.Join(absProjectPath, "go.mod")
+		if _, err := os.Stat(goModPath); err == nil {
+			goModName := path.Join(projectDirName, "go.mod")
+			if err := registry.register(&artifact{Name: goModName, Kind: kindGoMod, Source: goModPath}); err == nil {
+				goModLink := filepath.Join(absOutputPath, filepath.FromSlash(goModName))
+				if _, err := os.Lstat(goModLink); err != nil || copyMode {
+					if err := linkFile(goModPath, goModLink, opts); err != nil {
+						rep.warn("could not link go.mod: %v", err)
+					}
+				}
+			}
+		}
 	}
 
+	// Source files are selected by extension, and by content with -sniff
+	sourceFilter := &fileFilter{extensions: sourceExtensions, sniff: opts.sniff}
+
 	// Process directories and packages for source files
 	processedDirs := make(map[string]bool)
 
+	// Directories can only be linked as a whole when symlinking into the flat
+	// layout, otherwise generated files would be written into the project
+	linkPackageDirs := opts.linkDirs && !copyMode && !stripComments && grouping == groupFlat
+
+	// Sources are skipped as a whole with -no-source
+	if opts.noSource {
+		includeDirsList, includeFilesList, includePkgsList = nil, nil, nil
+	}
+
 	// Process included directories
 	for _, dir := range includeDirsList {
-		includePkgsList = append(includePkgsList, path.Join(moduleName, dir))
+		if _, err := os.Stat(filepath.Join(absProjectPath, dir)); os.IsNotExist(err) {
+			rep.warn("included path %s does not exist", dir)
+			continue
+		}
+		includePkgsList = append(includePkgsList, dirPackagePattern(moduleName, dir))
 	}
 
-	// Process included packages
+	// Link the regions first, so that the files are sliced however else
+	// they're included
+	if entries := scopeEntries(opts.includeRegions, p.namespace, namespaces); len(entries) > 0 {
+		if err := linkRegions(absProjectPath, absOutputPath, entries, opts, registry, rep); err != nil {
+			return nil, err
+		}
+	}
+
+	// Process included files, which are linked even if git ignores them as
+	// they were asked for explicitly
+	for _, file := range includeFilesList {
+		if err := linkProjectFile(filepath.Join(absProjectPath, file), absProjectPath, absOutputPath, kindSource, opts, registry, rep); err != nil {
+			rep.warn("could not link %s: %v", file, err)
+		}
+	}
+
+	// Process included packages, resolved at once
+	if err := resolvePackageDirs(absProjectPath, includePkgsList); err != nil {
+		rep.info("Resolving the included packages one at a time: %v", err)
+	}
 	for _, pkg := range includePkgsList {
 		pkgDir, err := getPackageDir(pkg, absProjectPath)
 		if err != nil {
-			if *verboseFlag {
-				fmt.Printf("Warning: Error finding directory for package %s: %v\n", pkg, err)
-			}
+			rep.warn("could not find the directory of package %s: %v", pkg, err)
 			continue
 		}
 
 		if _, processed := processedDirs[pkgDir]; !processed {
-			if err := symlinkDirectoryFiles(pkgDir, absProjectPath, absOutputPath, isGitRepo, *verboseFlag); err != nil && *verboseFlag {
-				fmt.Printf("Warning: Error symlinking files from package %s: %v\n", pkg, err)
+			if linkPackageDirs {
+				if err := symlinkPackageDirectory(pkgDir, absProjectPath, absOutputPath, registry, rep); err != nil {
+					rep.warn("could not symlink the directory of package %s: %v", pkg, err)
+				}
+			} else if err := symlinkDirectoryFiles(pkgDir, absProjectPath, absOutputPath, kindSource, sourceFilter, opts, registry, isGitRepo, rep); err != nil {
+				rep.warn("could not symlink the files of package %s: %v", pkg, err)
 			}
 			processedDirs[pkgDir] = true
 		}
 	}
 
-	if err := generateDirectoryStructure(absProjectPath, absOutputPath, excludeDirsList, isGitRepo, *verboseFlag); err != nil {
-		fmt.Printf("Error generating directory structure: %v\n", err)
-		os.Exit(1)
+	// Write stubs of the requested packages, and with -stubs of every package
+	// whose sources aren't included
+	stubDirs := make(map[string]string)
+	stubDirList, stubPkgList, _ := categorizeIncludesExcludes(scopeEntries(opts.includeStubs, p.namespace, namespaces), absProjectPath, moduleName, opts.aliases, rep)
+	for _, dir := range stubDirList {
+		stubPkgList = append(stubPkgList, dirPackagePattern(moduleName, dir))
+	}
+	if err := resolvePackageDirs(absProjectPath, stubPkgList); err != nil {
+		rep.info("Resolving the stubbed packages one at a time: %v", err)
+	}
+	for _, pkg := range stubPkgList {
+		pkgDir, err := getPackageDir(pkg, absProjectPath)
+		if err != nil {
+			rep.warn("could not find package %s to stub: %v", pkg, err)
+			continue
+		}
+		stubDirs[pkg] = pkgDir
+	}
+	if opts.stubs {
+		for _, pkg := range pkgInfos {
+			if pkg.Dir != "" && !processedDirs[pkg.Dir] {
+				stubDirs[pkg.ImportPath] = pkg.Dir
+			}
+		}
+	}
+	stubPkgs := make([]string, 0, len(stubDirs))
+	for pkg := range stubDirs {
+		stubPkgs = append(stubPkgs, pkg)
+	}
+	sort.Strings(stubPkgs)
+	for _, pkg := range stubPkgs {
+		if err := writeStub(moduleName, pkg, stubDirs[pkg], absOutputPath, registry, rep); err != nil {
+			rep.warn("could not write the stub of %s: %v", pkg, err)
+		}
+	}
+
+	// Map where the exported types and functions are used, optionally only
+	// those of the included packages
+	if opts.xref {
+		var scope map[string]bool
+		if opts.xrefIncluded {
+			scope = processedDirs
+		}
+		if err := writeXref(moduleName, absOutputPath, pkgInfos, scope, imp, registry, rep); err != nil {
+			rep.warn("could not write the cross-references: %v", err)
+		}
+	}
+
+	// Link the files embedded with //go:embed
+	if opts.includeEmbed {
+		linkEmbedFiles(pkgInfos, absProjectPath, absOutputPath, opts, registry, rep)
+	}
+
+	// Process asset directories, which don't need to contain Go code
+	for _, dir := range scopeEntries(opts.assetDirs, p.namespace, namespaces) {
+		assetDir := dir
+		if !filepath.IsAbs(assetDir) {
+			assetDir = filepath.Join(absProjectPath, assetDir)
+		}
+
+		if err := symlinkDirectoryFiles(assetDir, absProjectPath, absOutputPath, kindAsset, &fileFilter{}, opts, registry, isGitRepo, rep); err != nil {
+			rep.warn("could not link assets from %s: %v", dir, err)
+		}
+	}
+
+	// Link the schema migrations in the order they are applied
+	if dirs := scopeEntries(opts.migrationDirs, p.namespace, namespaces); len(dirs) > 0 {
+		if err := linkMigrations(absProjectPath, absOutputPath, dirs, opts.skipDown, opts, registry, rep); err != nil {
+			rep.warn("could not link the migrations: %v", err)
+		}
+	}
+
+	// Link the config files, redacted unless symlinked
+	if globs := scopeEntries(opts.configFiles, p.namespace, namespaces); len(globs) > 0 {
+		linkConfigFiles(absProjectPath, absOutputPath, globs, opts.redact, registry, rep)
+	}
+
+	// Link the build tooling: makefiles, Dockerfiles and CI workflows
+	if opts.buildFiles {
+		linkBuildFiles(absProjectPath, absOutputPath, opts.buildFileGlobs, excludeDirsList, opts.maxFileSize, opts, registry, rep)
+	}
+
+	// Document the files linked so far with the commands given for their extension
+	if len(opts.docCommands) > 0 {
+		writeCommandDocs(absProjectPath, absOutputPath, opts.docCommands, opts.resumed, registry, rep)
+	}
+
+	// Summarize API definitions, which are too large or too raw to read as is
+	if opts.apiSummary {
+		includedDirs := make([]string, 0, len(processedDirs))
+		for dir := range processedDirs {
+			includedDirs = append(includedDirs, dir)
+		}
+		for _, file := range includeFilesList {
+			if strings.HasSuffix(file, ".proto") {
+				includedDirs = append(includedDirs, filepath.Join(absProjectPath, file))
+			}
+		}
+		writeAPISummaries(absProjectPath, absOutputPath, includedDirs, registry, rep)
+	}
+
+	if opts.linkDirs && !linkPackageDirs && len(processedDirs) > 0 {
+		rep.warn("-link-dirs only applies to symlinks in the flat layout, files were linked individually")
+	}
+	if linkPackageDirs && isGitRepo && len(processedDirs) > 0 {
+		rep.warn("-link-dirs: .gitignore rules are not applied to files inside linked directories")
+	}
+	if linkPackageDirs && len(excludeFilePatterns)+len(includeFilePatterns)+len(excludeFilesList) > 0 && len(processedDirs) > 0 {
+		rep.warn("-link-dirs: file patterns are not applied to files inside linked directories")
+	}
+
+	if err := generateDirectoryStructure(absProjectPath, absOutputPath, excludeDirsList, isGitRepo, opts.structureLimits, rep); err != nil {
+		return nil, fmt.Errorf("error generating directory structure: %v", err)
+	}
+	registry.register(&artifact{Name: projectFileName(structureFileName), Kind: kindStructure})
+	if opts.structureJSON {
+		if err := writeStructureJSON(absProjectPath, absOutputPath, excludeDirsList, isGitRepo, opts.structureLimits, registry, rep); err != nil {
+			rep.warn("could not write %s: %v", structureJSONFileName, err)
+		}
+	}
+
+	return result, nil
+}
+
+// stringList is a flag value collecting repeated and comma-separated values
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, splitAndTrim(value, ",")...)
+	return nil
+}
+
+// defaultOutputPath returns ~/.gocontext/<module-name>, the default location
+// of the sync directory
+func defaultOutputPath(moduleName, projectPath string) (string, error) {
+	baseDir, _, err := contextHome()
+	if err != nil {
+		return "", err
+	}
+
+	// Create a safe directory name from the module
+	dirName := "default"
+	if moduleName != "" {
+		dirName = strings.Replace(moduleName, "/", "_", -1)
+		dirName = strings.Replace(dirName, ".", "_", -1)
+	} else {
+		dirName = filepath.Base(projectPath)
+	}
+
+	return filepath.Join(baseDir, dirName), nil
+}
+
+// contextHome returns the base directory of the default sync directories and
+// where it was taken from. GOCONTEXT_HOME takes precedence, then XDG_DATA_HOME
+// on Linux, then ~/.gocontext.
+func contextHome() (string, string, error) {
+	if dir := os.Getenv("GOCONTEXT_HOME"); dir != "" {
+		return dir, "GOCONTEXT_HOME", nil
+	}
+
+	if runtime.GOOS == "linux" {
+		if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+			return filepath.Join(dir, "gocontext"), "XDG_DATA_HOME", nil
+		}
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", "", fmt.Errorf("%v (set GOCONTEXT_HOME or use -output)", err)
 	}
 
-	fmt.Printf("Context synced successfully to: %s\n", absOutputPath)
+	return filepath.Join(homeDir, ".gocontext"), "home directory", nil
 }
 
 // splitAndTrim splits a comma-separated string and trims each element
@@ -200,29 +1678,46 @@ func splitAndTrim(s string, sep string) []string {
 	return result
 }
 
-// categorizeIncludesExcludes separates paths into directories and packages based on module name
-func categorizeIncludesExcludes(items []string, moduleName string) (dirs []string, pkgs []string) {
+// categorizeIncludesExcludes separates paths into directories and packages based
+// on module name, and files: paths relative to the project naming regular files
+func categorizeIncludesExcludes(items []string, projectPath, moduleName string, aliases moduleAliases, rep *reporter) (dirs, pkgs, files []string) {
 	for _, item := range items {
-		// If the item starts with the module name, it's a package
-		if strings.HasPrefix(item, moduleName+"/") || item == moduleName {
+		// Packages may be given with an aliased module path
+		if resolved := aliases.resolve(item); resolved != item {
+			rep.info("Module alias applied: %s -> %s", item, resolved)
+			item = resolved
+		}
+
+		// If the item starts with the module name, it's a package. Without a
+		// module name every item is a file or a directory.
+		if moduleName != "" && (strings.HasPrefix(item, moduleName+"/") || item == moduleName) {
 			pkgs = append(pkgs, item)
+		} else if info, err := os.Stat(filepath.Join(projectPath, item)); err == nil && info.Mode().IsRegular() {
+			files = append(files, filepath.Clean(item))
 		} else {
 			// Otherwise it's a directory
 			dirs = append(dirs, item)
 		}
 	}
-	return dirs, pkgs
+	return dirs, pkgs, files
+}
+
+// commandError adds the captured stderr of a failed command to its error
+func commandError(err error) error {
+	var exitError *exec.ExitError
+	if errors.As(err, &exitError) {
+		if stderr := strings.TrimSpace(string(exitError.Stderr)); stderr != "" {
+			return fmt.Errorf("%v: %s", err, stderr)
+		}
+	}
+	return err
 }
 
 // isGoProject checks if a directory is a Go project
 func isGoProject(path string) bool {
 	// Try running 'go list' in the directory
-	cmd := exec.Command("go", "list", "-f", "{{.ImportPath}}", ".")
-	cmd.Dir = path
-	cmd.Stderr = nil // Suppress stderr output
-
 	// If the command succeeds, it's a Go project
-	if output, err := cmd.Output(); err == nil && len(output) > 0 {
+	if output, err := runGoWithRetry([]string{"list", "-f", "{{.ImportPath}}", "."}, path, goAttempts); err == nil && len(output) > 0 {
 		return true
 	}
 
@@ -243,53 +1738,128 @@ func getModuleName(projectPath string) (string, error) {
 		return "", err
 	}
 
-	// Read go.mod file
-	content, err := os.ReadFile(goModPath)
+	// Read go.mod file
+	content, err := os.ReadFile(goModPath)
+	if err != nil {
+		return "", err
+	}
+
+	// Parse to find the module name
+	lines := strings.Split(string(content), "\n")
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "module ") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "module ")), nil
+		}
+	}
+
+	return "", fmt.Errorf("module declaration not found in go.mod")
+}
+
+// resolveModuleName returns the module name from go.mod or, for GOPATH-style
+// projects without go.mod, the import path of the project root
+func resolveModuleName(projectPath string) (string, error) {
+	moduleName, err := getModuleName(projectPath)
+	if err == nil {
+		return moduleName, nil
+	}
+
+	if importPath, importErr := getImportPath(projectPath); importErr == nil {
+		return importPath, nil
+	}
+	return "", err
+}
+
+// getImportPath returns the import path of the package in the project root,
+// as reported by go list. It is used for GOPATH-style projects without go.mod.
+func getImportPath(projectPath string) (string, error) {
+	output, err := runGoWithRetry([]string{"list", "-e", "-f", "{{.ImportPath}}", "."}, projectPath, goAttempts)
 	if err != nil {
-		return "", err
+		return "", commandError(err)
 	}
 
-	// Parse to find the module name
-	lines := strings.Split(string(content), "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if strings.HasPrefix(line, "module ") {
-			return strings.TrimSpace(strings.TrimPrefix(line, "module ")), nil
-		}
+	importPath := strings.TrimSpace(string(output))
+	if importPath == "" || importPath == "." || strings.HasPrefix(importPath, "_") {
+		return "", fmt.Errorf("no import path for %s", projectPath)
 	}
 
-	return "", fmt.Errorf("module declaration not found in go.mod")
+	return importPath, nil
 }
 
-// isGitRepository checks if a directory is a git repository
-func isGitRepository(path string) bool {
-	gitPath := filepath.Join(path, ".git")
-	if _, err := os.Stat(gitPath); err == nil {
-		return true
+// dirPackagePattern returns the package pattern of a project directory for go
+// list: its import path below the module, or without a module name the
+// directory relative to the project
+func dirPackagePattern(moduleName, dir string) string {
+	if moduleName == "" {
+		return "./" + path.Clean(filepath.ToSlash(dir))
+	}
+	return path.Join(moduleName, filepath.ToSlash(dir))
+}
+
+// dirImportPath returns the import path go list reports for the package in a
+// project directory. Without a module name, that's the local import path: the
+// absolute directory prefixed with an underscore.
+func dirImportPath(projectPath, moduleName, dir string) string {
+	if moduleName == "" {
+		return "_" + filepath.ToSlash(filepath.Join(projectPath, dir))
 	}
+	return path.Join(moduleName, filepath.ToSlash(dir))
+}
 
-	// Try running git command to be sure
-	cmd := exec.Command("git", "rev-parse", "--is-inside-work-tree")
-	cmd.Dir = path
-	out, err := cmd.Output()
+// goListPattern returns the pattern go list resolves a package by. Local
+// import paths, which go list reports but can't resolve, become the package
+// directory relative to the project.
+func goListPattern(projectPath, pkg string) string {
+	if !strings.HasPrefix(pkg, "_/") {
+		return pkg
+	}
+	absProject, err := filepath.Abs(projectPath)
 	if err != nil {
-		return false
+		return pkg
+	}
+	rel, err := filepath.Rel(absProject, filepath.FromSlash(pkg[1:]))
+	if err != nil {
+		return pkg
+	}
+	return "./" + filepath.ToSlash(rel)
+}
+
+// relativePackagePath returns the package path relative to the module, "."
+// for the module root, or the full import path for packages outside the module
+func relativePackagePath(moduleName, pkg string) string {
+	if pkg == moduleName {
+		return "."
 	}
+	if moduleName != "" && strings.HasPrefix(pkg, moduleName+"/") {
+		return strings.TrimPrefix(pkg, moduleName+"/")
+	}
+	return pkg
+}
 
-	return strings.TrimSpace(string(out)) == "true"
+// isGitRepository checks if a directory is inside the work tree of a git
+// repository, which .git may be a file of or not be in at all
+func isGitRepository(path string) bool {
+	return resolveRepo(path) != nil
 }
 
 // isIgnoredByGit checks if a file is ignored by git
 func isIgnoredByGit(path string, projectPath string) (bool, error) {
-	// Get relative path from project root
-	relPath, err := filepath.Rel(projectPath, path)
+	// Files git listed for the project aren't ignored
+	if l := cachedGitListing(projectPath); l != nil && l.listed[path] {
+		return false, nil
+	}
+
+	// Get relative path from the root of the repository the file belongs to,
+	// which is the submodule's checkout for paths inside a submodule
+	repoPath := gitRootFor(path, projectPath)
+	relPath, err := filepath.Rel(repoPath, path)
 	if err != nil {
 		return false, err
 	}
 
 	// Use git check-ignore to see if the file is ignored
 	cmd := exec.Command("git", "check-ignore", "-q", relPath)
-	cmd.Dir = projectPath
+	cmd.Dir = repoPath
 
 	// If exit code is 0, the file is ignored
 	// If exit code is 1, the file is not ignored
@@ -320,38 +1890,60 @@ func createSyncDirectory(path string, clean bool) error {
 	return os.MkdirAll(path, 0755)
 }
 
-// discoverPackages finds all Go packages in the project
+// discoverPackages finds all Go packages in the project. Packages that fail
+// to compile are still listed thanks to -e, so a broken package doesn't abort
+// the whole discovery.
 func discoverPackages(projectPath string) ([]string, error) {
-	cmd := exec.Command("go", "list", "./...")
-	cmd.Dir = projectPath
-	output, err := cmd.Output()
+	output, err := runGoWithRetry([]string{"list", "-e", "./..."}, projectPath, goAttempts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to run 'go list ./...': %v", err)
+		return nil, fmt.Errorf("failed to run 'go list -e ./...': %v", commandError(err))
 	}
 
 	return splitAndTrim(string(output), "\n"), nil
 }
 
+// documentsUnexported reports whether the documentation of a package covers
+// its unexported declarations, which is the case under the given prefixes
+func documentsUnexported(pkg string, prefixes []string, aliases moduleAliases) bool {
+	for _, prefix := range prefixes {
+		prefix = strings.TrimSuffix(aliases.resolve(prefix), "/")
+		if pkg == prefix || strings.HasPrefix(pkg, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
 // filterPackages filters a list of packages based on inclusion/exclusion lists
-func filterPackages(packages, excludeDirs, excludePkgs []string, moduleName string) []string {
+func filterPackages(packages, excludeDirs, excludePkgs, excludeSuffixes []string, projectPath, moduleName string, aliases moduleAliases) []string {
 	// If no includes or excludes specified, return all packages
-	if len(excludeDirs) == 0 && len(excludePkgs) == 0 {
+	if len(excludeDirs) == 0 && len(excludePkgs) == 0 && len(excludeSuffixes) == 0 {
 		return packages
 	}
 
+	var excludes []string
+	for _, excl := range excludePkgs {
+		excludes = append(excludes, aliases.resolve(excl))
+	}
 	for _, excl := range excludeDirs {
-		excludePkgs = append(excludePkgs, path.Join(moduleName, excl))
+		excludes = append(excludes, dirImportPath(projectPath, moduleName, excl))
 	}
 
 	var filtered []string
 
 	for _, pkg := range packages {
 		excluded := false
-		for _, excl := range excludePkgs {
+		for _, excl := range excludes {
 			if strings.HasPrefix(pkg, excl) {
 				excluded = true
 			}
 		}
+		// Suffixes match the last element of the import path, e.g. foo_mock
+		for _, suffix := range excludeSuffixes {
+			if strings.HasSuffix(path.Base(pkg), suffix) {
+				excluded = true
+			}
+		}
 		if !excluded {
 			filtered = append(filtered, pkg)
 		}
@@ -362,15 +1954,19 @@ func filterPackages(packages, excludeDirs, excludePkgs []string, moduleName stri
 
 var pkgCache map[string]string = make(map[string]string)
 
+// pkgDirErrors caches why go list couldn't resolve the directory of a package
+var pkgDirErrors = make(map[string]error)
+
 // getPackageDir gets the directory for a Go package
 func getPackageDir(pkg string, projectPath string) (string, error) {
-	if cachedPath, ok := pkgCache[pkg]; ok {
+	if cachedPath, ok := cachedPackageDir(pkg); ok {
 		return cachedPath, nil
 	}
+	if err, ok := pkgDirErrors[pkg]; ok {
+		return "", err
+	}
 	// Run go list to get the package directory
-	cmd := exec.Command("go", "list", "-f", "{{.Dir}}", pkg)
-	cmd.Dir = projectPath
-	output, err := cmd.Output()
+	output, err := runGoWithRetry([]string{"list", "-f", "{{.Dir}}", goListPattern(projectPath, pkg)}, projectPath, goAttempts)
 	if err != nil {
 		return "", err
 	}
@@ -401,8 +1997,8 @@ func hasDocFile(pkg string, projectPath string) (bool, error) {
 	return true, nil
 }
 
-// needsDocUpdate checks if the documentation for a package needs to be updated
-func needsDocUpdate(pkg, outputPath, projectPath string, isGitRepo bool) (bool, error) {
+// needsDocUpdate checks if the documentation file for a package needs to be updated
+func needsDocUpdate(pkg, docFile, projectPath string, isGitRepo, unexported bool) (bool, error) {
 	// First, check if doc.go exists in the package directory
 	hasDoc, err := hasDocFile(pkg, projectPath)
 	if err != nil {
@@ -414,63 +2010,156 @@ func needsDocUpdate(pkg, outputPath, projectPath string, isGitRepo bool) (bool,
 		return false, nil
 	}
 
-	// Check if the documentation file already exists
-	docFile := filepath.Join(outputPath, "doc_"+strings.Replace(pkg, "/", "_", -1)+".txt")
+	// Check if the documentation file already exists; if not, it needs to be
+	// created, and in git its tree is still recorded below
 	docFileInfo, err := os.Stat(docFile)
-	if os.IsNotExist(err) {
-		// Doc file doesn't exist, so it needs to be created
-		return true, nil
-	}
-	if err != nil {
+	missing := os.IsNotExist(err)
+	if err != nil && !missing {
 		return false, err
 	}
 
-	// If not a git repository, always update
-	if !isGitRepo {
-		return true, nil
-	}
-
 	// Get the package directory
 	pkgDir, err := getPackageDir(pkg, projectPath)
 	if err != nil {
 		return false, err
 	}
 
-	// Check for uncommitted changes
-	cmd := exec.Command("git", "status", "--porcelain", pkgDir)
-	cmd.Dir = projectPath
-	output, err := cmd.Output()
-	if err == nil && len(output) > 0 {
-		// There are uncommitted changes
-		return true, nil
+	// Packages inside a submodule are checked against the submodule's
+	// repository, queried once with packages looked up in its snapshot. A
+	// repository without commits has no trees and counts as outside git.
+	repoPath := gitRootFor(pkgDir, projectPath)
+	var snapshot *gitSnapshot
+	if isGitRepo {
+		snapshot = snapshotGit(repoPath)
+		isGitRepo = !snapshot.empty
 	}
 
-	// Get the last modified time of the package in git
-	cmd = exec.Command("git", "log", "-1", "--format=%at", "--", pkgDir)
-	cmd.Dir = projectPath
-	output, err = cmd.Output()
-	if err != nil || len(output) == 0 {
-		// If there's an error or no output, fall back to always updating
-		return true, nil
+	// Other version control systems have no tree hashes, packages are
+	// described by the time of the last commit touching their files, or by
+	// their content when they have uncommitted changes
+	if vc := projectVCS(projectPath); !isGitRepo && vc != nil && vc.kind() != vcsGit {
+		key := docKey(pkg, docFile, unexported)
+		if missing {
+			docs.forget(key)
+		}
+		committed, ok := vc.lastModified(pkgDir)
+		revision := fmt.Sprintf("%s:%d", vc.kind(), committed.Unix())
+		if !ok || vc.hasChanges(pkgDir) {
+			if revision, err = contentHash(pkgDir, filepath.Dir(docFile), false); err != nil {
+				docs.forget(key)
+				return true, nil
+			}
+		}
+		return !docs.upToDate(key, revision), nil
+	}
+
+	// Outside version control, regenerate when a file of the package is
+	// newer than the doc
+	if !isGitRepo {
+		if missing {
+			return true, nil
+		}
+		newest, err := newestModTime(pkgDir)
+		if err != nil {
+			return true, nil
+		}
+		return docFileInfo.ModTime().Before(newest), nil
 	}
 
-	// Parse the timestamp
-	timestamp, err := strconv.ParseInt(strings.TrimSpace(string(output)), 10, 64)
+	key := docKey(pkg, docFile, unexported)
+	if missing {
+		docs.forget(key)
+	}
+
+	relDir, err := filepath.Rel(repoPath, pkgDir)
 	if err != nil {
+		docs.forget(key)
 		return true, nil
 	}
+	path := snapshot.repoPath(relDir)
+
+	// Compare the tree of the package directory with the one the doc was
+	// generated from. Uncommitted changes and untracked directories aren't
+	// described by a tree, their content is hashed instead.
+	tree, ok := snapshot.treeHash(path)
+	if !ok || snapshot.hasChanges(path) {
+		if tree, err = contentHash(pkgDir, filepath.Dir(docFile), true); err != nil {
+			docs.forget(key)
+			return true, nil
+		}
+	}
+
+	return !docs.upToDate(key, tree), nil
+}
+
+// renderDocumentation returns the documentation of a package in the doc
+// format, the full documentation or only the synopsis and symbol list, of
+// the unexported declarations too with unexported. The pretty format
+// type-checks with imp, see renderPrettyDoc.
+func renderDocumentation(pkg, pkgDir, projectPath string, imp *packageImporter, synopsisOnly, unexported bool) ([]byte, error) {
+	var output []byte
+	var err error
+	if docFormat == docFormatPretty && !synopsisOnly {
+		// Packages that don't type-check are documented by go doc
+		output, err = renderPrettyDoc(pkgDir, pkg, imp, unexported)
+	}
+	if docFormat == docFormatMarkdown {
+		output, err = renderMarkdownDoc(pkgDir, pkg, synopsisOnly, unexported)
+		if err != nil {
+			return nil, err
+		}
+	} else if output == nil || err != nil {
+		args := []string{"doc", "-short", "-all"}
+		if synopsisOnly {
+			args = []string{"doc"}
+		}
+		if unexported {
+			args = append(args, "-u")
+		}
 
-	// Convert the timestamp to time.Time
-	lastModifiedTime := time.Unix(timestamp, 0)
+		// Run go doc with the full import path, which works for the module root
+		// and for packages that don't share the module prefix
+		output, err = runGoWithRetry(append(args, pkg), projectPath, goAttempts)
+		if err != nil {
+			return nil, commandError(err)
+		}
+	}
 
-	// Compare the timestamp of the doc file with the timestamp of the latest commit
-	return docFileInfo.ModTime().Before(lastModifiedTime), nil
+	if len(output) <= 1 {
+		return nil, errors.New("doc is empty")
+	}
+	return output, nil
 }
 
-// extractDocumentation runs go doc -all for a package and saves the output if needed
-func extractDocumentation(moduleName, pkg, outputPath string, projectPath string, isGitRepo bool, verbose bool) error {
+// extractDocumentation runs go doc -all for a package and saves the output if needed.
+// In synopsis mode only the package synopsis and top-level symbol list are saved.
+// With unexported, go doc -u documents the unexported declarations as well.
+// Docs written by the resumed sync, if any, are kept as is.
+func extractDocumentation(moduleName, pkg, outputPath string, projectPath string, imp *packageImporter, resumed *resumeState, registry *artifactRegistry, isGitRepo bool, synopsisOnly, unexported bool, rep *reporter) error {
+	// Create filename with doc_ or synopsis_ prefix
+	kind := kindDoc
+	if synopsisOnly {
+		kind = kindSynopsis
+	}
+	docName := docFileName(moduleName, pkg, kind)
+	docFile := filepath.Join(outputPath, docName)
+
+	pkgDir, err := getPackageDir(pkg, projectPath)
+	if err != nil {
+		return err
+	}
+	docArtifact := &artifact{Name: docName, Kind: kind, Package: pkg, Unexported: unexported, dir: pkgDir}
+
+	// The doc written by the sync being resumed is kept as is
+	if resumed.done(docFile) {
+		registry.register(docArtifact)
+		rep.count(counterDocsCached)
+		rep.info("Documentation for %s was written before the interruption, skipping", pkg)
+		return nil
+	}
+
 	// Check if documentation needs to be updated
-	needsUpdate, err := needsDocUpdate(pkg, outputPath, projectPath, isGitRepo)
+	needsUpdate, err := needsDocUpdate(pkg, docFile, projectPath, isGitRepo, unexported)
 	if err != nil {
 		return err
 	}
@@ -478,123 +2167,102 @@ func extractDocumentation(moduleName, pkg, outputPath string, projectPath string
 	if !needsUpdate {
 		// Check if it's because doc.go doesn't exist
 		hasDoc, err := hasDocFile(pkg, projectPath)
-		if err == nil && !hasDoc && verbose {
-			fmt.Printf("Skipping documentation for %s: no doc.go file found\n", pkg)
-		} else if verbose {
-			fmt.Printf("Documentation for %s is up-to-date, skipping\n", pkg)
+		if err == nil && !hasDoc {
+			rep.info("Skipping documentation for %s: no doc.go file found", pkg)
+		} else if err == nil && hasDoc {
+			registry.register(docArtifact)
+			rep.count(counterDocsCached)
+			rep.info("Documentation for %s is up-to-date, skipping", pkg)
 		}
 		return nil
 	}
 
-	// Run go doc -all with the appropriate package path
-	cmd := exec.Command("go", "doc", "-short", "-all", pkg[len(moduleName)+1:])
-	cmd.Dir = projectPath
-	output, err := cmd.Output()
+	output, err := renderDocumentation(pkg, pkgDir, projectPath, imp, synopsisOnly, unexported)
 	if err != nil {
 		return err
 	}
 
-	if len(output) <= 1 {
-		return errors.New("doc is empty")
-	}
-
-	// Create filename with doc_ prefix - use the relative package path for uniqueness
-	docFile := filepath.Join(outputPath, "doc_"+strings.Replace(strings.TrimPrefix(pkg, moduleName+"/"), "/", "_", -1)+".txt")
-
 	// Write output to file
-	if err := os.WriteFile(docFile, output, 0644); err != nil {
+	if err := os.MkdirAll(filepath.Dir(docFile), 0755); err != nil {
 		return err
 	}
-
-	if verbose {
-		fmt.Printf("Extracted documentation for %s\n", pkg)
+	if err := writeFileAtomic(docFile, output); err != nil {
+		return err
 	}
+	docs.written(docKey(pkg, docFile, unexported))
+	registry.register(docArtifact)
+	rep.count(counterDocsGenerated)
+
+	rep.info("Extracted documentation for %s", pkg)
 
 	return nil
 }
 
-// findAndSymlinkReadmes finds all README.md files and symlinks them
-func findAndSymlinkReadmes(projectPath, syncPath string, excludeDirs []string, isGitRepo bool, verbose bool) error {
-	// Walk through project directory
-	err := filepath.Walk(projectPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+// findAndSymlinkReadmes finds all README.md files and symlinks them. The
+// candidate files of the project are listed first, then the READMEs among
+// them are checked against .gitignore and linked concurrently.
+func findAndSymlinkReadmes(projectPath, syncPath string, excludeDirs []string, opts *options, registry *artifactRegistry, isGitRepo bool, rep *reporter) error {
+	files, err := candidateFiles(projectPath, projectPath, isGitRepo, func(path, name string) bool {
+		// Skip well-known noise directories before asking git
+		if noiseDirs[name] {
+			rep.info("Skipping directory: %s", path)
+			return true
 		}
 
 		// Check if the directory should be excluded based on explicit excludes
-		if info.IsDir() {
-			for _, excludeDir := range excludeDirs {
-				excludePath := excludeDir
-				if !filepath.IsAbs(excludePath) {
-					excludePath = filepath.Join(projectPath, excludeDir)
-				}
-				if path == excludePath || strings.HasPrefix(path, excludePath+string(os.PathSeparator)) {
-					if verbose {
-						fmt.Printf("Skipping excluded directory: %s\n", path)
-					}
-					return filepath.SkipDir
-				}
+		for _, excludeDir := range excludeDirs {
+			excludePath := excludeDir
+			if !filepath.IsAbs(excludePath) {
+				excludePath = filepath.Join(projectPath, excludeDir)
 			}
-		}
-
-		// Check if the file/directory is ignored by git
-		if isGitRepo {
-			ignored, err := isIgnoredByGit(path, projectPath)
-			if err != nil {
-				// If there's an error checking git ignore status, just continue
-				if verbose {
-					fmt.Printf("Warning: Error checking git ignore status for %s: %v\n", path, err)
-				}
-			} else if ignored {
-				if info.IsDir() {
-					if verbose {
-						fmt.Printf("Skipping git-ignored directory: %s\n", path)
-					}
-					return filepath.SkipDir
-				}
-				if verbose {
-					fmt.Printf("Skipping git-ignored file: %s\n", path)
-				}
-				return nil
+			if path == excludePath || strings.HasPrefix(path, excludePath+string(os.PathSeparator)) {
+				rep.info("Skipping excluded directory: %s", path)
+				return true
 			}
 		}
+		return false
+	})
+	if err != nil {
+		return err
+	}
 
-		// Check if it's a README.md file
-		if !info.IsDir() && strings.ToLower(info.Name()) == "readme.md" {
-			// Create a unique name for the symlink
-			relPath, err := filepath.Rel(projectPath, path)
-			if err != nil {
-				return err
-			}
-			symlinkName := "readme_" + strings.Replace(relPath, "/", "_", -1)
-			symlinkPath := filepath.Join(syncPath, symlinkName)
-
-			// Ignore existing symlinks
-			if _, err := os.Lstat(symlinkPath); err == nil {
-				if verbose {
-					fmt.Printf("Ignoring already symlinked README: %s\n", relPath)
-				}
-				return nil
-			}
-
-			// Create symlink
-			if err := os.Symlink(path, symlinkPath); err != nil {
-				return err
-			}
-
-			if verbose {
-				fmt.Printf("Symlinked README: %s\n", relPath)
-			}
+	var readmes []string
+	for _, path := range files {
+		if strings.ToLower(filepath.Base(path)) == "readme.md" {
+			readmes = append(readmes, path)
 		}
+	}
 
-		return nil
-	})
+	return linkFiles(readmes, projectPath, syncPath, kindReadme, nil, opts, registry, rep)
+}
 
-	return err
+// sourceExtensions are the file extensions linked from included packages
+var sourceExtensions = map[string]bool{
+	".go":    true,
+	".proto": true,
+	".tmpl":  true,
+	".txt":   true,
 }
 
-// symlinkDirectoryFiles symlinks all .go files from a directory
-func symlinkDirectoryFiles(dirPath, projectPath, syncPath string, isGitRepo bool, verbose bool) error {
+// noiseDirs are the names of directories never walked for READMEs and source
+// files: version control, dependencies, test fixtures and build output. go list
+// skips most of them already.
+var noiseDirs = map[string]bool{
+	".git":         true,
+	".hg":          true,
+	".svn":         true,
+	"node_modules": true,
+	"vendor":       true,
+	"testdata":     true,
+	"dist":         true,
+	"build":        true,
+	"target":       true,
+}
+
+// symlinkDirectoryFiles symlinks all files accepted by the filter from a
+// directory as artifacts of the given kind. The candidate files of the
+// directory are listed first, then checked and linked concurrently.
+func symlinkDirectoryFiles(dirPath, projectPath, syncPath, kind string, filter *fileFilter, opts *options, registry *artifactRegistry, isGitRepo bool, rep *reporter) error {
 	// Make sure the directory exists
 	info, err := os.Stat(dirPath)
 	if err != nil {
@@ -605,129 +2273,357 @@ func symlinkDirectoryFiles(dirPath, projectPath, syncPath string, isGitRepo bool
 		return fmt.Errorf("%s is not a directory", dirPath)
 	}
 
-	// File extensions to include
-	extensions := map[string]bool{
-		".go":    true,
-		".proto": true,
-		".tmpl":  true,
-		".txt":   true,
+	// Skip well-known noise directories below the linked one
+	files, err := candidateFiles(dirPath, projectPath, isGitRepo, func(path, name string) bool {
+		if noiseDirs[name] {
+			rep.info("Skipping directory: %s", path)
+			return true
+		}
+		return false
+	})
+	if err == nil {
+		err = linkFiles(files, projectPath, syncPath, kind, filter, opts, registry, rep)
 	}
 
-	// Walk through the directory and symlink files
-	err = filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
+	rep.info("Symlinked from directory %s", dirPath)
+
+	return err
+}
+
+// linkFiles links the files accepted by the filter, nil accepting every
+// file, that the version control of the project doesn't ignore. The checks, then the links, run on the
+// worker pool; the files are registered and their outcome logged in order
+// in between and after, so that the registry sees the same sequence as if
+// they were linked one by one.
+func linkFiles(files []string, projectPath, syncPath, kind string, filter *fileFilter, opts *options, registry *artifactRegistry, rep *reporter) error {
+	type check struct {
+		matched, ignored bool
+		err              error
+	}
+	vc := projectVCS(projectPath)
+	checks := make([]check, len(files))
+	forEach(len(files), func(i int) {
+		checks[i].matched = filter == nil || filter.matches(files[i])
+		if checks[i].matched && vc != nil {
+			checks[i].ignored, checks[i].err = vc.isIgnored(files[i])
+		}
+	})
+
+	var links []*fileLink
+	for i, path := range files {
+		if !checks[i].matched {
+			continue
+		}
+		if checks[i].err != nil {
+			// If there's an error checking the ignore status, just continue
+			rep.warn("could not check the %s ignore status of %s: %v", vc.kind(), path, checks[i].err)
+		} else if checks[i].ignored {
+			rep.info("Skipping %s-ignored file: %s", vc.kind(), path)
+			continue
+		}
+
+		l, err := registerProjectFile(path, projectPath, syncPath, kind, registry, rep)
 		if err != nil {
 			return err
 		}
-
-		// Skip directories themselves (but still walk into them)
-		if info.IsDir() {
-			return nil
+		if l != nil {
+			links = append(links, l)
 		}
+	}
 
-		// Check if the file is ignored by git
-		if isGitRepo {
-			ignored, err := isIgnoredByGit(path, projectPath)
-			if err != nil {
-				if verbose {
-					fmt.Printf("Warning: Error checking git ignore status for %s: %v\n", path, err)
-				}
-			} else if ignored {
-				if verbose {
-					fmt.Printf("Skipping git-ignored file: %s\n", path)
-				}
-				return nil
+	// The license header condensing keeps once is chosen in walk order
+	// before the files are copied, from the files copied whole
+	if copyMode && opts != nil && opts.cond != nil {
+		var sources []string
+		for _, l := range links {
+			if opts.regions[l.source] == nil {
+				sources = append(sources, l.source)
 			}
 		}
+		opts.cond.chooseHeader(sources)
+	}
 
-		// Check if it's a source file with an allowed extension
-		ext := filepath.Ext(info.Name())
-		if extensions[ext] {
-			// Use full relative path from project root to ensure uniqueness
-			relPath, err := filepath.Rel(projectPath, path)
-			if err != nil {
-				return err
-			}
+	results := make([]linkResult, len(links))
+	forEach(len(links), func(i int) {
+		results[i] = links[i].link(opts)
+	})
 
-			// Create symlink name using full relative path
-			safeRelPath := strings.Replace(relPath, string(os.PathSeparator), "_", -1)
-			symlinkPath := filepath.Join(syncPath, "src_"+safeRelPath)
+	var firstErr error
+	for _, res := range results {
+		if err := res.report(rep); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
 
-			// Skip if symlink already exists
-			if _, err := os.Lstat(symlinkPath); err == nil {
-				if verbose {
-					fmt.Printf("Ignoring already symlinked file: %s\n", path)
-				}
-				return nil
-			}
+// fileLink is a project file registered as an artifact, to be linked into
+// the sync directory
+type fileLink struct {
+	source, dest, relPath, kind string
+}
 
-			// Create symlink
-			if err := os.Symlink(path, symlinkPath); err != nil {
-				return err
-			}
+// registerProjectFile registers a project file as an artifact of the given
+// kind and returns how to link it, or nil if it is excluded by the file
+// patterns or already linked
+func registerProjectFile(path, projectPath, syncPath, kind string, registry *artifactRegistry, rep *reporter) (*fileLink, error) {
+	// Use full relative path from project root to ensure uniqueness
+	relPath, err := filepath.Rel(projectPath, path)
+	if err != nil {
+		return nil, err
+	}
+	if !fileAllowed(relPath, kind) {
+		rep.info("Skipping file excluded by pattern: %s", relPath)
+		return nil, nil
+	}
+	if registry.isExcluded(path) {
+		rep.info("Skipping excluded file: %s", relPath)
+		return nil, nil
+	}
 
-			if verbose {
-				fmt.Printf("Symlinked file: %s\n", path)
-			}
+	// Create symlink name using full relative path
+	symlinkName := artifactName(kind, relPath)
+	symlinkPath := filepath.Join(syncPath, symlinkName)
+
+	// Make sure the file is only linked once per sync
+	if err := registry.register(&artifact{Name: symlinkName, Kind: kind, Source: path}); err != nil {
+		rep.info("Skipping duplicate file %s: %v", path, err)
+		return nil, nil
+	}
+
+	return &fileLink{source: path, dest: symlinkPath, relPath: relPath, kind: kind}, nil
+}
+
+// linkResult is the outcome of linking a file, logged by whoever registered it
+type linkResult struct {
+	warning, message string
+	err              error
+}
+
+// report logs the outcome of the link and returns its error
+func (res linkResult) report(rep *reporter) error {
+	if res.warning != "" {
+		rep.warn("%s", res.warning)
+	}
+	if res.message != "" {
+		rep.info("%s", res.message)
+	}
+	return res.err
+}
+
+// link links or copies the file into the sync directory, copies transformed
+// as set in opts, if given. It is safe to call concurrently for different
+// files.
+func (l *fileLink) link(opts *options) linkResult {
+	var res linkResult
+
+	// Go sources are written without comments, which can't be done by linking
+	if stripComments && l.kind == kindSource && filepath.Ext(l.source) == ".go" && (opts == nil || opts.regions[l.source] == nil) {
+		var tok tokenizer = heuristicTokenizer{}
+		if opts != nil {
+			tok = opts.tokens
+		}
+		err := writeStrippedFile(l.source, l.dest, tok)
+		if err == nil {
+			res.message = fmt.Sprintf("Stripped comments from file: %s", l.source)
+			return res
+		}
+		res.warning = fmt.Sprintf("%s: %v, linking it as is", l.relPath, err)
+		if err := os.Remove(l.dest); err != nil && !os.IsNotExist(err) {
+			res.err = err
+			return res
+		}
+	}
+
+	// Skip if symlink already exists, replacing a copy left by -strip-comments
+	if info, err := os.Lstat(l.dest); err == nil && !copyMode {
+		if info.Mode()&os.ModeSymlink != 0 {
+			res.message = fmt.Sprintf("Ignoring already symlinked file: %s", l.source)
+			return res
+		}
+		if err := os.Remove(l.dest); err != nil {
+			res.err = err
+			return res
 		}
+	}
+
+	// Create symlink
+	if err := linkFile(l.source, l.dest, opts); err != nil {
+		res.err = err
+		return res
+	}
+
+	res.message = fmt.Sprintf("Symlinked file: %s", l.source)
+	return res
+}
+
+// linkProjectFile links a single project file into the sync directory as an
+// artifact of the given kind, unless it's already linked
+func linkProjectFile(path, projectPath, syncPath, kind string, opts *options, registry *artifactRegistry, rep *reporter) error {
+	l, err := registerProjectFile(path, projectPath, syncPath, kind, registry, rep)
+	if err != nil || l == nil {
+		return err
+	}
+	return l.link(opts).report(rep)
+}
+
+// symlinkPackageDirectory creates a single symlink pointing at a package directory
+func symlinkPackageDirectory(dirPath, projectPath, syncPath string, registry *artifactRegistry, rep *reporter) error {
+	relPath, err := filepath.Rel(projectPath, dirPath)
+	if err != nil {
+		return err
+	}
+	if relPath == "." {
+		relPath = filepath.Base(projectPath)
+	}
 
+	symlinkName := flatName(kindPrefixes[kindSourceDir], relPath)
+	symlinkPath := filepath.Join(syncPath, symlinkName)
+
+	// Make sure the directory is only linked once per sync
+	if err := registry.register(&artifact{Name: symlinkName, Kind: kindSourceDir, Source: dirPath}); err != nil {
+		rep.info("Skipping duplicate directory %s: %v", dirPath, err)
 		return nil
-	})
+	}
 
-	if verbose {
-		fmt.Printf("Symlinked from directory %s\n", dirPath)
+	// Skip if symlink already exists
+	if _, err := os.Lstat(symlinkPath); err == nil {
+		rep.info("Ignoring already symlinked directory: %s", dirPath)
+		return nil
 	}
 
-	return err
+	if err := os.MkdirAll(filepath.Dir(symlinkPath), 0755); err != nil {
+		return err
+	}
+	if err := os.Symlink(dirPath, symlinkPath); err != nil {
+		return err
+	}
+
+	rep.info("Symlinked directory: %s", dirPath)
+
+	return nil
 }
 
-// generateDirectoryStructure creates a text file with the project's directory structure using tree command
-func generateDirectoryStructure(projectPath, outputPath string, excludeDirs []string, isGitRepo, verbose bool) error {
-	structureFile := filepath.Join(outputPath, "directory_structure.txt")
+// structureFileName is the name of the directory structure artifact
+const structureFileName = "directory_structure.txt"
 
-	if verbose {
-		fmt.Println("Generating directory structure...")
+// generateDirectoryStructure creates a text file with the project's directory structure using tree command,
+// within the given limits
+func generateDirectoryStructure(projectPath, outputPath string, excludeDirs []string, isGitRepo bool, limits structureLimits, rep *reporter) error {
+	structureFile := filepath.Join(outputPath, filepath.FromSlash(projectFileName(structureFileName)))
+	if err := os.MkdirAll(filepath.Dir(structureFile), 0755); err != nil {
+		return err
 	}
 
+	rep.info("Generating directory structure...")
+
 	// Check if tree command is available
-	treeCmd := exec.Command("tree", "--version")
-	err := treeCmd.Run()
+	versionOutput, err := exec.Command("tree", "--version").Output()
 	if err != nil {
 		return fmt.Errorf("tree command not found. Please install tree utility to use this feature: %v", err)
 	}
 
-	// Prepare exclude patterns for tree command
-	excludePatterns := []string{}
-
-	// Add exclude directory patterns
-	for _, excludeDir := range excludeDirs {
-		excludePatterns = append(excludePatterns, "-I", excludeDir)
-	}
+	// Prepare exclude patterns for tree command, starting with the exclude directories
+	excludePatterns := append([]string{}, excludeDirs...)
 
 	// Add output directory to exclude patterns if it's within the project
 	relOutputPath, err := filepath.Rel(projectPath, outputPath)
 	if err == nil && !strings.HasPrefix(relOutputPath, "..") {
-		excludePatterns = append(excludePatterns, "-I", filepath.Base(outputPath))
+		excludePatterns = append(excludePatterns, filepath.Base(outputPath))
 	}
 
-	// Add gitignore patterns if in a git repo
-	treeOptions := []string{"--dirsfirst", "--noreport", "-o", structureFile}
+	// Add gitignore patterns if in a git repo. tree only supports --gitignore
+	// since 2.0, so older versions get -I patterns derived from .gitignore.
+	treeOptions := append([]string{"--dirsfirst", "--noreport", "-o", structureFile}, limits.treeArgs()...)
 	if isGitRepo {
-		treeOptions = append(treeOptions, "--gitignore")
+		if major, _, ok := parseTreeVersion(string(versionOutput)); ok && major >= 2 {
+			treeOptions = append(treeOptions, "--gitignore")
+		} else {
+			rep.info("tree doesn't support --gitignore, using patterns from .gitignore instead")
+			excludePatterns = append(excludePatterns, gitignoreTreePatterns(projectPath)...)
+		}
+	}
+
+	// Older tree versions only honor a single -I, so combine all patterns
+	args := treeOptions
+	if len(excludePatterns) > 0 {
+		args = append(args, "-I", strings.Join(excludePatterns, "|"))
 	}
 
 	// Create command with all options
-	args := append(treeOptions, excludePatterns...)
 	cmd := exec.Command("tree", args...)
 	cmd.Dir = projectPath
 
 	// Execute command
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("error running tree command: %v", err)
+	if _, err := cmd.Output(); err != nil {
+		return fmt.Errorf("error running tree command: %v", commandError(err))
 	}
 
-	if verbose {
-		fmt.Println("Generated directory structure")
+	// tree can't truncate the listings of directories itself
+	if limits.maxEntries > 0 {
+		content, err := os.ReadFile(structureFile)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(structureFile, []byte(limits.truncateTree(string(content))), 0644); err != nil {
+			return err
+		}
 	}
 
+	rep.info("Generated directory structure")
+
 	return nil
 }
+
+// parseTreeVersion extracts the major and minor version from `tree --version`
+// output such as "tree v1.8.0 (c) 1996 - 2018 by ..."
+func parseTreeVersion(output string) (major, minor int, ok bool) {
+	for _, field := range strings.Fields(output) {
+		if !strings.HasPrefix(field, "v") {
+			continue
+		}
+
+		parts := strings.Split(strings.TrimPrefix(field, "v"), ".")
+		if len(parts) < 2 {
+			continue
+		}
+
+		major, err := strconv.Atoi(parts[0])
+		if err != nil {
+			continue
+		}
+		minor, err := strconv.Atoi(parts[1])
+		if err != nil {
+			continue
+		}
+		return major, minor, true
+	}
+
+	return 0, 0, false
+}
+
+// gitignoreTreePatterns converts the top-level .gitignore into name patterns
+// usable with tree -I. tree matches patterns against names only, so negations
+// and patterns anchored to nested paths can't be expressed and are skipped.
+func gitignoreTreePatterns(projectPath string) []string {
+	content, err := os.ReadFile(filepath.Join(projectPath, ".gitignore"))
+	if err != nil {
+		return nil
+	}
+
+	var patterns []string
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+			continue
+		}
+
+		line = strings.TrimSuffix(strings.TrimPrefix(line, "/"), "/")
+		if line == "" || strings.Contains(line, "/") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+
+	return patterns
+}
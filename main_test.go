@@ -0,0 +1,156 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeFixture creates the files of a project in a temporary directory and
+// returns its path
+func writeFixture(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// Projects without a module name: GOPATH-style projects without go.mod, and
+// projects whose go.mod doesn't declare a module
+var noModuleFixtures = map[string]map[string]string{
+	"gopath": {
+		"main.go":               "package main\n\nfunc main() {}\n",
+		"cmd/app/main.go":       "package main\n\nfunc main() {}\n",
+		"internal/core/core.go": "package core\n",
+		"README.md":             "# fixture\n",
+	},
+	"empty module": {
+		"go.mod":                "go 1.16\n",
+		"main.go":               "package main\n\nfunc main() {}\n",
+		"cmd/app/main.go":       "package main\n\nfunc main() {}\n",
+		"internal/core/core.go": "package core\n",
+		"README.md":             "# fixture\n",
+	},
+}
+
+func TestCategorizeWithoutModule(t *testing.T) {
+	for name, files := range noModuleFixtures {
+		t.Run(name, func(t *testing.T) {
+			root := writeFixture(t, files)
+			moduleName, _ := resolveModuleName(root)
+			if moduleName != "" {
+				t.Fatalf("module name %q, want none", moduleName)
+			}
+
+			rep := newReporter(io.Discard, false)
+			dirs, pkgs, files := categorizeIncludesExcludes([]string{"cmd", "internal/core", "README.md", "example.com/internal", "/abs"}, root, moduleName, nil, rep)
+
+			// Nothing is a package without a module name, not even entries
+			// looking like import paths or starting with a slash
+			if len(pkgs) != 0 {
+				t.Errorf("packages %v, want none", pkgs)
+			}
+			if want := []string{"cmd", "internal/core", "example.com/internal", "/abs"}; !reflect.DeepEqual(dirs, want) {
+				t.Errorf("directories %v, want %v", dirs, want)
+			}
+			if want := []string{"README.md"}; !reflect.DeepEqual(files, want) {
+				t.Errorf("files %v, want %v", files, want)
+			}
+		})
+	}
+}
+
+func TestFilterPackagesWithoutModule(t *testing.T) {
+	for name, files := range noModuleFixtures {
+		t.Run(name, func(t *testing.T) {
+			root := writeFixture(t, files)
+
+			// go list reports the local import paths of the directories
+			local := func(dir string) string {
+				return "_" + filepath.ToSlash(filepath.Join(root, dir))
+			}
+			packages := []string{local("."), local("cmd/app"), local("internal/core")}
+
+			tests := []struct {
+				excludeDirs, excludeSuffixes []string
+				want                         []string
+			}{
+				{nil, nil, packages},
+				{[]string{"internal"}, nil, []string{local("."), local("cmd/app")}},
+				{[]string{"cmd/app", "internal/core"}, nil, []string{local(".")}},
+				{[]string{"missing"}, nil, packages},
+				{nil, []string{"core"}, []string{local("."), local("cmd/app")}},
+			}
+			for _, tt := range tests {
+				got := filterPackages(packages, tt.excludeDirs, nil, tt.excludeSuffixes, root, "", nil)
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("excluding %v and suffixes %v: got %v, want %v", tt.excludeDirs, tt.excludeSuffixes, got, tt.want)
+				}
+			}
+
+			// The local import paths are given to go list relative to the
+			// project
+			if got := goListPattern(root, local("cmd/app")); got != "./cmd/app" {
+				t.Errorf("go list pattern %q, want ./cmd/app", got)
+			}
+			if got := dirImportPath(root, "", "internal/core"); got != local("internal/core") {
+				t.Errorf("import path of internal/core %q, want %q", got, local("internal/core"))
+			}
+		})
+	}
+}
+
+func TestParseTreeVersion(t *testing.T) {
+	tests := []struct {
+		output       string
+		major, minor int
+		ok           bool
+	}{
+		{"tree v1.8.0 (c) 1996 - 2018 by Steve Baker, Thomas Moore, Francesc Rocher, Florian Sesser, Kyosuke Tokoro \n", 1, 8, true},
+		{"tree v2.0.2 (c) 1996 - 2022 by Steve Baker, Thomas Moore, Francesc Rocher, Florian Sesser, Kyosuke Tokoro\n", 2, 0, true},
+		{"tree v2.1.1 © 1996 - 2023 by Steve Baker, Thomas Moore, Francesc Rocher, Florian Sesser, Kyosuke Tokoro\n", 2, 1, true},
+		{"tree v1.7.0 (c) 1996 - 2014 by Steve Baker, Thomas Moore, Francesc Rocher, Florian Sesser, Kyosuke Tokoro \n", 1, 7, true},
+		{"tree: invalid option -- '-'\n", 0, 0, false},
+		{"tree version unknown\n", 0, 0, false},
+		{"tree v2 (c)\n", 0, 0, false},
+		{"", 0, 0, false},
+	}
+	for _, tt := range tests {
+		major, minor, ok := parseTreeVersion(tt.output)
+		if major != tt.major || minor != tt.minor || ok != tt.ok {
+			t.Errorf("%q: got %d.%d %v, want %d.%d %v", tt.output, major, minor, ok, tt.major, tt.minor, tt.ok)
+		}
+	}
+}
+
+func TestGitignoreTreePatterns(t *testing.T) {
+	tests := []struct {
+		name, gitignore string
+		want            []string
+	}{
+		{"names", "*.log\nnode_modules/\n/build/\n  dist  \n", []string{"*.log", "node_modules", "build", "dist"}},
+		{"comments and negations", "# output\n\n!keep.log\n*.tmp\n", []string{"*.tmp"}},
+		{"nested paths", "docs/generated\n/cmd/tool/bin/\n**/cache\n", nil},
+		{"crlf", "bin/\r\n*.exe\r\n", []string{"bin", "*.exe"}},
+		{"slashes only", "/\n//\n", nil},
+	}
+	for _, tt := range tests {
+		root := writeFixture(t, map[string]string{".gitignore": tt.gitignore})
+		if got := gitignoreTreePatterns(root); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	if got := gitignoreTreePatterns(t.TempDir()); got != nil {
+		t.Errorf("without .gitignore: got %q", got)
+	}
+}
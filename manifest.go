@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// manifestFileName is the name of the manifest written to the sync directory
+const manifestFileName = "manifest.json"
+
+// manifest describes the contents of a sync directory
+type manifest struct {
+	Module       string        `json:"module,omitempty"`
+	Project      string        `json:"project,omitempty"`
+	Projects     []projectInfo `json:"projects,omitempty"`
+	VCS          string        `json:"vcs,omitempty"` // git or hg, empty for neither
+	Grouping     string        `json:"grouping"`
+	Copy         bool          `json:"copy,omitempty"`
+	DocFormat    string        `json:"docFormat,omitempty"`
+	DocExt       string        `json:"docExt,omitempty"`
+	OrderedNames bool          `json:"orderedNames,omitempty"`
+
+	// NamePrefixes are the name prefixes of artifact kinds changed from the
+	// default with -doc-prefix, -src-prefix or -readme-prefix
+	NamePrefixes map[string]string `json:"namePrefixes,omitempty"`
+
+	GeneratedAt time.Time    `json:"generatedAt"`
+	Entrypoints []entrypoint `json:"entrypoints,omitempty"`
+
+	// EstimatedTokens is the total of the artifacts' estimated tokens, and
+	// TokensByKind the totals per artifact kind
+	EstimatedTokens int            `json:"estimatedTokens"`
+	TokensByKind    map[string]int `json:"tokensByKind,omitempty"`
+
+	// Tokenizer is the name of the tokenizer the tokens are counted with
+	Tokenizer string `json:"tokenizer,omitempty"`
+
+	// OverLimit is set when the total size of the artifacts exceeds -max-size
+	OverLimit bool `json:"overLimit,omitempty"`
+
+	// Partial is set when -max-runtime ran out or the sync was interrupted
+	// before it finished; Interrupted tells the latter
+	Partial     bool `json:"partial,omitempty"`
+	Interrupted bool `json:"interrupted,omitempty"`
+
+	Artifacts []*artifact `json:"artifacts"`
+}
+
+// projectInfo describes one of the projects merged into a sync directory.
+// Its artifacts live in the subdirectory named after the project.
+type projectInfo struct {
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	Module string `json:"module,omitempty"`
+	VCS    string `json:"vcs,omitempty"`
+}
+
+// projectFor returns the path and module of the project an artifact or
+// entrypoint belongs to
+func (m *manifest) projectFor(name string) (string, string) {
+	for _, p := range m.Projects {
+		if p.Name == name {
+			return p.Path, p.Module
+		}
+	}
+	return m.Project, m.Module
+}
+
+// writeManifest writes manifest.json listing every artifact registered during
+// the run, with their tokens counted by tok
+func writeManifest(outputPath string, m *manifest, tok tokenizer, registry *artifactRegistry) error {
+	artifacts := make([]*artifact, len(registry.artifacts))
+	copy(artifacts, registry.artifacts)
+	sort.Slice(artifacts, func(i, j int) bool {
+		return artifacts[i].Name < artifacts[j].Name
+	})
+
+	// Mark artifacts belonging to entrypoints: their docs and main file
+	entrypointKeys := make(map[string]bool)
+	for _, ep := range m.Entrypoints {
+		projectPath, _ := m.projectFor(ep.Project)
+		entrypointKeys[ep.Package] = true
+		entrypointKeys[filepath.Join(projectPath, filepath.FromSlash(ep.Dir), ep.File)] = true
+	}
+
+	for _, a := range artifacts {
+		_, moduleName := m.projectFor(a.Project)
+		labelSubmodule(a, moduleName)
+		if (a.Package != "" && entrypointKeys[a.Package]) || (a.Source != "" && entrypointKeys[a.Source]) {
+			a.Entrypoint = true
+		}
+		if a.Source != "" && a.Kind != kindSourceDir {
+			a.License = fileLicense(a.Source)
+		}
+	}
+
+	// Count the tokens of every file, following links to the real contents
+	m.EstimatedTokens = 0
+	m.TokensByKind = make(map[string]int)
+	m.Tokenizer = tok.name()
+	for _, a := range artifacts {
+		a.EstimatedTokens, a.Size = 0, 0
+		if a.Kind == kindSourceDir {
+			continue
+		}
+		path := filepath.Join(outputPath, filepath.FromSlash(a.Name))
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			a.Size = info.Size()
+			if a.EstimatedTokens, err = countFileTokens(tok, path); err != nil {
+				a.EstimatedTokens = estimateTokens(info.Size())
+			}
+		}
+		m.EstimatedTokens += a.EstimatedTokens
+		m.TokensByKind[a.Kind] += a.EstimatedTokens
+	}
+
+	m.GeneratedAt = time.Now().UTC()
+	m.Artifacts = artifacts
+
+	return saveManifest(outputPath, m)
+}
+
+// embedContents inlines the contents of the artifacts into the manifest, so
+// that it is self-contained. Contents are read as written to the sync
+// directory, where copies carry the transforms of the run such as regions,
+// -condense and -strip-comments; linked files are redacted by red as copies
+// are.
+// Directories are skipped, and files larger than maxSize or that don't look
+// like text are recorded without their content.
+func embedContents(syncPath string, registry *artifactRegistry, maxSize int64, red *redactor) {
+	for _, a := range registry.artifacts {
+		a.Content, a.ContentSkipped = "", ""
+		if a.Kind == kindSourceDir {
+			continue
+		}
+
+		synced := filepath.Join(syncPath, filepath.FromSlash(a.Name))
+		linkInfo, err := os.Lstat(synced)
+		if err != nil {
+			a.ContentSkipped = fmt.Sprintf("unreadable: %v", err)
+			continue
+		}
+		info, err := os.Stat(synced)
+		if err != nil {
+			a.ContentSkipped = fmt.Sprintf("unreadable: %v", err)
+			continue
+		}
+		if info.Size() > maxSize {
+			a.ContentSkipped = fmt.Sprintf("too large: %d bytes, limit %d", info.Size(), maxSize)
+			continue
+		}
+
+		content, err := os.ReadFile(synced)
+		if err != nil {
+			a.ContentSkipped = fmt.Sprintf("unreadable: %v", err)
+			continue
+		}
+		if len(content) > 0 && !isTextSample(content, false) {
+			a.ContentSkipped = "binary"
+			continue
+		}
+		if linkInfo.Mode()&os.ModeSymlink != 0 {
+			content = red.content(a, content)
+		}
+		a.Content = string(content)
+	}
+}
+
+// saveManifest writes a manifest to the sync directory as is
+func saveManifest(outputPath string, m *manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(filepath.Join(outputPath, manifestFileName), append(data, '\n'))
+}
+
+// readManifest reads the manifest left in the sync directory by a previous run
+func readManifest(outputPath string) (*manifest, error) {
+	data, err := os.ReadFile(filepath.Join(outputPath, manifestFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Contents are embedded as written to the sync directory, transformed copies
+// included, and sized once transformed
+func TestEmbedContents(t *testing.T) {
+	projectPath := writeFixture(t, map[string]string{
+		"big.go":      "package big\n\n" + strings.Repeat("// filler comment line\n", 100),
+		"config.yaml": "name: app\napi_token: abc123\n",
+		"linked.go":   "package linked\n",
+	})
+	syncPath := writeFixture(t, map[string]string{
+		// The copy of big.go kept only its package clause
+		"src_big.go": "package big\n",
+		"doc_a.txt":  "package a\n",
+		"image.png":  "\x89PNG\x00\x00",
+		"huge.txt":   strings.Repeat("x", 200),
+	})
+	for _, name := range []string{"config.yaml", "linked.go"} {
+		if err := os.Symlink(filepath.Join(projectPath, name), filepath.Join(syncPath, "src_"+name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	registry := newArtifactRegistry()
+	artifacts := []*artifact{
+		{Name: "src_big.go", Kind: kindSource, Source: filepath.Join(projectPath, "big.go")},
+		{Name: "src_config.yaml", Kind: kindConfig, Source: filepath.Join(projectPath, "config.yaml")},
+		{Name: "src_linked.go", Kind: kindSource, Source: filepath.Join(projectPath, "linked.go")},
+		{Name: "doc_a.txt", Kind: kindDoc, Package: "example.com/a"},
+		{Name: "image.png", Kind: kindAsset},
+		{Name: "huge.txt", Kind: kindReport},
+		{Name: "missing.txt", Kind: kindReport},
+	}
+	for _, a := range artifacts {
+		registry.register(a)
+	}
+	red, err := newRedactor(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	embedContents(syncPath, registry, 100, red)
+
+	tests := []struct {
+		name, content, skipped string
+	}{
+		{"src_big.go", "package big\n", ""},
+		{"src_config.yaml", "name: app\napi_token: ", ""},
+		{"src_linked.go", "package linked\n", ""},
+		{"doc_a.txt", "package a\n", ""},
+		{"image.png", "", "binary"},
+		{"huge.txt", "", "too large: 200 bytes, limit 100"},
+		{"missing.txt", "", "unreadable"},
+	}
+	for _, tt := range tests {
+		a := registry.byName[tt.name]
+		if !strings.HasPrefix(a.Content, tt.content) || (tt.content == "" && a.Content != "") {
+			t.Errorf("%s: content %q, want %q", tt.name, a.Content, tt.content)
+		}
+		if !strings.HasPrefix(a.ContentSkipped, tt.skipped) || (tt.skipped == "" && a.ContentSkipped != "") {
+			t.Errorf("%s: skipped %q, want %q", tt.name, a.ContentSkipped, tt.skipped)
+		}
+	}
+	if content := registry.byName["src_config.yaml"].Content; strings.Contains(content, "abc123") {
+		t.Errorf("secret of a linked config file embedded: %q", content)
+	}
+}
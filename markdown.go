@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/doc"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// Formats of the documentation files
+const (
+	docFormatText     = "text"
+	docFormatMarkdown = "md"
+)
+
+// docFormat is the format of the documentation files, set once from the command line
+var docFormat = docFormatText
+
+// validateDocFormat checks the value of the -doc-format flag
+func validateDocFormat(value string) error {
+	switch value {
+	case docFormatText, docFormatMarkdown, docFormatPretty:
+		return nil
+	}
+	return fmt.Errorf("invalid doc format %q, expected %s, %s or %s", value, docFormatText, docFormatMarkdown, docFormatPretty)
+}
+
+// docFileExt returns the extension of the documentation files, -doc-ext or
+// the one of the doc format
+func docFileExt() string {
+	if docExtension != "" {
+		return docExtension
+	}
+	if docFormat == docFormatMarkdown {
+		return ".md"
+	}
+	return ".txt"
+}
+
+// renderMarkdownDoc renders the documentation of the package in pkgDir as
+// markdown from go/doc structures. With synopsisOnly, only the package
+// comment and an index of the exported declarations are rendered. With
+// unexported, the unexported declarations are rendered too.
+func renderMarkdownDoc(pkgDir, importPath string, synopsisOnly, unexported bool) ([]byte, error) {
+	names, err := buildableGoFiles(pkgDir)
+	if err != nil {
+		return nil, err
+	}
+
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range names {
+		file, err := parser.ParseFile(fset, filepath.Join(pkgDir, name), nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	var mode doc.Mode
+	if unexported {
+		mode = doc.AllDecls
+	}
+	p, err := doc.NewFromFiles(fset, files, importPath, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# package %s\n\n", p.Name)
+	fmt.Fprintf(&b, "`import \"%s\"`\n\n", importPath)
+	writeMarkdownComment(&b, p.Doc)
+
+	if synopsisOnly {
+		writeMarkdownIndex(&b, fset, p)
+		return b.Bytes(), nil
+	}
+
+	writeMarkdownValues(&b, fset, "Constants", p.Consts)
+	writeMarkdownValues(&b, fset, "Variables", p.Vars)
+	writeMarkdownFuncs(&b, fset, "## Functions", "###", p.Funcs)
+
+	if len(p.Types) > 0 {
+		b.WriteString("## Types\n\n")
+	}
+	for _, t := range p.Types {
+		fmt.Fprintf(&b, "### type %s\n\n", t.Name)
+		writeMarkdownDecl(&b, fset, t.Decl)
+		writeMarkdownComment(&b, t.Doc)
+		writeMarkdownValues(&b, fset, "", t.Consts)
+		writeMarkdownValues(&b, fset, "", t.Vars)
+		writeMarkdownFuncs(&b, fset, "", "####", t.Funcs)
+		writeMarkdownFuncs(&b, fset, "", "####", t.Methods)
+	}
+
+	return b.Bytes(), nil
+}
+
+// writeMarkdownIndex writes the one-line declarations of the exported symbols
+func writeMarkdownIndex(b *bytes.Buffer, fset *token.FileSet, p *doc.Package) {
+	var lines []string
+	for _, v := range append(p.Consts, p.Vars...) {
+		lines = append(lines, strings.Join(valueNames(v), ", "))
+	}
+	for _, f := range p.Funcs {
+		lines = append(lines, declString(fset, funcSignature(f.Decl)))
+	}
+	for _, t := range p.Types {
+		lines = append(lines, "type "+t.Name)
+		for _, f := range append(t.Funcs, t.Methods...) {
+			lines = append(lines, "    "+declString(fset, funcSignature(f.Decl)))
+		}
+	}
+
+	if len(lines) == 0 {
+		return
+	}
+	b.WriteString("## Index\n\n```go\n")
+	b.WriteString(strings.Join(lines, "\n"))
+	b.WriteString("\n```\n\n")
+}
+
+// writeMarkdownValues writes grouped constant or variable declarations
+func writeMarkdownValues(b *bytes.Buffer, fset *token.FileSet, heading string, values []*doc.Value) {
+	if len(values) == 0 {
+		return
+	}
+	if heading != "" {
+		fmt.Fprintf(b, "## %s\n\n", heading)
+	}
+	for _, v := range values {
+		writeMarkdownDecl(b, fset, v.Decl)
+		writeMarkdownComment(b, v.Doc)
+	}
+}
+
+// writeMarkdownFuncs writes function or method declarations with their docs
+func writeMarkdownFuncs(b *bytes.Buffer, fset *token.FileSet, heading, level string, funcs []*doc.Func) {
+	if len(funcs) == 0 {
+		return
+	}
+	if heading != "" {
+		fmt.Fprintf(b, "%s\n\n", heading)
+	}
+	for _, f := range funcs {
+		name := f.Name
+		if f.Recv != "" {
+			name = fmt.Sprintf("(%s) %s", f.Recv, f.Name)
+		}
+		fmt.Fprintf(b, "%s func %s\n\n", level, name)
+		writeMarkdownDecl(b, fset, funcSignature(f.Decl))
+		writeMarkdownComment(b, f.Doc)
+	}
+}
+
+// writeMarkdownDecl writes a declaration in a Go code fence
+func writeMarkdownDecl(b *bytes.Buffer, fset *token.FileSet, decl ast.Decl) {
+	b.WriteString("```go\n")
+	b.WriteString(declString(fset, decl))
+	b.WriteString("\n```\n\n")
+}
+
+// declString prints a declaration without its doc comment
+func declString(fset *token.FileSet, decl ast.Decl) string {
+	switch d := decl.(type) {
+	case *ast.GenDecl:
+		copied := *d
+		copied.Doc = nil
+		decl = &copied
+	case *ast.FuncDecl:
+		copied := *d
+		copied.Doc = nil
+		decl = &copied
+	}
+
+	var buf bytes.Buffer
+	if err := (&printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}).Fprint(&buf, fset, decl); err != nil {
+		return ""
+	}
+	return buf.String()
+}
+
+// funcSignature returns the declaration of a function without its body
+func funcSignature(decl *ast.FuncDecl) *ast.FuncDecl {
+	copied := *decl
+	copied.Body = nil
+	return &copied
+}
+
+// valueNames returns the names declared by a constant or variable group
+func valueNames(v *doc.Value) []string {
+	keyword := strings.ToLower(v.Decl.Tok.String())
+	var names []string
+	for _, name := range v.Names {
+		names = append(names, keyword+" "+name)
+	}
+	return names
+}
+
+// writeMarkdownComment converts a doc comment to markdown: prose paragraphs
+// are kept, indented blocks become code fences and headings become bold lines
+func writeMarkdownComment(b *bytes.Buffer, text string) {
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+
+	var paragraph, code []string
+	flushParagraph := func() {
+		if len(paragraph) == 0 {
+			return
+		}
+		if len(paragraph) == 1 && isCommentHeading(paragraph[0]) {
+			fmt.Fprintf(b, "**%s**\n\n", strings.TrimPrefix(paragraph[0], "# "))
+		} else {
+			b.WriteString(strings.Join(paragraph, "\n"))
+			b.WriteString("\n\n")
+		}
+		paragraph = nil
+	}
+	flushCode := func() {
+		if len(code) == 0 {
+			return
+		}
+		// Trailing blank lines belong to the following prose
+		for len(code) > 0 && strings.TrimSpace(code[len(code)-1]) == "" {
+			code = code[:len(code)-1]
+		}
+		b.WriteString("```\n")
+		b.WriteString(strings.Join(unindent(code), "\n"))
+		b.WriteString("\n```\n\n")
+		code = nil
+	}
+
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t"):
+			flushParagraph()
+			code = append(code, line)
+		case strings.TrimSpace(line) == "":
+			if len(code) > 0 {
+				code = append(code, "")
+			} else {
+				flushParagraph()
+			}
+		default:
+			flushCode()
+			paragraph = append(paragraph, line)
+		}
+	}
+	flushCode()
+	flushParagraph()
+}
+
+// isCommentHeading reports whether a single-line paragraph is a doc comment
+// heading, either "# Heading" or the older capitalized line without punctuation
+func isCommentHeading(line string) bool {
+	if strings.HasPrefix(line, "# ") {
+		return true
+	}
+	if line == "" || !unicode.IsUpper([]rune(line)[0]) {
+		return false
+	}
+	last := line[len(line)-1]
+	return !strings.ContainsAny(line, ",.;:!?+*/=()[]{}_^°&§~%#@<\">\\") && last != '.'
+}
+
+// unindent removes the indentation common to all non-blank lines
+func unindent(lines []string) []string {
+	prefix := ""
+	first := true
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if first {
+			prefix, first = indent, false
+			continue
+		}
+		for !strings.HasPrefix(indent, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+
+	result := make([]string, len(lines))
+	for i, line := range lines {
+		result[i] = strings.TrimPrefix(line, prefix)
+	}
+	return result
+}
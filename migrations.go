@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// migrationsIndexFileName is the name of the index of schema migrations
+const migrationsIndexFileName = "schema_migrations_index.txt"
+
+// migrationVersion matches the numeric or timestamp prefix of a migration,
+// optionally preceded by a V as used by Flyway
+var migrationVersion = regexp.MustCompile(`^[Vv]?(\d+)`)
+
+// migrationDown matches the names of down migrations: _down, -down or .down
+// right before the extension or the version separator
+var migrationDown = regexp.MustCompile(`(?i)[._-]down(\.sql$|[._-])`)
+
+// migration is an SQL migration file
+type migration struct {
+	path    string // absolute path
+	relPath string // path relative to the migrations directory
+	version string // numeric prefix without leading zeros, "" if none
+	down    bool
+	desc    string
+}
+
+// isDownMigration reports whether a migration reverts another, by its name or
+// by living in a directory named down
+func isDownMigration(relPath string) bool {
+	for _, dir := range strings.Split(path.Dir(relPath), "/") {
+		if strings.EqualFold(dir, "down") {
+			return true
+		}
+	}
+	return migrationDown.MatchString(path.Base(relPath))
+}
+
+// migrationDescription returns the first comment line of a migration,
+// skipping the annotations of migration tools such as "-- +goose Up"
+func migrationDescription(filePath string) string {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		var comment string
+		switch {
+		case strings.HasPrefix(line, "--"):
+			comment = strings.TrimPrefix(line, "--")
+		case strings.HasPrefix(line, "/*"):
+			comment = strings.TrimSuffix(strings.TrimPrefix(line, "/*"), "*/")
+		default:
+			continue
+		}
+		comment = strings.TrimSpace(comment)
+		if comment != "" && !strings.HasPrefix(comment, "+") && !strings.HasPrefix(comment, "migrate:") {
+			return comment
+		}
+	}
+	return ""
+}
+
+// findMigrations returns the .sql files below dir in the order they are
+// applied: by version, numerically, then up before down and by name. Files
+// without a version come last.
+func findMigrations(dir string, skipDown bool) ([]migration, error) {
+	var migrations []migration
+	err := filepath.Walk(dir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if filePath != dir && noiseDirs[info.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.EqualFold(filepath.Ext(filePath), ".sql") {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return err
+		}
+		m := migration{path: filePath, relPath: filepath.ToSlash(relPath)}
+		m.down = isDownMigration(m.relPath)
+		if m.down && skipDown {
+			return nil
+		}
+		if match := migrationVersion.FindStringSubmatch(path.Base(m.relPath)); match != nil {
+			m.version = strings.TrimLeft(match[1], "0")
+			if m.version == "" {
+				m.version = "0"
+			}
+		}
+		m.desc = migrationDescription(filePath)
+		migrations = append(migrations, m)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(migrations, func(i, j int) bool {
+		a, b := migrations[i], migrations[j]
+		if (a.version == "") != (b.version == "") {
+			return b.version == ""
+		}
+		if len(a.version) != len(b.version) {
+			return len(a.version) < len(b.version)
+		}
+		if a.version != b.version {
+			return a.version < b.version
+		}
+		if a.down != b.down {
+			return !a.down
+		}
+		return a.relPath < b.relPath
+	})
+	return migrations, nil
+}
+
+// migrationFileName returns the name of a linked migration. The flat layout
+// prefixes it with its position so that listing the sync directory shows the
+// migrations in the order they are applied.
+func migrationFileName(relDir, relPath string, position int) string {
+	switch grouping {
+	case groupDir:
+		return path.Join(relDir, relPath)
+	case groupPackage:
+		return path.Join(projectDirName, fmt.Sprintf("%s%04d_%s", kindPrefixes[kindMigration], position, flatName("", relPath)))
+	}
+	return fmt.Sprintf("%s%04d_%s", kindPrefixes[kindMigration], position, flatName("", relPath))
+}
+
+// linkMigrations links the SQL migrations of the directories and writes the
+// index listing them in the order they are applied
+func linkMigrations(projectPath, syncPath string, dirs []string, skipDown bool, opts *options, registry *artifactRegistry, rep *reporter) error {
+	var b strings.Builder
+	b.WriteString("Schema migrations\n")
+	b.WriteString("=================\n\n")
+	b.WriteString("Migrations are listed in the order they are applied. Down migrations\n")
+	b.WriteString("revert the up migration of the same version.\n")
+
+	position := 0
+	for _, dir := range dirs {
+		migrationsDir := dir
+		if !filepath.IsAbs(migrationsDir) {
+			migrationsDir = filepath.Join(projectPath, dir)
+		}
+		relDir, err := filepath.Rel(projectPath, migrationsDir)
+		if err != nil {
+			relDir = migrationsDir
+		}
+		relDir = filepath.ToSlash(relDir)
+
+		migrations, err := findMigrations(migrationsDir, skipDown)
+		if err != nil {
+			rep.warn("could not read the migrations in %s: %v", dir, err)
+			continue
+		}
+
+		fmt.Fprintf(&b, "\n%s\n", relDir)
+		for _, m := range migrations {
+			position++
+			name := migrationFileName(relDir, m.relPath, position)
+			if err := registry.register(&artifact{Name: name, Kind: kindMigration, Source: m.path}); err != nil {
+				rep.info("Skipping duplicate migration %s: %v", m.relPath, err)
+				continue
+			}
+			linkPath := filepath.Join(syncPath, filepath.FromSlash(name))
+			if _, err := os.Lstat(linkPath); err != nil || copyMode {
+				os.Remove(linkPath)
+				if err := linkFile(m.path, linkPath, opts); err != nil {
+					return err
+				}
+			}
+
+			direction := "up"
+			if m.down {
+				direction = "down"
+			}
+			version := m.version
+			if version == "" {
+				version = "-"
+			}
+			fmt.Fprintf(&b, "  %4d  %-14s %-4s  %s", position, version, direction, m.relPath)
+			if m.desc != "" {
+				fmt.Fprintf(&b, "  - %s", m.desc)
+			}
+			b.WriteString("\n")
+		}
+		if len(migrations) == 0 {
+			b.WriteString("  (no .sql files)\n")
+		}
+	}
+
+	name := projectFileName(migrationsIndexFileName)
+	outputPath := filepath.Join(syncPath, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputPath, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	registry.register(&artifact{Name: name, Kind: kindReport})
+
+	rep.info("Linked %d migrations", position)
+
+	return nil
+}
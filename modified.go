@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ageUnits are the suffixes of ages beyond those of time.ParseDuration
+var ageUnits = map[string]time.Duration{
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+}
+
+// age is a flag value for a duration that also takes days and weeks, as 90d
+// or 2w, besides the units of time.ParseDuration
+type age time.Duration
+
+func (a *age) String() string {
+	if *a == 0 {
+		return ""
+	}
+	return time.Duration(*a).String()
+}
+
+func (a *age) Set(value string) error {
+	d, err := parseAge(value)
+	if err != nil {
+		return err
+	}
+	*a = age(d)
+	return nil
+}
+
+// parseAge parses a positive duration, as a whole number of days or weeks or
+// in the syntax of time.ParseDuration
+func parseAge(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, fmt.Errorf("invalid age %q, expected e.g. 90d, 2w or 36h", value)
+	}
+	if unit, ok := ageUnits[strings.ToLower(value[len(value)-1:])]; ok {
+		n, err := strconv.Atoi(value[:len(value)-1])
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid age %q, expected e.g. 90d, 2w or 36h", value)
+		}
+		return time.Duration(n) * unit, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid age %q, expected e.g. 90d, 2w or 36h", value)
+	}
+	return d, nil
+}
+
+// recentlyModified reports whether the source of the package in pkgDir, the
+// files directly in it, was modified within the given duration. Under version
+// control, uncommitted changes are recent and committed files were modified
+// by the last commit touching them, as checkouts reset the modification times
+// of files; the latest modification time of the files is used otherwise, and
+// for packages without history.
+func recentlyModified(pkgDir string, within time.Duration) bool {
+	newest, err := newestModTime(pkgDir)
+	if err != nil || len(directFiles(pkgDir)) == 0 {
+		return false
+	}
+
+	cutoff := time.Now().Add(-within)
+	if vc := vcsContaining(pkgDir); vc != nil {
+		if vc.hasChanges(pkgDir) {
+			return true
+		}
+		if committed, ok := vc.lastModified(pkgDir); ok {
+			return !committed.Before(cutoff)
+		}
+	}
+	return !newest.Before(cutoff)
+}
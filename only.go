@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// onlyKinds are the kinds of artifacts a run restricted with -only produces
+// again for its packages. The other artifacts of the packages, and those of
+// the project as a whole, are kept as the previous sync left them.
+var onlyKinds = map[string]bool{
+	kindDoc:        true,
+	kindSynopsis:   true,
+	kindSignatures: true,
+	kindCommand:    true,
+	kindSource:     true,
+	kindReadme:     true,
+}
+
+// syncOnlyPackages syncs the packages of -only and nothing else: their docs,
+// or signatures, the synopses of their commands, and the files directly in
+// their directories, the READMEs and the sources of included packages. The
+// packages must be part of the module; those filtered out are skipped, and
+// the excluded files aren't linked.
+func syncOnlyPackages(p *project, opts *options, allPackages, packages, includeDirs, includePkgs, excludeFiles []string, isGitRepo bool, outputPath string, rep *reporter) (*syncResult, error) {
+	absProjectPath, moduleName := p.path, p.moduleName
+
+	known := make(map[string]bool)
+	for _, pkg := range allPackages {
+		known[pkg] = true
+	}
+	filtered := make(map[string]bool)
+	for _, pkg := range packages {
+		filtered[pkg] = true
+	}
+
+	var only []string
+	for _, pkg := range opts.only {
+		pkg = opts.aliases.resolve(pkg)
+		if !known[pkg] {
+			return nil, fmt.Errorf("package %s given to -only is not part of %s", pkg, moduleName)
+		}
+		if !filtered[pkg] {
+			rep.info("Skipping filtered out package: %s", pkg)
+			continue
+		}
+		only = append(only, pkg)
+	}
+	rep.info("Syncing only %d of %d packages", len(only), len(packages))
+
+	result := &syncResult{project: p, registry: newArtifactRegistry(), only: newOnlyScope()}
+	registry := result.registry
+	for _, pkg := range only {
+		result.only.packages[pkg] = true
+	}
+	for _, file := range excludeFiles {
+		registry.exclude(filepath.Join(absProjectPath, file))
+	}
+
+	pkgInfos, err := loadPackages(absProjectPath, only)
+	if err != nil {
+		rep.warn("could not load packages: %v", err)
+	}
+	result.packages = pkgInfos
+	imp := newPackageImporter(pkgInfos)
+
+	if opts.signaturesOnly && !opts.noDocs {
+		writeSignatures(moduleName, outputPath, pkgInfos, opts.resumed, registry, rep)
+	} else if !opts.noDocs {
+		for _, pkg := range only {
+			if err := extractDocumentation(moduleName, pkg, outputPath, absProjectPath, imp, opts.resumed, registry, isGitRepo, opts.synopsisOnly, documentsUnexported(pkg, opts.unexportedPrefixes, opts.aliases), rep); err != nil {
+				rep.warn("could not document %s: %v", pkg, err)
+			}
+		}
+	}
+	if opts.cmdDocs && !opts.noDocs {
+		writeCommandSynopses(moduleName, outputPath, pkgInfos, registry, rep)
+	}
+
+	// Sources are linked for the packages below an included directory or
+	// package, resolved as a full sync would
+	for _, dir := range includeDirs {
+		includePkgs = append(includePkgs, dirPackagePattern(moduleName, dir))
+	}
+	var includedDirs []string
+	if err := resolvePackageDirs(absProjectPath, append(includePkgs, only...)); err != nil {
+		rep.info("Resolving the packages one at a time: %v", err)
+	}
+	for _, pkg := range includePkgs {
+		if dir, err := getPackageDir(pkg, absProjectPath); err == nil {
+			includedDirs = append(includedDirs, dir)
+		}
+	}
+	sourceFilter := &fileFilter{extensions: sourceExtensions, sniff: opts.sniff}
+
+	// Package directories linked as a whole are up to date already
+	linkPackageDirs := opts.linkDirs && !copyMode && !stripComments && grouping == groupFlat
+
+	for _, pkg := range only {
+		pkgDir, err := getPackageDir(pkg, absProjectPath)
+		if err != nil {
+			rep.warn("could not find the directory of %s: %v", pkg, err)
+			continue
+		}
+
+		// Subdirectories belong to other packages
+		files, err := candidateFiles(pkgDir, absProjectPath, isGitRepo, func(string, string) bool { return true })
+		if err != nil {
+			rep.warn("could not list the files of %s: %v", pkg, err)
+			continue
+		}
+		var readmes []string
+		for _, file := range files {
+			if strings.ToLower(filepath.Base(file)) == "readme.md" {
+				readmes = append(readmes, file)
+			}
+		}
+		if !opts.noReadme {
+			result.only.readmeDirs[pkgDir] = true
+			if err := linkFiles(readmes, absProjectPath, outputPath, kindReadme, nil, opts, registry, rep); err != nil {
+				rep.warn("could not link the README of %s: %v", pkg, err)
+			}
+		}
+		if !opts.noSource && !linkPackageDirs && withinAny(pkgDir, includedDirs) {
+			result.only.sourceDirs[pkgDir] = true
+			if err := linkFiles(files, absProjectPath, outputPath, kindSource, sourceFilter, opts, registry, rep); err != nil {
+				rep.warn("could not link the files of %s: %v", pkg, err)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// withinAny reports whether path is one of dirs or below one of them
+func withinAny(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if path == dir || strings.HasPrefix(path, dir+string(os.PathSeparator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// onlyScope is what a run restricted with -only produced again: the docs of
+// its packages, and the READMEs and sources of their directories
+type onlyScope struct {
+	packages   map[string]bool
+	readmeDirs map[string]bool
+	sourceDirs map[string]bool
+}
+
+func newOnlyScope() *onlyScope {
+	return &onlyScope{packages: make(map[string]bool), readmeDirs: make(map[string]bool), sourceDirs: make(map[string]bool)}
+}
+
+// owns reports whether an artifact of the previous sync is one the run
+// produced again, which it replaces
+func (s *onlyScope) owns(a *artifact) bool {
+	switch {
+	case !onlyKinds[a.Kind]:
+		return false
+	case a.Kind == kindReadme:
+		return s.readmeDirs[filepath.Dir(a.Source)]
+	case a.Kind == kindSource:
+		return s.sourceDirs[filepath.Dir(a.Source)]
+	}
+	return s.packages[a.Package]
+}
+
+// keepUntouched registers the artifacts of the previous sync that a run
+// restricted with -only didn't produce again and that are still in the sync
+// directory, and prunes those of its packages it no longer produces
+func (r *artifactRegistry) keepUntouched(outputPath string, previous *manifest, scope *onlyScope, rep *reporter) {
+	replaced := &manifest{}
+	for _, a := range previous.Artifacts {
+		if _, ok := r.byName[a.Name]; ok {
+			continue
+		}
+		if scope.owns(a) {
+			replaced.Artifacts = append(replaced.Artifacts, a)
+			continue
+		}
+		if _, err := os.Lstat(filepath.Join(outputPath, filepath.FromSlash(a.Name))); err == nil {
+			r.register(a)
+		}
+	}
+	packages := make(map[string]bool)
+	for pkg := range scope.packages {
+		packages[" "+pkg] = true
+	}
+	r.pruneStale(outputPath, replaced, map[string]bool{"": true}, packages, rep)
+}
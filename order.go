@@ -0,0 +1,173 @@
+package main
+
+import (
+	"sort"
+)
+
+// packageOrder is the order in which packages are presented: every package
+// comes after the packages of the module it imports, so that leaf packages
+// are read first
+type packageOrder struct {
+	packages []string   // import paths in dependency order
+	cycles   [][]string // import cycles, each listed in lexical order
+}
+
+// importGraph returns the import paths of the packages in lexical order and
+// the edges from each package to the packages among them it imports, sorted,
+// with test imports if asked
+func importGraph(packages []*packageInfo, withTests bool) ([]string, map[string][]string) {
+	known := make(map[string]bool)
+	var names []string
+	for _, pkg := range packages {
+		if !known[pkg.ImportPath] {
+			known[pkg.ImportPath] = true
+			names = append(names, pkg.ImportPath)
+		}
+	}
+	sort.Strings(names)
+
+	// Edges point from a package to the packages it imports
+	edges := make(map[string][]string)
+	for _, pkg := range packages {
+		lists := [][]string{pkg.Imports}
+		if withTests {
+			lists = append(lists, pkg.TestImports, pkg.XTestImports)
+		}
+		seen := make(map[string]bool)
+		for _, list := range lists {
+			for _, imp := range list {
+				if imp != pkg.ImportPath && known[imp] && !seen[imp] {
+					seen[imp] = true
+					edges[pkg.ImportPath] = append(edges[pkg.ImportPath], imp)
+				}
+			}
+		}
+		sort.Strings(edges[pkg.ImportPath])
+	}
+	return names, edges
+}
+
+// orderPackages sorts the packages topologically by their intra-module
+// imports, including test imports. Packages in an import cycle, which can
+// only happen through test imports, are kept together in lexical order.
+func orderPackages(moduleName string, packages []*packageInfo) *packageOrder {
+	names, edges := importGraph(packages, true)
+	components := stronglyConnectedComponents(names, edges)
+
+	// Build the graph of components and count the dependencies of each
+	componentOf := make(map[string]int)
+	for i, component := range components {
+		sort.Strings(component)
+		for _, name := range component {
+			componentOf[name] = i
+		}
+	}
+
+	dependents := make(map[int][]int)
+	pending := make([]int, len(components))
+	for i, component := range components {
+		deps := make(map[int]bool)
+		for _, name := range component {
+			for _, imp := range edges[name] {
+				if j := componentOf[imp]; j != i && !deps[j] {
+					deps[j] = true
+					dependents[j] = append(dependents[j], i)
+					pending[i]++
+				}
+			}
+		}
+	}
+
+	// Emit components whose dependencies are all emitted, lexically first
+	order := &packageOrder{}
+	var ready []int
+	for i := range components {
+		if pending[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+
+	for len(ready) > 0 {
+		sort.Slice(ready, func(a, b int) bool {
+			return components[ready[a]][0] < components[ready[b]][0]
+		})
+		next := ready[0]
+		ready = ready[1:]
+
+		order.packages = append(order.packages, components[next]...)
+		if len(components[next]) > 1 {
+			order.cycles = append(order.cycles, components[next])
+		}
+
+		for _, dependent := range dependents[next] {
+			pending[dependent]--
+			if pending[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+
+	return order
+}
+
+// stronglyConnectedComponents returns the strongly connected components of
+// the graph using Tarjan's algorithm
+func stronglyConnectedComponents(nodes []string, edges map[string][]string) [][]string {
+	index := make(map[string]int)
+	lowLink := make(map[string]int)
+	onStack := make(map[string]bool)
+	var stack []string
+	var components [][]string
+	next := 0
+
+	var visit func(node string)
+	visit = func(node string) {
+		index[node] = next
+		lowLink[node] = next
+		next++
+		stack = append(stack, node)
+		onStack[node] = true
+
+		for _, succ := range edges[node] {
+			if _, visited := index[succ]; !visited {
+				visit(succ)
+				if lowLink[succ] < lowLink[node] {
+					lowLink[node] = lowLink[succ]
+				}
+			} else if onStack[succ] && index[succ] < lowLink[node] {
+				lowLink[node] = index[succ]
+			}
+		}
+
+		if lowLink[node] == index[node] {
+			var component []string
+			for {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[top] = false
+				component = append(component, top)
+				if top == node {
+					break
+				}
+			}
+			components = append(components, component)
+		}
+	}
+
+	for _, node := range nodes {
+		if _, visited := index[node]; !visited {
+			visit(node)
+		}
+	}
+
+	return components
+}
+
+// position returns the index of each package in the order
+func (o *packageOrder) position() map[string]int {
+	positions := make(map[string]int)
+	for i, pkg := range o.packages {
+		positions[pkg] = i
+	}
+	return positions
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// packageInfo is the subset of `go list -json` output used by the analysis passes
+type packageInfo struct {
+	ImportPath      string
+	Name            string
+	Dir             string
+	Doc             string
+	GoFiles         []string
+	CgoFiles        []string
+	TestGoFiles     []string
+	XTestGoFiles    []string
+	IgnoredGoFiles  []string
+	Imports         []string
+	TestImports     []string
+	XTestImports    []string
+	EmbedPatterns   []string
+	EmbedFiles      []string
+	TestEmbedFiles  []string
+	XTestEmbedFiles []string
+}
+
+// sourceFiles returns the paths of all .go files of the package, including
+// test files and files excluded by build constraints
+func (p *packageInfo) sourceFiles() []string {
+	var files []string
+	for _, list := range [][]string{p.GoFiles, p.CgoFiles, p.TestGoFiles, p.XTestGoFiles, p.IgnoredGoFiles} {
+		for _, file := range list {
+			files = append(files, filepath.Join(p.Dir, file))
+		}
+	}
+	return files
+}
+
+// loadPackages lists the given packages with a single `go list -e -json` call.
+// The package directories are cached for getPackageDir.
+func loadPackages(projectPath string, packages []string) ([]*packageInfo, error) {
+	if len(packages) == 0 {
+		return nil, nil
+	}
+
+	args := []string{"list", "-e", "-json"}
+	for _, pkg := range packages {
+		args = append(args, goListPattern(projectPath, pkg))
+	}
+	output, err := runGoWithRetry(args, projectPath, goAttempts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load packages: %v", commandError(err))
+	}
+
+	var infos []*packageInfo
+	decoder := json.NewDecoder(strings.NewReader(string(output)))
+	for {
+		var info packageInfo
+		if err := decoder.Decode(&info); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to parse go list output: %v", err)
+		}
+
+		if info.Dir != "" {
+			pkgCache[info.ImportPath] = info.Dir
+		}
+		infos = append(infos, &info)
+	}
+
+	return infos, nil
+}
+
+// resolvePackageDirs resolves the directories of the packages that aren't
+// cached yet with a single go list call, caching them for getPackageDir. A
+// package go list can't resolve has its own error cached instead of failing
+// the others.
+func resolvePackageDirs(projectPath string, packages []string) error {
+	absProject, err := filepath.Abs(projectPath)
+	if err != nil {
+		return err
+	}
+
+	// go list reports a package by its import path, or by the pattern given
+	// when it can't resolve it
+	byKey := make(map[string]string)
+	args := []string{"list", "-e", "-f", `{{.ImportPath}}{{"\t"}}{{.Dir}}{{"\t"}}{{with .Error}}{{printf "%q" .Err}}{{end}}`}
+	for _, pkg := range packages {
+		if _, ok := cachedPackageDir(pkg); ok {
+			continue
+		}
+		if _, ok := byKey[pkg]; ok {
+			continue
+		}
+		pattern := goListPattern(projectPath, pkg)
+		byKey[pkg], byKey[pattern] = pkg, pkg
+		if strings.HasPrefix(pattern, "./") {
+			byKey["_"+filepath.ToSlash(filepath.Join(absProject, pattern))] = pkg
+		}
+		args = append(args, pattern)
+	}
+	if len(args) == 4 {
+		return nil
+	}
+
+	output, err := runGoWithRetry(args, projectPath, goAttempts)
+	if err != nil {
+		return fmt.Errorf("failed to resolve package directories: %v", commandError(err))
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		pkg, ok := byKey[fields[0]]
+		if !ok {
+			continue
+		}
+		switch {
+		case fields[1] != "":
+			// Packages that fail to compile still have a directory
+			pkgCache[pkg] = fields[1]
+		case fields[2] != "":
+			message, err := strconv.Unquote(fields[2])
+			if err != nil {
+				message = fields[2]
+			}
+			pkgDirErrors[pkg] = errors.New(message)
+		}
+	}
+	return nil
+}
+
+// testOnlyDeps returns the packages of candidates that the tests of packages
+// import but that aren't in packages themselves, such as test helpers that
+// were filtered out. They are found with a single go list call.
+func testOnlyDeps(projectPath string, packages, candidates []string) ([]string, error) {
+	if len(packages) == 0 {
+		return nil, nil
+	}
+
+	args := []string{"list", "-e", "-f", `{{join .TestImports " "}} {{join .XTestImports " "}}`}
+	for _, pkg := range packages {
+		args = append(args, goListPattern(projectPath, pkg))
+	}
+	output, err := runGoWithRetry(args, projectPath, goAttempts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list test imports: %v", commandError(err))
+	}
+
+	selected := make(map[string]bool)
+	for _, pkg := range packages {
+		selected[pkg] = true
+	}
+	imported := make(map[string]bool)
+	for _, imp := range strings.Fields(string(output)) {
+		imported[imp] = true
+	}
+
+	var deps []string
+	for _, pkg := range candidates {
+		if imported[pkg] && !selected[pkg] {
+			deps = append(deps, pkg)
+		}
+	}
+	return deps, nil
+}
+
+// checkedPackage is a package type-checked from source with its files and the
+// definitions and uses of its identifiers
+type checkedPackage struct {
+	pkg   *types.Package
+	fset  *token.FileSet
+	files []*ast.File
+	info  *types.Info
+	err   error
+}
+
+// packageImporter type-checks the loaded packages from source as they are
+// imported, each only once, and imports any other package, such as those of
+// the standard library, with the source importer of go/importer. It resolves
+// the packages of the module without depending on the current directory.
+type packageImporter struct {
+	packages map[string]*packageInfo
+	checked  map[string]*checkedPackage
+	fallback types.Importer
+}
+
+// newPackageImporter creates an importer for the loaded packages
+func newPackageImporter(packages []*packageInfo) *packageImporter {
+	imp := &packageImporter{
+		packages: make(map[string]*packageInfo),
+		checked:  make(map[string]*checkedPackage),
+		fallback: importer.ForCompiler(token.NewFileSet(), "source", nil),
+	}
+	for _, pkg := range packages {
+		if pkg.Dir != "" {
+			imp.packages[pkg.ImportPath] = pkg
+		}
+	}
+	return imp
+}
+
+// Import implements types.Importer
+func (imp *packageImporter) Import(path string) (*types.Package, error) {
+	if _, ok := imp.packages[path]; !ok {
+		return imp.fallback.Import(path)
+	}
+	c := imp.check(path)
+	if c.pkg == nil {
+		return nil, c.err
+	}
+	return c.pkg, nil
+}
+
+// check type-checks a loaded package, or returns the result of the previous
+// check. Type errors are ignored, so that what could be resolved is recorded
+// for packages whose imports don't all resolve.
+func (imp *packageImporter) check(path string) *checkedPackage {
+	if c, ok := imp.checked[path]; ok {
+		if c == nil {
+			return &checkedPackage{err: fmt.Errorf("import cycle through %s", path)}
+		}
+		return c
+	}
+	imp.checked[path] = nil
+
+	c := &checkedPackage{}
+	if c.fset, c.files, c.err = parsePackage(imp.packages[path].Dir); c.err == nil {
+		c.info = &types.Info{Defs: make(map[*ast.Ident]types.Object), Uses: make(map[*ast.Ident]types.Object)}
+		conf := types.Config{Importer: imp, FakeImportC: true, Error: func(error) {}}
+		c.pkg, _ = conf.Check(path, c.fset, c.files, c.info)
+	}
+	imp.checked[path] = c
+	return c
+}
+
+// parsePackage parses the buildable Go files of the package in pkgDir
+func parsePackage(pkgDir string) (*token.FileSet, []*ast.File, error) {
+	names, err := buildableGoFiles(pkgDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range names {
+		file, err := parser.ParseFile(fset, filepath.Join(pkgDir, name), nil, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		files = append(files, file)
+	}
+	if len(files) == 0 {
+		return nil, nil, fmt.Errorf("no buildable Go files")
+	}
+	return fset, files, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// pkgDirCacheFileName is the name of the package directory cache inside
+// stateDirName
+const pkgDirCacheFileName = "pkg_dirs.json"
+
+// pkgDirCache persists pkgCache across runs. It only holds while the go.mod
+// and go.sum of the projects and the Go version are those it was built under.
+type pkgDirCache struct {
+	GoVersion string            `json:"goVersion"`
+	Modules   map[string]string `json:"modules"` // project path -> hash of go.mod and go.sum
+	Dirs      map[string]string `json:"dirs"`    // import path -> directory
+}
+
+// moduleFilesHash returns the hash of the go.mod and go.sum of a project,
+// missing files hashing as empty
+func moduleFilesHash(projectPath string) string {
+	h := sha256.New()
+	for _, name := range []string{"go.mod", "go.sum"} {
+		data, _ := os.ReadFile(filepath.Join(projectPath, name))
+		h.Write([]byte(name + "\x00"))
+		h.Write(data)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// currentPkgDirCache returns an empty cache keyed by the current Go version
+// and module files of the projects
+func currentPkgDirCache(projects []*project) (*pkgDirCache, error) {
+	output, err := runGoWithRetry([]string{"env", "GOVERSION"}, projects[0].path, goAttempts)
+	if err != nil {
+		return nil, commandError(err)
+	}
+
+	c := &pkgDirCache{
+		GoVersion: strings.TrimSpace(string(output)),
+		Modules:   make(map[string]string),
+		Dirs:      make(map[string]string),
+	}
+	for _, p := range projects {
+		c.Modules[p.path] = moduleFilesHash(p.path)
+	}
+	return c, nil
+}
+
+// loadPkgDirCache fills pkgCache from the package directory cache of a sync
+// directory, unless the module files or the Go version changed since it was
+// saved, and returns the number of directories loaded
+func loadPkgDirCache(outputPath string, current *pkgDirCache) int {
+	data, err := os.ReadFile(filepath.Join(outputPath, stateDirName, pkgDirCacheFileName))
+	if err != nil {
+		return 0
+	}
+	var saved pkgDirCache
+	if err := json.Unmarshal(data, &saved); err != nil || saved.GoVersion != current.GoVersion || len(saved.Modules) != len(current.Modules) {
+		return 0
+	}
+	for path, hash := range current.Modules {
+		if saved.Modules[path] != hash {
+			return 0
+		}
+	}
+
+	for pkg, dir := range saved.Dirs {
+		pkgCache[pkg] = dir
+	}
+	return len(saved.Dirs)
+}
+
+// savePkgDirCache writes pkgCache to the package directory cache of a sync
+// directory
+func savePkgDirCache(outputPath string, current *pkgDirCache) error {
+	current.Dirs = pkgCache
+	data, err := json.MarshalIndent(current, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	stateDir := filepath.Join(outputPath, stateDirName)
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(filepath.Join(stateDir, pkgDirCacheFileName), append(data, '\n'))
+}
+
+// cachedPackageDir returns the cached directory of a package. A directory
+// that no longer exists is dropped, for the package to be resolved again.
+func cachedPackageDir(pkg string) (string, bool) {
+	dir, ok := pkgCache[pkg]
+	if !ok {
+		return "", false
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		delete(pkgCache, pkg)
+		return "", false
+	}
+	return dir, true
+}
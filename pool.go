@@ -0,0 +1,44 @@
+package main
+
+import (
+	"runtime"
+	"sync"
+)
+
+// jobs bounds the number of files checked and linked concurrently, set from
+// the -jobs flag
+var jobs = runtime.NumCPU()
+
+// forEach calls work for every index in [0, n) on at most jobs goroutines and
+// returns once every call returned. The calls store their results by index,
+// for the calling goroutine to log and register them in order, so that
+// nothing but the work itself runs concurrently.
+func forEach(n int, work func(i int)) {
+	workers := jobs
+	if workers > n {
+		workers = n
+	}
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			work(i)
+		}
+		return
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				work(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
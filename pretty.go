@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/doc"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// docFormatPretty is the doc format rendering every type with its full set
+// of fields and methods, the promoted ones included
+const docFormatPretty = "pretty"
+
+// renderPrettyDoc renders the documentation of the package in pkgDir as go
+// doc -all does, listing the fields and methods each type gets through its
+// embedded types, which go doc leaves out. With unexported, the unexported
+// declarations are rendered too. The package is type-checked with imp, the
+// importer of the loaded packages of the sync, or imports every package from
+// source if nil.
+func renderPrettyDoc(pkgDir, importPath string, imp *packageImporter, unexported bool) ([]byte, error) {
+	names, err := buildableGoFiles(pkgDir)
+	if err != nil {
+		return nil, err
+	}
+
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range names {
+		file, err := parser.ParseFile(fset, filepath.Join(pkgDir, name), nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	// Type-check before go/doc, which strips the unexported declarations
+	// from the files
+	if imp == nil {
+		imp = newPackageImporter(nil)
+	}
+	conf := types.Config{Importer: imp, FakeImportC: true}
+	tpkg, err := conf.Check(importPath, fset, files, nil)
+	if err != nil {
+		return nil, fmt.Errorf("type-checking %s: %v", importPath, err)
+	}
+
+	var mode doc.Mode
+	if unexported {
+		mode = doc.AllDecls
+	}
+	p, err := doc.NewFromFiles(fset, files, importPath, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "package %s // import %q\n\n", p.Name, importPath)
+	writeIndentedComment(&b, "", p.Doc)
+
+	if len(p.Consts) > 0 {
+		writePrettySection(&b, "CONSTANTS")
+	}
+	for _, v := range p.Consts {
+		writePrettyDecl(&b, fset, v.Decl, v.Doc)
+	}
+	if len(p.Vars) > 0 {
+		writePrettySection(&b, "VARIABLES")
+	}
+	for _, v := range p.Vars {
+		writePrettyDecl(&b, fset, v.Decl, v.Doc)
+	}
+	if len(p.Funcs) > 0 {
+		writePrettySection(&b, "FUNCTIONS")
+	}
+	for _, f := range p.Funcs {
+		writePrettyDecl(&b, fset, funcSignature(f.Decl), f.Doc)
+	}
+	if len(p.Types) > 0 {
+		writePrettySection(&b, "TYPES")
+	}
+	for _, t := range p.Types {
+		writePrettyDecl(&b, fset, t.Decl, t.Doc)
+		if obj, ok := tpkg.Scope().Lookup(t.Name).(*types.TypeName); ok {
+			writePromoted(&b, tpkg, obj.Type(), unexported)
+		}
+		for _, v := range append(t.Consts, t.Vars...) {
+			writePrettyDecl(&b, fset, v.Decl, v.Doc)
+		}
+		for _, f := range append(t.Funcs, t.Methods...) {
+			writePrettyDecl(&b, fset, funcSignature(f.Decl), f.Doc)
+		}
+	}
+
+	return b.Bytes(), nil
+}
+
+// writePrettySection writes the heading of a section of the documentation
+func writePrettySection(b *bytes.Buffer, title string) {
+	fmt.Fprintf(b, "%s\n\n", title)
+}
+
+// writePrettyDecl writes a declaration followed by its indented doc comment
+func writePrettyDecl(b *bytes.Buffer, fset *token.FileSet, decl ast.Decl, comment string) {
+	b.WriteString(declString(fset, decl))
+	b.WriteString("\n")
+	writeIndentedComment(b, "    ", comment)
+	b.WriteString("\n")
+}
+
+// writeIndentedComment writes a doc comment with its lines indented
+func writeIndentedComment(b *bytes.Buffer, indent, comment string) {
+	comment = strings.TrimSpace(comment)
+	if comment == "" {
+		return
+	}
+	for _, line := range strings.Split(comment, "\n") {
+		if strings.TrimSpace(line) == "" {
+			b.WriteString("\n")
+			continue
+		}
+		fmt.Fprintf(b, "%s%s\n", indent, line)
+	}
+	if indent == "" {
+		b.WriteString("\n")
+	}
+}
+
+// writePromoted writes the fields and methods a named type has through its
+// embedded types, each with the embedded type it's promoted from. Types
+// without embedded types have nothing promoted and get nothing written.
+func writePromoted(b *bytes.Buffer, pkg *types.Package, t types.Type, unexported bool) {
+	visible := func(name string) bool {
+		return unexported || ast.IsExported(name)
+	}
+	qualifier := types.RelativeTo(pkg)
+
+	// Fields come from the embedded structs at any depth, each resolved
+	// as a selector would be, which drops the ambiguous ones
+	var fields []string
+	if st, ok := t.Underlying().(*types.Struct); ok {
+		for _, name := range embeddedFieldNames(st) {
+			if !visible(name) {
+				continue
+			}
+			obj, index, _ := types.LookupFieldOrMethod(t, false, pkg, name)
+			field, ok := obj.(*types.Var)
+			if !ok || len(index) < 2 {
+				continue
+			}
+			fields = append(fields, fmt.Sprintf("%s %s // from %s", name, types.TypeString(field.Type(), qualifier), embeddingPath(t, index)))
+		}
+	}
+
+	// Methods promoted to the type or its pointer, or embedded in an
+	// interface
+	var methods []string
+	_, isInterface := t.Underlying().(*types.Interface)
+	named, _ := t.(*types.Named)
+	for _, recv := range []types.Type{t, types.NewPointer(t)} {
+		if isInterface && recv != t {
+			break
+		}
+		set := types.NewMethodSet(recv)
+		for i := 0; i < set.Len(); i++ {
+			sel := set.At(i)
+			fn := sel.Obj().(*types.Func)
+			if !visible(fn.Name()) {
+				continue
+			}
+			var from string
+			if isInterface {
+				embedder, ok := fn.Type().(*types.Signature).Recv().Type().(*types.Named)
+				if !ok || named == nil || embedder.Obj() == named.Obj() {
+					continue
+				}
+				from = types.TypeString(embedder, qualifier)
+			} else {
+				if len(sel.Index()) < 2 || (recv != t && inMethodSet(t, fn)) {
+					continue
+				}
+				from = embeddingPath(t, sel.Index())
+			}
+			sig := fn.Name() + strings.TrimPrefix(types.TypeString(fn.Type(), qualifier), "func")
+			methods = append(methods, fmt.Sprintf("%s%s // from %s", receiverPrefix(recv, qualifier, isInterface), sig, from))
+		}
+	}
+
+	if len(fields) == 0 && len(methods) == 0 {
+		return
+	}
+	b.WriteString("    Promoted:\n")
+	for _, line := range append(fields, methods...) {
+		fmt.Fprintf(b, "        %s\n", line)
+	}
+	b.WriteString("\n")
+}
+
+// receiverPrefix returns how a promoted method is listed, as a method of the
+// type or its pointer, or by its name alone for an interface
+func receiverPrefix(recv types.Type, qualifier types.Qualifier, isInterface bool) string {
+	if isInterface {
+		return ""
+	}
+	return fmt.Sprintf("func (%s) ", types.TypeString(recv, qualifier))
+}
+
+// inMethodSet reports whether the method set of t has fn, which its
+// pointer's set repeats
+func inMethodSet(t types.Type, fn *types.Func) bool {
+	return types.NewMethodSet(t).Lookup(fn.Pkg(), fn.Name()) != nil
+}
+
+// embeddedFieldNames returns the names of the fields of the structs
+// embedded in st, at any depth, sorted
+func embeddedFieldNames(st *types.Struct) []string {
+	seen := make(map[string]bool)
+	visited := make(map[types.Type]bool)
+	var walk func(st *types.Struct)
+	walk = func(st *types.Struct) {
+		for i := 0; i < st.NumFields(); i++ {
+			f := st.Field(i)
+			if !f.Embedded() {
+				continue
+			}
+			t := f.Type()
+			if ptr, ok := t.(*types.Pointer); ok {
+				t = ptr.Elem()
+			}
+			if visited[t] {
+				continue
+			}
+			visited[t] = true
+			inner, ok := t.Underlying().(*types.Struct)
+			if !ok {
+				continue
+			}
+			for j := 0; j < inner.NumFields(); j++ {
+				seen[inner.Field(j).Name()] = true
+			}
+			walk(inner)
+		}
+	}
+	walk(st)
+
+	var names []string
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// embeddingPath returns the embedded fields a selection with the given index
+// sequence goes through, as A.B
+func embeddingPath(t types.Type, index []int) string {
+	var path []string
+	for _, i := range index[:len(index)-1] {
+		if ptr, ok := t.Underlying().(*types.Pointer); ok {
+			t = ptr.Elem()
+		}
+		st, ok := t.Underlying().(*types.Struct)
+		if !ok {
+			break
+		}
+		f := st.Field(i)
+		path = append(path, f.Name())
+		t = f.Type()
+	}
+	return strings.Join(path, ".")
+}
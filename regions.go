@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// lineRange is an inclusive range of 1-based line numbers
+type lineRange struct {
+	start, end int
+}
+
+// fileRegions are the line ranges kept of files included with
+// -include-region, by absolute source path
+type fileRegions map[string][]lineRange
+
+// parseIncludeRegion parses an -include-region entry of the form
+// path:start-end, e.g. big.go:100-160. A single line is given as path:line.
+func parseIncludeRegion(entry string) (string, lineRange, error) {
+	idx := strings.LastIndex(entry, ":")
+	if idx <= 0 || idx == len(entry)-1 {
+		return "", lineRange{}, fmt.Errorf("invalid region %q, expected path:start-end", entry)
+	}
+
+	spec := entry[idx+1:]
+	startText, endText := spec, spec
+	if dash := strings.Index(spec, "-"); dash >= 0 {
+		startText, endText = spec[:dash], spec[dash+1:]
+	}
+	start, err1 := strconv.Atoi(strings.TrimSpace(startText))
+	end, err2 := strconv.Atoi(strings.TrimSpace(endText))
+	if err1 != nil || err2 != nil || start < 1 || end < start {
+		return "", lineRange{}, fmt.Errorf("invalid line range %q in region %q", spec, entry)
+	}
+	return entry[:idx], lineRange{start, end}, nil
+}
+
+// mergeRanges sorts the ranges and merges the ones overlapping or adjacent
+func mergeRanges(ranges []lineRange) []lineRange {
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].start < ranges[j].start
+	})
+	var merged []lineRange
+	for _, r := range ranges {
+		if n := len(merged); n > 0 && r.start <= merged[n-1].end+1 {
+			if r.end > merged[n-1].end {
+				merged[n-1].end = r.end
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// lineCommentPrefix returns the line comment syntax of a file, for the
+// markers of omitted lines
+func lineCommentPrefix(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case "", ".py", ".sh", ".bash", ".rb", ".pl", ".yaml", ".yml", ".toml", ".mk", ".tf", ".r":
+		return "#"
+	case ".sql", ".lua", ".hs":
+		return "--"
+	}
+	return "//"
+}
+
+// splitLines splits content into lines, without the empty element following
+// a final newline
+func splitLines(content []byte) [][]byte {
+	lines := bytes.Split(content, []byte("\n"))
+	if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// sliceRegions keeps the ranges of the content of a file, replacing the lines
+// in between with a marker such as "// ... (lines 1-99 omitted)"
+func sliceRegions(name string, content []byte, ranges []lineRange) []byte {
+	lines := splitLines(content)
+	prefix := lineCommentPrefix(name)
+	omitted := func(b *bytes.Buffer, from, to int) {
+		if from == to {
+			fmt.Fprintf(b, "%s ... (line %d omitted)\n", prefix, from)
+		} else if from < to {
+			fmt.Fprintf(b, "%s ... (lines %d-%d omitted)\n", prefix, from, to)
+		}
+	}
+
+	var b bytes.Buffer
+	next := 1
+	for _, r := range ranges {
+		end := r.end
+		if end > len(lines) {
+			end = len(lines)
+		}
+		omitted(&b, next, r.start-1)
+		for _, line := range lines[r.start-1 : end] {
+			b.Write(line)
+			b.WriteByte('\n')
+		}
+		next = end + 1
+	}
+	omitted(&b, next, len(lines))
+	return b.Bytes()
+}
+
+// content returns the content of an artifact sliced to its regions, or as
+// is if it has none
+func (r fileRegions) content(a *artifact, content []byte) []byte {
+	ranges, ok := r[a.Source]
+	if !ok || a.Source == "" {
+		return content
+	}
+	return sliceRegions(a.Source, content, ranges)
+}
+
+// copyRegions copies the ranges of source to dest, condensed with cond
+// unless nil
+func copyRegions(source, dest string, ranges []lineRange, cond *condenser) error {
+	content, err := os.ReadFile(source)
+	if err != nil {
+		return err
+	}
+	content = sliceRegions(source, content, ranges)
+	if cond != nil {
+		content = cond.apply(source, content)
+	}
+
+	if err := os.Remove(dest); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.WriteFile(dest, content, 0644)
+}
+
+// linkRegions validates the regions of the project against the length of
+// their files, records them in the regions of opts and links the files, which
+// are sliced when copied or written to single-file output
+func linkRegions(projectPath, syncPath string, entries []string, opts *options, registry *artifactRegistry, rep *reporter) error {
+	for _, entry := range entries {
+		file, r, err := parseIncludeRegion(entry)
+		if err != nil {
+			return err
+		}
+		source := file
+		if !filepath.IsAbs(source) {
+			source = filepath.Join(projectPath, file)
+		}
+		source = filepath.Clean(source)
+
+		content, err := os.ReadFile(source)
+		if err != nil {
+			return fmt.Errorf("region %s: %v", entry, err)
+		}
+		if n := len(splitLines(content)); r.end > n {
+			return fmt.Errorf("region %s is out of range, %s has %d lines", entry, file, n)
+		}
+
+		// The ranges of a file given in several entries are kept together
+		opts.regions[source] = mergeRanges(append(opts.regions[source], r))
+
+		if err := linkProjectFile(source, projectPath, syncPath, kindSource, opts, registry, rep); err != nil {
+			return fmt.Errorf("could not link %s: %v", file, err)
+		}
+		rep.info("Included lines %d-%d of %s", r.start, r.end, file)
+	}
+	return nil
+}
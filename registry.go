@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Artifact kinds recorded in the registry and the manifest
+const (
+	kindDoc           = "doc"
+	kindSynopsis      = "synopsis"
+	kindReadme        = "readme"
+	kindSource        = "source"
+	kindSourceDir     = "source-dir"
+	kindAsset         = "asset"
+	kindEmbed         = "embed"
+	kindGoMod         = "gomod"
+	kindStructure     = "structure"
+	kindStructureJSON = "structure-json"
+	kindReport        = "report"
+	kindStub          = "stub"
+	kindCommand       = "command"
+	kindConstants     = "constants"
+	kindMigration     = "migration"
+	kindConfig        = "config"
+	kindBuild         = "build"
+	kindDiff          = "diff"
+	kindSignatures    = "signatures"
+	kindFileDoc       = "file-doc"
+)
+
+// artifact describes a single file in the sync directory
+type artifact struct {
+	Name       string `json:"name"`
+	Kind       string `json:"kind"`
+	Source     string `json:"source,omitempty"`
+	Package    string `json:"package,omitempty"`
+	Submodule  string `json:"submodule,omitempty"`
+	Module     string `json:"module,omitempty"`
+	Entrypoint bool   `json:"entrypoint,omitempty"`
+	Project    string `json:"project,omitempty"`
+
+	// Unexported is set on the docs covering unexported declarations too
+	Unexported bool `json:"unexported,omitempty"`
+
+	// License is the SPDX identifier of the license declared at the top of a
+	// linked file, if any
+	License string `json:"license,omitempty"`
+
+	// EstimatedTokens is the size of the file in tokens, see estimateTokens
+	EstimatedTokens int `json:"estimatedTokens,omitempty"`
+
+	// Size is the size of the file in bytes, checked by -resume
+	Size int64 `json:"size,omitempty"`
+
+	// Stale is set on the artifacts a partial sync kept from the previous
+	// one without producing them again
+	Stale bool `json:"stale,omitempty"`
+
+	// Content is the file's content, inlined with -embed-content. Files that
+	// are too large or binary are left out, with the reason in ContentSkipped.
+	Content        string `json:"content,omitempty"`
+	ContentSkipped string `json:"contentSkipped,omitempty"`
+
+	// dir is the project directory the artifact was derived from, used for
+	// artifacts without a single source file
+	dir string
+}
+
+// artifactRegistry tracks every artifact written to the sync directory during
+// a single run. Linked files are keyed by their resolved source path so that
+// any file is only ever linked once; the first name registered for a source wins.
+type artifactRegistry struct {
+	artifacts []*artifact
+	bySource  map[string]*artifact // resolved source path -> artifact
+	byName    map[string]*artifact // artifact name -> artifact
+
+	// excluded are the resolved paths of the files excluded with -exclude,
+	// never linked. Being absolute, they're particular to their project.
+	excluded map[string]bool
+}
+
+// newArtifactRegistry creates an empty registry
+func newArtifactRegistry() *artifactRegistry {
+	return &artifactRegistry{
+		bySource: make(map[string]*artifact),
+		byName:   make(map[string]*artifact),
+		excluded: make(map[string]bool),
+	}
+}
+
+// exclude marks a project file as never to be linked
+func (r *artifactRegistry) exclude(path string) {
+	r.excluded[resolveSourcePath(path)] = true
+}
+
+// isExcluded reports whether a project file was excluded with -exclude
+func (r *artifactRegistry) isExcluded(path string) bool {
+	return len(r.excluded) > 0 && r.excluded[resolveSourcePath(path)]
+}
+
+// duplicateArtifactError is returned when a source file is already registered
+type duplicateArtifactError struct {
+	source   string
+	existing string
+}
+
+func (e *duplicateArtifactError) Error() string {
+	return fmt.Sprintf("%s is already linked as %s", e.source, e.existing)
+}
+
+// resolveSourcePath returns the canonical path of a source file so that the
+// same file reached through different paths maps to a single key
+func resolveSourcePath(source string) string {
+	if resolved, err := filepath.EvalSymlinks(source); err == nil {
+		source = resolved
+	}
+	if abs, err := filepath.Abs(source); err == nil {
+		source = abs
+	}
+	return filepath.Clean(source)
+}
+
+// register records an artifact. It returns a *duplicateArtifactError if the
+// artifact's source was already registered, or an error if the name is
+// already taken by a different artifact.
+func (r *artifactRegistry) register(a *artifact) error {
+	var resolved string
+	if a.Source != "" {
+		resolved = resolveSourcePath(a.Source)
+		if existing, ok := r.bySource[resolved]; ok {
+			return &duplicateArtifactError{source: a.Source, existing: existing.Name}
+		}
+	}
+
+	if other, ok := r.byName[a.Name]; ok {
+		if other.Source != "" {
+			return fmt.Errorf("name collision: %s is already used for %s", a.Name, other.Source)
+		}
+		return fmt.Errorf("name collision: %s is already registered", a.Name)
+	}
+
+	if resolved != "" {
+		r.bySource[resolved] = a
+	}
+	r.byName[a.Name] = a
+	r.artifacts = append(r.artifacts, a)
+	return nil
+}
+
+// isLinkedKind reports whether artifacts of the kind are linked (or copied)
+// from project files rather than generated
+func isLinkedKind(kind string) bool {
+	switch kind {
+	case kindReadme, kindSource, kindSourceDir, kindAsset, kindEmbed, kindGoMod, kindMigration, kindConfig, kindBuild:
+		return true
+	}
+	return false
+}
+
+// isPrunableKind reports whether artifacts of the kind are removed when a run
+// no longer produces them: linked files, and generated files that only exist
+// for some packages or options, such as stubs, command synopses and diffs
+func isPrunableKind(kind string) bool {
+	switch kind {
+	case kindStub, kindCommand, kindConstants, kindDiff, kindSignatures, kindFileDoc:
+		return true
+	}
+	return isLinkedKind(kind)
+}
+
+// pruneStale removes the artifacts of prunable kinds recorded in the previous
+// manifest that weren't registered during this run, e.g. sources of packages
+// that are no longer included, and the docs and synopses of packages that
+// weren't synced, keyed by project and import path in packages. Other
+// generated files are kept unless regenerated under another name, as are the
+// artifacts of projects that aren't among the synced projects.
+func (r *artifactRegistry) pruneStale(outputPath string, previous *manifest, projects, packages map[string]bool, rep *reporter) int {
+	// Docs of packages documented under a different name this time, e.g.
+	// renumbered by -ordered-names, are stale as well
+	docNames := make(map[string]bool)
+	for _, a := range r.artifacts {
+		if a.Kind == kindDoc || a.Kind == kindSynopsis {
+			docNames[a.Kind+" "+a.Package] = true
+		}
+	}
+
+	pruned := 0
+	for _, a := range previous.Artifacts {
+		isDoc := a.Kind == kindDoc || a.Kind == kindSynopsis
+		staleDoc := isDoc && (docNames[a.Kind+" "+a.Package] || !packages[a.Project+" "+a.Package])
+		if _, ok := r.byName[a.Name]; ok || (!isPrunableKind(a.Kind) && !staleDoc) || !projects[a.Project] {
+			continue
+		}
+
+		artifactPath := filepath.Join(outputPath, filepath.FromSlash(a.Name))
+		info, err := os.Lstat(artifactPath)
+		if err != nil || info.IsDir() {
+			continue
+		}
+
+		if err := os.Remove(artifactPath); err != nil {
+			rep.warn("could not prune %s: %v", a.Name, err)
+			continue
+		}
+
+		removeEmptyParents(outputPath, filepath.Dir(artifactPath))
+
+		rep.info("Pruned stale artifact: %s", a.Name)
+		pruned++
+	}
+
+	return pruned
+}
+
+// settlePrevious deals with the artifacts of the previous sync that weren't
+// produced this time. A sync cut short by an interrupt or -max-runtime, ctx
+// being done, didn't get to produce them all and keeps them; a -only sync,
+// with a scope, keeps those outside it; a full sync prunes them, see
+// pruneStale. It reports whether the entrypoints of the previous sync still
+// hold.
+func (r *artifactRegistry) settlePrevious(ctx context.Context, outputPath string, previous *manifest, scope *onlyScope, projects, packages map[string]bool, rep *reporter) bool {
+	switch {
+	case ctx.Err() != nil:
+		r.keepPrevious(outputPath, previous)
+	case scope != nil:
+		r.keepUntouched(outputPath, previous, scope, rep)
+		return true
+	default:
+		r.pruneStale(outputPath, previous, projects, packages, rep)
+	}
+	return false
+}
+
+// keepPrevious registers the artifacts recorded in the previous manifest that
+// weren't registered during this run but are still in the sync directory, in
+// place of pruning them when the run didn't get to produce them
+func (r *artifactRegistry) keepPrevious(outputPath string, previous *manifest) {
+	for _, a := range previous.Artifacts {
+		if _, ok := r.byName[a.Name]; ok {
+			continue
+		}
+		if _, err := os.Lstat(filepath.Join(outputPath, filepath.FromSlash(a.Name))); err != nil {
+			continue
+		}
+		a.Stale = true
+		r.register(a)
+	}
+}
+
+// removeDanglingLinks removes the links of the previous sync whose target no
+// longer exists, e.g. after a source file was renamed, and returns their
+// names. Only links of the linked kinds recorded in the previous manifest are
+// removed; other dangling links, such as those the user created, are reported.
+func removeDanglingLinks(outputPath string, previous *manifest, rep *reporter) []string {
+	recorded := make(map[string]bool)
+	if previous != nil {
+		for _, a := range previous.Artifacts {
+			if isLinkedKind(a.Kind) {
+				recorded[a.Name] = true
+			}
+		}
+	}
+
+	var removed []string
+	for _, l := range findDanglingLinks(outputPath, recorded) {
+		if !l.recorded {
+			rep.warn("dangling link %s -> %s, not created by gocontext", l.name, l.target)
+			continue
+		}
+		if err := removeLink(outputPath, l.name); err != nil {
+			rep.warn("could not remove the dangling link %s: %v", l.name, err)
+			continue
+		}
+		rep.info("Removed dangling link: %s", l.name)
+		removed = append(removed, l.name)
+	}
+	return removed
+}
+
+// newlyLinked returns the names of the linked artifacts of this run that
+// weren't part of the previous sync
+func (r *artifactRegistry) newlyLinked(previous *manifest) []string {
+	known := make(map[string]bool)
+	if previous != nil {
+		for _, a := range previous.Artifacts {
+			known[a.Name] = true
+		}
+	}
+
+	var names []string
+	for _, a := range r.artifacts {
+		if isLinkedKind(a.Kind) && !known[a.Name] {
+			names = append(names, a.Name)
+		}
+	}
+	return names
+}
+
+// removeEmptyParents removes dir and its parents up to, but excluding, root
+// as long as they are empty
+func removeEmptyParents(root, dir string) {
+	for dir != root && strings.HasPrefix(dir, root+string(os.PathSeparator)) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// previousSync writes the artifacts of a previous sync into a temporary sync
+// directory and returns it with the manifest recording them
+func previousSync(t *testing.T, artifacts ...*artifact) (string, *manifest) {
+	t.Helper()
+	files := make(map[string]string)
+	for _, a := range artifacts {
+		files[a.Name] = a.Kind + "\n"
+	}
+	return writeFixture(t, files), &manifest{Artifacts: artifacts}
+}
+
+func TestSettlePreviousKeepsArtifactsOfDeadlineRun(t *testing.T) {
+	outputPath, previous := previousSync(t,
+		&artifact{Name: "doc_a.txt", Kind: kindDoc, Package: "example.com/a"},
+		&artifact{Name: "sig_a.txt", Kind: kindSignatures, Package: "example.com/a"},
+		&artifact{Name: "cmd_b.txt", Kind: kindCommand, Package: "example.com/b"},
+		&artifact{Name: "stub_b.go", Kind: kindStub, Package: "example.com/b"},
+	)
+
+	// The deadline ran out after the first package
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	r := newArtifactRegistry()
+	r.register(&artifact{Name: "doc_a.txt", Kind: kindDoc, Package: "example.com/a"})
+	r.settlePrevious(ctx, outputPath, previous, nil, map[string]bool{"": true}, map[string]bool{" example.com/a": true}, newReporter(io.Discard, false))
+
+	for _, a := range previous.Artifacts {
+		if _, err := os.Lstat(filepath.Join(outputPath, a.Name)); err != nil {
+			t.Errorf("%s was removed: %v", a.Name, err)
+		}
+		kept, ok := r.byName[a.Name]
+		if !ok {
+			t.Errorf("%s is missing from the registry", a.Name)
+			continue
+		}
+		if want := a.Name != "doc_a.txt"; kept.Stale != want {
+			t.Errorf("%s stale %v, want %v", a.Name, kept.Stale, want)
+		}
+	}
+}
+
+func TestSettlePreviousPrunesArtifactsOfFullRun(t *testing.T) {
+	outputPath, previous := previousSync(t,
+		&artifact{Name: "sig_a.txt", Kind: kindSignatures, Package: "example.com/a"},
+		&artifact{Name: "structure.txt", Kind: kindStructure},
+		&artifact{Name: "doc_a.txt", Kind: kindDoc, Package: "example.com/a"},
+		&artifact{Name: "doc_gone.txt", Kind: kindDoc, Package: "example.com/gone"},
+		&artifact{Name: "synopsis_gone.txt", Kind: kindSynopsis, Package: "example.com/gone"},
+		&artifact{Name: "other/doc_gone.txt", Kind: kindDoc, Package: "example.com/gone", Project: "other"},
+	)
+
+	// example.com/a was synced but not documented again, example.com/gone
+	// is no longer part of the project, the other project wasn't synced
+	r := newArtifactRegistry()
+	r.settlePrevious(context.Background(), outputPath, previous, nil, map[string]bool{"": true}, map[string]bool{" example.com/a": true}, newReporter(io.Discard, false))
+
+	for _, name := range []string{"sig_a.txt", "doc_gone.txt", "synopsis_gone.txt"} {
+		if _, err := os.Lstat(filepath.Join(outputPath, name)); !os.IsNotExist(err) {
+			t.Errorf("%s wasn't pruned: %v", name, err)
+		}
+	}
+	for _, name := range []string{"structure.txt", "doc_a.txt", "other/doc_gone.txt"} {
+		if _, err := os.Lstat(filepath.Join(outputPath, filepath.FromSlash(name))); err != nil {
+			t.Errorf("%s was removed: %v", name, err)
+		}
+	}
+}
+
+// A -only sync keeps the docs of the packages it didn't sync
+func TestSettlePreviousKeepsDocsOutsideOnly(t *testing.T) {
+	outputPath, previous := previousSync(t,
+		&artifact{Name: "doc_a.txt", Kind: kindDoc, Package: "example.com/a"},
+		&artifact{Name: "doc_b.txt", Kind: kindDoc, Package: "example.com/b"},
+		&artifact{Name: "sig_a.txt", Kind: kindSignatures, Package: "example.com/a"},
+	)
+
+	scope := newOnlyScope()
+	scope.packages["example.com/a"] = true
+	r := newArtifactRegistry()
+	r.register(&artifact{Name: "doc_a.txt", Kind: kindDoc, Package: "example.com/a"})
+	if !r.settlePrevious(context.Background(), outputPath, previous, scope, map[string]bool{"": true}, map[string]bool{" example.com/a": true}, newReporter(io.Discard, false)) {
+		t.Error("entrypoints of the previous sync dropped by a -only sync")
+	}
+
+	if _, err := os.Lstat(filepath.Join(outputPath, "doc_b.txt")); err != nil {
+		t.Errorf("doc_b.txt was removed: %v", err)
+	}
+	if _, ok := r.byName["doc_b.txt"]; !ok {
+		t.Error("doc_b.txt is missing from the registry")
+	}
+	if _, err := os.Lstat(filepath.Join(outputPath, "sig_a.txt")); !os.IsNotExist(err) {
+		t.Errorf("sig_a.txt wasn't pruned: %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// exitRemoteFailure is the exit code used when the local sync succeeded but
+// pushing it to the remote destination failed
+const exitRemoteFailure = 3
+
+// parseRemote splits a user@host:/path destination into host and path
+func parseRemote(remote string) (host, remotePath string, err error) {
+	idx := strings.Index(remote, ":")
+	if idx <= 0 || idx == len(remote)-1 {
+		return "", "", fmt.Errorf("invalid remote %q, expected [user@]host:/path", remote)
+	}
+	return remote[:idx], remote[idx+1:], nil
+}
+
+// pushToRemote mirrors the sync directory to a remote destination. Symlinks
+// are dereferenced so that the remote gets the real file contents. rsync is
+// used when available so that pruned artifacts are deleted on the remote too;
+// otherwise it falls back to ssh and scp, which can't mirror deletions.
+func pushToRemote(outputPath, remote string, rep *reporter) error {
+	host, remotePath, err := parseRemote(remote)
+	if err != nil {
+		return err
+	}
+
+	if _, err := exec.LookPath("rsync"); err == nil {
+		rep.info("Pushing %s to %s with rsync", outputPath, remote)
+
+		cmd := exec.Command("rsync", "-rtL", "--delete", outputPath+"/", remote+"/")
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("rsync failed: %v: %s", err, strings.TrimSpace(string(output)))
+		}
+		return nil
+	}
+
+	if _, err := exec.LookPath("scp"); err != nil {
+		return fmt.Errorf("neither rsync nor scp is available")
+	}
+
+	rep.info("rsync not found, pushing %s to %s with scp (deletions are not mirrored)", outputPath, remote)
+
+	cmd := exec.Command("ssh", remoteMkdirArgs(host, remotePath)...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("creating remote directory failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	entries, err := os.ReadDir(outputPath)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	args := []string{"-rp"}
+	for _, entry := range entries {
+		args = append(args, filepath.Join(outputPath, entry.Name()))
+	}
+	args = append(args, remote+"/")
+
+	cmd = exec.Command("scp", args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("scp failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// remoteMkdirArgs returns the ssh arguments creating remotePath on host. ssh
+// hands the command to the remote shell as one string, so the path is quoted;
+// a leading ~/ is left out of the quotes to still expand to the home directory.
+func remoteMkdirArgs(host, remotePath string) []string {
+	quoted := shellQuote(remotePath)
+	if strings.HasPrefix(remotePath, "~/") {
+		quoted = "~/" + shellQuote(remotePath[2:])
+	}
+	return []string{host, "mkdir -p -- " + quoted}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRemote(t *testing.T) {
+	host, path, err := parseRemote("me@box:/srv/ctx")
+	if err != nil || host != "me@box" || path != "/srv/ctx" {
+		t.Errorf("got %q %q %v", host, path, err)
+	}
+	for _, remote := range []string{"box", ":/srv", "box:"} {
+		if _, _, err := parseRemote(remote); err == nil {
+			t.Errorf("%q accepted", remote)
+		}
+	}
+}
+
+// The remote path reaches mkdir as a single word, whatever it contains
+func TestRemoteMkdirArgs(t *testing.T) {
+	tests := []struct {
+		path, command, dir string
+	}{
+		{"/srv/ctx", `mkdir -p -- '/srv/ctx'`, "/srv/ctx"},
+		{"/srv/my ctx", `mkdir -p -- '/srv/my ctx'`, "/srv/my ctx"},
+		{"/srv/it's; rm -rf ~", `mkdir -p -- '/srv/it'\''s; rm -rf ~'`, "/srv/it's; rm -rf ~"},
+		{"/srv/$(id)`id`", "mkdir -p -- '/srv/$(id)`id`'", "/srv/$(id)`id`"},
+		{"~/ctx dir", `mkdir -p -- ~/'ctx dir'`, "/home/me/ctx dir"},
+		{"-ctx", `mkdir -p -- '-ctx'`, "-ctx"},
+	}
+	sh, lookErr := exec.LookPath("sh")
+	for _, tt := range tests {
+		args := remoteMkdirArgs("box", tt.path)
+		if want := []string{"box", tt.command}; !reflect.DeepEqual(args, want) {
+			t.Errorf("%s: got %q, want %q", tt.path, args, want)
+			continue
+		}
+		if lookErr != nil {
+			continue
+		}
+
+		// Run by a shell as ssh would, with mkdir printing its arguments
+		cmd := exec.Command(sh, "-c", `mkdir() { printf '%s\n' "$@"; }; `+args[1])
+		cmd.Env = []string{"HOME=/home/me"}
+		output, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.path, err)
+		}
+		if got, want := strings.Split(strings.TrimSuffix(string(output), "\n"), "\n"), []string{"-p", "--", tt.dir}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: mkdir got %q, want %q", tt.path, got, want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// repoInfo locates the repository a project is checked out from. The project
+// may be a subdirectory of the repository's work tree, and the work tree a
+// linked worktree or submodule checkout whose .git is a file pointing at the
+// git directory.
+type repoInfo struct {
+	gitDir    string // git directory of the work tree
+	commonDir string // git directory shared by all worktrees of the repository
+	topLevel  string // root of the work tree
+	prefix    string // path of the project inside the work tree, "." at its root
+}
+
+// repoInfos are the repositories resolved during the run, by project path,
+// nil for a directory that isn't inside a work tree
+var repoInfos = make(map[string]*repoInfo)
+
+// resolveRepo returns the repository of the directory at path with a single
+// git call the first time, or nil if it isn't inside a work tree
+func resolveRepo(path string) *repoInfo {
+	if r, ok := repoInfos[path]; ok {
+		return r
+	}
+
+	var r *repoInfo
+	output, err := runGit(path, "rev-parse", "--git-dir", "--git-common-dir", "--show-toplevel")
+	lines := strings.Split(strings.TrimSuffix(string(output), "\n"), "\n")
+	if err == nil && len(lines) == 3 && lines[2] != "" {
+		// The git directories are relative to path unless git made them
+		// absolute
+		abs := func(dir string) string {
+			dir = filepath.FromSlash(dir)
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(path, dir)
+			}
+			return filepath.Clean(dir)
+		}
+		r = &repoInfo{
+			gitDir:    abs(lines[0]),
+			commonDir: abs(lines[1]),
+			topLevel:  filepath.Clean(filepath.FromSlash(lines[2])),
+			prefix:    ".",
+		}
+
+		// The top level has its symlinks resolved, which path may not
+		if realPath, err := filepath.EvalSymlinks(path); err == nil {
+			if rel, err := filepath.Rel(r.topLevel, realPath); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				r.prefix = rel
+			}
+		}
+	}
+	repoInfos[path] = r
+	return r
+}
+
+// linkedWorktree reports whether the work tree is a linked worktree rather
+// than the repository's main one
+func (r *repoInfo) linkedWorktree() bool {
+	return r.gitDir != r.commonDir
+}
+
+// subdirectory reports whether the project is a subdirectory of the work
+// tree rather than its root
+func (r *repoInfo) subdirectory() bool {
+	return r.prefix != "."
+}
+
+// projectPath returns the path inside the project of a path relative to the
+// root of the work tree, and whether it's inside the project at all
+func (r *repoInfo) projectPath(relPath string) (string, bool) {
+	if !r.subdirectory() {
+		return relPath, true
+	}
+	rel, err := filepath.Rel(r.prefix, relPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
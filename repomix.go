@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// repomixFileName is the name of the file written with -format=repomix
+const repomixFileName = "output.xml"
+
+// repomixMetadata is recorded as attributes of the root element
+type repomixMetadata struct {
+	module      string
+	commit      string
+	generatedAt time.Time
+}
+
+// renderRepomix renders the entries in the XML layout of repomix: a file
+// summary, the directory structure, and a <file path="..."> block per file
+func renderRepomix(meta repomixMetadata, structure string, entries []contextEntry) []byte {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+
+	b.WriteString("<repository")
+	writeXMLAttr(&b, "module", meta.module)
+	writeXMLAttr(&b, "commit", meta.commit)
+	writeXMLAttr(&b, "generated-at", meta.generatedAt.UTC().Format(time.RFC3339))
+	b.WriteString(">\n")
+
+	b.WriteString("<file_summary>\n")
+	fmt.Fprintf(&b, "This file is a merged representation of the context of %s generated by gocontext.\n", xmlText(meta.module))
+	b.WriteString("It contains the directory structure followed by package documentation and source files,\n")
+	b.WriteString("with packages in dependency order.\n")
+	b.WriteString("</file_summary>\n\n")
+
+	b.WriteString("<directory_structure>\n")
+	writeCDATA(&b, structure)
+	b.WriteString("\n</directory_structure>\n\n")
+
+	b.WriteString("<files>\n")
+	for _, e := range entries {
+		b.WriteString("<file")
+		writeXMLAttr(&b, "path", e.path)
+		b.WriteString(">\n")
+		writeCDATA(&b, string(e.content))
+		b.WriteString("\n</file>\n\n")
+	}
+	b.WriteString("</files>\n")
+	b.WriteString("</repository>\n")
+
+	return b.Bytes()
+}
+
+// writeXMLAttr writes an escaped attribute, omitting empty values
+func writeXMLAttr(b *bytes.Buffer, name, value string) {
+	if value == "" {
+		return
+	}
+	fmt.Fprintf(b, " %s=\"%s\"", name, xmlText(value))
+}
+
+// xmlText escapes text for use in XML content and attributes
+func xmlText(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(validXMLChars(s)))
+	return b.String()
+}
+
+// writeCDATA writes text as a CDATA section, splitting it wherever the text
+// itself contains the "]]>" terminator
+func writeCDATA(b *bytes.Buffer, text string) {
+	b.WriteString("<![CDATA[")
+	b.WriteString(strings.Replace(validXMLChars(text), "]]>", "]]]]><![CDATA[>", -1))
+	b.WriteString("]]>")
+}
+
+// validXMLChars replaces the characters XML 1.0 doesn't allow, such as most
+// control characters, with the Unicode replacement character
+func validXMLChars(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\t' || r == '\n' || r == '\r':
+			return r
+		case r < 0x20, r == 0xFFFE, r == 0xFFFF, r >= 0xD800 && r <= 0xDFFF:
+			return utf8.RuneError
+		}
+		return r
+	}, s)
+}
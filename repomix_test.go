@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+// repomixDocument is the layout of the repomix output, as read back
+type repomixDocument struct {
+	XMLName   xml.Name `xml:"repository"`
+	Module    string   `xml:"module,attr"`
+	Commit    string   `xml:"commit,attr"`
+	Summary   string   `xml:"file_summary"`
+	Structure string   `xml:"directory_structure"`
+	Files     []struct {
+		Path    string `xml:"path,attr"`
+		Content string `xml:",chardata"`
+	} `xml:"files>file"`
+}
+
+func TestRenderRepomixParses(t *testing.T) {
+	entries := []contextEntry{
+		{path: "a&b/<c>.go", content: []byte("if a < b && c > d {\n}\n")},
+		{path: `quote".txt`, content: []byte("x := m[a[b]]>0\nend ]]> of CDATA ]]>]]>\n")},
+		{path: "invalid.txt", content: []byte("bad \xff\xfe bytes and a \x01 control character\n")},
+		{path: "empty.txt", content: nil},
+	}
+	want := []struct {
+		path, content string
+	}{
+		{"a&b/<c>.go", "if a < b && c > d {\n}\n"},
+		{`quote".txt`, "x := m[a[b]]>0\nend ]]> of CDATA ]]>]]>\n"},
+		{"invalid.txt", "bad �� bytes and a � control character\n"},
+		{"empty.txt", ""},
+	}
+
+	meta := repomixMetadata{module: "example.com/a&b", commit: "abc123", generatedAt: time.Unix(0, 0)}
+	output := renderRepomix(meta, "./a&b\n./<c>]]>\n", entries)
+
+	var doc repomixDocument
+	if err := xml.Unmarshal(output, &doc); err != nil {
+		t.Fatalf("output doesn't parse: %v\n%s", err, output)
+	}
+	if doc.Module != meta.module || doc.Commit != meta.commit {
+		t.Errorf("module %q and commit %q, want %q and %q", doc.Module, doc.Commit, meta.module, meta.commit)
+	}
+	if !strings.Contains(doc.Summary, "example.com/a&b") {
+		t.Errorf("summary doesn't name the module: %q", doc.Summary)
+	}
+	if got := strings.TrimSpace(doc.Structure); got != "./a&b\n./<c>]]>" {
+		t.Errorf("directory structure %q", got)
+	}
+
+	if len(doc.Files) != len(want) {
+		t.Fatalf("got %d files, want %d", len(doc.Files), len(want))
+	}
+	for i, f := range doc.Files {
+		// Each CDATA section is followed by a newline of the layout
+		content := strings.TrimPrefix(strings.TrimSuffix(f.Content, "\n"), "\n")
+		if f.Path != want[i].path {
+			t.Errorf("file %d: path %q, want %q", i, f.Path, want[i].path)
+		}
+		if content != want[i].content {
+			t.Errorf("file %s: content %q, want %q", want[i].path, content, want[i].content)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// reporter prints the messages of a run and collects its warnings and errors
+// for the summary at the end. It is safe for concurrent use.
+type reporter struct {
+	mu      sync.Mutex
+	out     io.Writer
+	verbose bool
+
+	warnings []string
+	errors   []string
+
+	// counters are the tallies of the run kept for its summary, by name
+	counters map[string]int
+}
+
+// newReporter creates a reporter writing to out; informational messages are
+// only printed when verbose
+func newReporter(out io.Writer, verbose bool) *reporter {
+	return &reporter{out: out, verbose: verbose}
+}
+
+// info prints an informational message in verbose mode
+func (r *reporter) info(format string, args ...interface{}) {
+	if !r.verbose {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fmt.Fprintf(r.out, format+"\n", args...)
+}
+
+// warn records a warning for the summary, printing it right away in verbose mode
+func (r *reporter) warn(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.warnings = append(r.warnings, message)
+	if r.verbose {
+		fmt.Fprintf(r.out, "Warning: %s\n", message)
+	}
+}
+
+// error prints an error and records it for the summary
+func (r *reporter) error(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors = append(r.errors, message)
+	fmt.Fprintf(r.out, "Error: %s\n", message)
+}
+
+// progress reports that step done of total, described by the message, is
+// being worked on, in verbose mode
+func (r *reporter) progress(done, total int, format string, args ...interface{}) {
+	if !r.verbose {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fmt.Fprintf(r.out, "[%d/%d] %s\n", done, total, fmt.Sprintf(format, args...))
+}
+
+// count increments a counter of the run
+func (r *reporter) count(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.counters == nil {
+		r.counters = make(map[string]int)
+	}
+	r.counters[name]++
+}
+
+// counted returns the value of a counter of the run
+func (r *reporter) counted(name string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.counters[name]
+}
+
+// summary prints the warnings and errors collected during the run
+func (r *reporter) summary() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	printList(r.out, "Warnings", r.warnings)
+	printList(r.out, "Errors", r.errors)
+}
+
+// printList prints a titled list of messages, if there are any
+func printList(out io.Writer, title string, messages []string) {
+	if len(messages) == 0 {
+		return
+	}
+
+	fmt.Fprintf(out, "%s (%d):\n", title, len(messages))
+	for _, message := range messages {
+		fmt.Fprintf(out, "  - %s\n", message)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Run with -race: the reporter is shared by the workers of a sync
+func TestReporterConcurrent(t *testing.T) {
+	const workers, messages = 8, 100
+
+	var out bytes.Buffer
+	rep := newReporter(&out, true)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < messages; i++ {
+				rep.info("info %d/%d", w, i)
+				rep.warn("warning %d/%d", w, i)
+				rep.progress(i+1, messages, "step of worker %d", w)
+				rep.count("files")
+				rep.counted("files")
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if got := rep.counted("files"); got != workers*messages {
+		t.Errorf("counted %d files, want %d", got, workers*messages)
+	}
+	if got := len(rep.warnings); got != workers*messages {
+		t.Errorf("recorded %d warnings, want %d", got, workers*messages)
+	}
+
+	// Every message is printed on a line of its own, never interleaved
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 3*workers*messages {
+		t.Fatalf("printed %d lines, want %d", len(lines), 3*workers*messages)
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "info ") && !strings.HasPrefix(line, "Warning: warning ") && !strings.HasPrefix(line, "[") {
+			t.Fatalf("unexpected line %q", line)
+		}
+	}
+
+	out.Reset()
+	rep.summary()
+	if !strings.HasPrefix(out.String(), "Warnings (800):\n") {
+		t.Errorf("summary starts with %q", strings.SplitN(out.String(), "\n", 2)[0])
+	}
+}
+
+// Warnings are recorded for the summary even when they aren't printed
+func TestReporterQuiet(t *testing.T) {
+	var out bytes.Buffer
+	rep := newReporter(&out, false)
+	rep.info("hidden")
+	rep.progress(1, 2, "hidden")
+	rep.warn("could not read %s", "x")
+
+	if out.Len() != 0 {
+		t.Errorf("printed %q without verbose", out.String())
+	}
+	rep.summary()
+	if want := "Warnings (1):\n  - could not read x\n"; out.String() != want {
+		t.Errorf("summary %q, want %q", out.String(), want)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// resumeState holds the artifacts an interrupted sync wrote before it
+// stopped, by path, so that a sync resumed with -resume doesn't write them
+// again
+type resumeState struct {
+	written map[string]*artifact
+}
+
+// loadResume returns the state of the interrupted sync recorded by the
+// previous manifest, or nil if the previous sync completed. Artifacts kept
+// from an older sync aren't part of it.
+func loadResume(outputPath string, previous *manifest) *resumeState {
+	if previous == nil || !previous.Partial {
+		return nil
+	}
+
+	r := &resumeState{written: make(map[string]*artifact)}
+	for _, a := range previous.Artifacts {
+		if !a.Stale {
+			r.written[filepath.Join(outputPath, filepath.FromSlash(a.Name))] = a
+		}
+	}
+	return r
+}
+
+// done reports whether the file at filePath was written by the interrupted
+// sync and is still there with the size recorded, checked without reading it
+func (r *resumeState) done(filePath string) bool {
+	if r == nil {
+		return false
+	}
+	a, ok := r.written[filePath]
+	if !ok {
+		return false
+	}
+	info, err := os.Stat(filePath)
+	return err == nil && info.Mode().IsRegular() && info.Size() == a.Size
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// goAttempts is how many times a go subprocess is run before giving up on a
+// transient failure, set from the -retries flag
+var goAttempts = 3
+
+// runCtx bounds the whole run: go subprocesses are killed and no new ones are
+// started once it is done, set from the -max-runtime flag
+var runCtx = context.Background()
+
+// retryBaseDelay is the delay before the first retry, doubled for each subsequent one
+const retryBaseDelay = 500 * time.Millisecond
+
+// transientGoErrors are fragments of go command errors caused by flaky
+// network access, e.g. while fetching dependencies into a cold module cache
+var transientGoErrors = []string{
+	"dial tcp",
+	"i/o timeout",
+	"connection reset",
+	"connection refused",
+	"tls handshake timeout",
+	"temporary failure in name resolution",
+	"no such host",
+	"502 bad gateway",
+	"503 service unavailable",
+	"504 gateway timeout",
+	"request canceled",
+}
+
+// transientEOFContexts are fragments preceding "unexpected EOF" on a line when
+// a download was cut short. The same words end syntax errors, which aren't
+// transient, so the EOF alone isn't enough.
+var transientEOFContexts = []string{
+	"reading http",
+	"read tcp",
+	"git fetch",
+	"fetch-pack:",
+}
+
+// isTransientGoError reports whether a failed go command is worth retrying.
+// Compile errors and other deterministic failures are not.
+func isTransientGoError(err error) bool {
+	var exitError *exec.ExitError
+	if !errors.As(err, &exitError) {
+		return false
+	}
+
+	stderr := strings.ToLower(string(exitError.Stderr))
+	for _, fragment := range transientGoErrors {
+		if strings.Contains(stderr, fragment) {
+			return true
+		}
+	}
+	for _, line := range strings.Split(stderr, "\n") {
+		eof := strings.Index(line, "unexpected eof")
+		if eof < 0 {
+			continue
+		}
+		for _, context := range transientEOFContexts {
+			if strings.Contains(line[:eof], context) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// runGoWithRetry runs the go command with the given arguments in dir and
+// returns its standard output. Transient failures are retried with
+// exponential backoff, up to attempts runs in total.
+func runGoWithRetry(args []string, dir string, attempts int) ([]byte, error) {
+	delay := retryBaseDelay
+	for attempt := 1; ; attempt++ {
+		cmd := exec.CommandContext(runCtx, "go", args...)
+		cmd.Dir = dir
+		output, err := cmd.Output()
+		if err == nil || attempt >= attempts || !isTransientGoError(err) {
+			return output, err
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-runCtx.Done():
+			return output, err
+		}
+		delay *= 2
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+)
+
+func TestIsTransientGoError(t *testing.T) {
+	retried := []string{
+		"go: example.com/a@v1.2.0: Get \"https://proxy.golang.org/example.com/a/@v/v1.2.0.zip\": dial tcp 142.250.0.1:443: i/o timeout",
+		"go: example.com/a@v1.2.0: reading https://proxy.golang.org/example.com/a/@v/v1.2.0.zip: unexpected EOF",
+		"go: downloading example.com/a v1.2.0\ngo: example.com/a@v1.2.0: reading https://proxy.golang.org/example.com/a/@v/v1.2.0.mod: 503 Service Unavailable",
+		"go: example.com/a@v1.2.0: git fetch -f origin refs/heads/*:refs/heads/* in /go/pkg/mod/cache/vcs/abc: exit status 128:\n\terror: RPC failed; curl 18 transfer closed\n\tfetch-pack: unexpected EOF",
+		"go: example.com/a@v1.2.0: read tcp 10.0.0.2:51234->142.250.0.1:443: unexpected EOF",
+		"go: example.com/a@v1.2.0: dial tcp: lookup proxy.golang.org: Temporary failure in name resolution",
+		"go: example.com/a@v1.2.0: dial tcp: lookup proxy.golang.org: no such host",
+	}
+	notRetried := []string{
+		"pkg/a/a.go:12:1: syntax error: unexpected EOF, expected }",
+		"pkg/a/a.go:3:2: expected 'package', found 'EOF'",
+		"# example.com/a/pkg\npkg/a/a.go:7:2: undefined: fetchAll",
+		"go: example.com/a@v1.2.0: reading https://proxy.golang.org/example.com/a/@v/v1.2.0.mod: 404 Not Found",
+		"pkg/a/fetch.go:20:1: syntax error: unexpected EOF",
+		"go: cannot find main module, but found .git/config",
+		"",
+	}
+
+	for _, stderr := range retried {
+		if !isTransientGoError(&exec.ExitError{Stderr: []byte(stderr)}) {
+			t.Errorf("not retried: %q", stderr)
+		}
+	}
+	for _, stderr := range notRetried {
+		if isTransientGoError(&exec.ExitError{Stderr: []byte(stderr)}) {
+			t.Errorf("retried: %q", stderr)
+		}
+	}
+
+	// Only failures of the go command are retried
+	if isTransientGoError(errors.New("dial tcp: i/o timeout")) {
+		t.Error("retried an error that isn't an exit of the go command")
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/doc"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// renderSignatures renders the exported declarations of the package in
+// pkgDir without any comment: the signatures of its functions and methods,
+// its types with their exported fields and methods, and its constants and
+// variables, in go doc order
+func renderSignatures(pkgDir, importPath string) ([]byte, error) {
+	// Parsing without comments leaves no prose anywhere in the declarations
+	fset, files, err := parsePackage(pkgDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no buildable Go files")
+	}
+
+	p, err := doc.NewFromFiles(fset, files, importPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "package %s // import %q\n\n", p.Name, importPath)
+	writeDecl := func(decl ast.Decl) {
+		b.WriteString(declString(fset, decl))
+		b.WriteString("\n")
+	}
+	writeValues := func(values []*doc.Value) {
+		for _, v := range values {
+			writeDecl(v.Decl)
+		}
+	}
+	writeFuncs := func(funcs []*doc.Func) {
+		for _, f := range funcs {
+			writeDecl(funcSignature(f.Decl))
+		}
+	}
+
+	writeValues(p.Consts)
+	writeValues(p.Vars)
+	writeFuncs(p.Funcs)
+	for _, t := range p.Types {
+		// Each type starts a block with its constructors and methods
+		b.WriteString("\n")
+		writeDecl(t.Decl)
+		writeValues(t.Consts)
+		writeValues(t.Vars)
+		writeFuncs(t.Funcs)
+		writeFuncs(t.Methods)
+	}
+	return []byte(b.String()), nil
+}
+
+// signaturesFileName returns the name of the signatures of a package, placed
+// like its doc
+func signaturesFileName(moduleName, pkg string) string {
+	relPkg := relativePackagePath(moduleName, pkg)
+
+	switch grouping {
+	case groupDir:
+		return path.Join(relPkg, "sig.txt")
+	case groupPackage:
+		return path.Join(packageDirName(relPkg), "sig.txt")
+	}
+
+	if relPkg == "." {
+		relPkg = pkg
+	}
+	return flatName(kindPrefixes[kindSignatures], relPkg) + ".txt"
+}
+
+// writeSignatures writes the signatures of every package in place of its
+// documentation, keeping the ones written by the resumed sync, if any
+func writeSignatures(moduleName, syncPath string, packages []*packageInfo, resumed *resumeState, registry *artifactRegistry, rep *reporter) {
+	for i, pkg := range packages {
+		if runCtx.Err() != nil {
+			rep.warn("%s, skipped the signatures of %d of %d packages", stopReason(), len(packages)-i, len(packages))
+			break
+		}
+		if pkg.Dir == "" || len(pkg.GoFiles)+len(pkg.CgoFiles) == 0 {
+			continue
+		}
+		rep.progress(i+1, len(packages), "Listing the signatures of %s", pkg.ImportPath)
+
+		name := signaturesFileName(moduleName, pkg.ImportPath)
+		outputPath := filepath.Join(syncPath, filepath.FromSlash(name))
+		a := &artifact{Name: name, Kind: kindSignatures, Package: pkg.ImportPath, dir: pkg.Dir}
+		if resumed.done(outputPath) {
+			registry.register(a)
+			continue
+		}
+
+		output, err := renderSignatures(pkg.Dir, pkg.ImportPath)
+		if err != nil {
+			rep.warn("could not list the signatures of %s: %v", pkg.ImportPath, err)
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+			rep.warn("could not write the signatures of %s: %v", pkg.ImportPath, err)
+			continue
+		}
+		if err := writeFileAtomic(outputPath, output); err != nil {
+			rep.warn("could not write the signatures of %s: %v", pkg.ImportPath, err)
+			continue
+		}
+		if err := registry.register(a); err != nil {
+			rep.warn("could not register the signatures of %s: %v", pkg.ImportPath, err)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// changesFileName is the name of the summary of changes since a tag
+const changesFileName = "changes.txt"
+
+// verifyTag checks that tag names a tag of the repository at projectPath
+func verifyTag(projectPath, tag string) error {
+	if _, err := gitOutput(projectPath, "rev-parse", "--verify", "--quiet", "refs/tags/"+tag+"^{commit}"); err != nil {
+		return fmt.Errorf("tag %q not found in %s", tag, projectPath)
+	}
+	return nil
+}
+
+// packagesTouchedSince returns the files changed since ref, committed or not,
+// grouped by the import path of the package directly containing them. Only
+// packages of the given list are returned.
+func packagesTouchedSince(projectPath, moduleName, ref string, packages []string) (map[string][]string, error) {
+	output, err := gitOutput(projectPath, "diff", "--name-only", "--relative", ref, "--")
+	if err != nil {
+		return nil, fmt.Errorf("could not list changes since %s: %v", ref, err)
+	}
+
+	byDir := make(map[string][]string)
+	for _, file := range splitAndTrim(output, "\n") {
+		byDir[path.Dir(file)] = append(byDir[path.Dir(file)], file)
+	}
+
+	touched := make(map[string][]string)
+	for _, pkg := range packages {
+		if files, ok := byDir[relativePackagePath(moduleName, pkg)]; ok {
+			touched[pkg] = files
+		}
+	}
+	return touched, nil
+}
+
+// writeChanges writes the packages and files changed since a tag
+func writeChanges(syncPath, moduleName, tag string, touched map[string][]string, registry *artifactRegistry) error {
+	var pkgs []string
+	for pkg := range touched {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
+
+	var b strings.Builder
+	title := fmt.Sprintf("Changes since %s", tag)
+	fmt.Fprintf(&b, "%s\n%s\n", title, strings.Repeat("=", len(title)))
+	for _, pkg := range pkgs {
+		fmt.Fprintf(&b, "\n%s\n", relativePackagePath(moduleName, pkg))
+		files := touched[pkg]
+		sort.Strings(files)
+		for _, file := range files {
+			fmt.Fprintf(&b, "    %s\n", file)
+		}
+	}
+	if len(pkgs) == 0 {
+		b.WriteString("\n(no package changed)\n")
+	}
+
+	name := projectFileName(changesFileName)
+	outputPath := filepath.Join(syncPath, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputPath, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+
+	return registry.register(&artifact{Name: name, Kind: kindReport})
+}
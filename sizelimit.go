@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// exitSizeLimit is the exit code used when the sync succeeded but its total
+// size exceeds -max-size
+const exitSizeLimit = 4
+
+// largestArtifactsShown is how many of the largest artifacts are listed when
+// a size limit is exceeded
+const largestArtifactsShown = 10
+
+// byteSize is a flag value holding a size in bytes, given as a number with an
+// optional k, m or g suffix (powers of 1024), e.g. 512k or 2MB
+type byteSize int64
+
+func (s *byteSize) String() string {
+	return formatSize(int64(*s))
+}
+
+func (s *byteSize) Set(value string) error {
+	number := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(value)), "b")
+	multiplier := int64(1)
+	if n := len(number); n > 0 {
+		switch number[n-1] {
+		case 'k':
+			multiplier = 1 << 10
+		case 'm':
+			multiplier = 1 << 20
+		case 'g':
+			multiplier = 1 << 30
+		}
+		if multiplier > 1 {
+			number = number[:n-1]
+		}
+	}
+
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid size %q, expected a number with an optional k, m or g suffix", value)
+	}
+	*s = byteSize(n * float64(multiplier))
+	return nil
+}
+
+// formatSize formats a size in bytes with the largest fitting unit
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<30:
+		return fmt.Sprintf("%.1fGB", float64(size)/(1<<30))
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1fMB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1fKB", float64(size)/(1<<10))
+	default:
+		return fmt.Sprintf("%dB", size)
+	}
+}
+
+// artifactSize is the size of the resolved contents of an artifact
+type artifactSize struct {
+	name string
+	size int64
+}
+
+// artifactSizes returns the sizes of the artifacts, largest first, and their
+// total. Symlinks are followed, and linked directories count the files below.
+func artifactSizes(syncPath string, registry *artifactRegistry) ([]artifactSize, int64) {
+	var sizes []artifactSize
+	var total int64
+	for _, a := range registry.artifacts {
+		path := filepath.Join(syncPath, filepath.FromSlash(a.Name))
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+
+		size := info.Size()
+		if info.IsDir() {
+			size = 0
+			resolved, err := filepath.EvalSymlinks(path)
+			if err != nil {
+				continue
+			}
+			filepath.Walk(resolved, func(_ string, info os.FileInfo, err error) error {
+				if err == nil && info.Mode().IsRegular() {
+					size += info.Size()
+				}
+				return nil
+			})
+		}
+
+		sizes = append(sizes, artifactSize{name: a.Name, size: size})
+		total += size
+	}
+
+	sort.SliceStable(sizes, func(i, j int) bool {
+		return sizes[i].size > sizes[j].size
+	})
+	return sizes, total
+}
+
+// printLargestArtifacts lists the largest artifacts
+func printLargestArtifacts(sizes []artifactSize) {
+	if len(sizes) > largestArtifactsShown {
+		sizes = sizes[:largestArtifactsShown]
+	}
+	fmt.Println("Largest artifacts:")
+	for _, s := range sizes {
+		fmt.Printf("  %8s  %s\n", formatSize(s.size), s.name)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// stateDirName is the directory of the sync directory holding gocontext's own
+// bookkeeping, which isn't part of the context
+const stateDirName = ".gocontext"
+
+// stateFileName is the name of the state file inside stateDirName
+const stateFileName = "state.json"
+
+// syncState records what a sync directory was last synced from, so that
+// re-invocations on an unchanged tree can exit immediately
+type syncState struct {
+	Args     []string                `json:"args"`
+	Projects map[string]projectState `json:"projects"`
+}
+
+// projectState is the git state of a project at the time of a sync
+type projectState struct {
+	Head  string `json:"head"`
+	Dirty bool   `json:"dirty"`
+}
+
+// gitState returns the HEAD commit of the repository at projectPath and
+// whether its working tree has uncommitted changes, using a single git call
+func gitState(projectPath string) (projectState, error) {
+	cmd := exec.Command("git", "status", "--porcelain=v2", "--branch")
+	cmd.Dir = projectPath
+	output, err := cmd.Output()
+	if err != nil {
+		return projectState{}, commandError(err)
+	}
+
+	var state projectState
+	for _, line := range splitAndTrim(string(output), "\n") {
+		if strings.HasPrefix(line, "# branch.oid ") {
+			state.Head = strings.TrimPrefix(line, "# branch.oid ")
+		} else if !strings.HasPrefix(line, "#") {
+			state.Dirty = true
+		}
+	}
+
+	if state.Head == "" || state.Head == "(initial)" {
+		return projectState{}, fmt.Errorf("repository has no commits")
+	}
+
+	return state, nil
+}
+
+// currentState computes the state of the given projects. It fails if any of
+// them isn't a git repository, as their state can't be determined cheaply.
+func currentState(projects []*project, args []string) (*syncState, error) {
+	state := &syncState{Args: args, Projects: make(map[string]projectState)}
+	for _, p := range projects {
+		if !isGitRepository(p.path) {
+			return nil, fmt.Errorf("%s is not a git repository", p.path)
+		}
+
+		ps, err := gitState(p.path)
+		if err != nil {
+			return nil, err
+		}
+		state.Projects[p.path] = ps
+	}
+	return state, nil
+}
+
+// upToDate reports whether a sync from the current state would reproduce the
+// saved one: same arguments, same commits, and clean working trees
+func (s *syncState) upToDate(saved *syncState) bool {
+	if saved == nil || strings.Join(s.Args, "\x00") != strings.Join(saved.Args, "\x00") || len(s.Projects) != len(saved.Projects) {
+		return false
+	}
+
+	for path, ps := range s.Projects {
+		if ps.Dirty || saved.Projects[path] != ps {
+			return false
+		}
+	}
+	return true
+}
+
+// readState reads the state file of a sync directory
+func readState(outputPath string) (*syncState, error) {
+	data, err := os.ReadFile(filepath.Join(outputPath, stateDirName, stateFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	var s syncState
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// saveState writes the state file of a sync directory
+func saveState(outputPath string, s *syncState) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	stateDir := filepath.Join(outputPath, stateDirName)
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(stateDir, stateFileName), append(data, '\n'), 0644)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Formats of the package statistics accepted by -stats-format
+const (
+	statsFormatText = "text"
+	statsFormatCSV  = "csv"
+)
+
+// packageStats are the line counts of the Go files of a package
+type packageStats struct {
+	pkg       string // path relative to the module
+	files     int
+	lines     int
+	comments  int // lines holding only comments
+	tests     int // lines of _test.go files
+	generated int // lines of files with a "Code generated" header
+}
+
+// add adds the counts of other to s
+func (s *packageStats) add(other packageStats) {
+	s.files += other.files
+	s.lines += other.lines
+	s.comments += other.comments
+	s.tests += other.tests
+	s.generated += other.generated
+}
+
+// countGoLines counts the lines and comment-only lines of a Go file, and
+// reports whether it carries the generated code header. CRLF line endings
+// count as one line break.
+func countGoLines(filePath string) (lines, comments int, generated bool, err error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	defer f.Close()
+
+	inBlock, inPreamble := false, true
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(bytes.TrimSuffix(scanner.Bytes(), []byte("\r")))
+		lines++
+
+		if inPreamble {
+			if bytes.HasPrefix(line, []byte("package ")) {
+				inPreamble = false
+			} else if !generated && generatedHeader.Match(line) {
+				generated = true
+			}
+		}
+
+		switch {
+		case inBlock:
+			comments++
+			inBlock = !bytes.Contains(line, []byte("*/"))
+		case bytes.HasPrefix(line, []byte("//")):
+			comments++
+		case bytes.HasPrefix(line, []byte("/*")):
+			comments++
+			inBlock = !bytes.Contains(line[2:], []byte("*/"))
+		}
+	}
+	return lines, comments, generated, scanner.Err()
+}
+
+// collectStats counts the lines of the Go files of a package, as listed when
+// the package was loaded
+func collectStats(moduleName string, pkg *packageInfo, rep *reporter) packageStats {
+	stats := packageStats{pkg: relativePackagePath(moduleName, pkg.ImportPath)}
+	for _, filePath := range pkg.sourceFiles() {
+		lines, comments, generated, err := countGoLines(filePath)
+		if err != nil {
+			rep.warn("could not count the lines of %s: %v", filePath, err)
+			continue
+		}
+		stats.files++
+		stats.lines += lines
+		stats.comments += comments
+		if strings.HasSuffix(filePath, "_test.go") {
+			stats.tests += lines
+		}
+		if generated {
+			stats.generated += lines
+		}
+	}
+	return stats
+}
+
+// writeStats writes the line counts of every package and the module totals,
+// as an aligned table or as CSV
+func writeStats(syncPath, moduleName string, packages []*packageInfo, format string, registry *artifactRegistry, rep *reporter) error {
+	header := []string{"package", "files", "lines", "comments", "tests", "generated"}
+	var rows [][]string
+	total := packageStats{pkg: "total"}
+	for _, pkg := range packages {
+		stats := collectStats(moduleName, pkg, rep)
+		total.add(stats)
+		rows = append(rows, stats.row())
+	}
+	rows = append(rows, total.row())
+
+	var b bytes.Buffer
+	fileName := "stats.txt"
+	if format == statsFormatCSV {
+		fileName = "stats.csv"
+		w := csv.NewWriter(&b)
+		w.Write(header)
+		w.WriteAll(rows)
+		if err := w.Error(); err != nil {
+			return err
+		}
+	} else {
+		width := len(header[0])
+		for _, row := range rows {
+			if len(row[0]) > width {
+				width = len(row[0])
+			}
+		}
+		for _, row := range append([][]string{header}, rows...) {
+			fmt.Fprintf(&b, "%-*s", width, row[0])
+			for _, cell := range row[1:] {
+				fmt.Fprintf(&b, "  %9s", cell)
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	name := projectFileName(fileName)
+	outputPath := filepath.Join(syncPath, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputPath, b.Bytes(), 0644); err != nil {
+		return err
+	}
+	registry.register(&artifact{Name: name, Kind: kindReport})
+
+	rep.info("Counted %d lines in %d Go files", total.lines, total.files)
+
+	return nil
+}
+
+// row returns the counts as the cells of a table row
+func (s packageStats) row() []string {
+	return []string{
+		s.pkg,
+		strconv.Itoa(s.files),
+		strconv.Itoa(s.lines),
+		strconv.Itoa(s.comments),
+		strconv.Itoa(s.tests),
+		strconv.Itoa(s.generated),
+	}
+}
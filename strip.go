@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// stripComments writes included Go files without their comments, set once
+// from the command line
+var stripComments bool
+
+// strippedTotals are the sizes of the Go files stripped of comments during
+// the run, which are stripped concurrently, in bytes and in tokens of the
+// selected tokenizer
+var strippedTotals struct {
+	sync.Mutex
+	files                     int
+	before, after             int64
+	tokensBefore, tokensAfter int
+}
+
+// isDirectiveComment reports whether a comment must be kept for the file to
+// build the same: build constraints and //go:, //line and cgo //export directives
+func isDirectiveComment(text string) bool {
+	if strings.HasPrefix(text, "// +build") {
+		return true
+	}
+	for _, prefix := range []string{"//go:", "//line ", "//export "} {
+		if strings.HasPrefix(text, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// stripGoComments returns the Go source without comments, except directives
+// and the cgo preamble of import "C"
+func stripGoComments(filename string, src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	// The cgo preamble is the doc comment of import "C"
+	preambles := make(map[*ast.CommentGroup]bool)
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			if imp := spec.(*ast.ImportSpec); imp.Path.Value == `"C"` {
+				if gen.Doc != nil {
+					preambles[gen.Doc] = true
+				}
+				if imp.Doc != nil {
+					preambles[imp.Doc] = true
+				}
+			}
+		}
+	}
+
+	var kept []*ast.CommentGroup
+	for _, group := range file.Comments {
+		if preambles[group] {
+			kept = append(kept, group)
+			continue
+		}
+		var directives []*ast.Comment
+		for _, c := range group.List {
+			if isDirectiveComment(c.Text) {
+				directives = append(directives, c)
+			}
+		}
+		if len(directives) > 0 {
+			kept = append(kept, &ast.CommentGroup{List: directives})
+		}
+	}
+	file.Comments = kept
+
+	var b bytes.Buffer
+	if err := format.Node(&b, fset, file); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// writeStrippedFile writes the Go file at source without comments to dest,
+// replacing whatever is at dest without following symlinks so that the
+// original file is never modified. The tokens saved are counted with tok.
+func writeStrippedFile(source, dest string, tok tokenizer) error {
+	src, err := os.ReadFile(source)
+	if err != nil {
+		return err
+	}
+	stripped, err := stripGoComments(source, src)
+	if err != nil {
+		return fmt.Errorf("could not strip comments: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(dest, stripped); err != nil {
+		return err
+	}
+
+	tokensBefore, tokensAfter := countTextTokens(tok, src), countTextTokens(tok, stripped)
+
+	strippedTotals.Lock()
+	defer strippedTotals.Unlock()
+	strippedTotals.files++
+	strippedTotals.before += int64(len(src))
+	strippedTotals.after += int64(len(stripped))
+	strippedTotals.tokensBefore += tokensBefore
+	strippedTotals.tokensAfter += tokensAfter
+	return nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// structureJSONFileName is the name of the machine-readable directory
+// structure written with -structure-json
+const structureJSONFileName = "directory_structure.json"
+
+// structureNode is a directory or file of the machine-readable directory
+// structure. The size of a directory is the total size of the files below it,
+// those left out by the limits of the structure included.
+type structureNode struct {
+	Name      string           `json:"name"`
+	Type      string           `json:"type"`
+	Size      int64            `json:"size"`
+	Package   string           `json:"package,omitempty"`
+	Children  []*structureNode `json:"children,omitempty"`
+	Truncated bool             `json:"truncated,omitempty"`
+	Omitted   int              `json:"omitted,omitempty"` // children left out of a truncated directory
+}
+
+// writeStructureJSON writes the directory structure of the project as nested
+// JSON objects, directories first and then by name at every level. It's
+// built from the files the sync walks for READMEs rather than from the output
+// of tree, leaving out what directory_structure.txt does: hidden entries, the
+// excluded directories, the sync directory and, in git repositories, the
+// ignored files. Directories without files are left out, as git doesn't
+// track them. The limits apply as they do to the text.
+func writeStructureJSON(projectPath, syncPath string, excludeDirs []string, isGitRepo bool, limits structureLimits, registry *artifactRegistry, rep *reporter) error {
+	files, err := candidateFiles(projectPath, projectPath, isGitRepo, func(path, name string) bool {
+		if strings.HasPrefix(name, ".") || path == syncPath {
+			return true
+		}
+		for _, excludeDir := range excludeDirs {
+			excludePath := excludeDir
+			if !filepath.IsAbs(excludePath) {
+				excludePath = filepath.Join(projectPath, excludeDir)
+			}
+			if path == excludePath || strings.HasPrefix(path, excludePath+string(os.PathSeparator)) {
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return err
+	}
+
+	root := &structureNode{Name: ".", Type: "dir"}
+	dirs := map[string]*structureNode{".": root}
+	var dirFor func(relDir string) *structureNode
+	dirFor = func(relDir string) *structureNode {
+		if node, ok := dirs[relDir]; ok {
+			return node
+		}
+		node := &structureNode{Name: filepath.Base(relDir), Type: "dir"}
+		parent := dirFor(filepath.Dir(relDir))
+		parent.Children = append(parent.Children, node)
+		dirs[relDir] = node
+		return node
+	}
+
+	for _, path := range files {
+		relPath, err := filepath.Rel(projectPath, path)
+		if err != nil || strings.HasPrefix(filepath.Base(path), ".") {
+			continue
+		}
+
+		// Symlinks are described by what they point to, if anything
+		info, err := os.Stat(path)
+		if err != nil {
+			if info, err = os.Lstat(path); err != nil {
+				continue
+			}
+		}
+		node := &structureNode{Name: filepath.Base(path), Type: "file", Size: info.Size()}
+		if strings.HasSuffix(path, ".go") {
+			if f, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.PackageClauseOnly); err == nil {
+				node.Package = f.Name.Name
+			}
+		}
+		parent := dirFor(filepath.Dir(relPath))
+		parent.Children = append(parent.Children, node)
+	}
+	sortStructure(root)
+	limits.apply(root, 0)
+
+	data, err := json.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := projectFileName(structureJSONFileName)
+	outputPath := filepath.Join(syncPath, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputPath, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	rep.info("Generated %s", structureJSONFileName)
+
+	return registry.register(&artifact{Name: name, Kind: kindStructureJSON})
+}
+
+// sortStructure sorts the children of a directory, directories first as in
+// directory_structure.txt, and totals the sizes of the directories
+func sortStructure(node *structureNode) int64 {
+	if node.Type != "dir" {
+		return node.Size
+	}
+	node.Size = 0
+	for _, child := range node.Children {
+		node.Size += sortStructure(child)
+	}
+	sort.Slice(node.Children, func(i, j int) bool {
+		a, b := node.Children[i], node.Children[j]
+		if a.Type != b.Type {
+			return a.Type == "dir"
+		}
+		return a.Name < b.Name
+	})
+	return node.Size
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// structureLimits bound the directory structure of monorepos, whose leaf
+// files make up most of it. Zero means unlimited.
+type structureLimits struct {
+	depth      int // levels below the project root listed
+	maxEntries int // entries listed per directory
+}
+
+// treeArgs returns the tree options of the limits. tree can only limit the
+// depth; the entries are truncated in its output.
+func (l structureLimits) treeArgs() []string {
+	if l.depth > 0 {
+		return []string{"-L", strconv.Itoa(l.depth)}
+	}
+	return nil
+}
+
+// truncationMarker is the line listed after the last entry kept of a
+// truncated directory
+func truncationMarker(omitted int) string {
+	return fmt.Sprintf("… and %d more", omitted)
+}
+
+// truncateTree truncates the listing of every directory in the output of
+// tree after maxEntries entries, ending it with a truncation marker. Entries
+// are recognized by their indentation, four characters per level followed by
+// a connector such as "├── " or, in tree's ASCII style, "|-- ". Lines of any
+// other form are kept as they are.
+func (l structureLimits) truncateTree(output string) string {
+	if l.maxEntries <= 0 {
+		return output
+	}
+
+	var b strings.Builder
+	var counts, omitted []int // by level, for the directories being listed
+	var prefixes []string     // by level, the indentation of the entries listed
+	last := "└── "
+
+	// end ends the listings of the levels below level
+	end := func(level int) {
+		for i := len(counts) - 1; i > level; i-- {
+			if omitted[i] > 0 {
+				fmt.Fprintf(&b, "%s%s%s\n", prefixes[i], last, truncationMarker(omitted[i]))
+			}
+		}
+		if len(counts) > level+1 {
+			counts, omitted, prefixes = counts[:level+1], omitted[:level+1], prefixes[:level+1]
+		}
+	}
+
+	lines := strings.SplitAfter(output, "\n")
+	for _, line := range lines {
+		// Other lines, such as the report at the end, end the listings
+		level, connector, ok := treeEntry(line)
+		if !ok {
+			end(-1)
+			b.WriteString(line)
+			continue
+		}
+		end(level)
+		for len(counts) <= level {
+			counts, omitted, prefixes = append(counts, 0), append(omitted, 0), append(prefixes, "")
+		}
+
+		// Entries of a directory after the listing of one of its
+		// ancestors was truncated are left out with it
+		hidden := false
+		for i := 0; i < level; i++ {
+			hidden = hidden || omitted[i] > 0
+		}
+		if hidden {
+			continue
+		}
+
+		counts[level]++
+		if counts[level] > l.maxEntries {
+			omitted[level]++
+			continue
+		}
+		prefixes[level] = string([]rune(line)[:4*level])
+		if strings.ContainsAny(connector, "|`") {
+			last = "`-- "
+		}
+		b.WriteString(line)
+	}
+	end(-1)
+	return b.String()
+}
+
+// treeEntry returns the level of an entry line of tree's output, 0 for the
+// entries of the root, and its connector
+func treeEntry(line string) (int, string, bool) {
+	runes := []rune(line)
+	for level := 0; 4*level+4 <= len(runes); level++ {
+		group := runes[4*level : 4*level+4]
+		switch {
+		case (group[0] == '├' || group[0] == '└') && group[1] == '─' && group[2] == '─':
+			return level, string(group), true
+		case (group[0] == '|' || group[0] == '`') && group[1] == '-' && group[2] == '-':
+			return level, string(group), true
+		case !strings.ContainsRune("│| \u00a0", group[0]) || !isTreeSpace(group[1]) || !isTreeSpace(group[2]) || !isTreeSpace(group[3]):
+			return 0, "", false
+		}
+	}
+	return 0, "", false
+}
+
+// isTreeSpace reports whether r pads the indentation of tree's output, which
+// tree 2 pads with non-breaking spaces
+func isTreeSpace(r rune) bool {
+	return r == ' ' || r == '\u00a0'
+}
+
+// apply limits a node of the machine-readable structure at the given level,
+// 0 for the root, and the nodes below it. Directories with children left out
+// are marked truncated, with the number of children left out.
+func (l structureLimits) apply(node *structureNode, level int) {
+	if node.Type != "dir" || len(node.Children) == 0 {
+		return
+	}
+	keep := len(node.Children)
+	if l.depth > 0 && level >= l.depth {
+		keep = 0
+	} else if l.maxEntries > 0 && keep > l.maxEntries {
+		keep = l.maxEntries
+	}
+	if keep < len(node.Children) {
+		node.Truncated = true
+		node.Omitted = len(node.Children) - keep
+		node.Children = node.Children[:keep]
+	}
+	for _, child := range node.Children {
+		l.apply(child, level+1)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// capturedTree is the output of tree 1.8 in a UTF-8 locale
+const capturedTree = `.
+├── a
+│   ├── 1.go
+│   ├── 2.go
+│   ├── 3.go
+│   └── sub
+│       ├── x.go
+│       └── y.go
+├── b.go
+├── c.go
+└── d
+    └── e.go
+
+3 directories, 8 files
+`
+
+// treeStyles turn capturedTree into the output of the other styles: tree 2
+// pads the indentation with non-breaking spaces, and --charset=ascii draws
+// with ASCII characters
+var treeStyles = map[string]*strings.Replacer{
+	"unicode": strings.NewReplacer(),
+	"nbsp":    strings.NewReplacer("│   ", "│\u00a0\u00a0 "),
+	"ascii":   strings.NewReplacer("├── ", "|-- ", "└── ", "`-- ", "│   ", "|   "),
+}
+
+func TestTruncateTree(t *testing.T) {
+	tests := []struct {
+		maxEntries int
+		want       string
+	}{
+		{0, capturedTree},
+		{10, capturedTree},
+		{2, `.
+├── a
+│   ├── 1.go
+│   ├── 2.go
+│   └── … and 2 more
+├── b.go
+└── … and 2 more
+
+3 directories, 8 files
+`},
+		{1, `.
+├── a
+│   ├── 1.go
+│   └── … and 3 more
+└── … and 3 more
+
+3 directories, 8 files
+`},
+	}
+	for style, r := range treeStyles {
+		for _, tt := range tests {
+			got := structureLimits{maxEntries: tt.maxEntries}.truncateTree(r.Replace(capturedTree))
+			if want := r.Replace(tt.want); got != want {
+				t.Errorf("%s, %d entries: got\n%s\nwant\n%s", style, tt.maxEntries, got, want)
+			}
+		}
+	}
+}
+
+func TestTreeEntry(t *testing.T) {
+	tests := []struct {
+		line      string
+		level     int
+		connector string
+		ok        bool
+	}{
+		{"├── a\n", 0, "├── ", true},
+		{"└── d\n", 0, "└── ", true},
+		{"│   ├── 1.go\n", 1, "├── ", true},
+		{"│       └── y.go\n", 2, "└── ", true},
+		{"    └── e.go\n", 1, "└── ", true},
+		{"│   └── sub\n", 1, "└── ", true},
+		{"│       ├── x.go\n", 2, "├── ", true},
+		{"|-- a\n", 0, "|-- ", true},
+		{"|   `-- sub\n", 1, "`-- ", true},
+		{".\n", 0, "", false},
+		{"\n", 0, "", false},
+		{"3 directories, 8 files\n", 0, "", false},
+		{"│\u00a0\u00a0 └── x.go\n", 1, "└── ", true},
+		{"│   \n", 0, "", false},
+		{"name ├── x\n", 0, "", false},
+	}
+	for _, tt := range tests {
+		level, connector, ok := treeEntry(tt.line)
+		if level != tt.level || connector != tt.connector || ok != tt.ok {
+			t.Errorf("%q: got %d %q %v, want %d %q %v", tt.line, level, connector, ok, tt.level, tt.connector, tt.ok)
+		}
+	}
+}
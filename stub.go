@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// stubBody replaces the bodies of functions in stubs
+const stubBody = "{ /* ... */ }"
+
+// buildableGoFiles returns the sorted names of the non-test Go files of the
+// directory that match the current build context
+func buildableGoFiles(pkgDir string) ([]string, error) {
+	entries, err := os.ReadDir(pkgDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		if match, err := build.Default.MatchFile(pkgDir, name); err != nil || !match {
+			continue
+		}
+		names = append(names, name)
+	}
+
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no buildable Go files in %s", pkgDir)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// stubFileName returns the name of the stub of a package, placed like its doc
+func stubFileName(moduleName, pkg string) string {
+	relPkg := relativePackagePath(moduleName, pkg)
+
+	switch grouping {
+	case groupDir:
+		return path.Join(relPkg, "stub.go.txt")
+	case groupPackage:
+		return path.Join(packageDirName(relPkg), "stub.go.txt")
+	}
+
+	if relPkg == "." {
+		relPkg = pkg
+	}
+	return flatName(kindPrefixes[kindStub], relPkg) + ".go.txt"
+}
+
+// renderStub merges the files of the package in pkgDir into a single Go file
+// with every function body replaced by stubBody. Everything else, including
+// doc comments, types and constant blocks, is kept verbatim.
+func renderStub(pkgDir, importPath string) ([]byte, error) {
+	names, err := buildableGoFiles(pkgDir)
+	if err != nil {
+		return nil, err
+	}
+
+	fset := token.NewFileSet()
+	var packageName, packageDoc string
+	var imports []string
+	seenImports := make(map[string]bool)
+	var decls bytes.Buffer
+
+	for _, name := range names {
+		src, err := os.ReadFile(filepath.Join(pkgDir, name))
+		if err != nil {
+			return nil, err
+		}
+		file, err := parser.ParseFile(fset, name, src, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		offset := func(pos token.Pos) int { return fset.Position(pos).Offset }
+
+		packageName = file.Name.Name
+		if file.Doc != nil && packageDoc == "" {
+			packageDoc = string(src[offset(file.Doc.Pos()):offset(file.Doc.End())])
+		}
+
+		// Imports of all files are merged into a single block
+		start := offset(file.Name.End())
+		for _, spec := range file.Imports {
+			line := spec.Path.Value
+			if spec.Name != nil {
+				line = spec.Name.Name + " " + line
+			}
+			if !seenImports[line] {
+				seenImports[line] = true
+				imports = append(imports, line)
+			}
+		}
+		for _, decl := range file.Decls {
+			if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+				start = offset(gen.End())
+			}
+		}
+
+		// Splice the function bodies out of the rest of the file
+		var b bytes.Buffer
+		last := start
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil {
+				continue
+			}
+			b.Write(src[last:offset(fn.Body.Lbrace)])
+			b.WriteString(stubBody)
+			last = offset(fn.Body.Rbrace) + 1
+		}
+		b.Write(src[last:])
+
+		rest := strings.TrimSpace(b.String())
+		if rest == "" {
+			continue
+		}
+		fmt.Fprintf(&decls, "\n// From %s\n\n%s\n", name, rest)
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Stub of package %s: function bodies are elided.\n\n", importPath)
+	if packageDoc != "" {
+		out.WriteString(packageDoc)
+		out.WriteString("\n")
+	}
+	fmt.Fprintf(&out, "package %s\n", packageName)
+	if len(imports) > 0 {
+		sort.Slice(imports, func(i, j int) bool {
+			return importPathOf(imports[i]) < importPathOf(imports[j])
+		})
+		out.WriteString("\nimport (\n")
+		for _, line := range imports {
+			fmt.Fprintf(&out, "\t%s\n", line)
+		}
+		out.WriteString(")\n")
+	}
+	out.Write(decls.Bytes())
+
+	return out.Bytes(), nil
+}
+
+// importPathOf returns the unquoted path of an import spec line
+func importPathOf(line string) string {
+	fields := strings.Fields(line)
+	unquoted, err := strconv.Unquote(fields[len(fields)-1])
+	if err != nil {
+		return line
+	}
+	return unquoted
+}
+
+// writeStub writes the stub of a package to the sync directory
+func writeStub(moduleName, pkg, pkgDir, syncPath string, registry *artifactRegistry, rep *reporter) error {
+	output, err := renderStub(pkgDir, pkg)
+	if err != nil {
+		return err
+	}
+
+	name := stubFileName(moduleName, pkg)
+	stubFile := filepath.Join(syncPath, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(stubFile), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(stubFile, output, 0644); err != nil {
+		return err
+	}
+
+	rep.info("Generated stub for %s", pkg)
+
+	return registry.register(&artifact{Name: name, Kind: kindStub, Package: pkg, dir: pkgDir})
+}
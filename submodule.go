@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// submodule describes a git submodule checked out inside the project
+type submodule struct {
+	path    string // path relative to the project root
+	absPath string // absolute path of the submodule checkout
+	module  string // Go module name declared by the submodule, if any
+}
+
+// submodules holds the submodules detected in the project
+var submodules []submodule
+
+// parseGitmodules reads the submodule paths declared in the .gitmodules file
+// of the project's work tree, keeping those inside the project
+func parseGitmodules(projectPath string, repo *repoInfo) ([]submodule, error) {
+	content, err := os.ReadFile(filepath.Join(repo.topLevel, ".gitmodules"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var result []submodule
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "path") {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) != "path" {
+			continue
+		}
+
+		relPath, ok := repo.projectPath(filepath.FromSlash(strings.TrimSpace(parts[1])))
+		if !ok {
+			continue
+		}
+		absPath := filepath.Join(projectPath, relPath)
+
+		// Only consider submodules that are actually checked out
+		if info, err := os.Stat(absPath); err != nil || !info.IsDir() {
+			continue
+		}
+
+		sub := submodule{path: relPath, absPath: absPath}
+		if moduleName, err := getModuleName(absPath); err == nil {
+			sub.module = moduleName
+		}
+		result = append(result, sub)
+	}
+
+	return result, nil
+}
+
+// findSubmodule returns the submodule containing path, or nil if path belongs
+// to the outer repository
+func findSubmodule(path string) *submodule {
+	for i := range submodules {
+		if path == submodules[i].absPath || strings.HasPrefix(path, submodules[i].absPath+string(os.PathSeparator)) {
+			return &submodules[i]
+		}
+	}
+	return nil
+}
+
+// gitRootFor returns the directory git commands concerning path should run in
+func gitRootFor(path, projectPath string) string {
+	if sub := findSubmodule(path); sub != nil {
+		return sub.absPath
+	}
+	return projectPath
+}
+
+// labelSubmodule records on the artifact which submodule, and which module
+// when it differs from the project's, the artifact was derived from
+func labelSubmodule(a *artifact, moduleName string) {
+	path := a.Source
+	if path == "" {
+		path = a.dir
+	}
+
+	sub := findSubmodule(path)
+	if sub == nil {
+		return
+	}
+
+	a.Submodule = filepath.ToSlash(sub.path)
+	if sub.module != "" && sub.module != moduleName {
+		a.Module = sub.module
+	}
+}
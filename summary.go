@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Counters of the reporter making up the summary of a run
+const (
+	counterDocsCached    = "docs cached"    // docs kept as up to date
+	counterDocsGenerated = "docs generated" // docs written by go doc
+)
+
+// runSummary is what a run did, printed at its end and included in the JSON
+// output as its summary object
+type runSummary struct {
+	Packages       int     `json:"packages"` // packages with a doc, synopsis or signatures
+	Sources        int     `json:"sources"`
+	Readmes        int     `json:"readmes"`
+	Artifacts      int     `json:"artifacts"`
+	Bytes          int64   `json:"bytes"`
+	Tokens         int     `json:"tokens"`
+	ElapsedSeconds float64 `json:"elapsedSeconds"`
+	DocsCached     int     `json:"docsCached"`
+	DocsGenerated  int     `json:"docsGenerated"`
+}
+
+// summarizeRun counts the artifacts of the registry by kind, along with the
+// size and tokens of the context and the doc cache counters of the reporter
+func summarizeRun(registry *artifactRegistry, totalSize int64, tokens int, elapsed time.Duration, rep *reporter) runSummary {
+	s := runSummary{
+		Artifacts:      len(registry.artifacts),
+		Bytes:          totalSize,
+		Tokens:         tokens,
+		ElapsedSeconds: elapsed.Round(time.Millisecond).Seconds(),
+		DocsCached:     rep.counted(counterDocsCached),
+		DocsGenerated:  rep.counted(counterDocsGenerated),
+	}
+
+	documented := make(map[string]bool)
+	for _, a := range registry.artifacts {
+		switch a.Kind {
+		case kindDoc, kindSynopsis, kindSignatures:
+			documented[a.Package] = true
+		case kindSource:
+			s.Sources++
+		case kindReadme:
+			s.Readmes++
+		}
+	}
+	s.Packages = len(documented)
+	return s
+}
+
+// cacheHitRate returns the share of the docs kept from a previous sync, -1
+// when no doc was looked at
+func (s runSummary) cacheHitRate() float64 {
+	total := s.DocsCached + s.DocsGenerated
+	if total == 0 {
+		return -1
+	}
+	return float64(s.DocsCached) / float64(total)
+}
+
+// print writes the summary as a block of aligned lines
+func (s runSummary) print(out io.Writer) {
+	fmt.Fprintln(out, "Summary:")
+	fmt.Fprintf(out, "  Packages documented: %d\n", s.Packages)
+	fmt.Fprintf(out, "  Sources linked:      %d\n", s.Sources)
+	fmt.Fprintf(out, "  READMEs linked:      %d\n", s.Readmes)
+	fmt.Fprintf(out, "  Artifacts:           %d, %s, ~%d tokens\n", s.Artifacts, formatSize(s.Bytes), s.Tokens)
+	if rate := s.cacheHitRate(); rate >= 0 {
+		fmt.Fprintf(out, "  Doc cache:           %d of %d docs up to date (%.0f%%)\n", s.DocsCached, s.DocsCached+s.DocsGenerated, 100*rate)
+	}
+	fmt.Fprintf(out, "  Elapsed:             %s\n", time.Duration(s.ElapsedSeconds*float64(time.Second)))
+}
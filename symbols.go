@@ -0,0 +1,202 @@
+package main
+
+import (
+	"go/ast"
+	"go/doc"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// symbolsFileName is the name of the index of exported symbols
+const symbolsFileName = "symbols.tsv"
+
+// symbol is an exported declaration of a package
+type symbol struct {
+	name, kind, pkg, synopsis string
+}
+
+// oneLine collapses a declaration to a single line fit for a TSV cell
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// typeSynopsis is the one-line declaration of a type, leaving out the fields
+// and methods of structs and interfaces
+func typeSynopsis(fset *token.FileSet, t *doc.Type) string {
+	for _, spec := range t.Decl.Specs {
+		ts, ok := spec.(*ast.TypeSpec)
+		if !ok || ts.Name.Name != t.Name {
+			continue
+		}
+		switch ts.Type.(type) {
+		case *ast.StructType:
+			return "type " + t.Name + " struct"
+		case *ast.InterfaceType:
+			return "type " + t.Name + " interface"
+		}
+		decl := &ast.GenDecl{Tok: token.TYPE, Specs: []ast.Spec{ts}}
+		return oneLine(declString(fset, decl))
+	}
+	return "type " + t.Name
+}
+
+// valueSymbols returns the symbols of constant or variable groups, each with
+// the line of its own spec
+func valueSymbols(fset *token.FileSet, importPath string, values []*doc.Value) []symbol {
+	var symbols []symbol
+	for _, v := range values {
+		kind := strings.ToLower(v.Decl.Tok.String())
+		for _, spec := range v.Decl.Specs {
+			vs := spec.(*ast.ValueSpec)
+			decl := &ast.GenDecl{Tok: v.Decl.Tok, Specs: []ast.Spec{&ast.ValueSpec{Names: vs.Names, Type: vs.Type, Values: vs.Values}}}
+			synopsis := oneLine(declString(fset, decl))
+			for _, name := range vs.Names {
+				if name.IsExported() {
+					symbols = append(symbols, symbol{name.Name, kind, importPath, synopsis})
+				}
+			}
+		}
+	}
+	return symbols
+}
+
+// funcSymbols returns the symbols of functions or methods, the methods named
+// after their receiver type
+func funcSymbols(fset *token.FileSet, importPath, recvType string, funcs []*doc.Func) []symbol {
+	var symbols []symbol
+	for _, f := range funcs {
+		name, kind := f.Name, "func"
+		if f.Recv != "" {
+			name, kind = recvType+"."+f.Name, "method"
+		}
+		symbols = append(symbols, symbol{name, kind, importPath, oneLine(declString(fset, funcSignature(f.Decl)))})
+	}
+	return symbols
+}
+
+// packageSymbols parses the package in pkgDir with go/doc and returns its
+// exported symbols in documentation order. Files that don't parse are left
+// out, the symbols of the others are returned along with the first error.
+func packageSymbols(pkgDir, importPath string) ([]symbol, error) {
+	names, err := buildableGoFiles(pkgDir)
+	if err != nil {
+		return nil, err
+	}
+
+	fset := token.NewFileSet()
+	var files []*ast.File
+	var parseErr error
+	for _, name := range names {
+		file, err := parser.ParseFile(fset, filepath.Join(pkgDir, name), nil, parser.ParseComments)
+		if err != nil {
+			if parseErr == nil {
+				parseErr = err
+			}
+			continue
+		}
+		files = append(files, file)
+	}
+	if len(files) == 0 {
+		return nil, parseErr
+	}
+
+	p, err := doc.NewFromFiles(fset, files, importPath)
+	if err != nil {
+		return nil, err
+	}
+
+	symbols := valueSymbols(fset, importPath, p.Consts)
+	symbols = append(symbols, valueSymbols(fset, importPath, p.Vars)...)
+	symbols = append(symbols, funcSymbols(fset, importPath, "", p.Funcs)...)
+	for _, t := range p.Types {
+		symbols = append(symbols, symbol{t.Name, "type", importPath, typeSynopsis(fset, t)})
+		symbols = append(symbols, valueSymbols(fset, importPath, t.Consts)...)
+		symbols = append(symbols, valueSymbols(fset, importPath, t.Vars)...)
+		symbols = append(symbols, funcSymbols(fset, importPath, t.Name, t.Funcs)...)
+		symbols = append(symbols, funcSymbols(fset, importPath, t.Name, t.Methods)...)
+	}
+	return symbols, parseErr
+}
+
+// goDocSymbols lists the symbols of a package from `go doc -short`, for
+// packages whose files don't parse. Methods aren't part of its output.
+func goDocSymbols(projectPath, importPath string) ([]symbol, error) {
+	output, err := runGoWithRetry([]string{"doc", "-short", importPath}, projectPath, goAttempts)
+	if err != nil {
+		return nil, commandError(err)
+	}
+
+	var symbols []symbol
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		kind := fields[0]
+		switch kind {
+		case "const", "var", "func", "type":
+		default:
+			continue
+		}
+		name := fields[1]
+		if i := strings.IndexAny(name, "([="); i >= 0 {
+			name = name[:i]
+		}
+		if name == "" || !ast.IsExported(name) {
+			continue
+		}
+		symbols = append(symbols, symbol{name, kind, importPath, oneLine(line)})
+	}
+	return symbols, nil
+}
+
+// writeSymbolIndex writes the exported symbols of every package as a TSV of
+// symbol, kind, package and one-line declaration
+func writeSymbolIndex(projectPath, syncPath string, packages []*packageInfo, registry *artifactRegistry, rep *reporter) error {
+	var b strings.Builder
+	b.WriteString("symbol\tkind\tpackage\tsynopsis\n")
+
+	count := 0
+	for _, pkg := range packages {
+		if pkg.Dir == "" || len(pkg.GoFiles)+len(pkg.CgoFiles) == 0 {
+			continue
+		}
+
+		// go doc is only asked when parsing fails, its output has no methods
+		symbols, err := packageSymbols(pkg.Dir, pkg.ImportPath)
+		if err != nil {
+			rep.info("Could not parse %s, falling back to go doc: %v", pkg.ImportPath, err)
+			if docSymbols, docErr := goDocSymbols(projectPath, pkg.ImportPath); docErr == nil {
+				symbols = docSymbols
+			} else if len(symbols) > 0 {
+				rep.warn("listing the symbols of the files of %s that parse: %v", pkg.ImportPath, err)
+			} else {
+				rep.warn("could not list the symbols of %s: %v", pkg.ImportPath, docErr)
+				continue
+			}
+		}
+
+		for _, s := range symbols {
+			b.WriteString(strings.Join([]string{s.name, s.kind, s.pkg, s.synopsis}, "\t"))
+			b.WriteString("\n")
+		}
+		count += len(symbols)
+	}
+
+	name := projectFileName(symbolsFileName)
+	outputPath := filepath.Join(syncPath, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputPath, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	registry.register(&artifact{Name: name, Kind: kindReport})
+
+	rep.info("Indexed %d exported symbols", count)
+
+	return nil
+}
@@ -0,0 +1,89 @@
+// Package queue implements a bounded work queue with retries.
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrClosed is returned by Push once the queue is closed
+var ErrClosed = errors.New("queue: closed")
+
+// Job is a unit of work. Run is retried up to MaxAttempts times, waiting
+// Backoff << attempt between attempts.
+type Job struct {
+	ID          string
+	MaxAttempts int
+	Backoff     time.Duration
+	Run         func(ctx context.Context) error
+}
+
+// Queue runs jobs on a fixed number of workers
+type Queue struct {
+	mu      sync.Mutex
+	jobs    chan *Job
+	closed  bool
+	wg      sync.WaitGroup
+	results map[string]error
+}
+
+// New starts a queue of the given capacity served by n workers
+func New(ctx context.Context, capacity, n int) *Queue {
+	q := &Queue{jobs: make(chan *Job, capacity), results: make(map[string]error)}
+	for i := 0; i < n; i++ {
+		q.wg.Add(1)
+		go q.work(ctx)
+	}
+	return q
+}
+
+// Push adds a job, blocking while the queue is full
+func (q *Queue) Push(j *Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+	q.jobs <- j
+	return nil
+}
+
+// Close stops accepting jobs and waits for the running ones to finish
+func (q *Queue) Close() map[string]error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.jobs)
+	}
+	q.mu.Unlock()
+	q.wg.Wait()
+	return q.results
+}
+
+func (q *Queue) work(ctx context.Context) {
+	defer q.wg.Done()
+	for j := range q.jobs {
+		err := run(ctx, j)
+		q.mu.Lock()
+		q.results[j.ID] = err
+		q.mu.Unlock()
+	}
+}
+
+func run(ctx context.Context, j *Job) error {
+	var err error
+	for attempt := 0; attempt < j.MaxAttempts; attempt++ {
+		if err = j.Run(ctx); err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("job %s: %w (after %d attempts)", j.ID, ctx.Err(), attempt+1)
+		case <-time.After(j.Backoff << uint(attempt)):
+		}
+	}
+	return fmt.Errorf("job %s failed %d times: %v", j.ID, j.MaxAttempts, err)
+}
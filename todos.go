@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// todosFileName is the name of the report of TODO comments
+const todosFileName = "todos.txt"
+
+// defaultTodoMarkers are the words marking open questions in comments
+const defaultTodoMarkers = "TODO,FIXME,HACK,BUG"
+
+// maxBlameFiles caps the files git blame is run on, one call per file, so
+// that huge repositories don't take forever
+const maxBlameFiles = 200
+
+// todo is a comment carrying one of the markers
+type todo struct {
+	file string // path relative to the project
+	line int
+	text string
+
+	// author and age from git blame, empty if unknown
+	author string
+	age    string
+}
+
+// todoPattern matches a marker at the start of a comment and captures the
+// comment from the marker on
+func todoPattern(markers []string) *regexp.Regexp {
+	quoted := make([]string, len(markers))
+	for i, m := range markers {
+		quoted[i] = regexp.QuoteMeta(m)
+	}
+	return regexp.MustCompile(`(?://|/\*|#|^\s*\*)\s*((?:` + strings.Join(quoted, "|") + `)\b.*)`)
+}
+
+// scanTodos reads a file for comments carrying a marker
+func scanTodos(filePath, relPath string, pattern *regexp.Regexp) ([]todo, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var todos []todo
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		if m := pattern.FindStringSubmatch(scanner.Text()); m != nil {
+			text := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(m[1]), "*/"))
+			todos = append(todos, todo{file: relPath, line: lineNum, text: text})
+		}
+	}
+	return todos, scanner.Err()
+}
+
+// todoFiles returns the files of a package to scan: its Go files and the
+// files of its directory with the other source extensions
+func todoFiles(pkg *packageInfo) []string {
+	files := pkg.sourceFiles()
+	entries, err := os.ReadDir(pkg.Dir)
+	if err != nil {
+		return files
+	}
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.Type().IsRegular() && ext != ".go" && sourceExtensions[ext] {
+			files = append(files, filepath.Join(pkg.Dir, entry.Name()))
+		}
+	}
+	return files
+}
+
+// blameTodos fills in the author and age of the todos of a file with a single
+// git blame call. Lines that aren't committed yet are left without an author.
+func blameTodos(projectPath string, todos []todo, now time.Time) error {
+	args := []string{"blame", "--line-porcelain"}
+	byLine := make(map[int]*todo)
+	for i := range todos {
+		args = append(args, "-L", fmt.Sprintf("%d,%d", todos[i].line, todos[i].line))
+		byLine[todos[i].line] = &todos[i]
+	}
+	args = append(args, "--", filepath.FromSlash(todos[0].file))
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = projectPath
+	output, err := cmd.Output()
+	if err != nil {
+		return commandError(err)
+	}
+
+	// Every line starts with a header of the commit and the line numbers,
+	// followed by key-value lines and the tab-indented content
+	var current *todo
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case strings.HasPrefix(line, "\t"):
+			current = nil
+		case current == nil && len(fields) >= 3 && len(fields[0]) == 40:
+			if n, err := strconv.Atoi(fields[2]); err == nil {
+				current = byLine[n]
+			}
+		case current == nil:
+		case strings.HasPrefix(line, "author "):
+			if author := strings.TrimPrefix(line, "author "); author != "Not Committed Yet" {
+				current.author = author
+			}
+		case strings.HasPrefix(line, "author-time ") && current.author != "":
+			if sec, err := strconv.ParseInt(strings.TrimPrefix(line, "author-time "), 10, 64); err == nil {
+				current.age = formatAge(now.Sub(time.Unix(sec, 0)))
+			}
+		}
+	}
+	return nil
+}
+
+// formatAge formats the age of a line in the largest fitting unit
+func formatAge(d time.Duration) string {
+	days := int(d.Hours() / 24)
+	switch {
+	case days < 1:
+		return "today"
+	case days < 60:
+		return fmt.Sprintf("%d days ago", days)
+	case days < 730:
+		return fmt.Sprintf("%d months ago", days/30)
+	default:
+		return fmt.Sprintf("%d years ago", days/365)
+	}
+}
+
+// writeTodos writes the comments of the packages carrying one of the markers,
+// with their author and age from git blame in git repositories
+func writeTodos(projectPath, syncPath, moduleName string, packages []*packageInfo, markers []string, isGitRepo bool, registry *artifactRegistry, rep *reporter) error {
+	pattern := todoPattern(markers)
+	now := time.Now()
+
+	var b strings.Builder
+	b.WriteString("TODO comments\n")
+	b.WriteString("=============\n")
+
+	count, blamed := 0, 0
+	for _, pkg := range packages {
+		var pkgTodos []todo
+		for _, filePath := range todoFiles(pkg) {
+			relPath, err := filepath.Rel(projectPath, filePath)
+			if err != nil {
+				relPath = filePath
+			}
+			relPath = filepath.ToSlash(relPath)
+
+			todos, err := scanTodos(filePath, relPath, pattern)
+			if err != nil {
+				rep.warn("could not scan %s for TODO comments: %v", relPath, err)
+				continue
+			}
+			if len(todos) == 0 {
+				continue
+			}
+
+			if isGitRepo && blamed < maxBlameFiles {
+				blamed++
+				if err := blameTodos(projectPath, todos, now); err != nil {
+					rep.info("Could not blame %s: %v", relPath, err)
+				}
+			} else if isGitRepo && blamed == maxBlameFiles {
+				blamed++
+				rep.info("Blamed %d files, listing the remaining TODO comments without author", maxBlameFiles)
+			}
+			pkgTodos = append(pkgTodos, todos...)
+		}
+		if len(pkgTodos) == 0 {
+			continue
+		}
+
+		sort.SliceStable(pkgTodos, func(i, j int) bool {
+			return pkgTodos[i].file < pkgTodos[j].file
+		})
+		fmt.Fprintf(&b, "\n%s\n", relativePackagePath(moduleName, pkg.ImportPath))
+		for _, t := range pkgTodos {
+			fmt.Fprintf(&b, "  %s:%d: %s", t.file, t.line, t.text)
+			if t.author != "" {
+				fmt.Fprintf(&b, " (%s, %s)", t.author, t.age)
+			}
+			b.WriteString("\n")
+		}
+		count += len(pkgTodos)
+	}
+
+	if count == 0 {
+		b.WriteString("\n(none)\n")
+	}
+
+	name := projectFileName(todosFileName)
+	outputPath := filepath.Join(syncPath, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputPath, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	registry.register(&artifact{Name: name, Kind: kindReport})
+
+	rep.info("Listed %d TODO comments", count)
+
+	return nil
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	_ "embed"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+)
+
+// bytesPerToken is the average number of bytes per token of source code and
+// English prose for the tokenizers of current models. Code with long
+// identifiers runs a little higher and dense symbols a little lower, so
+// estimates are good for budgeting, not for exact limits.
+const bytesPerToken = 4
+
+// estimateTokens estimates the number of tokens of a text of the given size
+// in bytes, rounding up so that non-empty files count at least one token
+func estimateTokens(size int64) int {
+	if size <= 0 {
+		return 0
+	}
+	return int((size + bytesPerToken - 1) / bytesPerToken)
+}
+
+// Tokenizer names accepted by -tokenizer
+const (
+	tokenizerHeuristic = "heuristic"
+	tokenizerCL100k    = "cl100k"
+)
+
+// tokenizer counts the tokens of a text read as a stream
+type tokenizer interface {
+	name() string
+	countTokens(r io.Reader) (int, error)
+}
+
+// cl100kVocab is the cl100k_base.tiktoken vocabulary, gzipped
+//
+//go:embed cl100k_base.tiktoken.gz
+var cl100kVocab []byte
+
+// newTokenizer creates the tokenizer of the given name. The cl100k tokenizer
+// loads its vocabulary, in the .tiktoken format, from vocabPath, or from the
+// copy built into the binary if vocabPath is empty.
+func newTokenizer(name, vocabPath string) (tokenizer, error) {
+	switch name {
+	case tokenizerHeuristic:
+		return heuristicTokenizer{}, nil
+	case tokenizerCL100k:
+		var ranks map[string]int
+		var err error
+		if vocabPath == "" {
+			ranks, err = cl100kRanks()
+		} else {
+			ranks, err = loadBPERanks(vocabPath)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not load the cl100k vocabulary: %v", err)
+		}
+		return &bpeTokenizer{ranks: ranks}, nil
+	default:
+		return nil, fmt.Errorf("unknown tokenizer %q (expected %s or %s)", name, tokenizerHeuristic, tokenizerCL100k)
+	}
+}
+
+// countFileTokens counts the tokens of the file at path with tok, following
+// symlinks
+func countFileTokens(tok tokenizer, path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return tok.countTokens(f)
+}
+
+// countTextTokens counts the tokens of a text in memory with tok
+func countTextTokens(tok tokenizer, text []byte) int {
+	n, _ := tok.countTokens(bytes.NewReader(text))
+	return n
+}
+
+// heuristicTokenizer estimates tokens from the size of the text, see estimateTokens
+type heuristicTokenizer struct{}
+
+func (heuristicTokenizer) name() string { return tokenizerHeuristic }
+
+func (heuristicTokenizer) countTokens(r io.Reader) (int, error) {
+	n, err := io.Copy(io.Discard, r)
+	return estimateTokens(n), err
+}
+
+// bpeTokenizer counts the tokens of the cl100k_base byte pair encoding: the
+// text is split into pieces as by the cl100k pattern, then each piece is
+// merged from single bytes following the ranks of the vocabulary
+type bpeTokenizer struct {
+	ranks map[string]int
+}
+
+func (*bpeTokenizer) name() string { return tokenizerCL100k }
+
+// bpeChunkSize is the size of the chunks the text is streamed in. Chunks end
+// at a line break so that the pieces, which don't span lines, stay whole.
+const bpeChunkSize = 64 * 1024
+
+func (t *bpeTokenizer) countTokens(r io.Reader) (int, error) {
+	reader := bufio.NewReaderSize(r, bpeChunkSize)
+	var pending []byte
+	count := 0
+	for {
+		line, err := reader.ReadSlice('\n')
+		pending = append(pending, line...)
+		if len(pending) >= bpeChunkSize || err != nil && err != bufio.ErrBufferFull {
+			count += t.countChunk(pending)
+			pending = pending[:0]
+		}
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil && err != bufio.ErrBufferFull {
+			return count, err
+		}
+	}
+}
+
+// countChunk counts the tokens of a chunk of text
+func (t *bpeTokenizer) countChunk(text []byte) int {
+	count := 0
+	for len(text) > 0 {
+		n := nextPiece(text)
+		count += t.countPiece(text[:n])
+		text = text[n:]
+	}
+	return count
+}
+
+// countPiece counts the tokens a piece is encoded in, merging the adjacent
+// parts of lowest rank until no pair is in the vocabulary
+func (t *bpeTokenizer) countPiece(piece []byte) int {
+	if _, ok := t.ranks[string(piece)]; ok {
+		return 1
+	}
+
+	// bounds are the start offsets of the parts, followed by the end
+	bounds := make([]int, len(piece)+1)
+	for i := range bounds {
+		bounds[i] = i
+	}
+	for len(bounds) > 2 {
+		best, bestRank := -1, 0
+		for i := 0; i+2 < len(bounds); i++ {
+			if rank, ok := t.ranks[string(piece[bounds[i]:bounds[i+2]])]; ok && (best < 0 || rank < bestRank) {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		bounds = append(bounds[:best+1], bounds[best+2:]...)
+	}
+	return len(bounds) - 1
+}
+
+// nextPiece returns the length of the piece at the start of the text, split
+// like the cl100k pattern:
+//
+//	'(?i:[sdmt]|ll|ve|re)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+
+func nextPiece(text []byte) int {
+	r, size := utf8.DecodeRune(text)
+
+	// Contractions
+	if r == '\'' {
+		for _, suffix := range []string{"s", "t", "re", "ve", "m", "ll", "d"} {
+			if n := 1 + len(suffix); len(text) >= n && bytes.EqualFold(text[1:n], []byte(suffix)) {
+				return n
+			}
+		}
+	}
+
+	// Words, with a leading character other than a letter, digit or line break
+	if unicode.IsLetter(r) {
+		return size + runLength(text[size:], unicode.IsLetter, -1)
+	}
+	if r != '\r' && r != '\n' && !unicode.IsNumber(r) {
+		if n := runLength(text[size:], unicode.IsLetter, -1); n > 0 {
+			return size + n
+		}
+	}
+
+	// Numbers, up to three digits
+	if unicode.IsNumber(r) {
+		return runLength(text, unicode.IsNumber, 3)
+	}
+
+	// Punctuation, with a leading space and trailing line breaks
+	start := 0
+	if r == ' ' {
+		start = 1
+	}
+	if n := runLength(text[start:], isPunctuation, -1); n > 0 {
+		end := start + n
+		return end + runLength(text[end:], isLineBreak, -1)
+	}
+
+	// Whitespace: up to the last line break of the run, or else the run but
+	// for the last character when a non-space character follows
+	n := runLength(text, unicode.IsSpace, -1)
+	if n == 0 {
+		return size
+	}
+	if i := bytes.LastIndexAny(text[:n], "\r\n"); i >= 0 {
+		return i + 1
+	}
+	if n == len(text) {
+		return n
+	}
+	if _, last := utf8.DecodeLastRune(text[:n]); n > last {
+		return n - last
+	}
+	return n
+}
+
+// isPunctuation reports whether r is neither a space, a letter nor a digit
+func isPunctuation(r rune) bool {
+	return !unicode.IsSpace(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+// isLineBreak reports whether r is a line break
+func isLineBreak(r rune) bool {
+	return r == '\r' || r == '\n'
+}
+
+// runLength returns the length in bytes of the run of runes at the start of
+// the text satisfying f, of at most max runes unless max is negative
+func runLength(text []byte, f func(rune) bool, max int) int {
+	n := 0
+	for count := 0; n < len(text) && count != max; count++ {
+		r, size := utf8.DecodeRune(text[n:])
+		if !f(r) {
+			break
+		}
+		n += size
+	}
+	return n
+}
+
+// cl100kRanks returns the ranks of the built-in cl100k vocabulary
+func cl100kRanks() (map[string]int, error) {
+	r, err := gzip.NewReader(bytes.NewReader(cl100kVocab))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return readBPERanks(r, "cl100k_base.tiktoken")
+}
+
+// loadBPERanks reads the vocabulary file at path, see readBPERanks
+func loadBPERanks(path string) (map[string]int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readBPERanks(f, path)
+}
+
+// readBPERanks reads a vocabulary in the .tiktoken format: one base64 token
+// and its rank per line. name is the name of the vocabulary in errors.
+func readBPERanks(r io.Reader, name string) (map[string]int, error) {
+	ranks := make(map[string]int)
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		fields := bytes.Fields(scanner.Bytes())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected a token and a rank", name, lineNo)
+		}
+		token, err := base64.StdEncoding.DecodeString(string(fields[0]))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", name, lineNo, err)
+		}
+		rank, err := strconv.Atoi(string(fields[1]))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", name, lineNo, err)
+		}
+		ranks[string(token)] = rank
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ranks) == 0 {
+		return nil, fmt.Errorf("%s has no tokens", name)
+	}
+	return ranks, nil
+}
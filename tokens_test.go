@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+var (
+	cl100kOnce      sync.Once
+	cl100kTokenizer *bpeTokenizer
+)
+
+// testCL100k returns the cl100k tokenizer of the built-in vocabulary, loaded
+// once for all the tests and benchmarks
+func testCL100k(tb testing.TB) *bpeTokenizer {
+	cl100kOnce.Do(func() {
+		ranks, err := cl100kRanks()
+		if err != nil {
+			tb.Fatal(err)
+		}
+		cl100kTokenizer = &bpeTokenizer{ranks: ranks}
+	})
+	if cl100kTokenizer == nil {
+		tb.Fatal("the cl100k vocabulary failed to load")
+	}
+	return cl100kTokenizer
+}
+
+// The counts are those of tiktoken's cl100k_base encoding
+func TestCL100kTokenizer(t *testing.T) {
+	tok := testCL100k(t)
+	if n := len(tok.ranks); n != 100256 {
+		t.Errorf("built-in vocabulary has %d tokens, want 100256", n)
+	}
+
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"tiktoken is great!", 6},
+		{"Hello, world!", 4},
+		{"hello world!你好，世界！", 10},
+		{"it's 12345 o'clock", 7},
+		{"DON'T shout", 3},
+		{"  indented\n\n\n  x", 6},
+		{"a  \t b\r\n\r\nc", 5},
+		{"func main() {\n\treturn nil\n}\n", 8},
+	}
+	for _, tt := range tests {
+		if got := countTextTokens(tok, []byte(tt.text)); got != tt.want {
+			t.Errorf("%q: %d tokens, want %d", tt.text, got, tt.want)
+		}
+	}
+
+	for name, want := range map[string]int{"source.go": 545, "notes.md": 173} {
+		data, err := os.ReadFile(filepath.Join("testdata", "tokens", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := countTextTokens(tok, data); got != want {
+			t.Errorf("%s: %d tokens, want %d", name, got, want)
+		}
+	}
+}
+
+// A vocabulary file given with -tokenizer-vocab replaces the built-in one
+func TestNewTokenizerVocabFile(t *testing.T) {
+	root := writeFixture(t, map[string]string{
+		"tiny.tiktoken": "YQ== 0\nYg== 1\nYWI= 2\n",
+		"bad.tiktoken":  "YQ==\n",
+	})
+	tok, err := newTokenizer(tokenizerCL100k, filepath.Join(root, "tiny.tiktoken"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// "abab" is a single piece, merged into ab ab
+	if n := countTextTokens(tok, []byte("abab")); n != 2 {
+		t.Errorf("abab: %d tokens, want 2", n)
+	}
+	if _, err := newTokenizer(tokenizerCL100k, filepath.Join(root, "bad.tiktoken")); err == nil {
+		t.Error("malformed vocabulary accepted")
+	}
+	if _, err := newTokenizer(tokenizerCL100k, filepath.Join(root, "missing.tiktoken")); err == nil {
+		t.Error("missing vocabulary accepted")
+	}
+}
+
+// benchmarkText is the fixture corpus, Go source and Markdown prose
+func benchmarkText(b *testing.B) []byte {
+	var text []byte
+	for _, name := range []string{"source.go", "notes.md"} {
+		data, err := os.ReadFile(filepath.Join("testdata", "tokens", name))
+		if err != nil {
+			b.Fatal(err)
+		}
+		text = append(text, data...)
+	}
+	return text
+}
+
+func benchmarkTokenizer(b *testing.B, tok tokenizer) {
+	text := benchmarkText(b)
+	b.SetBytes(int64(len(text)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := tok.countTokens(bytes.NewReader(text)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBPETokenizer(b *testing.B) {
+	benchmarkTokenizer(b, testCL100k(b))
+}
+
+func BenchmarkHeuristicTokenizer(b *testing.B) {
+	benchmarkTokenizer(b, heuristicTokenizer{})
+}
+
+// BenchmarkLoadCL100k is the cost of -tokenizer=cl100k at startup
+func BenchmarkLoadCL100k(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		if _, err := cl100kRanks(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
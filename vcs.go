@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// vcsInfoFileName is the name of the provenance summary
+const vcsInfoFileName = "vcs_info.txt"
+
+// vcsInfo is the git provenance of a project
+type vcsInfo struct {
+	commit string
+	branch string // empty on a detached HEAD
+	dirty  bool
+	remote string // URL of origin, empty if there is none
+}
+
+// gitOutput runs a git command in dir and returns its trimmed output
+func gitOutput(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		return "", commandError(err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// readVCSInfo gathers the commit, branch, dirty state and origin URL of the
+// repository at projectPath
+func readVCSInfo(projectPath string) (*vcsInfo, error) {
+	commit, err := gitOutput(projectPath, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+
+	info := &vcsInfo{commit: commit}
+	if branch, err := gitOutput(projectPath, "rev-parse", "--abbrev-ref", "HEAD"); err == nil && branch != "HEAD" {
+		info.branch = branch
+	}
+	if status, err := gitOutput(projectPath, "status", "--porcelain"); err == nil {
+		info.dirty = status != ""
+	}
+	if remote, err := gitOutput(projectPath, "remote", "get-url", "origin"); err == nil {
+		info.remote = redactRemote(remote)
+	}
+
+	return info, nil
+}
+
+// redactRemote removes credentials from a remote URL, which would otherwise
+// end up in the context
+func redactRemote(remote string) string {
+	u, err := url.Parse(remote)
+	if err != nil || u.User == nil || u.Scheme == "" {
+		return remote
+	}
+	u.User = nil
+	return u.String()
+}
+
+// writeVCSInfo writes the provenance of the project, skipping projects that
+// aren't git repositories
+func writeVCSInfo(projectPath, syncPath string, registry *artifactRegistry, rep *reporter) error {
+	if !isGitRepository(projectPath) {
+		rep.info("Skipping %s: %s is not a git repository", vcsInfoFileName, projectPath)
+		return nil
+	}
+	if snapshotGit(projectPath).empty {
+		rep.info("Skipping %s: %s has no commits yet", vcsInfoFileName, projectPath)
+		return nil
+	}
+
+	info, err := readVCSInfo(projectPath)
+	if err != nil {
+		return err
+	}
+
+	branch := info.branch
+	if branch == "" {
+		branch = "(detached HEAD)"
+	}
+	remote := info.remote
+	if remote == "" {
+		remote = "(none)"
+	}
+
+	var b strings.Builder
+	b.WriteString("Version control\n")
+	b.WriteString("===============\n\n")
+	fmt.Fprintf(&b, "Commit: %s\n", info.commit)
+	fmt.Fprintf(&b, "Branch: %s\n", branch)
+	fmt.Fprintf(&b, "Dirty:  %t\n", info.dirty)
+	fmt.Fprintf(&b, "Remote: %s\n", remote)
+
+	name := projectFileName(vcsInfoFileName)
+	outputPath := filepath.Join(syncPath, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputPath, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+
+	return registry.register(&artifact{Name: name, Kind: kindReport})
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Categories of problems found by the verify command
+const (
+	problemBroken     = "Broken symlinks"
+	problemOutside    = "Symlinks pointing outside the project"
+	problemMissing    = "Artifacts missing from the sync directory"
+	problemUnexpected = "Files not recorded in the manifest"
+	problemEmptyDoc   = "Empty documentation files"
+	problemBadName    = "Documentation files not matching the naming scheme"
+	problemStale      = "Stale documentation"
+	problemManifest   = "Manifest problems"
+)
+
+// orderedNumber matches the number -ordered-names puts after the prefix of doc file names
+var orderedNumber = regexp.MustCompile(`^((?:doc|synopsis)_)\d+_`)
+
+// verifyReport collects the problems found in a sync directory by category
+type verifyReport struct {
+	problems map[string][]string
+	fixed    []string
+}
+
+func (r *verifyReport) add(category, format string, args ...interface{}) {
+	if r.problems == nil {
+		r.problems = make(map[string][]string)
+	}
+	r.problems[category] = append(r.problems[category], fmt.Sprintf(format, args...))
+}
+
+func (r *verifyReport) count() int {
+	n := 0
+	for _, problems := range r.problems {
+		n += len(problems)
+	}
+	return n
+}
+
+func (r *verifyReport) print() {
+	categories := []string{problemManifest, problemBroken, problemOutside, problemMissing, problemUnexpected, problemEmptyDoc, problemBadName, problemStale}
+	for _, category := range categories {
+		problems := r.problems[category]
+		if len(problems) == 0 {
+			continue
+		}
+		fmt.Printf("%s (%d):\n", category, len(problems))
+		for _, problem := range problems {
+			fmt.Printf("  %s\n", problem)
+		}
+	}
+
+	if len(r.fixed) > 0 {
+		fmt.Printf("Fixed (%d):\n", len(r.fixed))
+		for _, fix := range r.fixed {
+			fmt.Printf("  %s\n", fix)
+		}
+	}
+}
+
+// runVerifyCommand audits a sync directory and exits non-zero if anything is broken
+func runVerifyCommand(args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	projectPath := fs.String("project", "", "Path to the Go project (default: current directory)")
+	outputPath := fs.String("output", "", "Path of the sync directory (default: ~/.gocontext/<module-name>)")
+	fix := fs.Bool("fix", false, "Re-link or prune broken artifacts where it is safe to do so")
+	fs.Parse(args)
+
+	absProjectPath, err := resolveProject(*projectPath)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	moduleName, _ := resolveModuleName(absProjectPath)
+
+	if *outputPath == "" {
+		if *outputPath, err = defaultOutputPath(moduleName, absProjectPath); err != nil {
+			fmt.Printf("Error determining the default output path: %v\n", err)
+			return 1
+		}
+	}
+	absOutputPath, err := filepath.Abs(*outputPath)
+	if err != nil {
+		fmt.Printf("Error resolving output path: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Verifying %s against %s\n", absOutputPath, absProjectPath)
+
+	report := verifyOutput(absProjectPath, absOutputPath, moduleName, *fix)
+	report.print()
+
+	if n := report.count(); n > 0 {
+		fmt.Printf("Found %d problem(s)\n", n)
+		return 1
+	}
+
+	fmt.Println("Sync directory is healthy")
+	return 0
+}
+
+// verifyOutput checks every artifact of a sync directory. With fix, broken
+// links are re-linked to their source (rebased onto the current project path
+// if the project moved) or pruned when the source no longer exists.
+func verifyOutput(projectPath, outputPath, moduleName string, fix bool) *verifyReport {
+	report := &verifyReport{}
+
+	m, err := readManifest(outputPath)
+	if err != nil && !os.IsNotExist(err) {
+		report.add(problemManifest, "cannot read %s: %v", manifestFileName, err)
+	}
+
+	// Name checks and re-linking depend on the layout the directory was created with
+	red, _ := newRedactor(nil)
+	if m != nil {
+		if m.Grouping != "" {
+			grouping = m.Grouping
+		}
+		copyMode = m.Copy
+		if cfg, err := loadConfig(projectPath); err == nil && len(cfg.RedactKeys) > 0 {
+			if r, err := newRedactor(cfg.RedactKeys); err == nil {
+				red = r
+			}
+		}
+		if m.DocFormat != "" {
+			docFormat = m.DocFormat
+		}
+		docExtension = m.DocExt
+		for kind, prefix := range m.NamePrefixes {
+			kindPrefixes[kind] = prefix
+		}
+	}
+
+	recorded := make(map[string]*artifact)
+	if m != nil {
+		if len(m.Projects) == 0 && m.Module != moduleName {
+			report.add(problemManifest, "manifest module %s doesn't match project module %s", m.Module, moduleName)
+		}
+		for _, a := range m.Artifacts {
+			recorded[a.Name] = a
+		}
+	}
+
+	// Check what is on disk
+	onDisk := make(map[string]bool)
+	filepath.Walk(outputPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == outputPath {
+			return nil
+		}
+		if info.IsDir() {
+			if info.Name() == stateDirName {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		name, err := filepath.Rel(outputPath, path)
+		if err != nil {
+			return nil
+		}
+		name = filepath.ToSlash(name)
+		if name == manifestFileName {
+			return nil
+		}
+		onDisk[name] = true
+
+		if m != nil && recorded[name] == nil {
+			report.add(problemUnexpected, "%s", name)
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			verifySymlink(report, projectPath, path, name, recorded[name], m, fix)
+		}
+		return nil
+	})
+
+	if m == nil {
+		return report
+	}
+
+	isGitRepo := isGitRepository(projectPath)
+	docs = loadDocCache(outputPath)
+	var names []string
+	for name := range recorded {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		a := recorded[name]
+		artifactPath := filepath.Join(outputPath, filepath.FromSlash(name))
+
+		if !onDisk[name] {
+			if fix && a.Source != "" {
+				if source, ok := fixedSource(a, m, projectPath); ok {
+					link := func(source, dest string) error {
+						return linkFile(source, dest, nil)
+					}
+					if a.Kind == kindConfig {
+						link = func(source, dest string) error {
+							return linkConfigFile(source, dest, red)
+						}
+					}
+					if err := link(source, artifactPath); err == nil {
+						a.Source = source
+						report.fixed = append(report.fixed, fmt.Sprintf("re-linked %s -> %s", name, source))
+						continue
+					}
+				}
+			}
+			report.add(problemMissing, "%s", name)
+			continue
+		}
+
+		if a.Kind != kindDoc && a.Kind != kindSynopsis {
+			continue
+		}
+
+		if info, err := os.Stat(artifactPath); err == nil && info.Size() == 0 {
+			report.add(problemEmptyDoc, "%s", name)
+		}
+		// Artifacts of merged projects are checked against their own project
+		artifactProject, artifactModule := projectPath, moduleName
+		if len(m.Projects) > 0 {
+			artifactProject, artifactModule = m.projectFor(a.Project)
+		}
+
+		// Numbers given by -ordered-names depend on the import graph, only the rest is checked
+		checkedName := name
+		if m.OrderedNames {
+			checkedName = path.Join(path.Dir(name), orderedNumber.ReplaceAllString(path.Base(name), "$1"))
+		}
+
+		if expected := path.Join(a.Project, docFileName(artifactModule, a.Package, a.Kind)); a.Package != "" && expected != checkedName {
+			report.add(problemBadName, "%s (expected %s)", name, expected)
+		}
+		if a.Package != "" {
+			if stale, err := needsDocUpdate(a.Package, artifactPath, artifactProject, isGitRepo && artifactProject == projectPath, a.Unexported); err == nil && stale {
+				report.add(problemStale, "%s", name)
+			}
+		}
+	}
+
+	// Drop pruned artifacts and record re-linked sources
+	if fix && len(report.fixed) > 0 {
+		var kept []*artifact
+		for _, a := range m.Artifacts {
+			if _, err := os.Lstat(filepath.Join(outputPath, filepath.FromSlash(a.Name))); err == nil {
+				kept = append(kept, a)
+			}
+		}
+		m.Artifacts = kept
+		if len(m.Projects) == 0 {
+			m.Project = projectPath
+		}
+		if err := saveManifest(outputPath, m); err != nil {
+			report.add(problemManifest, "cannot rewrite %s: %v", manifestFileName, err)
+		}
+	}
+
+	return report
+}
+
+// verifySymlink checks that a symlink resolves to a file inside the project
+func verifySymlink(report *verifyReport, projectPath, path, name string, a *artifact, m *manifest, fix bool) {
+	target, err := os.Readlink(path)
+	if err != nil {
+		report.add(problemBroken, "%s: %v", name, err)
+		return
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		if fix {
+			if a != nil {
+				if source, ok := fixedSource(a, m, projectPath); ok {
+					if err := os.Remove(path); err == nil {
+						if err := linkFile(source, path, nil); err == nil {
+							a.Source = source
+							report.fixed = append(report.fixed, fmt.Sprintf("re-linked %s -> %s", name, source))
+							return
+						}
+					}
+				}
+			}
+			if err := os.Remove(path); err == nil {
+				report.fixed = append(report.fixed, fmt.Sprintf("pruned %s (source %s no longer exists)", name, target))
+				return
+			}
+		}
+		report.add(problemBroken, "%s -> %s", name, target)
+		return
+	}
+
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(path), target)
+	}
+	projectPaths := []string{projectPath}
+	if m != nil {
+		for _, p := range m.Projects {
+			projectPaths = append(projectPaths, p.Path)
+		}
+	}
+	for _, p := range projectPaths {
+		if target == p || strings.HasPrefix(target, p+string(os.PathSeparator)) {
+			return
+		}
+	}
+	report.add(problemOutside, "%s -> %s", name, target)
+}
+
+// fixedSource returns where the source of an artifact lives now, rebasing it
+// onto the current project path if the project was moved since the sync
+func fixedSource(a *artifact, m *manifest, projectPath string) (string, bool) {
+	candidates := []string{a.Source}
+	if m != nil && m.Project != "" && m.Project != projectPath {
+		if rel, err := filepath.Rel(m.Project, a.Source); err == nil && !strings.HasPrefix(rel, "..") {
+			candidates = append([]string{filepath.Join(projectPath, rel)}, candidates...)
+		}
+	}
+
+	for _, candidate := range candidates {
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of version control, as recorded in the manifest
+const (
+	vcsGit       = "git"
+	vcsMercurial = "hg"
+)
+
+// versionControl is what the sync asks of the version control system of a
+// project: which files it ignores, which directories have uncommitted
+// changes and when the files of a directory were last committed
+type versionControl interface {
+	kind() string
+
+	// isIgnored reports whether the file at path is ignored
+	isIgnored(path string) (bool, error)
+
+	// hasChanges reports whether a file in dir has uncommitted changes or
+	// isn't tracked. Git counts the files of its subdirectories as well.
+	hasChanges(dir string) bool
+
+	// lastModified returns the time of the last commit touching a file
+	// directly in dir, and whether there is one
+	lastModified(dir string) (time.Time, bool)
+}
+
+// projectVCSs are the version control systems of the projects, detected
+// once by project path, nil for a project under none
+var (
+	projectVCSsMu sync.Mutex
+	projectVCSs   = make(map[string]versionControl)
+)
+
+// projectVCS returns the version control system of the project at
+// projectPath: git, then Mercurial, or nil for a project under neither
+func projectVCS(projectPath string) versionControl {
+	projectVCSsMu.Lock()
+	defer projectVCSsMu.Unlock()
+	if vc, ok := projectVCSs[projectPath]; ok {
+		return vc
+	}
+
+	var vc versionControl
+	if isGitRepository(projectPath) {
+		vc = &gitRepo{projectPath: projectPath}
+	} else if root, err := runHg(projectPath, "root"); err == nil {
+		vc = &hgRepo{root: strings.TrimSpace(string(root))}
+	}
+	projectVCSs[projectPath] = vc
+	return vc
+}
+
+// vcsContaining returns the version control system of the detected project
+// containing path, the innermost one, or nil
+func vcsContaining(path string) versionControl {
+	projectVCSsMu.Lock()
+	defer projectVCSsMu.Unlock()
+
+	var vc versionControl
+	best := -1
+	for projectPath, candidate := range projectVCSs {
+		if candidate != nil && len(projectPath) > best && withinAny(path, []string{projectPath}) {
+			vc, best = candidate, len(projectPath)
+		}
+	}
+	return vc
+}
+
+// vcsKind returns the kind of version control of a project, empty for none
+func vcsKind(projectPath string) string {
+	if vc := projectVCS(projectPath); vc != nil {
+		return vc.kind()
+	}
+	return ""
+}
+
+// directFiles returns the names of the files directly in dir
+func directFiles(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names
+}
+
+// parseUnixTime parses the seconds since the epoch printed by a log command
+func parseUnixTime(output string) (time.Time, bool) {
+	seconds, err := strconv.ParseInt(strings.TrimSpace(output), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(seconds, 0), true
+}
+
+// gitRepo is the git repository of a project, answered from its snapshot
+// and git check-ignore
+type gitRepo struct {
+	projectPath string
+}
+
+func (g *gitRepo) kind() string {
+	return vcsGit
+}
+
+func (g *gitRepo) isIgnored(path string) (bool, error) {
+	return isIgnoredByGit(path, g.projectPath)
+}
+
+func (g *gitRepo) hasChanges(dir string) bool {
+	repoPath := gitRootFor(dir, g.projectPath)
+	relDir, err := filepath.Rel(repoPath, dir)
+	if err != nil {
+		return true
+	}
+	s := snapshotGit(repoPath)
+	return s.hasChanges(s.repoPath(relDir))
+}
+
+func (g *gitRepo) lastModified(dir string) (time.Time, bool) {
+	files := directFiles(dir)
+	if len(files) == 0 {
+		return time.Time{}, false
+	}
+	output, err := gitOutput(dir, append([]string{"log", "-1", "--format=%ct", "--"}, files...)...)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return parseUnixTime(output)
+}
+
+// runHg runs a Mercurial command in dir and returns its raw output
+var runHg = func(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("hg", args...)
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, commandError(err)
+	}
+	return output, nil
+}
+
+// hgRepo is the Mercurial repository of a project. Its status is taken
+// once, with the ignored files, the first time it's asked for.
+type hgRepo struct {
+	root string
+
+	once    sync.Once
+	ignored map[string]bool
+	changed []string // absolute paths of the files with uncommitted changes
+	err     error
+}
+
+func (h *hgRepo) kind() string {
+	return vcsMercurial
+}
+
+// status takes the status of the repository, entries being a status code,
+// a space and a path relative to the root
+func (h *hgRepo) status() error {
+	h.once.Do(func() {
+		output, err := runHg(h.root, "status", "--modified", "--added", "--removed", "--deleted", "--unknown", "--ignored", "--print0")
+		if err != nil {
+			h.err = err
+			return
+		}
+		h.ignored = make(map[string]bool)
+		for _, entry := range strings.Split(string(output), "\x00") {
+			if len(entry) < 3 {
+				continue
+			}
+			path := filepath.Join(h.root, filepath.FromSlash(entry[2:]))
+			if entry[0] == 'I' {
+				h.ignored[path] = true
+			} else {
+				h.changed = append(h.changed, path)
+			}
+		}
+	})
+	return h.err
+}
+
+func (h *hgRepo) isIgnored(path string) (bool, error) {
+	if err := h.status(); err != nil {
+		return false, err
+	}
+	return h.ignored[path], nil
+}
+
+func (h *hgRepo) hasChanges(dir string) bool {
+	if h.status() != nil {
+		return true
+	}
+	for _, path := range h.changed {
+		if filepath.Dir(path) == dir {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *hgRepo) lastModified(dir string) (time.Time, bool) {
+	files := directFiles(dir)
+	if len(files) == 0 {
+		return time.Time{}, false
+	}
+	output, err := runHg(dir, append([]string{"log", "-l1", "--template", `{date(date, "%s")}`, "--"}, files...)...)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return parseUnixTime(string(output))
+}
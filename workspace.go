@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// goWorkFileName is the name of the file declaring a Go workspace
+const goWorkFileName = "go.work"
+
+// parseGoWork returns the absolute directories of the modules listed by the
+// use directives of a go.work file, in order, in both their single-line and
+// block forms
+func parseGoWork(workPath string) ([]string, error) {
+	f, err := os.Open(workPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var dirs []string
+	seen := make(map[string]bool)
+	addDir := func(field string, lineNum int) error {
+		dir := field
+		if strings.HasPrefix(field, `"`) || strings.HasPrefix(field, "`") {
+			unquoted, err := strconv.Unquote(field)
+			if err != nil {
+				return fmt.Errorf("%s:%d: invalid path %s", workPath, lineNum, field)
+			}
+			dir = unquoted
+		}
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(filepath.Dir(workPath), filepath.FromSlash(dir))
+		}
+		dir = filepath.Clean(dir)
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+		return nil
+	}
+
+	inUse := false
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		if idx := strings.Index(line, "//"); idx >= 0 {
+			line = line[:idx]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch {
+		case inUse && fields[0] == ")":
+			inUse = false
+		case inUse:
+			if err := addDir(fields[0], lineNum); err != nil {
+				return nil, err
+			}
+		case fields[0] == "use" && len(fields) > 1 && fields[1] == "(":
+			inUse = true
+		case fields[0] == "use" && len(fields) > 1:
+			if err := addDir(fields[1], lineNum); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return dirs, nil
+}
+
+// findGoWork returns the go.work file of the workspace at projectPath: the
+// one at its root, or with force the one the go command would use, possibly
+// in a parent directory. It returns "" when the project isn't a workspace.
+func findGoWork(projectPath string, force bool) (string, error) {
+	workPath := filepath.Join(projectPath, goWorkFileName)
+	if _, err := os.Stat(workPath); err == nil {
+		return workPath, nil
+	}
+	if !force {
+		return "", nil
+	}
+
+	output, err := runGoWithRetry([]string{"env", "GOWORK"}, projectPath, goAttempts)
+	if err != nil {
+		return "", fmt.Errorf("could not find the workspace of %s: %v", projectPath, commandError(err))
+	}
+	workPath = strings.TrimSpace(string(output))
+	if workPath == "" || workPath == "off" {
+		return "", fmt.Errorf("-workspace given but no %s found for %s", goWorkFileName, projectPath)
+	}
+	return workPath, nil
+}
+
+// workspaceMembers returns the directory of the workspace at projectPath and
+// the directories of its modules, or nil if it isn't one. Modules without a
+// go.mod, e.g. missing directories, are skipped with a warning.
+func workspaceMembers(projectPath string, force bool, rep *reporter) (string, []string, error) {
+	workPath, err := findGoWork(projectPath, force)
+	if err != nil || workPath == "" {
+		return "", nil, err
+	}
+
+	dirs, err := parseGoWork(workPath)
+	if err != nil {
+		return "", nil, fmt.Errorf("could not read %s: %v", workPath, err)
+	}
+
+	workDir := filepath.Dir(workPath)
+	var members, relDirs []string
+	for _, dir := range dirs {
+		relDir, err := filepath.Rel(workDir, dir)
+		if err != nil {
+			relDir = dir
+		}
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err != nil {
+			rep.warn("skipping workspace module %s: no go.mod", relDir)
+			continue
+		}
+		members = append(members, dir)
+		relDirs = append(relDirs, relDir)
+	}
+	if len(members) == 0 {
+		return "", nil, fmt.Errorf("%s uses no modules", workPath)
+	}
+
+	rep.info("Found workspace %s with %d modules:", workPath, len(members))
+	for _, relDir := range relDirs {
+		rep.info("  %s", relDir)
+	}
+
+	return workDir, members, nil
+}
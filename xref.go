@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// xrefFileName is the name of the cross-reference report
+const xrefFileName = "xref.txt"
+
+// xrefSymbol is an exported type or function of a module package and the
+// other packages of the module referencing it
+type xrefSymbol struct {
+	kind, name string
+	refs       map[string]int // references by referencing package
+}
+
+// xrefKind returns the kind of a package-level object listed in the report:
+// "type" or "func", "" for anything else
+func xrefKind(obj types.Object) string {
+	switch obj := obj.(type) {
+	case *types.TypeName:
+		return "type"
+	case *types.Func:
+		if sig, ok := obj.Type().(*types.Signature); ok && sig.Recv() == nil {
+			return "func"
+		}
+	}
+	return ""
+}
+
+// writeXref writes the cross-reference report of the exported types and
+// functions of the packages, listing for each the other packages of the
+// module referencing it with the number of references. With scope, only the
+// symbols of the packages in these directories are listed. The packages are
+// those loaded for the sync, type-checked by the shared importer.
+func writeXref(moduleName, syncPath string, packages []*packageInfo, scope map[string]bool, imp *packageImporter, registry *artifactRegistry, rep *reporter) error {
+	// Every package is checked once, for its own symbols and for its references
+	symbols := make(map[string]map[string]*xrefSymbol) // by package, then name
+	uses := make(map[string]*types.Info)
+	var defining []string
+	for _, pkg := range packages {
+		if pkg.Dir == "" || len(pkg.GoFiles)+len(pkg.CgoFiles) == 0 {
+			continue
+		}
+		c := imp.check(pkg.ImportPath)
+		if c.err != nil {
+			rep.warn("could not cross-reference %s: %v", pkg.ImportPath, c.err)
+			continue
+		}
+		uses[pkg.ImportPath] = c.info
+
+		if scope != nil && !scope[pkg.Dir] {
+			continue
+		}
+		byName := make(map[string]*xrefSymbol)
+		for _, name := range c.pkg.Scope().Names() {
+			obj := c.pkg.Scope().Lookup(name)
+			if kind := xrefKind(obj); kind != "" && obj.Exported() {
+				byName[name] = &xrefSymbol{kind: kind, name: name, refs: make(map[string]int)}
+			}
+		}
+		symbols[pkg.ImportPath] = byName
+		defining = append(defining, pkg.ImportPath)
+	}
+
+	for referencing, info := range uses {
+		for _, obj := range info.Uses {
+			if obj.Pkg() == nil || obj.Pkg().Path() == referencing || obj.Parent() != obj.Pkg().Scope() {
+				continue
+			}
+			if s, ok := symbols[obj.Pkg().Path()][obj.Name()]; ok {
+				s.refs[referencing]++
+			}
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("Cross-references\n")
+	b.WriteString("================\n\n")
+	b.WriteString("Exported types and functions, with the other packages of the module\n")
+	b.WriteString("referencing them and the number of references.\n")
+
+	sort.Strings(defining)
+	for _, pkg := range defining {
+		byName := symbols[pkg]
+		if len(byName) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n%s\n", relativePackagePath(moduleName, pkg))
+
+		names := make([]string, 0, len(byName))
+		for name := range byName {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			s := byName[name]
+			if len(s.refs) == 0 {
+				fmt.Fprintf(&b, "  %s %s: not referenced from other packages\n", s.kind, s.name)
+				continue
+			}
+			fmt.Fprintf(&b, "  %s %s: referenced from %d packages\n", s.kind, s.name, len(s.refs))
+
+			referencing := make([]string, 0, len(s.refs))
+			for ref := range s.refs {
+				referencing = append(referencing, ref)
+			}
+			sort.Slice(referencing, func(i, j int) bool {
+				a, b := referencing[i], referencing[j]
+				if s.refs[a] != s.refs[b] {
+					return s.refs[a] > s.refs[b]
+				}
+				return a < b
+			})
+			for _, ref := range referencing {
+				fmt.Fprintf(&b, "      %s (%d)\n", relativePackagePath(moduleName, ref), s.refs[ref])
+			}
+		}
+	}
+
+	name := projectFileName(xrefFileName)
+	outputPath := filepath.Join(syncPath, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputPath, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	registry.register(&artifact{Name: name, Kind: kindReport})
+
+	rep.info("Cross-referenced the symbols of %d packages", len(defining))
+
+	return nil
+}